@@ -0,0 +1,227 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// defaultAbortPeriod is the period a condition has to hold for unless given
+const defaultAbortPeriod = 10 * time.Second
+
+// abortCheckPeriod is how often the conditions are checked at most
+const abortCheckPeriod = time.Second
+
+// abortCondition : A metric over the last period of the task that stops the
+// run once it crosses the threshold
+type abortCondition struct {
+	text       string
+	metric     string // error_rate, rps or p followed by the percentile
+	percentile float64
+	above      bool
+	threshold  float64 // a share for the error rate, milliseconds for the percentiles
+	over       time.Duration
+}
+
+// parseAbortCondition reads metric>value or metric<value with an optional
+// "over duration", e.g. "error_rate>10% over 30s" or "p99>2s"
+func parseAbortCondition(value string) (abortCondition, error) {
+	condition := abortCondition{text: value, over: defaultAbortPeriod}
+	expression := strings.TrimSpace(value)
+	if i := strings.Index(expression, " over "); i >= 0 {
+		over, err := time.ParseDuration(strings.TrimSpace(expression[i+len(" over "):]))
+		if err != nil || over <= 0 {
+			return condition, fmt.Errorf("period of %q should be a positive duration", value)
+		}
+		condition.over, expression = over, strings.TrimSpace(expression[:i])
+	}
+	i := strings.IndexAny(expression, "<>")
+	if i < 0 {
+		return condition, fmt.Errorf("condition %q should be metric>value or metric<value", value)
+	}
+	metric, threshold := strings.TrimSpace(expression[:i]), strings.TrimSpace(expression[i+1:])
+	condition.metric, condition.above = metric, expression[i] == '>'
+
+	var err error
+	switch {
+	case metric == "error_rate":
+		if strings.HasSuffix(threshold, "%") {
+			condition.threshold, err = strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+			condition.threshold /= 100
+		} else {
+			condition.threshold, err = strconv.ParseFloat(threshold, 64)
+		}
+	case metric == "rps":
+		condition.threshold, err = strconv.ParseFloat(threshold, 64)
+	case strings.HasPrefix(metric, "p"):
+		condition.percentile, err = strconv.ParseFloat(metric[1:], 64)
+		if err != nil || condition.percentile < 0 || condition.percentile > 100 {
+			return condition, fmt.Errorf("percentile of %q should be between 0 and 100", value)
+		}
+		var limit time.Duration
+		if limit, err = time.ParseDuration(threshold); err == nil {
+			condition.threshold = float64(limit) / float64(time.Millisecond)
+		} else {
+			condition.threshold, err = strconv.ParseFloat(threshold, 64)
+		}
+	default:
+		return condition, fmt.Errorf("unknown metric %q (error_rate, rps, p99 and alike)", metric)
+	}
+	if err != nil {
+		return condition, fmt.Errorf("threshold of %q should be a number, a percent or a duration", value)
+	}
+	return condition, nil
+}
+
+// abortFlag : Repeatable condition to stop the run early at, any of them does
+type abortFlag []abortCondition
+
+func (a *abortFlag) String() string {
+	return strings.Join(a.lines(), ", ")
+}
+
+func (a *abortFlag) lines() []string {
+	lines := make([]string, 0, len(*a))
+	for _, condition := range *a {
+		lines = append(lines, condition.text)
+	}
+	return lines
+}
+
+func (a *abortFlag) Set(value string) error {
+	condition, err := parseAbortCondition(value)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, condition)
+	return nil
+}
+
+// abortSample : What a condition needs of a response
+type abortSample struct {
+	end     time.Time
+	millis  float64
+	success bool
+}
+
+// abortWatch : Keeps the responses of the longest period of the conditions and
+// checks them against the responses as they come
+type abortWatch struct {
+	conditions []abortCondition
+	start      time.Time
+	checked    time.Time
+	longest    time.Duration
+	samples    []abortSample
+}
+
+func newAbortWatch(conditions []abortCondition, start time.Time) *abortWatch {
+	w := &abortWatch{conditions: conditions, start: start, checked: start}
+	for _, condition := range conditions {
+		if condition.over > w.longest {
+			w.longest = condition.over
+		}
+	}
+	return w
+}
+
+// measure is the metric of the condition over the samples of its last period
+func (w *abortWatch) measure(condition *abortCondition, now time.Time) float64 {
+	from := now.Add(-condition.over)
+	first := sort.Search(len(w.samples), func(i int) bool { return w.samples[i].end.After(from) })
+	samples := w.samples[first:]
+	switch condition.metric {
+	case "error_rate":
+		if len(samples) == 0 {
+			return math.NaN()
+		}
+		fails := 0
+		for _, sample := range samples {
+			if !sample.success {
+				fails++
+			}
+		}
+		return float64(fails) / float64(len(samples))
+	case "rps":
+		return float64(len(samples)) / condition.over.Seconds()
+	}
+	latencies := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		if sample.success {
+			latencies = append(latencies, sample.millis)
+		}
+	}
+	sort.Float64s(latencies)
+	return latency.Percentile(latencies, condition.percentile)
+}
+
+// add takes the response in and tells which condition is met, if any, once
+// the task has run for the whole period of the condition
+func (w *abortWatch) add(response *Response) (string, bool) {
+	now := response.End
+	// The responses complete about in order, a late one still counts
+	at := len(w.samples)
+	for at > 0 && w.samples[at-1].end.After(now) {
+		at--
+	}
+	sample := abortSample{end: now, millis: float64(response.Latency) / math.Pow10(6), success: response.Success}
+	w.samples = append(w.samples, abortSample{})
+	copy(w.samples[at+1:], w.samples[at:])
+	w.samples[at] = sample
+
+	if now.Sub(w.checked) < abortCheckPeriod {
+		return "", false
+	}
+	w.checked = now
+	from := now.Add(-w.longest)
+	expired := sort.Search(len(w.samples), func(i int) bool { return w.samples[i].end.After(from) })
+	w.samples = w.samples[expired:]
+
+	for i := range w.conditions {
+		condition := &w.conditions[i]
+		if now.Sub(w.start) < condition.over {
+			continue
+		}
+		value := w.measure(condition, now)
+		if math.IsNaN(value) || (condition.above && value <= condition.threshold) ||
+			(!condition.above && value >= condition.threshold) {
+			continue
+		}
+		return fmt.Sprintf("%s, it was %s", condition.text, condition.format(value)), true
+	}
+	return "", false
+}
+
+func (c *abortCondition) format(value float64) string {
+	switch c.metric {
+	case "error_rate":
+		return fmt.Sprintf("%.1f%%", 100*value)
+	case "rps":
+		return fmt.Sprintf("%.2f req/s", value)
+	}
+	return fmt.Sprintf("%.0f ms", value)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAbortCondition(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      abortCondition
+		wantError bool
+	}{
+		{value: "error_rate>10% over 30s",
+			want: abortCondition{metric: "error_rate", above: true, threshold: 0.1, over: 30 * time.Second}},
+		{value: "error_rate > 0.25",
+			want: abortCondition{metric: "error_rate", above: true, threshold: 0.25, over: defaultAbortPeriod}},
+		{value: "p99>2s over 1m",
+			want: abortCondition{metric: "p99", percentile: 99, above: true, threshold: 2000, over: time.Minute}},
+		{value: "p99.9>750",
+			want: abortCondition{metric: "p99.9", percentile: 99.9, above: true, threshold: 750, over: defaultAbortPeriod}},
+		{value: "rps<100 over 5s",
+			want: abortCondition{metric: "rps", threshold: 100, over: 5 * time.Second}},
+		{value: "error_rate=10%", wantError: true},
+		{value: "errors>10%", wantError: true},
+		{value: "p101>1s", wantError: true},
+		{value: "p99>soon", wantError: true},
+		{value: "rps<100 over ever", wantError: true},
+		{value: "rps<100 over -5s", wantError: true},
+	}
+	for _, test := range tests {
+		got, err := parseAbortCondition(test.value)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("parseAbortCondition(%q) passed, want an error", test.value)
+			}
+			continue
+		}
+		test.want.text = test.value
+		if err != nil || got != test.want {
+			t.Errorf("parseAbortCondition(%q) = %+v, %v, want %+v", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestAbortWatch(t *testing.T) {
+	start := time.Now()
+	errors, err := parseAbortCondition("error_rate>50% over 2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, err := parseAbortCondition("p50>100ms over 2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch := newAbortWatch([]abortCondition{errors, slow}, start)
+	respond := func(at time.Duration, success bool, latency time.Duration) (string, bool) {
+		return watch.add(&Response{Success: success, Latency: latency, End: start.Add(at)})
+	}
+
+	// Failing at first and slow later, each for less than the whole period
+	for at := time.Duration(0); at < 900*time.Millisecond; at += 10 * time.Millisecond {
+		if reason, ok := respond(at, false, 10*time.Millisecond); ok {
+			t.Fatalf("aborted at %s before the period was over: %s", at, reason)
+		}
+	}
+	for at := 900 * time.Millisecond; at < 5*time.Second; at += 10 * time.Millisecond {
+		if reason, ok := respond(at, true, 10*time.Millisecond); ok {
+			t.Fatalf("aborted at %s with the failures in the minority: %s", at, reason)
+		}
+	}
+	for at := 5 * time.Second; at < 5800*time.Millisecond; at += 10 * time.Millisecond {
+		if reason, ok := respond(at, true, 200*time.Millisecond); ok {
+			t.Fatalf("aborted at %s with the slow responses in the minority: %s", at, reason)
+		}
+	}
+	reason, ok := respond(7*time.Second, true, 200*time.Millisecond)
+	if want := "p50>100ms over 2s, it was 200 ms"; !ok || reason != want {
+		t.Errorf("aborted for %q (%v), want %q", reason, ok, want)
+	}
+}
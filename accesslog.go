@@ -0,0 +1,259 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func replayLogCommand(args []string) int {
+	fs, flags := newAttackFlagSet("replay-log")
+	format := fs.String("log-format", logCombined, "format of the access log (combined, json)")
+	speed := fs.Float64("speed", 1, "replay the log this many times as fast as it was recorded, 0 ignores the times")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade replay-log [options...] <access.log> <url>\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() < 2 {
+		fmt.Println("Provide an access log and an endpoint to replay it at!")
+		return 1
+	}
+	if *speed < 0 {
+		fmt.Println("Speed should not be negative")
+		return 1
+	}
+	flags.accessLog, flags.logFormat, flags.speed = fs.Arg(0), *format, *speed
+	return flags.attack(fs.Args()[1:], nil)
+}
+
+// Formats of the access logs
+const (
+	logCombined = "combined"
+	logJSON     = "json"
+)
+
+const combinedTime = "02/Jan/2006:15:04:05 -0700"
+
+// combinedLine matches the combined log format, and the common one which
+// leaves out the referer and the user agent
+var combinedLine = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" \d{3} \S+(?: "([^"]*)" "([^"]*)")?`)
+
+// Keys the fields of the json logs are found under, the first one present wins
+var (
+	jsonTimeKeys   = []string{"time", "timestamp", "@timestamp", "ts"}
+	jsonMethodKeys = []string{"method", "request_method"}
+	jsonPathKeys   = []string{"path", "uri", "request_uri", "url"}
+)
+
+// loggedRequest : A request of the access log with the moment it was made
+type loggedRequest struct {
+	time time.Time
+	ball *Cannonball
+}
+
+// loadAccessLog reads the requests of an access log ordered by their times,
+// each one carrying its offset from the first. The lines that are not requests
+// are skipped and counted
+func loadAccessLog(path string, format string) ([]*Cannonball, int, error) {
+	var parse func(line []byte) (*loggedRequest, error)
+	switch format {
+	case logCombined:
+		parse = parseCombinedLine
+	case logJSON:
+		parse = parseJSONLine
+	default:
+		return nil, 0, fmt.Errorf("unknown log format %q (combined, json)", format)
+	}
+	data, err := readInput(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var requests []*loggedRequest
+	skipped := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		request, err := parse(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(requests) == 0 {
+		return nil, skipped, fmt.Errorf("no %s requests in %s", format, path)
+	}
+
+	// The lines are written as the requests complete, not as they start
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].time.Before(requests[j].time)
+	})
+	corpus := make([]*Cannonball, len(requests))
+	for i, request := range requests {
+		request.ball.At = request.time.Sub(requests[0].time)
+		corpus[i] = request.ball
+	}
+	if format == logCombined {
+		spreadSeconds(corpus)
+	}
+	return corpus, skipped, nil
+}
+
+// spreadSeconds evenly spreads the requests of each second across it, the
+// combined format only keeps whole seconds which would make bursts of them
+func spreadSeconds(corpus []*Cannonball) {
+	for first := 0; first < len(corpus); {
+		last := first
+		for last < len(corpus) && corpus[last].At == corpus[first].At {
+			last++
+		}
+		for i := first; i < last; i++ {
+			corpus[i].At += time.Duration(i-first) * time.Second / time.Duration(last-first)
+		}
+		first = last
+	}
+}
+
+func parseCombinedLine(line []byte) (*loggedRequest, error) {
+	match := combinedLine.FindSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("not a request line")
+	}
+	at, err := time.Parse(combinedTime, string(match[1]))
+	if err != nil {
+		return nil, err
+	}
+	path, err := loggedPath(string(match[3]))
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	if referer := string(match[4]); referer != "" && referer != "-" {
+		header.Set("Referer", referer)
+	}
+	if agent := string(match[5]); agent != "" && agent != "-" {
+		header.Set("User-Agent", agent)
+	}
+	return &loggedRequest{time: at, ball: &Cannonball{Method: string(match[2]), Path: path, Header: header}}, nil
+}
+
+// parseJSONLine reads a line of a structured log, its request is either
+// given field by field or as the request line of the combined format
+func parseJSONLine(line []byte) (*loggedRequest, error) {
+	var entry map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entry); err != nil {
+		return nil, err
+	}
+	lookup := func(keys []string) interface{} {
+		for _, key := range keys {
+			if value, ok := entry[key]; ok {
+				return value
+			}
+		}
+		return nil
+	}
+
+	at, err := loggedTime(lookup(jsonTimeKeys))
+	if err != nil {
+		return nil, err
+	}
+	method, _ := lookup(jsonMethodKeys).(string)
+	target, _ := lookup(jsonPathKeys).(string)
+	if request, ok := entry["request"].(string); ok && (method == "" || target == "") {
+		fields := strings.Fields(request)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid request line %q", request)
+		}
+		method, target = fields[0], fields[1]
+	}
+	if method == "" || target == "" {
+		return nil, fmt.Errorf("no method and path")
+	}
+	path, err := loggedPath(target)
+	if err != nil {
+		return nil, err
+	}
+
+	ball := &Cannonball{Method: strings.ToUpper(method), Path: path, Header: make(http.Header)}
+	if headers, ok := entry["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			if text, ok := value.(string); ok && !skipHARHeader(name) {
+				ball.Header.Set(name, text)
+			}
+		}
+	}
+	if body, ok := entry["body"].(string); ok {
+		ball.Body = []byte(body)
+	}
+	return &loggedRequest{time: at, ball: ball}, nil
+}
+
+// loggedTime reads a timestamp as rfc 3339, the combined format or unix seconds
+func loggedTime(value interface{}) (time.Time, error) {
+	switch value := value.(type) {
+	case json.Number:
+		seconds, err := strconv.ParseFloat(value.String(), 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*1e9)), nil
+	case string:
+		if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return at, nil
+		}
+		return time.Parse(combinedTime, value)
+	default:
+		return time.Time{}, fmt.Errorf("no time")
+	}
+}
+
+// loggedPath keeps the path and the query of the request, the logs of the
+// proxies have whole urls which are aimed at the endpoint of the replay too
+func loggedPath(target string) (string, error) {
+	parsed, err := url.ParseRequestURI(target)
+	if err != nil {
+		return "", err
+	}
+	return parsed.RequestURI(), nil
+}
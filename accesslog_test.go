@@ -0,0 +1,184 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCombinedLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		method string
+		path   string
+		agent  string
+		fails  bool
+	}{
+		{`10.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/4.08"`,
+			"GET", "/apache_pb.gif?a=1", "Mozilla/4.08", false},
+		{`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "POST /predict HTTP/1.1" 500 -`, "POST", "/predict", "", false},
+		{`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET http://backend:8000/v1/models?x=1 HTTP/1.1" 200 12 "-" "-"`,
+			"GET", "/v1/models?x=1", "", false},
+		{`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "-" 400 0 "-" "-"`, "", "", "", true},
+		{`10.0.0.1 - - [yesterday] "GET / HTTP/1.1" 200 0`, "", "", "", true},
+		{`not a log line`, "", "", "", true},
+	}
+	for _, test := range tests {
+		request, err := parseCombinedLine([]byte(test.line))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got no error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+		ball := request.ball
+		if ball.Method != test.method || ball.Path != test.path || ball.Header.Get("User-Agent") != test.agent {
+			t.Errorf("%s: got %s %s as %q", test.line, ball.Method, ball.Path, ball.Header.Get("User-Agent"))
+		}
+		if want := time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC); !request.time.Equal(want) {
+			t.Errorf("%s: got time %v, want %v", test.line, request.time, want)
+		}
+	}
+}
+
+func TestParseJSONLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		method string
+		path   string
+		body   string
+		at     time.Time
+		fails  bool
+	}{
+		{`{"time": "2026-10-01T12:00:00.250Z", "method": "post", "path": "/predict", "body": "{}", "headers": {"X-Tenant": "a"}}`,
+			"POST", "/predict", "{}", time.Date(2026, 10, 1, 12, 0, 0, 250e6, time.UTC), false},
+		{`{"@timestamp": "01/Oct/2026:12:00:00 +0000", "request": "GET /health?deep=1 HTTP/1.1", "status": 200}`,
+			"GET", "/health?deep=1", "", time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), false},
+		{`{"ts": 1790856000.5, "request_method": "GET", "request_uri": "/"}`,
+			"GET", "/", "", time.Unix(1790856000, 5e8), false},
+		{`{"method": "GET", "path": "/"}`, "", "", "", time.Time{}, true},
+		{`{"time": "2026-10-01T12:00:00Z", "status": 200}`, "", "", "", time.Time{}, true},
+		{`{"time": "2026-10-01T12:00:00Z", "request": "-"}`, "", "", "", time.Time{}, true},
+		{`GET / HTTP/1.1`, "", "", "", time.Time{}, true},
+	}
+	for _, test := range tests {
+		request, err := parseJSONLine([]byte(test.line))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got no error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+		ball := request.ball
+		if ball.Method != test.method || ball.Path != test.path || string(ball.Body) != test.body {
+			t.Errorf("%s: got %s %s with %q", test.line, ball.Method, ball.Path, ball.Body)
+		}
+		if !request.time.Equal(test.at) {
+			t.Errorf("%s: got time %v, want %v", test.line, request.time, test.at)
+		}
+	}
+}
+
+func TestLoadAccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The lines come in the order the requests completed
+	combined := filepath.Join(dir, "access.log")
+	lines := []string{
+		`10.0.0.1 - - [01/Oct/2026:12:00:01 +0000] "GET /b HTTP/1.1" 200 1`,
+		`10.0.0.1 - - [01/Oct/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 1`,
+		`10.0.0.1 - - [01/Oct/2026:12:00:01 +0000] "GET /c HTTP/1.1" 200 1`,
+		`connection reset by peer`,
+		``,
+		`10.0.0.1 - - [01/Oct/2026:12:00:03 +0000] "GET /d HTTP/1.1" 200 1`,
+	}
+	if err := ioutil.WriteFile(combined, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	structured := filepath.Join(dir, "access.ndjson")
+	entries := `{"time": "2026-10-01T12:00:00.700Z", "method": "GET", "path": "/b"}
+{"time": "2026-10-01T12:00:00.200Z", "method": "GET", "path": "/a"}
+`
+	if err := ioutil.WriteFile(structured, []byte(entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		format  string
+		paths   string
+		at      []time.Duration
+		skipped int
+		fails   bool
+	}{
+		// The requests of a whole second are spread across it
+		{combined, logCombined, "/a /b /c /d", []time.Duration{0, time.Second, 1500 * time.Millisecond, 3 * time.Second}, 1, false},
+		{structured, logJSON, "/a /b", []time.Duration{0, 500 * time.Millisecond}, 0, false},
+		{structured, logCombined, "", nil, 2, true},
+		{combined, "w3c", "", nil, 0, true},
+		{filepath.Join(dir, "missing.log"), logCombined, "", nil, 0, true},
+	}
+	for _, test := range tests {
+		corpus, skipped, err := loadAccessLog(test.path, test.format)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s as %s: got no error", test.path, test.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s as %s: %s", test.path, test.format, err)
+			continue
+		}
+		var paths []string
+		var at []time.Duration
+		for _, ball := range corpus {
+			paths = append(paths, ball.Path)
+			at = append(at, ball.At)
+		}
+		if strings.Join(paths, " ") != test.paths || skipped != test.skipped {
+			t.Errorf("%s as %s: got %v skipping %d", test.path, test.format, paths, skipped)
+		}
+		for i := range at {
+			if at[i] != test.at[i] {
+				t.Errorf("%s as %s: got offsets %v, want %v", test.path, test.format, at, test.at)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// defaultAdaptivePeriod is how often the rate is adjusted without -interval
+const defaultAdaptivePeriod = time.Second
+
+// Bounds of a single adjustment of the rate, so that one noisy period neither
+// floods the service nor starves it
+const (
+	adaptiveMinFactor = 0.5
+	adaptiveMaxFactor = 1.25
+)
+
+// AdaptiveStep : A period of the adaptive load with the rate it was held at
+type AdaptiveStep struct {
+	Elapsed   float64 `json:"elapsed"`
+	Rate      float64 `json:"rate"`
+	RPS       float64 `json:"rps"`
+	P99       Millis  `json:"p99"`
+	ErrorRate float64 `json:"error_rate"`
+	Held      bool    `json:"held"`
+}
+
+// Adaptive : The rate found to keep the p99 latency at the target, RPS is the
+// highest throughput of a period that stayed within it
+type Adaptive struct {
+	Target    Millis         `json:"target"`
+	ErrorRate float64        `json:"max_error_rate"`
+	RPS       float64        `json:"rps"`
+	Rate      float64        `json:"rate"`
+	Steps     []AdaptiveStep `json:"steps"`
+}
+
+// controller : Adjusts the shared rate limit once a period in proportion to
+// how far the p99 latency of the period is from the target
+type controller struct {
+	result      Adaptive
+	period      time.Duration
+	limiter     *Limiter
+	start       time.Time
+	periodStart time.Time
+	latencies   *latency.Accumulator
+}
+
+func newController(target Millis, maxErrorRate float64, period time.Duration, limiter *Limiter, start time.Time) *controller {
+	return &controller{
+		result:      Adaptive{Target: target, ErrorRate: maxErrorRate, Steps: make([]AdaptiveStep, 0)},
+		period:      period,
+		limiter:     limiter,
+		start:       start,
+		periodStart: start,
+		latencies:   latency.New(),
+	}
+}
+
+// add counts the response towards the period it ended in, closing the
+// periods that are over first
+func (c *controller) add(response *Response) {
+	for !response.End.Before(c.periodStart.Add(c.period)) {
+		c.adjust(c.periodStart.Add(c.period))
+	}
+	c.latencies.Add(float64(response.Latency)/math.Pow10(6), response.Success)
+}
+
+// nextRate moves the rate towards the target, backing off as far as allowed
+// when the errors are over the limit, and never further than the clients
+// could follow
+func nextRate(rate float64, rps float64, p99 float64, target float64, errorRate float64, maxErrorRate float64) float64 {
+	factor := adaptiveMinFactor
+	if errorRate <= maxErrorRate && !math.IsNaN(p99) && p99 > 0 {
+		factor = math.Max(adaptiveMinFactor, math.Min(adaptiveMaxFactor, target/p99))
+	}
+	next := rate * factor
+	if factor > 1 && rps > 0 && next > 2*rps {
+		next = math.Max(rate, 2*rps)
+	}
+	return next
+}
+
+func (c *controller) adjust(now time.Time) {
+	stats := c.latencies.Stats(99)
+	c.latencies = latency.New()
+	c.periodStart = now
+	if stats.Count == 0 {
+		return
+	}
+
+	rate := c.limiter.Rate()
+	step := AdaptiveStep{
+		Elapsed:   now.Sub(c.start).Seconds(),
+		Rate:      rate,
+		RPS:       float64(stats.Count) / c.period.Seconds(),
+		P99:       Millis(stats.Percentiles[0]),
+		ErrorRate: float64(stats.Fails) / float64(stats.Count),
+	}
+	step.Held = step.ErrorRate <= c.result.ErrorRate && float64(step.P99) <= float64(c.result.Target)
+	c.result.Steps = append(c.result.Steps, step)
+	c.limiter.SetRate(nextRate(rate, step.RPS, float64(step.P99), float64(c.result.Target), step.ErrorRate,
+		c.result.ErrorRate))
+}
+
+func (c *controller) summarize() *Adaptive {
+	result := c.result
+	result.Rate = c.limiter.Rate()
+	for _, step := range result.Steps {
+		if step.Held && step.RPS > result.RPS {
+			result.RPS = step.RPS
+		}
+	}
+	return &result
+}
+
+func describeAdaptive(a *Adaptive) string {
+	held := 0
+	for _, step := range a.Steps {
+		if step.Held {
+			held++
+		}
+	}
+	if held == 0 {
+		return fmt.Sprintf("p99 never got under %.0f ms, the rate went down to %.2f req/s", a.Target, a.Rate)
+	}
+	return fmt.Sprintf("p99 under %.0f ms at %.2f req/s in %d of %d periods, the rate ended at %.2f req/s",
+		a.Target, a.RPS, held, len(a.Steps), a.Rate)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNextRate(t *testing.T) {
+	tests := []struct {
+		rate, rps, p99, errorRate float64
+		want                      float64
+	}{
+		{100, 100, 300, 0, 100},               // right at the target
+		{100, 100, 150, 0, 125},               // well under it, capped step up
+		{100, 100, 280, 0, 100.0 * 300 / 280}, // slightly under it
+		{100, 100, 400, 0, 75},                // over it
+		{100, 100, 3000, 0, 50},               // far over it, capped step down
+		{100, 100, 100, 0.5, 50},              // failing fast
+		{100, 100, math.NaN(), 0, 50},         // nothing succeeded
+		{100, 40, 100, 0, 100},                // the clients cannot keep up
+		{100, 90, 100, 0, 125},                // they still can
+	}
+	for _, test := range tests {
+		got := nextRate(test.rate, test.rps, test.p99, 300, test.errorRate, 0.01)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("nextRate(%v, %v, %v, 300, %v) = %v, want %v", test.rate, test.rps, test.p99, test.errorRate,
+				got, test.want)
+		}
+	}
+}
+
+func TestController(t *testing.T) {
+	start := time.Now()
+	limiter := newLimiter(100)
+	c := newController(300, 0.01, time.Second, limiter, start)
+	respond := func(at time.Duration, latency time.Duration) {
+		c.add(&Response{Success: true, Latency: latency, End: start.Add(at)})
+	}
+
+	// A fast second, a gap without responses and a slow second
+	for i := 0; i < 10; i++ {
+		respond(time.Duration(i)*100*time.Millisecond, 150*time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		respond(3*time.Second+time.Duration(i)*100*time.Millisecond, 600*time.Millisecond)
+	}
+	respond(4*time.Second, 100*time.Millisecond)
+
+	result := c.summarize()
+	if len(result.Steps) != 2 {
+		t.Fatalf("controller made %d steps, want 2: %+v", len(result.Steps), result.Steps)
+	}
+	if first := result.Steps[0]; !first.Held || first.Rate != 100 || first.RPS != 10 || first.Elapsed != 1 {
+		t.Errorf("first step %+v, want held at 100", first)
+	}
+	// The clients only kept up with 10 req/s, so the rate was not raised past 100
+	if second := result.Steps[1]; second.Held || second.Rate != 100 || second.Elapsed != 4 {
+		t.Errorf("second step %+v, want over the target at 100", second)
+	}
+	if result.Rate != 50 || result.RPS != 10 {
+		t.Errorf("controller ended at %v req/s holding %v, want 50 and 10", result.Rate, result.RPS)
+	}
+}
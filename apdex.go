@@ -0,0 +1,94 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Apdex : Application performance index of a task, the satisfied requests
+// count in full and the tolerating ones in half, the failures frustrate
+type Apdex struct {
+	Threshold  Millis  `json:"threshold"`
+	Score      float64 `json:"score"`
+	Satisfied  int     `json:"satisfied"`
+	Tolerating int     `json:"tolerating"`
+	Frustrated int     `json:"frustrated"`
+}
+
+// apdex : Sorts the requests of a task into the apdex buckets, a request is
+// satisfied up to the threshold and tolerating up to four times of it
+type apdex struct {
+	threshold  float64
+	satisfied  int
+	tolerating int
+	frustrated int
+}
+
+func newApdex(threshold time.Duration) *apdex {
+	return &apdex{threshold: float64(threshold) / float64(time.Millisecond)}
+}
+
+func (a *apdex) add(millis float64, success bool) {
+	switch {
+	case success && millis <= a.threshold:
+		a.satisfied++
+	case success && millis <= 4*a.threshold:
+		a.tolerating++
+	default:
+		a.frustrated++
+	}
+}
+
+func (a *apdex) summarize() *Apdex {
+	total := a.satisfied + a.tolerating + a.frustrated
+	if total == 0 {
+		return nil
+	}
+	return &Apdex{
+		Threshold:  Millis(a.threshold),
+		Score:      (float64(a.satisfied) + float64(a.tolerating)/2) / float64(total),
+		Satisfied:  a.satisfied,
+		Tolerating: a.tolerating,
+		Frustrated: a.frustrated,
+	}
+}
+
+// apdexRating is the usual name of the band the score falls into
+func apdexRating(score float64) string {
+	switch {
+	case score >= 0.94:
+		return "excellent"
+	case score >= 0.85:
+		return "good"
+	case score >= 0.7:
+		return "fair"
+	case score >= 0.5:
+		return "poor"
+	}
+	return "unacceptable"
+}
+
+func describeApdex(a *Apdex) string {
+	return fmt.Sprintf("%.2f (%s) at %g ms, %d satisfied, %d tolerating, %d frustrated",
+		a.Score, apdexRating(a.Score), a.Threshold, a.Satisfied, a.Tolerating, a.Frustrated)
+}
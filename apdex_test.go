@@ -0,0 +1,78 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestApdex(t *testing.T) {
+	tests := []struct {
+		latencies []float64
+		fails     int
+		want      *Apdex
+	}{
+		{nil, 0, nil},
+		{[]float64{100, 300, 301, 1200, 1201}, 0, &Apdex{Threshold: 300, Score: 0.6, Satisfied: 2, Tolerating: 2, Frustrated: 1}},
+		{[]float64{10}, 1, &Apdex{Threshold: 300, Score: 0.5, Satisfied: 1, Frustrated: 1}},
+		{nil, 2, &Apdex{Threshold: 300, Score: 0, Frustrated: 2}},
+	}
+	for i, test := range tests {
+		a := newApdex(300 * time.Millisecond)
+		for _, millis := range test.latencies {
+			a.add(millis, true)
+		}
+		// A failure frustrates however fast it came back
+		for f := 0; f < test.fails; f++ {
+			a.add(1, false)
+		}
+		got := a.summarize()
+		if (got == nil) != (test.want == nil) {
+			t.Errorf("#%d: got %+v, want %+v", i, got, test.want)
+			continue
+		}
+		if got != nil && (math.Abs(got.Score-test.want.Score) > 1e-9 || got.Threshold != test.want.Threshold ||
+			got.Satisfied != test.want.Satisfied || got.Tolerating != test.want.Tolerating || got.Frustrated != test.want.Frustrated) {
+			t.Errorf("#%d: got %+v, want %+v", i, got, test.want)
+		}
+	}
+}
+
+func TestApdexRating(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{1, "excellent"},
+		{0.94, "excellent"},
+		{0.9, "good"},
+		{0.7, "fair"},
+		{0.6, "poor"},
+		{0.2, "unacceptable"},
+	}
+	for _, test := range tests {
+		if got := apdexRating(test.score); got != test.want {
+			t.Errorf("apdexRating(%g) = %q, want %q", test.score, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,1364 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// attackFlags : Command line options of the commands that shoot at an endpoint
+type attackFlags struct {
+	fs            *flag.FlagSet
+	imagePath     *string
+	schedule      *string
+	numRequests   *int
+	numClients    *int
+	noisy         *bool
+	timeout       *float64
+	overall       *time.Duration
+	connect       *time.Duration
+	tlsTimeout    *time.Duration
+	headerTimeout *time.Duration
+	waitReady     *string
+	cooldown      *time.Duration
+	cooldownRate  *float64
+	readyTimeout  *time.Duration
+	protocol      *string
+	maxRPS        *float64
+	think         *time.Duration
+	thinkJitter   *time.Duration
+	interval      *time.Duration
+	timeSeries    *string
+	history       *string
+	pprof         *string
+	heatmap       *time.Duration
+	breaker       *string
+	apdex         *time.Duration
+	apikey        *string
+	auth          *string
+	sign          *string
+	proxy         *string
+	proxyAuth     *string
+	compress      *string
+	verbose       *bool
+	sample        *int
+	maxBodyPrint  *int
+	metrics       *bool
+	metricsFile   *string
+	sink          *string
+	sinkInterval  *time.Duration
+	rotateSize    *string
+	rotateAge     *time.Duration
+	k8sService    *string
+	shardHosts    *string
+	k8sAPI        *string
+	fanOut        *string
+	perTarget     *bool
+	perWorker     *bool
+	backendHeader *string
+	trace         *bool
+	otlpEndpoint  *string
+	requestID     *string
+	statsd        *string
+	statsdTags    *string
+	interactive   *bool
+	progress      *bool
+	ci            *bool
+	silent        *bool
+	format        *string
+	templatePath  *string
+	reportPath    *string
+	resultsPath   *string
+	corpusPath    *string
+	generator     *string
+	generatorCmd  *string
+	scenario      *string
+	mix           *string
+	script        *string
+	extract       *string
+	poll          *string
+	pollInterval  *time.Duration
+	pollUntil     *string
+	pollTimeout   *time.Duration
+	harPath       *string
+	curl          *string
+	decoders      *int
+	producers     *int
+	precompute    *int
+	validateJSON  *bool
+	fuzz          *float64
+	honor429      *bool
+	golden        *string
+	goldenSubset  *bool
+	goldenIgnore  *string
+	slowest       *int
+	noDelay       *bool
+	reusePort     *bool
+	unixSocket    *string
+	resolve       resolveFlag
+	ipVersion     *int
+	dnsRefresh    *time.Duration
+	host          *string
+	outputDir     *string
+	saveFailures  *string
+	resize        *string
+	crop          *string
+	grayscale     *bool
+	quality       *int
+	encodeFormat  *string
+	synthetic     *string
+	data          *string
+	dataOrder     *string
+	body          *string
+	header        headerFlag
+	cookies       *bool
+	sticky        headerFlag
+	maxResponse   *int64
+	chunked       *int
+	chunkInterval *time.Duration
+	uploadRate    *string
+	readRate      *string
+	findMax       *string
+	maxP99        *time.Duration
+	targetP99     *time.Duration
+	pattern       *string
+	arrival       *string
+	seed          *int64
+	abortIf       abortFlag
+	percentiles   *string
+	exact         *bool
+	withFailures  *bool
+	maxErrorRate  *float64
+	explain       *bool
+	dryRun        *bool
+	probe         bool      // fire a single request, set by the probe command
+	accessLog     string    // replay the requests of the log, set by the replay-log command
+	logFormat     string    // of the access log
+	speed         float64   // of the replay of the log, zero ignores the times of its requests
+	name          string    // of the task, set by the parallel command
+	output        io.Writer // of the report unless it goes to a file, stdout by default
+}
+
+func newAttackFlags(fs *flag.FlagSet) *attackFlags {
+	f := &attackFlags{
+		fs:            fs,
+		imagePath:     fs.String("image", defaultImage, "path of the image to shoot with"),
+		synthetic:     fs.String("synthetic", "", "generate a random image instead of reading one (WxH or WxH:solid, gradient, perlin)"),
+		schedule:      fs.String("schedule", defaultSchedule, "requests load schedule (5@1,10@2:noise=0.5:scale=0.5:batch=4)"),
+		findMax:       fs.String("find-max", "", "raise the load step by step to find the highest sustainable one (clients, rps)"),
+		maxP99:        fs.Duration("max-p99", 0, "99th percentile latency a sustainable load stays under"),
+		targetP99:     fs.Duration("target-p99", 0, "adjust the rate on the fly to hold the 99th percentile latency at this"),
+		pattern:       fs.String("pattern", "", "shape the rate over time (spike:base=10,peak=500,every=60s,for=5s, sawtooth, sine, step)"),
+		arrival:       fs.String("arrival", arrivalUniform, "spacing of the requests under a rate, a fixed tick or exponential gaps (uniform, poisson)"),
+		seed:          fs.Int64("seed", 0, "seed every source of randomness to reproduce the payloads of a run, the clock seeds them otherwise"),
+		maxErrorRate:  fs.Float64("max-error-rate", 0.01, "share of failed requests a sustainable load stays under"),
+		numRequests:   fs.Int("num-requests", defaultNumRequests, "total number of requests"),
+		numClients:    fs.Int("num-clients", defaultNumClients, "number of parallel requests"),
+		noisy:         fs.Bool("noisy", false, "add random noise to each request"),
+		timeout:       fs.Float64("timeout", defaultTimeout, "request timeout limit in seconds, same as -overall-timeout"),
+		overall:       fs.Duration("overall-timeout", 0, "limit of a whole request from the dial to the last byte of the body"),
+		connect:       fs.Duration("connect-timeout", 0, "limit of establishing a connection (default 30s)"),
+		tlsTimeout:    fs.Duration("tls-timeout", 0, "limit of the tls handshake (default 10s)"),
+		headerTimeout: fs.Duration("response-header-timeout", 0, "limit of the wait for the response headers once the request is sent"),
+		cooldown:      fs.Duration("cooldown", 0, "keep probing at a low rate after the load for this long to see the target recover"),
+		cooldownRate:  fs.Float64("cooldown-rate", defaultCooldownRate, "requests per second of the cooldown probes"),
+		waitReady:     fs.String("wait-ready", "", "health path to poll until it answers 2xx before starting the schedule (/health)"),
+		readyTimeout:  fs.Duration("ready-timeout", defaultReadyTimeout, "time after which a target still not ready fails the run"),
+		protocol:      fs.String("protocol", protocolHTTP, "send the payloads as http requests or as websocket messages (http, ws)"),
+		maxRPS:        fs.Float64("max-rps", 0, "cap on requests per second across all clients"),
+		breaker:       fs.String("circuit-breaker", "", "pause a client after failures in a row or at an error rate of its last requests (5:10s, 50%/20:10s)"),
+		think:         fs.Duration("think", 0, "pause of each client between requests"),
+		thinkJitter:   fs.Duration("think-jitter", 0, "random deviation of the pause between requests"),
+		interval:      fs.Duration("interval", 0, "period of the interim stats reports"),
+		heatmap:       fs.Duration("heatmap", 0, "add a heatmap of the latencies over time to the json report, in intervals of this long"),
+		apdex:         fs.Duration("apdex-threshold", 0, "report the apdex score of the requests satisfied within this latency (300ms)"),
+		timeSeries:    fs.String("timeseries", "", "path of the csv file to save the rps and p95 of every interval to"),
+		pprof:         fs.String("pprof", "", "address to serve the profiles of cannonade itself on (:6060)"),
+		history:       fs.String("history", "", "directory to append the summary of the run to, see the trend command"),
+		apikey:        fs.String("apikey", "", "api key to use as a query parameter"),
+		auth:          fs.String("auth", "", "credentials of every request (basic:user:pass, bearer:TOKEN, header:Name:VALUE)"),
+		sign:          fs.String("sign", "", "sign every request body into a header (hmac-sha256:SECRET:X-Signature[:X-Timestamp])"),
+		verbose:       fs.Bool("verbose", false, "print every response to stdout"),
+		sample:        fs.Int("sample-responses", 0, "print only one in N successful responses at random in the verbose mode"),
+		maxBodyPrint:  fs.Int("max-body-print", 0, "cut the successful responses printed in the verbose mode to N bytes"),
+		metrics:       fs.Bool("metrics", false, "save latencies to metrics.log file, same as -metrics-sink file"),
+		metricsFile:   fs.String("metrics-file", "", "save latencies to this file instead of metrics.log"),
+		rotateSize:    fs.String("metrics-max-size", "", "move the metrics file aside as file.1, file.2 and so on once it grows past this (100MB)"),
+		rotateAge:     fs.Duration("metrics-max-age", 0, "move the metrics file aside once it is open for this long"),
+		sink:          fs.String("metrics-sink", "", "push the latencies to file[:path], graphite:host:port or cloudwatch:namespace"),
+		sinkInterval:  fs.Duration("metrics-interval", defaultMetricsInterval, "period of the pushes to graphite and cloudwatch"),
+		shardHosts:    fs.String("shard-hosts", "", "comma-separated hostname aliases of the backend to spread the requests across"),
+		k8sService:    fs.String("k8s-service", "", "shoot at the pods behind a kubernetes service (ns/name:port)"),
+		k8sAPI:        fs.String("k8s-api", "", "kubernetes api address, in-cluster or kubectl proxy by default"),
+		fanOut:        fs.String("fan-out", "", "shoot at every address the host resolves to, with all the clients at each or spread across them (each, spread)"),
+		perTarget:     fs.Bool("per-target", false, "report stats for every target separately"),
+		perWorker:     fs.Bool("per-worker", false, "report stats for every client separately"),
+		backendHeader: fs.String("backend-header", "", "response header identifying the backend, e.g. X-Served-By"),
+		trace:         fs.Bool("trace", false, "inject a w3c traceparent header into every request"),
+		otlpEndpoint:  fs.String("otlp-endpoint", "", "export request spans to an otlp/http collector"),
+		requestID:     fs.String("request-id-header", "", "stamp every request with a uuid in this header, kept in the results and the failures (X-Request-Id)"),
+		statsd:        fs.String("statsd", "", "push live metrics to a statsd agent (host:8125)"),
+		statsdTags:    fs.String("statsd-tags", "", "dogstatsd tags to attach to the metrics (env:staging,team:ml)"),
+		interactive:   fs.Bool("interactive", false, "read rate, clients and stop commands from stdin"),
+		progress:      fs.Bool("progress", false, "show progressbar"),
+		ci:            fs.Bool("ci", false, "print plain key=value lines for the ci logs instead of the progressbar"),
+		explain:       fs.Bool("explain", false, "print the plan of the run and exit without sending any request"),
+		dryRun:        fs.Bool("dry-run", false, "print the first request as it would be sent and exit without sending it"),
+		silent:        fs.Bool("silent", false, "disable any output but errors"),
+		format:        fs.String("format", "text", "report format (text, markdown, json)"),
+		templatePath:  fs.String("template", "", "path of a text/template to render the report with"),
+		reportPath:    fs.String("report", "", "path of the file to write the report to"),
+		resultsPath:   fs.String("results", "", "path of the file to stream every response to (ndjson)"),
+		corpusPath:    fs.String("corpus", "", "directory of recorded requests to shoot with instead of the image"),
+		generator:     fs.String("generator", "", "go plugin generating the requests instead of the image (./gen.so)"),
+		generatorCmd:  fs.String("generator-cmd", "", "command generating the requests as ndjson over stdio instead of the image (./gen.py)"),
+		scenario:      fs.String("scenario", "", "json file of the requests every client makes one after another"),
+		mix:           fs.String("mix", "", "json file of the named requests to shuffle together by their weights"),
+		script:        fs.String("script", "", "lua script of the before_request and after_response hooks of every request"),
+		extract:       fs.String("extract", "", "capture values from the json responses into the results (id=$.prediction_id,...)"),
+		poll:          fs.String("poll", "", "json path of the job url to poll after each request ($.result_url)"),
+		pollInterval:  fs.Duration("poll-interval", defaultPollInterval, "pause between the polls of a job"),
+		pollUntil:     fs.String("poll-until", "", "value a poll response holds once the job is done ($.status=done)"),
+		pollTimeout:   fs.Duration("poll-timeout", defaultPollTimeout, "time after which a job still not done fails"),
+		harPath:       fs.String("har", "", "har file with the requests to shoot with instead of the image"),
+		curl:          fs.String("curl", "", "curl command or a file of them to shoot with instead of the image"),
+		producers:     fs.Int("producers", runtime.NumCPU(), "number of goroutines encoding the noisy payloads"),
+		precompute:    fs.Int("precompute", 0, "rotate a pool of this many noisy payloads instead of encoding one per request"),
+		decoders:      fs.Int("decoders", runtime.NumCPU(), "number of goroutines decoding and validating the responses"),
+		compress:      fs.String("compress", "", "compress the request bodies and accept compressed responses (gzip, zstd)"),
+		maxResponse:   fs.Int64("max-response-bytes", 0, "cut the responses larger than this and count them as oversized failures"),
+		chunked:       fs.Int("chunked", 0, "stream the bodies with chunked transfer encoding in chunks of this many bytes"),
+		chunkInterval: fs.Duration("chunk-interval", 0, "pause before every chunk of a streamed body after the first"),
+		uploadRate:    fs.String("upload-bandwidth", "", "throttle the sending of every request body like a slow client (256kbps)"),
+		readRate:      fs.String("read-bandwidth", "", "throttle the reading of every response body like a slow client (1mbps)"),
+		percentiles:   fs.String("percentiles", defaultPercentiles, "comma-separated latency percentiles to report"),
+		exact:         fs.Bool("exact-percentiles", false, "keep every latency for exact percentiles instead of a histogram past a million requests"),
+		withFailures:  fs.Bool("include-failures", false, "count the latencies of the failed requests towards the stats"),
+		validateJSON:  fs.Bool("validate-json", false, "count responses with invalid json bodies as failures"),
+		fuzz:          fs.Float64("fuzz", 0, "share of the requests to send with a mutated json body, expecting a 4xx for them"),
+		honor429:      fs.Bool("honor-429", false, "back a client off as long as a 429 asks and try again, reporting the throughput the rate limiter allowed"),
+		golden:        fs.String("golden", "", "file with the expected response, captured from a reference call if missing"),
+		goldenSubset:  fs.Bool("golden-subset", false, "only check the fields of the golden json, allowing any others"),
+		goldenIgnore:  fs.String("golden-ignore", "", "comma-separated json paths of the volatile fields to ignore ($.id,$.time)"),
+		noDelay:       fs.Bool("tcp-nodelay", true, "disable nagle's algorithm on the connections"),
+		proxy:         fs.String("proxy", "", "send the requests through an http or socks5 proxy (http://host:3128, socks5://host:1080)"),
+		proxyAuth:     fs.String("proxy-auth", "", "credentials of the proxy (user:pass)"),
+		reusePort:     fs.Bool("reuseport", false, "set SO_REUSEPORT on the connections where supported"),
+		host:          fs.String("host", "", "host header to send instead of the one of the url, also the tls server name"),
+		ipVersion:     fs.Int("ip-version", 0, "connect over ipv4 or ipv6 only (4, 6)"),
+		dnsRefresh:    fs.Duration("dns-refresh", 0, "resolve the targets again this often and reconnect once their addresses change"),
+		resolve:       make(resolveFlag),
+		unixSocket:    fs.String("unix", "", "connect to a unix domain socket instead of the host of the url (/var/run/api.sock)"),
+		slowest:       fs.Int("slowest", 0, "capture full details of the slowest requests of each task"),
+		outputDir:     fs.String("output-dir", defaultOutputDir, "directory to save the captured requests to"),
+		saveFailures:  fs.String("save-failures", "", "directory to save every failed request with its response to"),
+		resize:        fs.String("resize", "", "resize the image before encoding, either side can be left out (640x480, 640x)"),
+		crop:          fs.String("crop", "", "crop the image before resizing (WxH+X+Y, or WxH for the center)"),
+		grayscale:     fs.Bool("grayscale", false, "convert the image to grayscale before encoding"),
+		quality:       fs.Int("quality", defaultQuality, "jpeg quality of the encoded image (1-100)"),
+		encodeFormat:  fs.String("encode-format", formatJPEG, "format of the encoded image (jpeg, png)"),
+		data:          fs.String("data", "", "csv or jsonl file of the values for the {{name}} placeholders"),
+		dataOrder:     fs.String("data-order", dataCycle, "order of the data rows handed out to the requests (cycle, random)"),
+		body:          fs.String("body", "", "body template to send instead of the image, @file reads it from a file"),
+		header:        make(headerFlag),
+		cookies:       fs.Bool("cookies", false, "keep a cookie jar per client carrying the cookies the target sets"),
+		sticky:        make(headerFlag),
+	}
+	fs.Var(f.header, "header", "extra request header template (Name: value), can be repeated")
+	fs.Var(f.sticky, "sticky-header", "header template expanded once per client and sent with all its requests (X-Session-Id: {{uuid}}), can be repeated")
+	fs.Var(&f.abortIf, "abort-if", "stop the run early once a metric crosses a value over a period (error_rate>10% over 30s), can be repeated")
+	fs.Var(f.resolve, "resolve", "connect to the address instead of the one of the host (host:port:addr), can be repeated")
+	return f
+}
+
+func newAttackFlagSet(name string) (*flag.FlagSet, *attackFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cannonade %s [options...] <url>\n\nOptions:\n", name)
+		fs.PrintDefaults()
+	}
+	return fs, newAttackFlags(fs)
+}
+
+// isSet tells whether the option was given explicitly rather than left at its default
+func (f *attackFlags) isSet(name string) bool {
+	set := false
+	f.fs.Visit(func(flag *flag.Flag) {
+		set = set || flag.Name == name
+	})
+	return set
+}
+
+func attackCommand(args []string) int {
+	fs, flags := newAttackFlagSet("attack")
+	panicIf(fs.Parse(args))
+	return flags.attack(fs.Args(), nil)
+}
+
+func openReport(format string, templatePath string, reportPath string, silent bool, output io.Writer) (Renderer, io.Closer, error) {
+	var closer io.Closer = ioutil.NopCloser(nil)
+	if reportPath != "" {
+		f, err := os.Create(reportPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		output, closer = f, f
+	} else if silent {
+		output = ioutil.Discard
+	}
+
+	renderer, err := newRenderer(format, templatePath, output)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	return renderer, closer, nil
+}
+
+// numProducers is a single producer under a seed unless given, so that the
+// payloads come in the same order on every run
+func (f *attackFlags) numProducers() int {
+	if f.isSet("seed") && !f.isSet("producers") {
+		return 1
+	}
+	return *f.producers
+}
+
+// recordedArgs is the attack command line equivalent to the parsed one, it
+// leaves out the options of other commands so that any run can be replayed
+func (f *attackFlags) recordedArgs(args []string) []string {
+	known, _ := newAttackFlagSet("attack")
+	argv := make([]string, 0)
+	f.fs.Visit(func(fl *flag.Flag) {
+		if known.Lookup(fl.Name) == nil {
+			return
+		}
+		if repeated, ok := fl.Value.(interface{ lines() []string }); ok {
+			for _, line := range repeated.lines() {
+				argv = append(argv, fmt.Sprintf("-%s=%s", fl.Name, line))
+			}
+			return
+		}
+		argv = append(argv, fmt.Sprintf("-%s=%s", fl.Name, fl.Value.String()))
+	})
+	return append(argv, args...)
+}
+
+// attack runs the whole schedule, the hook gets the run control before the first task
+func (f *attackFlags) attack(args []string, hook func(ctl *Control)) int {
+	if len(args) == 0 && *f.harPath == "" && *f.curl == "" {
+		fmt.Println("Provide an endpoint to shoot at!")
+		return 1
+	}
+	sources := 0
+	for _, source := range []string{*f.corpusPath, *f.harPath, *f.curl, f.accessLog} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Println("Cannot use corpus, har, curl and access log sources together")
+		return 1
+	}
+	if sources > 0 && *f.synthetic != "" {
+		fmt.Println("Cannot use a synthetic image with recorded requests")
+		return 1
+	}
+	if sources > 0 && *f.scenario != "" {
+		fmt.Println("Cannot use a scenario with recorded requests")
+		return 1
+	}
+	if *f.generator != "" && *f.generatorCmd != "" {
+		fmt.Println("Cannot use a generator plugin and a generator command together")
+		return 1
+	}
+	if (*f.generator != "" || *f.generatorCmd != "") && (sources > 0 || *f.synthetic != "" || *f.scenario != "") {
+		fmt.Println("Cannot use a generator with recorded requests, a synthetic image or a scenario")
+		return 1
+	}
+
+	// Check options compatibility
+	if *f.progress && *f.verbose {
+		fmt.Println("Cannot use progress and verbose flags together")
+		return 1
+	}
+	if (*f.metrics || *f.metricsFile != "") && *f.sink != "" {
+		fmt.Println("Cannot use metrics and metrics-sink flags together")
+		return 1
+	}
+	metricsSpec := *f.sink
+	if *f.metricsFile != "" {
+		metricsSpec = "file:" + *f.metricsFile
+	} else if *f.metrics {
+		metricsSpec = "file"
+	}
+	sinkOptions := SinkOptions{Interval: *f.sinkInterval, MaxAge: *f.rotateAge}
+	if *f.rotateSize != "" {
+		var err error
+		sinkOptions.MaxSize, err = parseByteSize(*f.rotateSize)
+		if err != nil {
+			fmt.Printf("Failed parsing the metrics max size: %s\n", err)
+			return 1
+		}
+	}
+	if (sinkOptions.MaxSize > 0 || sinkOptions.MaxAge > 0) && metricsSpec != "file" && !strings.HasPrefix(metricsSpec, "file:") {
+		fmt.Println("Cannot rotate the metrics without saving them to a file")
+		return 1
+	}
+	if (*f.sample > 0 || *f.maxBodyPrint > 0) && !*f.verbose {
+		fmt.Println("Cannot sample or cut the printed responses without the verbose flag")
+		return 1
+	}
+	stdinImage := *f.imagePath == stdinPath
+	stdinBody := *f.body == stdinPath || *f.body == "@"+stdinPath
+	if stdinImage && stdinBody {
+		fmt.Println("Cannot read both the image and the body from stdin")
+		return 1
+	}
+	if (stdinImage || stdinBody) && *f.interactive {
+		fmt.Println("Cannot read both the payload and the commands from stdin")
+		return 1
+	}
+	switch *f.protocol {
+	case protocolHTTP:
+	case protocolWS:
+		if *f.compress != "" {
+			fmt.Println("Cannot compress the websocket messages")
+			return 1
+		}
+		if *f.sign != "" {
+			fmt.Println("Cannot sign the websocket messages")
+			return 1
+		}
+	default:
+		fmt.Printf("Unknown protocol %q (http, ws)\n", *f.protocol)
+		return 1
+	}
+	random := newRandomness(time.Now().UnixNano())
+	if f.isSet("seed") {
+		random = newRandomness(*f.seed)
+	}
+	timeout := *f.timeout
+	if f.isSet("overall-timeout") {
+		if f.isSet("timeout") {
+			fmt.Println("Cannot set both the timeout and the overall timeout, they are the same")
+			return 1
+		}
+		timeout = f.overall.Seconds()
+	}
+	if *f.unixSocket != "" {
+		switch {
+		case *f.proxy != "":
+			fmt.Println("Cannot send the requests through a proxy to a unix socket")
+			return 1
+		case *f.reusePort:
+			fmt.Println("Cannot reuse the ports of a unix socket")
+			return 1
+		case *f.k8sService != "" || *f.shardHosts != "" || *f.fanOut != "":
+			fmt.Println("Cannot spread the requests across the targets of a unix socket")
+			return 1
+		case len(f.resolve) > 0 || *f.ipVersion != 0 || *f.dnsRefresh > 0:
+			fmt.Println("Cannot resolve the address of a unix socket")
+			return 1
+		}
+	}
+	if (*f.dnsRefresh > 0 || *f.fanOut != "") && *f.proxy != "" {
+		fmt.Println("Cannot resolve the targets behind a proxy, the proxy resolves them")
+		return 1
+	}
+	switch {
+	case *f.fanOut == "":
+	case *f.fanOut != fanOutEach && *f.fanOut != fanOutSpread:
+		fmt.Printf("Unknown fan-out mode %q (each, spread)\n", *f.fanOut)
+		return 1
+	case *f.k8sService != "" || *f.shardHosts != "":
+		fmt.Println("Cannot fan out to the addresses of the pods or the host aliases, they are spread already")
+		return 1
+	case len(f.resolve) > 0 || *f.dnsRefresh > 0:
+		fmt.Println("Cannot fan out to the addresses of the host while pinning or refreshing them")
+		return 1
+	case *f.findMax == "clients":
+		fmt.Println("Cannot search the clients while fanning them out to the addresses")
+		return 1
+	}
+	if *f.ipVersion != 0 && *f.ipVersion != 4 && *f.ipVersion != 6 {
+		fmt.Printf("Unknown ip version %d (4, 6)\n", *f.ipVersion)
+		return 1
+	}
+
+	// Pick the credentials of the requests
+	var auth Authenticator
+	switch {
+	case *f.apikey != "" && *f.auth != "":
+		fmt.Println("Cannot use apikey and auth flags together")
+		return 1
+	case *f.apikey != "":
+		auth = &apikeyAuth{key: *f.apikey}
+	case *f.auth != "":
+		var err error
+		auth, err = parseAuth(*f.auth)
+		if err != nil {
+			fmt.Printf("Failed parsing the auth: %s\n", err)
+			return 1
+		}
+	}
+
+	var proxy *url.URL
+	if *f.proxy != "" {
+		var err error
+		proxy, err = parseProxy(*f.proxy, *f.proxyAuth)
+		if err != nil {
+			fmt.Printf("Failed parsing the proxy: %s\n", err)
+			return 1
+		}
+	} else if *f.proxyAuth != "" {
+		fmt.Println("Provide a proxy to authenticate with!")
+		return 1
+	}
+	var sign *signer
+	if *f.sign != "" {
+		var err error
+		sign, err = parseSign(*f.sign)
+		if err != nil {
+			fmt.Printf("Failed parsing the signing: %s\n", err)
+			return 1
+		}
+	}
+	if *f.cooldownRate <= 0 {
+		fmt.Println("Cooldown rate should be positive")
+		return 1
+	}
+	if f.isSet("cooldown-rate") && *f.cooldown <= 0 {
+		fmt.Println("Provide a cooldown duration to probe for!")
+		return 1
+	}
+	if f.isSet("ready-timeout") && *f.waitReady == "" {
+		fmt.Println("Provide a health path to wait for!")
+		return 1
+	}
+	if *f.fuzz < 0 || *f.fuzz > 1 {
+		fmt.Println("Fuzz share should be between 0 and 1")
+		return 1
+	}
+	if *f.fuzz > 0 && (*f.compress != "" || *f.protocol == protocolWS) {
+		fmt.Println("Cannot fuzz compressed bodies or websocket messages")
+		return 1
+	}
+	if *f.chunked < 0 {
+		fmt.Println("Chunk size should be positive")
+		return 1
+	}
+	if *f.chunkInterval != 0 && *f.chunked == 0 {
+		fmt.Println("Provide a chunk size to pace the chunks of!")
+		return 1
+	}
+	if *f.chunked > 0 && *f.protocol == protocolWS {
+		fmt.Println("Cannot stream websocket messages in chunks")
+		return 1
+	}
+	var uploadBandwidth, readBandwidth float64
+	if *f.uploadRate != "" {
+		var err error
+		uploadBandwidth, err = parseBandwidth(*f.uploadRate)
+		if err != nil {
+			fmt.Printf("Failed parsing the upload bandwidth: %s\n", err)
+			return 1
+		}
+	}
+	if *f.readRate != "" {
+		var err error
+		readBandwidth, err = parseBandwidth(*f.readRate)
+		if err != nil {
+			fmt.Printf("Failed parsing the read bandwidth: %s\n", err)
+			return 1
+		}
+	}
+	if (uploadBandwidth > 0 || readBandwidth > 0) && *f.protocol == protocolWS {
+		fmt.Println("Cannot throttle websocket messages")
+		return 1
+	}
+	if *f.honor429 && *f.protocol == protocolWS {
+		fmt.Println("Cannot honor the rate limits of websocket messages")
+		return 1
+	}
+	var breaker *CircuitBreaker
+	if *f.breaker != "" {
+		var err error
+		breaker, err = parseCircuitBreaker(*f.breaker)
+		if err != nil {
+			fmt.Printf("Failed parsing the circuit breaker: %s\n", err)
+			return 1
+		}
+	}
+	if *f.requestID != "" {
+		if strings.ContainsAny(*f.requestID, " :\t\r\n") {
+			fmt.Printf("Invalid request id header %q\n", *f.requestID)
+			return 1
+		}
+		if *f.protocol == protocolWS {
+			fmt.Println("Cannot stamp websocket messages with request ids")
+			return 1
+		}
+	}
+	if (*f.goldenSubset || *f.goldenIgnore != "") && *f.golden == "" {
+		fmt.Println("Provide a golden response to compare with!")
+		return 1
+	}
+
+	// Profile the load generator from the very start, preparing the payloads included
+	if *f.pprof != "" {
+		listener, err := startPprof(*f.pprof)
+		if err != nil {
+			fmt.Printf("Failed starting the profiler: %s\n", err)
+			return 1
+		}
+		defer listener.Close()
+		if !*f.silent {
+			fmt.Fprintf(os.Stderr, "Profiles are served on http://%s/debug/pprof/\n", listener.Addr())
+		}
+	}
+
+	// Open an image, a corpus of requests or a generator of them to shoot with
+	var img image.Image
+	var corpus []*Cannonball
+	var generator payloadGenerator
+	var err error
+	var endpoint string
+	if len(args) > 0 {
+		endpoint = args[0]
+	}
+	switch {
+	case *f.corpusPath != "":
+		corpus, err = loadCorpus(*f.corpusPath)
+		if err != nil {
+			fmt.Printf("Failed reading the corpus: %s\n", err)
+			return 1
+		}
+	case *f.harPath != "":
+		var origin string
+		corpus, origin, err = loadHAR(*f.harPath, endpoint != "")
+		if err != nil {
+			fmt.Printf("Failed reading the har: %s\n", err)
+			return 1
+		}
+		if endpoint == "" {
+			endpoint = origin
+		}
+	case *f.curl != "":
+		var origin string
+		corpus, origin, err = loadCurl(*f.curl, endpoint != "")
+		if err != nil {
+			fmt.Printf("Failed reading the curl commands: %s\n", err)
+			return 1
+		}
+		if endpoint == "" {
+			endpoint = origin
+		}
+	case f.accessLog != "":
+		var skipped int
+		corpus, skipped, err = loadAccessLog(f.accessLog, f.logFormat)
+		if err != nil {
+			fmt.Printf("Failed reading the access log: %s\n", err)
+			return 1
+		}
+		if skipped > 0 && !*f.silent {
+			fmt.Fprintf(os.Stderr, "Skipped %d lines of the access log which are not %s requests\n", skipped, f.logFormat)
+		}
+	case *f.generator != "":
+		generator, err = openPluginGenerator(*f.generator)
+		if err != nil {
+			fmt.Printf("Failed loading the generator: %s\n", err)
+			return 1
+		}
+	case *f.generatorCmd != "":
+		generator, err = startCommandGenerator(*f.generatorCmd)
+		if err != nil {
+			fmt.Printf("Failed starting the generator: %s\n", err)
+			return 1
+		}
+		defer generator.Close()
+	case *f.synthetic != "":
+		width, height, kind, err := parseSynthetic(*f.synthetic)
+		if err != nil {
+			fmt.Printf("Failed parsing the synthetic image: %s\n", err)
+			return 1
+		}
+		img = syntheticImage(kind, width, height, random.stream(streamImage))
+	case *f.body != "" && !f.isSet("image"):
+		// The body template takes the place of the image, a dot is enough to carry on
+		img = syntheticImage("solid", 1, 1, random.stream(streamImage))
+	default:
+		img, err = readImage(*f.imagePath)
+		if err != nil {
+			fmt.Printf("Failed reading the image: %s\n", err)
+			return 1
+		}
+	}
+
+	var captures []extraction
+	if *f.extract != "" {
+		captures, err = parseExtracts(*f.extract)
+		if err != nil {
+			fmt.Printf("Failed parsing the captures: %s\n", err)
+			return 1
+		}
+	}
+	var poller *Poller
+	if *f.poll != "" {
+		poller = &Poller{Interval: *f.pollInterval, Timeout: *f.pollTimeout}
+		poller.URL, err = parseJSONPath(*f.poll)
+		if err == nil && *f.pollUntil != "" {
+			poller.Until, err = parsePollCondition(*f.pollUntil)
+		}
+		if err != nil {
+			fmt.Printf("Failed parsing the polling: %s\n", err)
+			return 1
+		}
+		if *f.scenario != "" || *f.protocol == protocolWS {
+			fmt.Println("Cannot poll the jobs of a scenario or over websockets")
+			return 1
+		}
+	} else if *f.pollUntil != "" {
+		fmt.Println("Provide a job url to poll!")
+		return 1
+	}
+	var feed *dataFeed
+	if *f.data != "" {
+		if *f.dataOrder != dataCycle && *f.dataOrder != dataRandom {
+			fmt.Printf("Unknown data order %q (cycle, random)\n", *f.dataOrder)
+			return 1
+		}
+		feed, err = loadData(*f.data, *f.dataOrder == dataRandom)
+		if err != nil {
+			fmt.Printf("Failed reading the data: %s\n", err)
+			return 1
+		}
+	}
+	var scenario *Scenario
+	if *f.scenario != "" {
+		scenario, err = loadScenario(*f.scenario, feed.columnNames(), captures)
+		if err != nil {
+			fmt.Printf("Failed reading the scenario: %s\n", err)
+			return 1
+		}
+	}
+
+	var mix *Mix
+	if *f.mix != "" {
+		if sources > 0 || generator != nil || scenario != nil {
+			fmt.Println("Cannot use a mix with recorded or generated requests or a scenario")
+			return 1
+		}
+		mix, err = loadMix(*f.mix, feed.columnNames())
+		if err != nil {
+			fmt.Printf("Failed reading the mix: %s\n", err)
+			return 1
+		}
+	}
+
+	var hooks *script
+	if *f.script != "" {
+		hooks, err = loadScript(*f.script)
+		if err != nil {
+			fmt.Printf("Failed loading the script: %s\n", err)
+			return 1
+		}
+	}
+
+	// Expand the placeholders of the endpoint, the body and the headers per request
+	base, path, err := splitEndpoint(endpoint)
+	if err != nil {
+		fmt.Printf("Failed parsing the endpoint: %s\n", err)
+		return 1
+	}
+	var template *requestTemplate
+	if path != "" || *f.body != "" || len(f.header) > 0 {
+		template = &requestTemplate{Path: path, Body: *f.body, Header: http.Header(f.header)}
+		if *f.body == stdinPath || strings.HasPrefix(*f.body, "@") {
+			body, err := readInput(strings.TrimPrefix(*f.body, "@"))
+			if err != nil {
+				fmt.Printf("Failed reading the body: %s\n", err)
+				return 1
+			}
+			template.Body = string(body)
+		}
+		known := make(map[string]bool)
+		for _, column := range feed.columnNames() {
+			known[column] = true
+		}
+		if err := template.check(known); err != nil {
+			fmt.Printf("Failed preparing the templates: %s\n", err)
+			return 1
+		}
+		if scenario != nil {
+			fmt.Println("Cannot use templates with a scenario, set them on its steps")
+			return 1
+		}
+		if mix != nil {
+			fmt.Println("Cannot use templates with a mix, set them on its requests")
+			return 1
+		}
+		if template.Body != "" && sources > 0 {
+			fmt.Println("Cannot use a body template with recorded requests")
+			return 1
+		}
+	}
+
+	// Every client keeps its cookies and its sticky headers for all its requests
+	var identity *identityTemplate
+	if *f.cookies || len(f.sticky) > 0 {
+		identity = &identityTemplate{Cookies: *f.cookies, Header: http.Header(f.sticky)}
+		known := make(map[string]bool)
+		for _, column := range feed.columnNames() {
+			known[column] = true
+		}
+		if err := identity.check(known); err != nil {
+			fmt.Printf("Failed preparing the sticky headers: %s\n", err)
+			return 1
+		}
+	}
+	if feed != nil && template == nil && scenario == nil && mix == nil && len(f.sticky) == 0 && !*f.silent {
+		fmt.Println("Data has no effect without placeholders")
+	}
+
+	// Transform the image once so that every request carries the same preprocessing
+	if *f.quality < 1 || *f.quality > 100 {
+		fmt.Println("Quality should be between 1 and 100")
+		return 1
+	}
+	switch *f.encodeFormat {
+	case formatJPEG:
+	case formatPNG:
+		if *f.quality != defaultQuality {
+			fmt.Println("Cannot set the quality of a png, it is lossless")
+			return 1
+		}
+	case "webp":
+		fmt.Println("Cannot encode webp, there is no encoder for it")
+		return 1
+	default:
+		fmt.Printf("Unknown encode format %q (jpeg, png)\n", *f.encodeFormat)
+		return 1
+	}
+	transform := Transform{Grayscale: *f.grayscale}
+	if *f.crop != "" {
+		area, centered, err := parseCrop(*f.crop)
+		if err != nil {
+			fmt.Printf("Failed parsing the crop: %s\n", err)
+			return 1
+		}
+		transform.Crop, transform.Centered = &area, centered
+	}
+	if *f.resize != "" {
+		transform.Width, transform.Height, err = parseSize(*f.resize)
+		if err != nil {
+			fmt.Printf("Failed parsing the size: %s\n", err)
+			return 1
+		}
+	}
+	source := transform.String()
+	if *f.synthetic != "" {
+		source = strings.TrimSpace("synthetic=" + *f.synthetic + " " + source)
+	}
+	if *f.quality != defaultQuality {
+		source = strings.TrimSpace(fmt.Sprintf("%s quality=%d", source, *f.quality))
+	}
+	if *f.encodeFormat != formatJPEG {
+		source = strings.TrimSpace(source + " format=" + *f.encodeFormat)
+	}
+	if img != nil {
+		img, err = transform.Apply(img)
+		if err != nil {
+			fmt.Printf("Failed transforming the image: %s\n", err)
+			return 1
+		}
+	} else if source != "" && !*f.silent {
+		fmt.Println("Image transforms have no effect on recorded or generated requests")
+	}
+
+	// Resolve the targets to shoot at
+	targets := []Target{{Name: endpoint, URL: base}}
+	if *f.k8sService != "" {
+		targets, err = resolveService(*f.k8sAPI, *f.k8sService, base)
+		if err != nil {
+			fmt.Printf("Failed resolving the service: %s\n", err)
+			return 1
+		}
+	}
+	host := *f.host
+	if *f.fanOut != "" {
+		var hostname string
+		targets, hostname, err = fanOutTargets(base, *f.ipVersion, net.DefaultResolver.LookupIPAddr)
+		if err != nil {
+			fmt.Printf("Failed resolving the addresses of the target: %s\n", err)
+			return 1
+		}
+		if host == "" {
+			host = hostname
+		}
+	}
+	if *f.shardHosts != "" {
+		targets, err = shardTargets(targets, strings.Split(*f.shardHosts, ","))
+		if err != nil {
+			fmt.Printf("Failed sharding the targets: %s\n", err)
+			return 1
+		}
+	}
+
+	// Recorded requests are fired exactly once each unless asked otherwise
+	schedule := *f.schedule
+	numRequests := *f.numRequests
+	if corpus != nil && !f.isSet("num-requests") {
+		numRequests = len(corpus)
+	}
+	if schedule == "" {
+		schedule = fmt.Sprintf("%d@%d", numRequests, *f.numClients)
+	}
+	noise := 0.0
+	if *f.noisy {
+		noise = 1
+	}
+	milestones, err := parseSchedule(schedule, noise)
+	if err != nil {
+		fmt.Printf("Failed parsing the schedule: %s\n", err)
+		return 1
+	}
+	milestones = fanOutSchedule(milestones, *f.fanOut, len(targets))
+	for _, milestone := range milestones {
+		if *f.fanOut != "" && milestone.NumClients < len(targets) {
+			fmt.Printf("Cannot spread %d clients across %d addresses\n", milestone.NumClients, len(targets))
+			return 1
+		}
+	}
+
+	percentiles, err := parsePercentiles(*f.percentiles, *f.withFailures)
+	if err != nil {
+		fmt.Printf("Failed parsing the percentiles: %s\n", err)
+		return 1
+	}
+	percentiles.exact = *f.exact
+
+	// The search starts from the given clients or rate and doubles from there
+	var search *sweep
+	switch *f.findMax {
+	case "":
+	case "clients", "rps":
+		if len(milestones) > 1 {
+			fmt.Println("Cannot search for the max load along a multi-step schedule")
+			return 1
+		}
+		start := float64(*f.numClients)
+		if *f.findMax == "rps" {
+			start = *f.maxRPS
+			if start <= 0 {
+				start = defaultFindMaxRate
+			}
+		}
+		if *f.maxP99 > 0 && !percentiles.has(99) {
+			fmt.Println("Cannot limit the p99 latency without 99 among the percentiles")
+			return 1
+		}
+		limits := Limits{P99: Millis(float64(*f.maxP99) / float64(time.Millisecond)), ErrorRate: *f.maxErrorRate}
+		search = newSweep(*f.findMax, start, limits)
+	default:
+		fmt.Printf("Unknown find-max mode %q (clients, rps)\n", *f.findMax)
+		return 1
+	}
+
+	if *f.targetP99 > 0 && search != nil {
+		fmt.Println("Cannot hold a target latency while searching for the max load")
+		return 1
+	}
+
+	var shape *pattern
+	if *f.pattern != "" {
+		shape, err = parsePattern(*f.pattern)
+		if err != nil {
+			fmt.Printf("Failed parsing the pattern: %s\n", err)
+			return 1
+		}
+		switch {
+		case search != nil || *f.targetP99 > 0:
+			fmt.Println("Cannot shape the rate while searching for the max load or holding a target latency")
+			return 1
+		case f.isSet("max-rps"):
+			fmt.Println("Cannot cap the rate of a pattern, it sets the rate itself")
+			return 1
+		case len(milestones) > 1:
+			fmt.Println("Cannot shape the rate along a multi-step schedule")
+			return 1
+		}
+	}
+
+	switch *f.arrival {
+	case arrivalUniform:
+	case arrivalPoisson:
+		if *f.maxRPS <= 0 && *f.targetP99 <= 0 && shape == nil && *f.findMax != "rps" {
+			fmt.Println("Provide a rate to spread the arrivals around!")
+			return 1
+		}
+	default:
+		fmt.Printf("Unknown arrival %q (uniform, poisson)\n", *f.arrival)
+		return 1
+	}
+
+	if *f.explain {
+		explainPlan(os.Stdout, f, endpoint, targets, corpus, generator, img, source, scenario, mix, feed, auth, sign, proxy,
+			milestones, search, shape)
+		return 0
+	}
+
+	// Prepare the report renderer
+	output := f.output
+	if output == nil {
+		output = os.Stdout
+	}
+	renderer, closer, err := openReport(*f.format, *f.templatePath, *f.reportPath, *f.silent, output)
+	if err != nil {
+		fmt.Printf("Failed preparing the report: %s\n", err)
+		return 1
+	}
+	defer closer.Close()
+
+	task := Task{
+		Endpoint:    endpoint,
+		Targets:     targets,
+		Image:       img,
+		Corpus:      corpus,
+		Encoding:    Encoding{Format: *f.encodeFormat, Quality: *f.quality},
+		Source:      source,
+		Generator:   generator,
+		Speed:       f.speed,
+		NumClients:  *f.numClients,
+		NumRequests: *f.numRequests,
+		FanOut:      *f.fanOut != "",
+	}
+	sockets := SocketOptions{NoDelay: *f.noDelay, ReusePort: *f.reusePort, Unix: *f.unixSocket,
+		Resolve: f.resolve, IPVersion: *f.ipVersion, ConnectTimeout: *f.connect}
+	opt := Options{
+		Name:             f.name,
+		Silent:           *f.silent,
+		Verbose:          *f.verbose,
+		SampleResponses:  *f.sample,
+		MaxBodyPrint:     *f.maxBodyPrint,
+		Progress:         *f.progress,
+		CI:               *f.ci,
+		Timeout:          timeout,
+		Protocol:         *f.protocol,
+		MaxRPS:           *f.maxRPS,
+		TargetP99:        Millis(float64(*f.targetP99) / float64(time.Millisecond)),
+		Pattern:          shape,
+		MaxErrorRate:     *f.maxErrorRate,
+		Abort:            f.abortIf,
+		Breaker:          breaker,
+		Random:           random,
+		Think:            *f.think,
+		ThinkJitter:      *f.thinkJitter,
+		Interval:         *f.interval,
+		PrintWindows:     *f.interval > 0,
+		Heatmap:          *f.heatmap,
+		Apdex:            *f.apdex,
+		PerTarget:        *f.perTarget || ((*f.k8sService != "" || *f.fanOut != "") && !f.isSet("per-target")),
+		PerWorker:        *f.perWorker,
+		BackendHeader:    *f.backendHeader,
+		Host:             host,
+		Trace:            *f.trace || *f.otlpEndpoint != "",
+		RequestIDHeader:  *f.requestID,
+		Auth:             auth,
+		Sign:             sign,
+		Scenario:         scenario,
+		Mix:              mix,
+		Identity:         identity,
+		HonorRateLimit:   *f.honor429,
+		Template:         template,
+		Script:           hooks,
+		Data:             feed,
+		Extract:          captures,
+		Poll:             poller,
+		Overall:          newAccumulator(*f.exact),
+		Percentiles:      percentiles,
+		Transport:        newTransport(sockets),
+		Decoders:         *f.decoders,
+		Producers:        f.numProducers(),
+		Precompute:       *f.precompute,
+		MaxResponseBytes: *f.maxResponse,
+		UploadBandwidth:  uploadBandwidth,
+		ReadBandwidth:    readBandwidth,
+		ValidateJSON:     *f.validateJSON,
+		Slowest:          *f.slowest,
+		OutputDir:        *f.outputDir,
+	}
+	if *f.fuzz > 0 {
+		opt.Fuzz = &fuzzer{fraction: *f.fuzz}
+	}
+	if *f.chunked > 0 {
+		opt.Chunked = &chunking{size: *f.chunked, interval: *f.chunkInterval}
+	}
+	if opt.TargetP99 > 0 && opt.MaxRPS <= 0 {
+		// The controller needs a rate to adjust, it starts low and works its way up
+		opt.MaxRPS = defaultFindMaxRate
+	}
+	if *f.tlsTimeout > 0 {
+		opt.Transport.TLSHandshakeTimeout = *f.tlsTimeout
+	}
+	opt.Transport.ResponseHeaderTimeout = *f.headerTimeout
+	if proxy != nil {
+		opt.Transport.Proxy = http.ProxyURL(proxy)
+	}
+	if host != "" {
+		// The certificate is checked against the host presented rather than the address dialed
+		hostname := host
+		if h, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = h
+		}
+		opt.Transport.TLSClientConfig = &tls.Config{ServerName: hostname}
+	}
+	if *f.compress != "" {
+		opt.Compress, err = newCodec(*f.compress, *f.maxResponse)
+		if err != nil {
+			fmt.Printf("Failed preparing the compression: %s\n", err)
+			return 1
+		}
+		for i, ball := range task.Corpus {
+			task.Corpus[i] = opt.Compress.compress(ball)
+		}
+	}
+	if *f.dryRun || f.probe {
+		milestone := milestones[0]
+		task.Noise, task.Scale, task.Batch = milestone.Noise, milestone.Scale, milestone.Batch
+		if f.probe {
+			return probe(os.Stdout, &task, &opt)
+		}
+		if err := dryRun(os.Stdout, &task, &opt); err != nil {
+			fmt.Printf("Failed preparing the request: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+	if *f.waitReady != "" {
+		var log io.Writer = os.Stderr
+		if opt.Silent {
+			log = nil
+		}
+		if err := waitReady(log, task.Targets, *f.waitReady, *f.readyTimeout, readyInterval, &opt); err != nil {
+			fmt.Printf("Failed waiting for the targets: %s\n", err)
+			return 1
+		}
+	}
+	if *f.dnsRefresh > 0 {
+		var log io.Writer = os.Stderr
+		if opt.Silent {
+			log = nil
+		}
+		opt.DNS = startDNSRefresh(task.Targets, sockets, *f.dnsRefresh, opt.Transport, log)
+		defer opt.DNS.Close()
+	}
+	if *f.golden != "" {
+		ignore, err := parseIgnored(*f.goldenIgnore)
+		if err != nil {
+			fmt.Printf("Failed parsing the golden fields to ignore: %s\n", err)
+			return 1
+		}
+		milestone := milestones[0]
+		task.Noise, task.Scale, task.Batch = milestone.Noise, milestone.Scale, milestone.Batch
+		capture := func() ([]byte, error) {
+			response := fireOnce(task.Targets[0].URL, firstCannonball(&task, &opt), &opt)
+			if !response.Success {
+				return nil, fmt.Errorf("the reference call failed: %s", response.Body)
+			}
+			return []byte(response.Body), nil
+		}
+		var captured bool
+		opt.Golden, captured, err = loadGolden(*f.golden, *f.goldenSubset, ignore, capture)
+		if err != nil {
+			fmt.Printf("Failed loading the golden response: %s\n", err)
+			return 1
+		}
+		if captured && !opt.Silent {
+			fmt.Fprintf(os.Stderr, "Saved the response of a reference call to %s\n", *f.golden)
+		}
+	}
+	if *f.otlpEndpoint != "" {
+		opt.Exporter = newSpanExporter(*f.otlpEndpoint)
+		defer opt.Exporter.Close()
+	}
+	if metricsSpec != "" {
+		opt.Metrics, err = openMetricSink(metricsSpec, f.name, sinkOptions)
+		if err != nil {
+			fmt.Printf("Failed opening the metrics sink: %s\n", err)
+			return 1
+		}
+		defer func() {
+			if err := opt.Metrics.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed closing the metrics sink: %s\n", err)
+			}
+		}()
+	}
+	if *f.statsd != "" {
+		opt.Statsd, err = newStatsdClient(*f.statsd, *f.statsdTags)
+		if err != nil {
+			fmt.Printf("Failed connecting to statsd: %s\n", err)
+			return 1
+		}
+		defer opt.Statsd.Close()
+	}
+	if *f.resultsPath != "" {
+		opt.Results, err = createResults(*f.resultsPath, f.recordedArgs(args), endpoint)
+		if err != nil {
+			fmt.Printf("Failed creating the results: %s\n", err)
+			return 1
+		}
+		defer opt.Results.Close()
+	}
+	if *f.saveFailures != "" {
+		opt.Failures, err = createFailureLog(*f.saveFailures, opt.Protocol)
+		if err != nil {
+			fmt.Printf("Failed creating the failures directory: %s\n", err)
+			return 1
+		}
+	}
+	var series *timeSeries
+	if *f.timeSeries != "" {
+		series, err = createTimeSeries(*f.timeSeries)
+		if err != nil {
+			fmt.Printf("Failed creating the time series: %s\n", err)
+			return 1
+		}
+		if opt.Interval <= 0 {
+			opt.Interval = defaultSeriesInterval
+		}
+	}
+
+	if !opt.Silent {
+		peak := 0
+		for _, milestone := range milestones {
+			if milestone.NumClients > peak {
+				peak = milestone.NumClients
+			}
+		}
+		warnSocketLimits(newConsole(&opt, 0), peak)
+	}
+
+	ctl := newControl(opt.MaxRPS)
+	if *f.arrival == arrivalPoisson {
+		ctl.limiter.SpreadPoisson(random.stream(streamArrivals))
+	}
+	if *f.interactive {
+		go ctl.listen(os.Stdin, os.Stdout)
+	}
+	if hook != nil {
+		hook(ctl)
+	}
+
+	report := Report{Endpoint: endpoint}
+	cooldown := func() {
+		if *f.cooldown <= 0 || ctl.IsStopped() {
+			return
+		}
+		if !opt.Silent {
+			fmt.Fprintf(os.Stderr, "Cooling down for %v at %g req/s\n", *f.cooldown, *f.cooldownRate)
+		}
+		report.Cooldown = runCooldown(&task, &opt, *f.cooldown, *f.cooldownRate, ctl.Stopped())
+	}
+	save := func() {
+		if series != nil {
+			if err := series.write(report.Tasks); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed saving the time series: %s\n", err)
+			}
+		}
+		if *f.history != "" && len(report.Tasks) > 0 {
+			entry := newHistoryEntry(&report, f.recordedArgs(args), time.Now())
+			if err := appendHistory(*f.history, entry); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed saving the history: %s\n", err)
+			}
+		}
+	}
+	if search != nil {
+		// Every step repeats the first milestone at a higher load
+		milestone := milestones[0]
+		task.NumRequests, task.Noise, task.Scale, task.Batch = milestone.NumRequests, milestone.Noise, milestone.Scale, milestone.Batch
+		for i := 0; !ctl.IsStopped(); i++ {
+			level, ok := search.next()
+			if !ok {
+				break
+			}
+			if *f.findMax == "clients" {
+				task.NumClients = int(level)
+			} else {
+				ctl.limiter.SetRate(level)
+			}
+
+			summary := runTask(i, &task, &opt, ctl)
+			search.record(&summary)
+			report.Tasks = append(report.Tasks, summary)
+			panicIf(renderer.Task(&summary))
+		}
+		report.FindMax = &search.result
+		cooldown()
+		report.Aborted = ctl.Aborted()
+		save()
+		panicIf(renderer.Finish(&report))
+		if report.Aborted != "" {
+			return 1
+		}
+		return 0
+	}
+	ctl.plan(milestones)
+	for i, milestone := range milestones {
+		if ctl.IsStopped() {
+			break
+		}
+
+		task.NumRequests = milestone.NumRequests
+		task.NumClients = milestone.NumClients
+		task.Noise = milestone.Noise
+		task.Scale = milestone.Scale
+		task.Batch = milestone.Batch
+
+		summary := runTask(i, &task, &opt, ctl)
+		report.Tasks = append(report.Tasks, summary)
+		panicIf(renderer.Task(&summary))
+	}
+	if len(report.Tasks) > 1 {
+		report.Overall = combinePhases(opt.Overall, report.Tasks, opt.Percentiles)
+	}
+	cooldown()
+	report.Aborted = ctl.Aborted()
+	save()
+	panicIf(renderer.Finish(&report))
+
+	if report.Aborted != "" {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Authenticator : Credentials attached to every outgoing request
+type Authenticator interface {
+	// Apply adds the credentials to the request
+	Apply(req *http.Request)
+	// String describes the scheme without revealing the secret
+	String() string
+}
+
+// parseAuth reads an auth spec: basic:user:pass, bearer:TOKEN or header:Name:VALUE
+func parseAuth(spec string) (Authenticator, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("bad auth %q, expected scheme:credentials", spec)
+	}
+	switch scheme, credentials := parts[0], parts[1]; scheme {
+	case "basic":
+		pair := strings.SplitN(credentials, ":", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf("bad basic auth, expected basic:user:pass")
+		}
+		return &basicAuth{user: pair[0], password: pair[1]}, nil
+	case "bearer":
+		return &bearerAuth{token: credentials}, nil
+	case "header":
+		pair := strings.SplitN(credentials, ":", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("bad header auth, expected header:Name:VALUE")
+		}
+		return &headerAuth{name: http.CanonicalHeaderKey(pair[0]), value: pair[1]}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth scheme %q (basic, bearer, header)", scheme)
+	}
+}
+
+// apikeyAuth : The api key passed as the apikey query parameter
+type apikeyAuth struct {
+	key string
+}
+
+func (a *apikeyAuth) Apply(req *http.Request) {
+	query := req.URL.Query()
+	query.Set("apikey", a.key)
+	req.URL.RawQuery = query.Encode()
+}
+
+func (a *apikeyAuth) String() string {
+	return "api key in the apikey query parameter"
+}
+
+// basicAuth : HTTP basic authentication
+type basicAuth struct {
+	user     string
+	password string
+}
+
+func (a *basicAuth) Apply(req *http.Request) {
+	req.SetBasicAuth(a.user, a.password)
+}
+
+func (a *basicAuth) String() string {
+	return fmt.Sprintf("basic auth as %s", a.user)
+}
+
+// bearerAuth : A bearer token in the Authorization header
+type bearerAuth struct {
+	token string
+}
+
+func (a *bearerAuth) Apply(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+}
+
+func (a *bearerAuth) String() string {
+	return "bearer token"
+}
+
+// headerAuth : A secret in a custom header like X-Api-Key
+type headerAuth struct {
+	name  string
+	value string
+}
+
+func (a *headerAuth) Apply(req *http.Request) {
+	req.Header.Set(a.name, a.value)
+}
+
+func (a *headerAuth) String() string {
+	return fmt.Sprintf("%s header", a.name)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseAuth(t *testing.T) {
+	tests := []struct {
+		spec   string
+		header string
+		value  string
+		query  string
+		ok     bool
+	}{
+		{"basic:user:pa:ss", "Authorization", "Basic dXNlcjpwYTpzcw==", "", true},
+		{"bearer:token", "Authorization", "Bearer token", "", true},
+		{"header:x-api-key:s3cr3t", "X-Api-Key", "s3cr3t", "", true},
+		{"header:X-Token:a:b", "X-Token", "a:b", "", true},
+		{"basic:user", "", "", "", false},
+		{"basic::pass", "", "", "", false},
+		{"bearer:", "", "", "", false},
+		{"header:X-Api-Key", "", "", "", false},
+		{"digest:user:pass", "", "", "", false},
+		{"token", "", "", "", false},
+	}
+	for _, test := range tests {
+		auth, err := parseAuth(test.spec)
+		if (err == nil) != test.ok {
+			t.Errorf("parseAuth(%q): unexpected error %v", test.spec, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		req, _ := http.NewRequest("POST", "http://localhost/predict?a=1", nil)
+		auth.Apply(req)
+		if got := req.Header.Get(test.header); got != test.value {
+			t.Errorf("parseAuth(%q): %s = %q, want %q", test.spec, test.header, got, test.value)
+		}
+		if req.URL.RawQuery != "a=1" {
+			t.Errorf("parseAuth(%q): query changed to %q", test.spec, req.URL.RawQuery)
+		}
+	}
+}
+
+func TestApikeyAuth(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost/predict?a=1", nil)
+	(&apikeyAuth{key: "k&y"}).Apply(req)
+	if req.URL.RawQuery != "a=1&apikey=k%26y" {
+		t.Errorf("got query %q", req.URL.RawQuery)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throttleSteps is how many bursts a second of a throttled transfer is cut into
+const throttleSteps = 20
+
+// The units of a bandwidth in bits per second, the longest suffixes go first
+var bandwidthUnits = []struct {
+	suffix string
+	bits   float64
+}{
+	{"gbps", 1e9},
+	{"mbps", 1e6},
+	{"kbps", 1e3},
+	{"bps", 1},
+}
+
+// parseBandwidth reads a rate in bits per second like 256kbps or 1.5Mbps into
+// bytes per second
+func parseBandwidth(spec string) (float64, error) {
+	value := strings.ToLower(strings.TrimSpace(spec))
+	for _, unit := range bandwidthUnits {
+		if !strings.HasSuffix(value, unit.suffix) {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+		if err != nil || rate <= 0 {
+			return 0, fmt.Errorf("bandwidth %q should be a positive number", spec)
+		}
+		return rate * unit.bits / 8, nil
+	}
+	return 0, fmt.Errorf("bandwidth %q should end with one of bps, kbps, mbps or gbps", spec)
+}
+
+// throttledReader : A reader moving no faster than a rate in bytes per second
+// counted from its first read, a slow client pushing a body or taking one in
+type throttledReader struct {
+	io.Reader
+	ctx   context.Context
+	rate  float64
+	start time.Time
+	read  int64
+}
+
+func throttle(ctx context.Context, r io.Reader, rate float64) *throttledReader {
+	return &throttledReader{Reader: r, ctx: ctx, rate: rate}
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	chunk := int(t.rate / throttleSteps)
+	if chunk < 1 {
+		chunk = 1
+	}
+	if len(b) > chunk {
+		b = b[:chunk]
+	}
+	n, err := t.Reader.Read(b)
+	t.read += int64(n)
+
+	// Hold the bytes back until the rate catches up with them, a cancelled
+	// request gives up right away
+	due := t.start.Add(time.Duration(float64(t.read) / t.rate * float64(time.Second)))
+	if wait := time.Until(due); n > 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			timer.Stop()
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
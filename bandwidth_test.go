@@ -0,0 +1,134 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		spec string
+		rate float64
+		fail bool
+	}{
+		{spec: "256kbps", rate: 32000},
+		{spec: "1.5Mbps", rate: 187500},
+		{spec: "1gbps", rate: 125e6},
+		{spec: "800bps", rate: 100},
+		{spec: " 64KBPS ", rate: 8000},
+		{spec: "256", fail: true},
+		{spec: "256kb", fail: true},
+		{spec: "kbps", fail: true},
+		{spec: "-1mbps", fail: true},
+		{spec: "0bps", fail: true},
+	}
+	for _, test := range tests {
+		rate, err := parseBandwidth(test.spec)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%q: got %g, want an error", test.spec, rate)
+			}
+			continue
+		}
+		if err != nil || math.Abs(rate-test.rate) > 1e-6 {
+			t.Errorf("%q: got %g (%v), want %g", test.spec, rate, err, test.rate)
+		}
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 3000)
+	start := time.Now()
+	read, err := ioutil.ReadAll(throttle(context.Background(), bytes.NewReader(data), 20000))
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond || elapsed > time.Second {
+		t.Errorf("read 3000 bytes at 20000 B/s in %v, want about 150ms", elapsed)
+	}
+	if err != nil || !bytes.Equal(read, data) {
+		t.Errorf("got %d bytes (%v), want all the 3000", len(read), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := ioutil.ReadAll(throttle(ctx, bytes.NewReader(data), 1000)); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want the deadline of the context", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %v, want right at the deadline", elapsed)
+	}
+}
+
+func TestFireBandwidth(t *testing.T) {
+	// The server times how long the body takes to arrive
+	received := make(chan time.Duration, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- time.Since(start)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		upload float64
+		read   float64
+		limit  int64
+		slow   bool
+	}{
+		{name: "unlimited"},
+		{name: "upload", upload: 32000, slow: true},
+		{name: "read", read: 32000},
+		{name: "read under a response limit", read: 32000, limit: 16000},
+	}
+	body := bytes.Repeat([]byte("a"), 8000)
+	for _, test := range tests {
+		opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true}),
+			UploadBandwidth: test.upload, ReadBandwidth: test.read, MaxResponseBytes: test.limit}
+		start := time.Now()
+		response := fire(server.URL, &Cannonball{Method: "POST", Body: body}, nil, opt)
+		elapsed, upload := time.Since(start), <-received
+		if !response.Success || response.Bytes == 0 || len(response.raw) != len(body) {
+			t.Errorf("%s: got %d %q", test.name, response.Status, response.Body)
+		}
+		throttled := test.upload > 0 || test.read > 0
+		if throttled && elapsed < 200*time.Millisecond || !throttled && elapsed > 200*time.Millisecond {
+			t.Errorf("%s: took %v for 8000 bytes", test.name, elapsed)
+		}
+		if test.slow != (upload > 100*time.Millisecond) {
+			t.Errorf("%s: the body took %v to arrive", test.name, upload)
+		}
+	}
+
+	opt := &Options{Timeout: 0.1, Transport: newTransport(SocketOptions{NoDelay: true}), ReadBandwidth: 1000}
+	if response := fire(server.URL, &Cannonball{Method: "POST", Body: body}, nil, opt); response.Class != classTimeout {
+		t.Errorf("got %q %q, want a timeout", response.Class, response.Body)
+	}
+	<-received
+}
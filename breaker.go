@@ -0,0 +1,163 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CircuitBreaker : When a client stops sending for a while, like the circuit
+// breakers of the client libraries do, either after a number of failures in a
+// row or once the error rate of its last requests reaches a share
+type CircuitBreaker struct {
+	Failures int
+	Rate     float64
+	Window   int
+	Pause    time.Duration
+}
+
+// parseCircuitBreaker reads FAILURES:PAUSE like 5:10s, or RATE/WINDOW:PAUSE
+// like 50%/20:10s for the error rate of the last requests of a client
+func parseCircuitBreaker(spec string) (*CircuitBreaker, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("circuit breaker %q should be FAILURES:PAUSE or RATE/WINDOW:PAUSE", spec)
+	}
+	pause, err := time.ParseDuration(spec[i+1:])
+	if err != nil || pause <= 0 {
+		return nil, fmt.Errorf("pause of the circuit breaker %q should be a positive duration", spec)
+	}
+	breaker := &CircuitBreaker{Pause: pause}
+	trigger := spec[:i]
+	if j := strings.Index(trigger, "/"); j >= 0 {
+		breaker.Rate, err = parseShare(trigger[:j])
+		if err != nil || breaker.Rate == 0 {
+			return nil, fmt.Errorf("error rate of the circuit breaker %q should be a positive share", spec)
+		}
+		breaker.Window, err = strconv.Atoi(trigger[j+1:])
+		if err != nil || breaker.Window < 1 {
+			return nil, fmt.Errorf("window of the circuit breaker %q should be a positive number of requests", spec)
+		}
+		return breaker, nil
+	}
+	breaker.Failures, err = strconv.Atoi(trigger)
+	if err != nil || breaker.Failures < 1 {
+		return nil, fmt.Errorf("failures of the circuit breaker %q should be a positive number", spec)
+	}
+	return breaker, nil
+}
+
+// describe tells what opens the circuit
+func (b *CircuitBreaker) describe() string {
+	if b.Window > 0 {
+		return fmt.Sprintf("%g%% of the last %d requests failed", 100*b.Rate, b.Window)
+	}
+	return fmt.Sprintf("%d failures in a row", b.Failures)
+}
+
+func describeCircuitOpened(times int) string {
+	if times == 1 {
+		return "opened once, pausing a client"
+	}
+	return fmt.Sprintf("opened %d times, pausing the clients", times)
+}
+
+// circuit : The breaker of a single client, after a pause it is half-open and
+// a single failure opens it again
+type circuit struct {
+	breaker     *CircuitBreaker
+	consecutive int
+	outcomes    []bool // the last requests when over a window, true for the failures
+	next        int
+	failed      int
+	halfOpen    bool
+}
+
+func newCircuit(breaker *CircuitBreaker) *circuit {
+	if breaker == nil {
+		return nil
+	}
+	return &circuit{breaker: breaker, outcomes: make([]bool, 0, breaker.Window)}
+}
+
+// record tells whether the request opens the circuit, it is safe to call on a
+// nil circuit
+func (c *circuit) record(success bool) bool {
+	if c == nil {
+		return false
+	}
+	if c.halfOpen {
+		c.halfOpen = false
+		if !success {
+			return c.open()
+		}
+	}
+	if c.breaker.Window == 0 {
+		c.consecutive++
+		if success {
+			c.consecutive = 0
+		}
+		if c.consecutive >= c.breaker.Failures {
+			return c.open()
+		}
+		return false
+	}
+
+	if len(c.outcomes) < c.breaker.Window {
+		c.outcomes = append(c.outcomes, !success)
+	} else {
+		if c.outcomes[c.next] {
+			c.failed--
+		}
+		c.outcomes[c.next] = !success
+		c.next = (c.next + 1) % c.breaker.Window
+	}
+	if !success {
+		c.failed++
+	}
+	if len(c.outcomes) == c.breaker.Window && float64(c.failed) >= c.breaker.Rate*float64(c.breaker.Window) {
+		return c.open()
+	}
+	return false
+}
+
+// open forgets the requests so far, the next one after the pause is a trial
+func (c *circuit) open() bool {
+	c.consecutive, c.outcomes, c.next, c.failed = 0, c.outcomes[:0], 0, 0
+	c.halfOpen = true
+	return true
+}
+
+// wait pauses a client with an open circuit, false when the run stops meanwhile
+func (c *circuit) wait(stop <-chan struct{}, quit <-chan struct{}) bool {
+	timer := time.NewTimer(c.breaker.Pause)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+	case <-quit:
+	}
+	return false
+}
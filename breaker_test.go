@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		spec string
+		want CircuitBreaker
+	}{
+		{"5:10s", CircuitBreaker{Failures: 5, Pause: 10 * time.Second}},
+		{"50%/20:1m", CircuitBreaker{Rate: 0.5, Window: 20, Pause: time.Minute}},
+		{"0.25/8:500ms", CircuitBreaker{Rate: 0.25, Window: 8, Pause: 500 * time.Millisecond}},
+	}
+	for _, test := range tests {
+		got, err := parseCircuitBreaker(test.spec)
+		if err != nil || *got != test.want {
+			t.Errorf("parseCircuitBreaker(%q) = %+v, %v, want %+v", test.spec, got, err, test.want)
+		}
+	}
+	for _, spec := range []string{"5", "5:0s", "0:10s", "x:10s", "0%/20:10s", "50%/0:10s", "150%/20:10s"} {
+		if _, err := parseCircuitBreaker(spec); err == nil {
+			t.Errorf("parseCircuitBreaker(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+// trips records the outcomes and returns the indices of those opening the circuit
+func trips(c *circuit, outcomes string) []int {
+	var opened []int
+	for i, outcome := range outcomes {
+		if c.record(outcome == '+') {
+			opened = append(opened, i)
+		}
+	}
+	return opened
+}
+
+func TestCircuit(t *testing.T) {
+	tests := []struct {
+		breaker  CircuitBreaker
+		outcomes string
+		want     []int
+	}{
+		// Three failures in a row, the successes in between start over
+		{CircuitBreaker{Failures: 3}, "--+--+---", []int{8}},
+		// Half-open after a pause, a single failure opens it again
+		{CircuitBreaker{Failures: 3}, "----", []int{2, 3}},
+		{CircuitBreaker{Failures: 3}, "---+---", []int{2, 6}},
+		// Half of the last four failed, only once the window is full
+		{CircuitBreaker{Rate: 0.5, Window: 4}, "-+-+", []int{3}},
+		{CircuitBreaker{Rate: 0.5, Window: 4}, "+-++++-+-++", []int{8}},
+	}
+	for i, test := range tests {
+		got := trips(newCircuit(&test.breaker), test.outcomes)
+		if len(got) != len(test.want) {
+			t.Errorf("#%d: opened at %v, want %v", i, got, test.want)
+			continue
+		}
+		for j := range got {
+			if got[j] != test.want[j] {
+				t.Errorf("#%d: opened at %v, want %v", i, got, test.want)
+			}
+		}
+	}
+	if newCircuit(nil).record(false) {
+		t.Errorf("a nil circuit opened")
+	}
+}
+
+func TestCircuitWait(t *testing.T) {
+	c := newCircuit(&CircuitBreaker{Failures: 1, Pause: time.Hour})
+	stop := make(chan struct{})
+	close(stop)
+	if c.wait(stop, nil) {
+		t.Errorf("wait() went on after the run stopped")
+	}
+	c = newCircuit(&CircuitBreaker{Failures: 1, Pause: time.Millisecond})
+	if !c.wait(nil, nil) {
+		t.Errorf("wait() stopped without the run stopping")
+	}
+}
+
+func TestCircuitInvalidResponses(t *testing.T) {
+	// The status is fine, the bodies only fail the validation
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	opt := &Options{Timeout: 5, ValidateJSON: true, Transport: newTransport(SocketOptions{NoDelay: true}),
+		Breaker: &CircuitBreaker{Failures: 2, Pause: time.Millisecond}}
+	pipeline := make(chan *Cannonball, 3)
+	for i := 0; i < cap(pipeline); i++ {
+		pipeline <- &Cannonball{Method: "POST", Body: []byte("{}")}
+	}
+	close(pipeline)
+	responses := make(chan Response, cap(pipeline))
+	cannonade(0, newTargetPool([]Target{{Name: "api", URL: server.URL}}), opt, newLimiter(0), nil, pipeline, responses, nil)
+	close(responses)
+
+	var tripped []bool
+	for response := range responses {
+		if response.Success || response.Class != classInvalid {
+			t.Errorf("got success %v, class %q, want an invalid response", response.Success, response.Class)
+		}
+		tripped = append(tripped, response.Tripped)
+	}
+	// The second response opens the circuit, the failed probe opens it again
+	if len(tripped) != 3 || tripped[0] || !tripped[1] || !tripped[2] {
+		t.Errorf("got tripped %v, want [false true true]", tripped)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cacheHeaders are the headers the caches and the CDNs tell a hit with
+var cacheHeaders = []string{"X-Cache", "X-Cache-Status", "CF-Cache-Status", "X-Proxy-Cache", "X-Drupal-Cache"}
+
+// Caching : Signs of the responses served by a cache rather than by the service itself
+type Caching struct {
+	Responses int `json:"responses"`
+	Likely    int `json:"likely_hits"`
+	Headers   int `json:"header_hits"`
+	Identical int `json:"identical"`
+}
+
+// cachedByHeaders tells a hit from the cache headers or a positive Age
+func cachedByHeaders(header http.Header) bool {
+	for _, name := range cacheHeaders {
+		if strings.Contains(strings.ToUpper(header.Get(name)), "HIT") {
+			return true
+		}
+	}
+	age, err := strconv.Atoi(strings.TrimSpace(header.Get("Age")))
+	return err == nil && age > 0
+}
+
+// digest fingerprints a body to tell the identical ones
+func digest(body []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(body)
+	return h.Sum64()
+}
+
+// cacheStats : Accumulates the cache signs of the successful responses of a task,
+// a response is identical when its ETag or its body came before for another request
+type cacheStats struct {
+	responses int
+	likely    int
+	headers   int
+	identical int
+	seen      map[string]uint64
+}
+
+func newCacheStats() *cacheStats {
+	return &cacheStats{seen: make(map[string]uint64)}
+}
+
+func (s *cacheStats) add(response *Response) {
+	if !response.Success {
+		return
+	}
+	s.responses++
+
+	identical := false
+	key := ""
+	if response.etag != "" {
+		key = "etag " + response.etag
+	} else if response.digest != 0 {
+		key = "body " + strconv.FormatUint(response.digest, 16)
+	}
+	if key != "" {
+		if request, ok := s.seen[key]; !ok {
+			s.seen[key] = response.request
+		} else if request != response.request {
+			identical = true
+		}
+	}
+
+	if response.CacheHit {
+		s.headers++
+	}
+	if identical {
+		s.identical++
+	}
+	if response.CacheHit || identical {
+		s.likely++
+	}
+}
+
+// summarize is nil unless a response looks cached
+func (s *cacheStats) summarize() *Caching {
+	if s.likely == 0 {
+		return nil
+	}
+	return &Caching{Responses: s.responses, Likely: s.likely, Headers: s.headers, Identical: s.identical}
+}
+
+// describeCaching tells the share of the likely hits and what gave them away
+func describeCaching(c *Caching) string {
+	return fmt.Sprintf("%.1f%% of %d responses look cached, %d by their headers, %d identical to those of other requests",
+		100*float64(c.Likely)/float64(c.Responses), c.Responses, c.Headers, c.Identical)
+}
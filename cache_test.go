@@ -0,0 +1,90 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCachedByHeaders(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   bool
+	}{
+		{http.Header{}, false},
+		{http.Header{"X-Cache": {"Hit from cloudfront"}}, true},
+		{http.Header{"X-Cache": {"MISS"}}, false},
+		{http.Header{"Cf-Cache-Status": {"HIT"}}, true},
+		{http.Header{"Cf-Cache-Status": {"DYNAMIC"}}, false},
+		{http.Header{"Age": {"12"}}, true},
+		{http.Header{"Age": {"0"}}, false},
+		{http.Header{"Age": {"soon"}}, false},
+	}
+	for _, test := range tests {
+		if got := cachedByHeaders(test.header); got != test.want {
+			t.Errorf("cachedByHeaders(%v) = %t, want %t", test.header, got, test.want)
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	s := newCacheStats()
+	if s.summarize() != nil {
+		t.Errorf("got caching without any response")
+	}
+	responses := []Response{
+		{Success: true, request: 1, digest: 10},
+		// The same request is expected to get the same response
+		{Success: true, request: 1, digest: 10},
+		{Success: true, request: 2, digest: 20},
+		{Success: true, request: 3, digest: 10},
+		{Success: true, request: 4, digest: 40, etag: `"v1"`},
+		{Success: true, request: 5, digest: 50, etag: `"v1"`, CacheHit: true},
+		{Success: true, request: 6, digest: 60, CacheHit: true},
+		{Success: false, request: 7, digest: 10, CacheHit: true},
+	}
+	for i := range responses {
+		s.add(&responses[i])
+	}
+
+	want := &Caching{Responses: 7, Likely: 3, Headers: 2, Identical: 2}
+	if got := s.summarize(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFireCacheHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache", "HIT")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	opt := &Options{Timeout: 1, Transport: &http.Transport{}}
+	response := fire(server.URL, &Cannonball{Method: "POST", Body: []byte("x")}, nil, opt)
+	if !response.CacheHit || response.etag != `"abc"` || response.request != digest([]byte("x")) {
+		t.Errorf("got hit %t, etag %q and request %x", response.CacheHit, response.etag, response.request)
+	}
+}
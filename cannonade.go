@@ -23,25 +23,29 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
-	"flag"
 	"fmt"
-	"github.com/schollz/progressbar/v2"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
-	"log"
+	"image/png"
+	"io"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
-	"strconv"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/montanaflynn/stats"
+	"github.com/nizhib/cannonade/latency"
 )
 
 const defaultImage = "example.jpg"
@@ -49,39 +53,174 @@ const defaultSchedule = ""
 const defaultNumClients = 8
 const defaultNumRequests = 100
 const defaultTimeout = 10.0
+const defaultOutputDir = "cannonade-output"
 
 const noiseIterations = 100
-const jpegQuality = 95
+const defaultQuality = 95
 
-// Request : A simple API request object with base64-encoded JPEG image
+// Image formats of the payloads, WebP is left out as there is no encoder for it
+const (
+	formatJPEG = "jpeg"
+	formatPNG  = "png"
+)
+
+// Encoding : Format and quality the images are encoded with, the quality only applies to JPEG
+type Encoding struct {
+	Format  string
+	Quality int
+}
+
+// Request : A simple API request object with base64-encoded JPEG or PNG image,
+// batches of several images are sent as a list instead
 type Request struct {
-	Image string `json:"image"`
+	Image  string   `json:"image,omitempty"`
+	Images []string `json:"images,omitempty"`
+}
+
+// Cannonball : A ready to fire HTTP request, the path is resolved against the target
+type Cannonball struct {
+	Method  string
+	Path    string
+	Header  http.Header
+	Body    []byte
+	Label   string
+	RawSize int           // of the body before compression, zero when it is not compressed
+	At      time.Duration // since the first request of the log it was read from
+	Fuzz    string        // mutation of the body, empty when it is sent as it is
+
+	err   error      // of the generator which failed to produce the request
+	cost  encodeCost // of making the payload on the client
+	lease *bodyLease // of the pooled body, nil when it is not recycled
 }
 
 // Response : Body from the API response as well as additional info
 type Response struct {
-	Body    string
-	Success bool
-	Latency time.Duration
+	Body        string
+	Success     bool
+	Status      int
+	Latency     time.Duration
+	Worker      int
+	Target      string
+	Backend     string
+	Host        string
+	Label       string
+	TraceID     string
+	RequestID   string
+	End         time.Time
+	Intended    time.Time
+	Fired       time.Time
+	Timing      Timing
+	Detail      *Detail
+	Sent        int
+	Bytes       int
+	Oversized   bool
+	Class       string
+	Compression *Compression
+	Extracted   map[string]string
+	Polls       int
+	CacheHit    bool
+	Fuzz        string
+	Throttles   int
+	Backoff     time.Duration
+	Tripped     bool // opened the circuit of its client
+
+	raw      []byte
+	encoding string
+	verified bool // the body was converted and validated already
+	span     *Span
+	etag     string
+	request  uint64 // digests of the request and the response bodies
+	digest   uint64
+	ball     *Cannonball // kept along with the endpoint to save the failures
+	endpoint string
+
+	retryAfter time.Duration // the wait a 429 asked for
 }
 
 // Task : A load pattern to execute
 type Task struct {
 	Endpoint    string
+	Targets     []Target
 	Image       image.Image
-	Noisy       bool
+	Corpus      []*Cannonball
+	Noise       float64
+	Scale       float64
+	Batch       int
+	Encoding    Encoding
+	Source      string
+	Generator   payloadGenerator
+	Speed       float64 // of the replay of the corpus at the times of its requests, zero ignores them
 	NumRequests int
 	NumClients  int
+	FanOut      bool // every target gets a group of the clients and its share of the requests
+
+	costs *encodeStats // of the payloads encoded for the task
 }
 
 // Options: task execution options
 type Options struct {
-	Timeout  float64
-	ApiKey   string
-	Silent   bool
-	Verbose  bool
-	Metrics  bool
-	Progress bool
+	Timeout          float64
+	Protocol         string
+	MaxRPS           float64
+	TargetP99        Millis
+	Pattern          *pattern
+	MaxErrorRate     float64
+	Abort            []abortCondition
+	Breaker          *CircuitBreaker
+	Think            time.Duration
+	ThinkJitter      time.Duration
+	Interval         time.Duration
+	Heatmap          time.Duration
+	Apdex            time.Duration
+	PrintWindows     bool
+	PerTarget        bool
+	PerWorker        bool
+	BackendHeader    string
+	Host             string
+	Trace            bool
+	RequestIDHeader  string
+	Exporter         *spanExporter
+	Statsd           *statsdClient
+	Results          *resultsWriter
+	Failures         *failureLog
+	Transport        *http.Transport
+	DNS              *dnsRefresher
+	Random           *randomness
+	Decoders         int
+	Producers        int
+	Precompute       int
+	Slowest          int
+	OutputDir        string
+	ValidateJSON     bool
+	Golden           *golden
+	MaxResponseBytes int64
+	Chunked          *chunking
+	UploadBandwidth  float64
+	ReadBandwidth    float64
+	Auth             Authenticator
+	Sign             *signer
+	Compress         *codec
+	Scenario         *Scenario
+	Mix              *Mix
+	Fuzz             *fuzzer
+	HonorRateLimit   bool
+	Identity         *identityTemplate
+	Jar              http.CookieJar
+	Template         *requestTemplate
+	Script           *script
+	Data             *dataFeed
+	Extract          []extraction
+	Poll             *Poller
+	Overall          *latency.Accumulator
+	Percentiles      percentileSet
+	Name             string
+	Silent           bool
+	Verbose          bool
+	SampleResponses  int
+	MaxBodyPrint     int
+	Metrics          MetricSink
+	Progress         bool
+	CI               bool
 }
 
 func panicIf(err error) {
@@ -90,8 +229,33 @@ func panicIf(err error) {
 	}
 }
 
+// stdinPath stands for the standard input in place of a file path
+const stdinPath = "-"
+
+// openInput opens the file at path, the standard input for a dash, or an
+// object of s3:// or gs:// storage
+func openInput(path string) (io.ReadCloser, error) {
+	if path == stdinPath {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	if objectURL(path) {
+		return openObject(path)
+	}
+	return os.Open(path)
+}
+
+// readInput reads the whole file at path, or the standard input for a dash
+func readInput(path string) ([]byte, error) {
+	file, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
 func readImage(path string) (image.Image, error) {
-	file, err := os.Open(path)
+	file, err := openInput(path)
 	if err != nil {
 		return nil, err
 	}
@@ -105,10 +269,7 @@ func readImage(path string) (image.Image, error) {
 	return img, nil
 }
 
-func addNoise(img *image.Image) image.Image {
-	src := rand.NewSource(time.Now().UnixNano())
-	rnd := rand.New(src)
-
+func addNoise(img *image.Image, rnd *rand.Rand) image.Image {
 	bounds := (*img).Bounds()
 	noisy := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
 	draw.Draw(noisy, noisy.Bounds(), *img, bounds.Min, draw.Src)
@@ -123,257 +284,944 @@ func addNoise(img *image.Image) image.Image {
 	return noisy
 }
 
-func encodeImage(img *image.Image) string {
-	buf := bytes.NewBuffer(make([]byte, 0))
+// imageBuffers are the scratch buffers the images are encoded into before
+// their base64 goes into a body, reused across the payloads
+var imageBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
 
-	err := jpeg.Encode(buf, *img, &jpeg.Options{Quality: jpegQuality})
+// writeImage encodes the image in its format into the buffer
+func writeImage(buf *bytes.Buffer, img *image.Image, encoding Encoding) {
+	var err error
+	if encoding.Format == formatPNG {
+		err = png.Encode(buf, *img)
+	} else {
+		err = jpeg.Encode(buf, *img, &jpeg.Options{Quality: encoding.Quality})
+	}
 	panicIf(err)
+}
 
-	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+func encodeImage(img *image.Image, encoding Encoding) string {
+	buf := imageBuffers.Get().(*bytes.Buffer)
+	defer imageBuffers.Put(buf)
+	buf.Reset()
+
+	writeImage(buf, img, encoding)
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
 
-	return encoded
+// makeCannonball encodes the image into a request body, with random noise
+// added to every copy when the source of randomness is given, timing every
+// stage of it. The base64 is written straight into a body of the exact size
+// and framed by hand the way json.Marshal frames a Request, as it never
+// needs escaping.
+func makeCannonball(img image.Image, rnd *rand.Rand, batch int, encoding Encoding) *Cannonball {
+	return makeCannonballIn(nil, img, rnd, batch, encoding)
 }
 
-func makeCannonball(img image.Image, noisy bool) []byte {
-	if noisy {
-		img = addNoise(&img)
+// makeCannonballIn makes the cannonball in the given body when it has the
+// room for it
+func makeCannonballIn(buf []byte, img image.Image, rnd *rand.Rand, batch int, encoding Encoding) *Cannonball {
+	var cost encodeCost
+	images := make([]*bytes.Buffer, batch)
+	for i := range images {
+		shot := img
+		if rnd != nil {
+			start := time.Now()
+			shot = addNoise(&img, rnd)
+			cost.noise += time.Since(start)
+		}
+		start := time.Now()
+		images[i] = imageBuffers.Get().(*bytes.Buffer)
+		images[i].Reset()
+		writeImage(images[i], &shot, encoding)
+		cost.image += time.Since(start)
 	}
 
-	encoded := encodeImage(&img)
+	start := time.Now()
+	prefix, suffix := `{"image":"`, `"}`
+	if batch > 1 {
+		prefix, suffix = `{"images":["`, `"]}`
+	}
+	size := len(prefix) + len(suffix) + 3*(batch-1)
+	for _, buf := range images {
+		size += base64.StdEncoding.EncodedLen(buf.Len())
+	}
+	body := buf[:0]
+	if cap(body) < size {
+		body = make([]byte, 0, size)
+	}
+	body = append(body, prefix...)
+	for i, buf := range images {
+		if i > 0 {
+			body = append(body, `","`...)
+		}
+		encoded := time.Now()
+		n := len(body)
+		body = body[:n+base64.StdEncoding.EncodedLen(buf.Len())]
+		base64.StdEncoding.Encode(body[n:], buf.Bytes())
+		cost.base64 += time.Since(encoded)
+		imageBuffers.Put(buf)
+	}
+	body = append(body, suffix...)
+	cost.json = time.Since(start) - cost.base64
 
-	req := Request{encoded}
-	cannonball, err := json.Marshal(&req)
-	panicIf(err)
+	return &Cannonball{
+		Method: "POST",
+		Header: http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+		Body:   body,
+		cost:   cost,
+	}
+}
 
-	return cannonball
+// newRequest builds the request of the cannonball for the endpoint, with the
+// host, the credentials and the accepted encodings of the run
+func newRequest(endpoint string, ball *Cannonball, header http.Header, opt *Options) (*http.Request, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ball.Path != "" {
+		path, err := url.Parse(ball.Path)
+		if err != nil {
+			return nil, err
+		}
+		target = target.ResolveReference(path)
+	}
+	req, err := http.NewRequest(ball.Method, target.String(), bytes.NewReader(ball.Body))
+	if err != nil {
+		return nil, err
+	}
+	if lease := ball.lease; lease.holds(ball.Body) {
+		req.Body = lease.reader()
+		req.GetBody = func() (io.ReadCloser, error) {
+			return lease.reader(), nil
+		}
+	}
+	for key, values := range ball.Header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if opt.Host != "" {
+		req.Host = opt.Host
+	}
+	if opt.Auth != nil {
+		opt.Auth.Apply(req)
+	}
+	if opt.Compress != nil && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	if opt.Sign != nil {
+		opt.Sign.Sign(req, ball.Body)
+	}
+	return req, nil
 }
 
-func fire(endpoint string, ball []byte, timeout float64, apikey string) (string, bool) {
-	client := http.Client{
-		Timeout: time.Duration(timeout * float64(time.Second)),
+func fire(endpoint string, ball *Cannonball, header http.Header, opt *Options) Response {
+	client := http.Client{Transport: opt.Transport, Jar: opt.Jar}
+
+	req, err := newRequest(endpoint, ball, header, opt)
+	if err != nil {
+		return Response{Body: fmt.Sprintf("Error while preparing the request: %s", err), Class: classPrepare}
+	}
+
+	// The deadline covers the whole exchange up to the last byte of the body
+	ctx := req.Context()
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opt.Timeout*float64(time.Second)))
+		defer cancel()
+	}
+	trace, clientTrace := newTimingTrace()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, clientTrace))
+	if opt.Chunked != nil && req.ContentLength > 0 {
+		// Without a length the transport sends the body chunked as it streams in
+		req.Body = ioutil.NopCloser(opt.Chunked.stream(ctx, ball.Body))
+		req.ContentLength = -1
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(opt.Chunked.stream(ctx, ball.Body)), nil
+		}
+	}
+	if opt.UploadBandwidth > 0 && req.ContentLength != 0 {
+		// The body trickles out like from a slow client
+		req.Body = ioutil.NopCloser(throttle(ctx, req.Body, opt.UploadBandwidth))
+		getBody := req.GetBody
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(throttle(ctx, body, opt.UploadBandwidth)), nil
+		}
 	}
-	buf := bytes.NewBuffer(ball)
 
-	url := endpoint
-	if apikey != "" {
-		url += "?apikey=" + apikey
+	var detail *Detail
+	if opt.Slowest > 0 || opt.Failures != nil || opt.Script != nil {
+		detail = &Detail{
+			Method:        req.Method,
+			URL:           req.URL.String(),
+			RequestHeader: req.Header,
+			RequestBytes:  len(ball.Body),
+		}
 	}
 
-	res, err := client.Post(url, "application/json; charset=utf-8", buf)
+	res, err := client.Do(req)
 	if err != nil {
-		return fmt.Sprintf("Error while sending the request: %s", err), false
+		return Response{Body: fmt.Sprintf("Error while sending the request: %s", err), Class: classifyError(err),
+			Timing: trace.timing(), Detail: detail}
+	}
+	defer res.Body.Close()
+	if detail != nil {
+		detail.ResponseHeader = res.Header
 	}
 
-	buf = new(bytes.Buffer)
-	_, err = buf.ReadFrom(res.Body)
+	// Oversized bodies are cut short, closing the body drops the connection
+	// instead of draining whatever the endpoint keeps sending
+	limit := opt.MaxResponseBytes
+	oversized := func(body string) Response {
+		response := Response{Body: body, Status: res.StatusCode, Class: classOversized, Oversized: true, Timing: trace.timing(),
+			Detail: detail, Sent: len(ball.Body)}
+		if received, sent, ok := trace.transfer(); ok && res.ProtoMajor == 1 {
+			response.Bytes, response.Sent = int(received), int(sent)
+		}
+		return response
+	}
+	if limit > 0 && res.ContentLength > limit {
+		return oversized(fmt.Sprintf("Response of %d bytes is over the limit of %d", res.ContentLength, limit))
+	}
+	var body io.Reader = res.Body
+	if opt.ReadBandwidth > 0 {
+		body = throttle(ctx, body, opt.ReadBandwidth)
+	}
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(body)
+	if limit > 0 && int64(buf.Len()) > limit {
+		return oversized(fmt.Sprintf("Response is over the limit of %d bytes", limit))
+	}
 	if err != nil {
-		return fmt.Sprintf("Error while parsing the response: %s", err), false
+		class := classRead
+		if classifyError(err) == classTimeout {
+			class = classTimeout
+		}
+		return Response{Body: fmt.Sprintf("Error while parsing the response: %s", err), Status: res.StatusCode,
+			Class: class, Timing: trace.timing(), Detail: detail}
 	}
 
-	return buf.String(), res.StatusCode == 200
+	response := Response{Success: res.StatusCode == 200, Status: res.StatusCode, raw: buf.Bytes(),
+		Timing: trace.timing(), Detail: detail, Sent: len(ball.Body), Bytes: buf.Len()}
+
+	// HTTP/2 streams share their connections, so only the bodies can be told apart
+	if received, sent, ok := trace.transfer(); ok && res.ProtoMajor == 1 {
+		response.Bytes, response.Sent = int(received), int(sent)
+	} else if res.ContentLength >= 0 && !res.Uncompressed {
+		response.Bytes = int(res.ContentLength)
+	}
+	if !response.Success {
+		response.Class = statusClass(res.StatusCode)
+	}
+	if ball.RawSize > 0 {
+		response.Compression = &Compression{Sent: int64(len(ball.Body)), SentRaw: int64(ball.RawSize)}
+	}
+	if opt.Compress != nil {
+		response.encoding = res.Header.Get("Content-Encoding")
+	}
+	if opt.BackendHeader != "" {
+		response.Backend = res.Header.Get(opt.BackendHeader)
+	}
+	response.CacheHit = cachedByHeaders(res.Header)
+	if res.StatusCode == http.StatusTooManyRequests {
+		response.retryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	}
+	response.etag = res.Header.Get("ETag")
+	response.request = digest(ball.Body)
+
+	return response
 }
 
-func cannonade(endpoint string, timeout float64, apikey string,
-	pipeline <-chan []byte, responses chan<- Response, metrics bool) {
+func thinkTime(rnd *rand.Rand, think time.Duration, jitter time.Duration) time.Duration {
+	pause := think
+	if jitter > 0 {
+		pause += time.Duration(rnd.Int63n(2*int64(jitter)+1)) - jitter
+	}
+	if pause < 0 {
+		pause = 0
+	}
+	return pause
+}
 
-	var logger *log.Logger
-	if metrics {
-		f, err := os.OpenFile("metrics.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// aim fills the cannonball in for the next step of the user or the next row of
+// the data, recompressing it when its body changes
+func aim(cannonball *Cannonball, user *virtualUser, opt *Options, rnd *rand.Rand) *Cannonball {
+	if user != nil {
+		cannonball = user.next(cannonball, opt.Data, rnd)
+	} else if opt.Template != nil {
+		cannonball = opt.Template.apply(cannonball, opt.Data.row(rnd), rnd)
+	}
+	if opt.Compress != nil && (user != nil || opt.Template != nil) {
+		cannonball = opt.Compress.compress(cannonball)
+	}
+	return cannonball
+}
+
+func cannonade(worker int, targets *targetPool, opt *Options, limiter *Limiter, stop <-chan struct{},
+	pipeline <-chan *Cannonball, responses chan<- Response, quit <-chan struct{}) {
+
+	rnd := opt.Random.stream(streamWorkers + int64(worker))
+
+	var identity *clientIdentity
+	if opt.Identity != nil {
+		identity = opt.Identity.newClient(opt.Data, rnd)
+		opt = identity.options(opt)
+	}
+	var sockets *wsClient
+	if opt.Protocol == protocolWS {
+		sockets = newWSClient(opt)
+		defer sockets.close()
+	}
+	var user *virtualUser
+	if opt.Scenario != nil {
+		user = newVirtualUser(opt.Scenario)
+	}
+	breaker := newCircuit(opt.Breaker)
+	var resolved int64
+	var hooks *scriptState
+	if opt.Script != nil {
+		var err error
+		hooks, err = opt.Script.instance()
 		panicIf(err)
-		logger = log.New(f, "", 0)
+		defer hooks.close()
 	}
 
-	for cannonball := range pipeline {
+	for {
+		if !targets.claim() {
+			return
+		}
+		var cannonball *Cannonball
+		var ok bool
+		select {
+		case <-quit:
+			targets.release()
+			return
+		case cannonball, ok = <-pipeline:
+			if !ok {
+				return
+			}
+		}
+		lease := cannonball.lease
+		intended, ok := limiter.Wait(stop)
+		if !ok {
+			lease.recycle()
+			return
+		}
+		cannonball = aim(cannonball, user, opt, rnd)
+		if hooks != nil {
+			cannonball = hooks.beforeRequest(cannonball)
+		}
+		if opt.Fuzz != nil {
+			cannonball = opt.Fuzz.mutate(cannonball, rnd)
+		}
+		target := targets.pick()
+		var header http.Header
+		var span Span
+		if opt.Trace {
+			span = newSpan(rnd, cannonball.Method)
+			header = http.Header{"Traceparent": {span.traceparent()}}
+		}
+		header = identity.headers(header)
+		if opt.DNS.moved(&resolved) {
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set("Connection", "close")
+		}
+		var requestID string
+		if opt.RequestIDHeader != "" {
+			requestID = newUUID(rnd)
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set(opt.RequestIDHeader, requestID)
+		}
 		start := time.Now()
-		body, success := fire(endpoint, cannonball, timeout, apikey)
+		var response Response
+		if cannonball.err != nil {
+			response = Response{Body: fmt.Sprintf("Error while preparing the request: %s", cannonball.err), Class: classPrepare}
+		} else if sockets != nil {
+			response = sockets.fire(target.URL, cannonball, header, opt)
+		} else {
+			response = fire(target.URL, cannonball, header, opt)
+			if opt.HonorRateLimit {
+				response, start = retryThrottled(response, start, func() Response {
+					return fire(target.URL, cannonball, header, opt)
+				}, stop)
+			}
+		}
+		if opt.Poll != nil {
+			response = opt.Poll.follow(target.URL, response, header, opt, stop)
+		}
 		latency := time.Since(start)
-		if logger != nil {
-			panicIf(logger.Output(2, fmt.Sprintf("%3.3f", float64(latency)/math.Pow10(6))))
+		if user != nil {
+			user.advance(&response, opt)
+		}
+		if opt.Trace {
+			span.URL, span.Worker = target.URL, worker
+			span.Start, span.End = start, start.Add(latency)
+			response.TraceID, response.span = span.TraceID, &span
+		}
+		response.Latency, response.Worker, response.Target = latency, worker, target.Name
+		response.RequestID = requestID
+		response.Host = target.Host
+		response.End = start.Add(latency)
+		response.Intended, response.Fired = intended, start
+		response.Label = cannonball.Label
+		if cannonball.Fuzz != "" {
+			response.Fuzz = cannonball.Fuzz
+			judgeFuzz(&response)
+		}
+		if hooks != nil {
+			hooks.afterResponse(&response, opt)
+		}
+		if opt.Failures != nil {
+			response.ball, response.endpoint = cannonball, target.URL
+		}
+		if breaker != nil {
+			// The breaker counts the bodies failing validation as failures too
+			verify(&response, opt)
+		}
+		response.Tripped = breaker.record(response.Success)
+		responses <- response
+		lease.recycle()
+		if response.Tripped && !breaker.wait(stop, quit) {
+			return
+		}
+		if opt.Think > 0 || opt.ThinkJitter > 0 {
+			time.Sleep(thinkTime(rnd, opt.Think, opt.ThinkJitter))
 		}
-		responses <- Response{body, success, latency}
 	}
 }
 
-func printStats(latencies []float64, totalSeconds float64, numRequests int, numFails int) {
-	min, err := stats.Min(latencies)
-	if err != nil {
-		min = math.NaN()
-	}
-	median, err := stats.Median(latencies)
-	if err != nil {
-		median = math.NaN()
-	}
-	max, err := stats.Max(latencies)
-	if err != nil {
-		max = math.NaN()
+// estimatedNote tells the percentiles of the long runs are not exact
+const estimatedNote = "Percentiles estimated to within 0.1% from a histogram of the latencies"
+
+func summarize(latencies *latency.Accumulator, totalSeconds float64, set percentileSet) Summary {
+	stats := set.stats(latencies)
+	percentiles := make([]Percentile, len(set.thresholds))
+	for i, threshold := range set.thresholds {
+		percentiles[i] = Percentile{Threshold: threshold, Value: Millis(stats.Percentiles[i])}
 	}
-	sum, err := stats.Sum(latencies)
-	if err != nil {
-		sum = math.NaN()
+
+	// Attempts show the offered load, successes what the service actually handled
+	rps, successRPS := 0.0, 0.0
+	if totalSeconds > 0 {
+		rps = float64(stats.Count) / totalSeconds
+		successRPS = float64(stats.Successes) / totalSeconds
 	}
 
-	avg := sum / float64(numRequests)
-	rps := float64(numRequests) / totalSeconds
+	return Summary{
+		NumRequests: stats.Count,
+		NumFails:    stats.Fails,
+		Seconds:     totalSeconds,
+		Avg:         Millis(stats.Mean),
+		Min:         Millis(stats.Min),
+		Max:         Millis(stats.Max),
+		Median:      Millis(stats.Median),
+		RPS:         rps,
+		SuccessRPS:  successRPS,
+		Percentiles: percentiles,
+		Estimated:   latencies.Folded(),
+	}
+}
 
-	fmt.Println(" # reqs   # fails     Avg     Min     Max  |  Median   req/s  ")
-	fmt.Println("--------------------------------------------------------------")
-	fmt.Printf("%7d", numRequests)
-	fmt.Printf("%10d", numFails)
-	fmt.Printf("%8.0f", avg)
-	fmt.Printf("%8.0f", min)
-	fmt.Printf("%8.0f", max)
-	fmt.Print("  |")
-	fmt.Printf("%8.0f", median)
-	fmt.Printf("%8.2f\n", rps)
+func printStats(w io.Writer, summary *Summary) {
+	fmt.Fprintln(w, " # reqs   # fails     Avg     Min     Max  |  Median   req/s    ok/s  ")
+	fmt.Fprintln(w, "----------------------------------------------------------------------")
+	fmt.Fprintf(w, "%7d", summary.NumRequests)
+	fmt.Fprintf(w, "%10d", summary.NumFails)
+	fmt.Fprintf(w, "%8.0f", summary.Avg)
+	fmt.Fprintf(w, "%8.0f", summary.Min)
+	fmt.Fprintf(w, "%8.0f", summary.Max)
+	fmt.Fprint(w, "  |")
+	fmt.Fprintf(w, "%8.0f", summary.Median)
+	fmt.Fprintf(w, "%8.2f", summary.RPS)
+	fmt.Fprintf(w, "%8.2f\n", summary.SuccessRPS)
 
-	fmt.Println()
+	fmt.Fprintln(w)
 
-	pthresholds := []int64{50, 80, 90, 95, 99, 100}
-	percentiles := make([]float64, len(pthresholds))
+	fmt.Fprint(w, " # reqs ")
+	for _, percentile := range summary.Percentiles {
+		fmt.Fprintf(w, "%6s%%", formatThreshold(percentile.Threshold))
+	}
+	fmt.Fprint(w, "  \n")
+	fmt.Fprintln(w, strings.Repeat("-", 8+7*len(summary.Percentiles)+2))
+	fmt.Fprintf(w, "%7d ", summary.NumRequests)
+	for _, percentile := range summary.Percentiles {
+		fmt.Fprintf(w, "%7.0f", percentile.Value)
+	}
+	fmt.Fprint(w, "\n")
+	if summary.Estimated {
+		fmt.Fprintln(w, estimatedNote)
+	}
 
-	for i, threshold := range pthresholds {
-		percentiles[i], err = stats.Percentile(latencies, float64(threshold))
-		if err != nil {
-			percentiles[i] = math.NaN()
-		}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Received %s (%s per response), sent %s, %.2f MB/s\n",
+		formatBytes(float64(summary.BytesReceived)), formatBytes(summary.AvgResponseBytes),
+		formatBytes(float64(summary.BytesSent)), summary.Throughput)
+	if compression := summary.Compression; compression != nil {
+		fmt.Fprintf(w, "Compressed bodies: %s\n", describeCompression(compression))
+	}
+	if summary.NumOversized > 0 {
+		fmt.Fprintf(w, "Oversized: %d of %d responses cut at the size limit\n", summary.NumOversized, summary.NumRequests)
+	}
+	if summary.AvgPolls > 0 {
+		fmt.Fprintf(w, "Polled %.1f times per job on average\n", summary.AvgPolls)
+	}
+	if summary.Concurrency != nil {
+		fmt.Fprintf(w, "Concurrency: %s\n", describeConcurrency(summary.Concurrency))
+	}
+	if summary.Connections != nil {
+		fmt.Fprintf(w, "Connections: %s\n", describeConnections(summary.Connections))
+	}
+	if summary.Caching != nil {
+		fmt.Fprintf(w, "Cache: %s\n", describeCaching(summary.Caching))
+	}
+	if summary.CircuitOpened > 0 {
+		fmt.Fprintf(w, "Circuit breaker: %s\n", describeCircuitOpened(summary.CircuitOpened))
 	}
+	if summary.RateLimit != nil {
+		fmt.Fprintf(w, "Rate limit: %s\n", describeRateLimit(summary.RateLimit, summary.NumRequests))
+	}
+	if summary.ClientCost != nil {
+		fmt.Fprintf(w, "Encoding: %s\n", describeClientCost(summary.ClientCost, summary.Avg))
+	}
+	if summary.Adaptive != nil {
+		fmt.Fprintf(w, "Target: %s\n", describeAdaptive(summary.Adaptive))
+	}
+	if summary.Generator != nil {
+		fmt.Fprintf(w, "Generator: %s\n", describeGenerator(summary.Generator))
+	}
+}
+
+const megabyte = 1 << 20
 
-	fmt.Println(" # reqs     50%    80%    90%    95%    99%   100%  ")
-	fmt.Println("----------------------------------------------------")
-	fmt.Printf("%7d ", numRequests)
-	for _, percentile := range percentiles {
-		fmt.Printf("%7.0f", percentile)
+// formatBytes prints the size in the largest fitting binary unit
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	unit := 0
+	for n >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f B", n)
 	}
-	fmt.Print("\n")
+	return fmt.Sprintf("%.1f %s", n, units[unit])
 }
 
-func runTask(task *Task, opt *Options) {
+func runTask(taskIndex int, task *Task, opt *Options, ctl *Control) Summary {
+	payload := strings.TrimSpace(task.Source + " " +
+		(&Milestone{Noise: task.Noise, Scale: task.Scale, Batch: task.Batch}).Payload())
+	if task.Corpus != nil {
+		payload = fmt.Sprintf("%d recorded requests", len(task.Corpus))
+	}
+	if task.Generator != nil {
+		payload = "generated by " + task.Generator.String()
+	}
+
 	// Create channels
-	pipeline := make(chan []byte, task.NumRequests)
+	raw := make(chan Response, task.NumRequests)
 	responses := make(chan Response, task.NumRequests)
+	producing := make(chan struct{})
+	task.costs = newEncodeStats()
+	pipeline := producePayloads(task, opt, task.NumClients, producing)
 
-	// Prepare binary requests bodies
-	if !opt.Silent && opt.Verbose && task.NumRequests > 1 {
-		fmt.Print("Producing cannonballs... ")
+	// Fire parallel web requests
+	ctl.track(fmt.Sprintf("%d@%d", task.NumRequests, task.NumClients))
+	opt.Results.Task(taskIndex, task, payload)
+	targets := newTargetPool(task.Targets)
+	var groups []*targetPool
+	if task.FanOut {
+		groups = fanOutPools(task.Targets, task.NumRequests)
 	}
-	cannonball := makeCannonball(task.Image, task.Noisy)
-	for r := 0; r < task.NumRequests; r++ {
-		if task.Noisy && r > 0 {
-			cannonball = makeCannonball(task.Image, task.Noisy)
+	clients := newFleet(func(worker int, quit <-chan struct{}) {
+		pool := targets
+		if groups != nil {
+			pool = groups[worker%len(groups)]
 		}
-		pipeline <- cannonball
-	}
-	if !opt.Silent && opt.Verbose && task.NumRequests > 1 {
-		fmt.Print("done\n")
+		cannonade(worker, pool, opt, ctl.limiter, ctl.Stopped(), pipeline, raw, quit)
+	})
+	clients.min = len(groups)
+	decoding := startDecoders(opt.Decoders, opt, raw, responses)
+	ctl.attach(clients)
+	defer ctl.attach(nil)
+	monitor := monitorGenerator(generatorSamplePeriod)
+	if opt.Pattern != nil {
+		ctl.limiter.SetRate(opt.Pattern.rate(0))
 	}
-
-	// Fire parallel web requests
 	start := time.Now()
-	for c := 0; c < task.NumClients; c++ {
-		go cannonade(task.Endpoint, opt.Timeout, opt.ApiKey, pipeline, responses, opt.Metrics)
+	clients.resize(task.NumClients)
+
+	// Let the requests in flight land once the run is stopped
+	landed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	if opt.Pattern != nil {
+		go opt.Pattern.drive(ctl.limiter, start, done)
 	}
+	go func() {
+		stopped := false
+		select {
+		case <-ctl.Stopped():
+			stopped = true
+		case <-done:
+		}
+		close(producing)
+		clients.close()
+		clients.wg.Wait()
+		close(raw)
+		decoding.wait()
+		if stopped {
+			close(landed)
+		}
+	}()
 
 	// Gather stats from responses
-	var bar *progressbar.ProgressBar
-	if !opt.Silent && opt.Progress {
-		bar = progressbar.New(task.NumRequests)
-		err := bar.RenderBlank()
-		panicIf(err)
-		fmt.Print("\r")
-	}
-	var latencies = make([]float64, 0)
-	var numFails = 0
-	for r := 0; r < task.NumRequests; r++ {
-		response := <-responses
-		if response.Success {
-			latencies = append(latencies, float64(response.Latency)/math.Pow10(6))
-		} else {
-			numFails++
+	live := newConsole(opt, taskIndex)
+	live.start(task, payload)
+	var ticks <-chan time.Time
+	if opt.Interval > 0 {
+		ticker := time.NewTicker(opt.Interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	var collected = newCollector(opt.PerTarget, opt.BackendHeader != "", opt.PerWorker, opt.Percentiles)
+	if opt.Heatmap > 0 {
+		collected.heatmap = newHeatmap(start, opt.Heatmap)
+	}
+	if opt.Apdex > 0 {
+		collected.apdex = newApdex(opt.Apdex)
+	}
+	var slowestResponses = newSlowest(opt.Slowest)
+	var watch *abortWatch
+	if len(opt.Abort) > 0 {
+		watch = newAbortWatch(opt.Abort, start)
+	}
+	var adaptive *controller
+	if opt.TargetP99 > 0 {
+		period := opt.Interval
+		if period <= 0 {
+			period = defaultAdaptivePeriod
+		}
+		adaptive = newController(opt.TargetP99, opt.MaxErrorRate, period, ctl.limiter, start)
+	}
+	var windows = make([]Window, 0)
+	var windowLatencies = latency.New()
+	var windowStart = start
+	closeWindow := func(now time.Time) {
+		window := newWindow(windowLatencies, now.Sub(start), now.Sub(windowStart))
+		windows = append(windows, window)
+		live.window(&window)
+		windowLatencies = latency.New()
+		windowStart = now
+	}
+	// Windows are closed by the first response completed after their end, so
+	// that the ones still being decoded at the tick are counted where they belong
+	var boundaries []time.Time
+	var numRequests = 0
+gather:
+	for numRequests < task.NumRequests {
+		var response Response
+		select {
+		case response = <-responses:
+		case now := <-ticks:
+			boundaries = append(boundaries, now)
+			continue
+		case <-landed:
+			select {
+			case response = <-responses:
+			default:
+				break gather
+			}
 		}
-		if !opt.Silent && opt.Verbose {
-			_, err := fmt.Println(response.Body)
-			panicIf(err)
+		for len(boundaries) > 0 && !response.End.Before(boundaries[0]) {
+			closeWindow(boundaries[0])
+			boundaries = boundaries[1:]
 		}
-		if bar != nil {
-			err := bar.Add(1)
-			panicIf(err)
+		numRequests++
+		collected.add(&response)
+		if adaptive != nil {
+			adaptive.add(&response)
 		}
+		if watch != nil && !ctl.IsStopped() {
+			if reason, ok := watch.add(&response); ok {
+				live.warn("Aborting the run, " + reason)
+				ctl.Abort(reason)
+			}
+		}
+		if response.Tripped {
+			live.warn(fmt.Sprintf("Client #%d opened its circuit after %s, pausing it for %s",
+				response.Worker, opt.Breaker.describe(), opt.Breaker.Pause))
+		}
+		slowestResponses.add(&response)
+		if err := opt.Failures.Save(taskIndex, &response); err != nil {
+			live.fail("Stopped saving the failures", err)
+		}
+		opt.Results.Response(taskIndex, start, &response)
+		ctl.complete()
+		windowLatencies.Add(float64(response.Latency)/math.Pow10(6), response.Success)
+		if opt.Overall != nil {
+			opt.Overall.Add(float64(response.Latency)/math.Pow10(6), response.Success)
+		}
+		live.response(&response, ctl.progress())
 	}
-	if !opt.Silent && opt.Progress {
-		fmt.Println()
+	for _, boundary := range boundaries {
+		closeWindow(boundary)
+	}
+	if ticks != nil && windowLatencies.Count() > 0 {
+		closeWindow(time.Now())
 	}
 	totalSeconds := float64(time.Since(start)) / math.Pow10(9)
 
-	// Print pretty stats table
-	if !opt.Silent {
-		fmt.Printf("\nTask: %d@%d\n\n", task.NumRequests, task.NumClients)
-		printStats(latencies, totalSeconds, task.NumRequests, numFails)
+	// Aggregate the stats
+	summary := collected.summarize(totalSeconds, task.NumClients, clients.peak())
+	summary.Windows = windows
+	summary.Payload = payload
+	summary.Generator = monitor.finish()
+	summary.ClientCost = task.costs.summarize(summary.NumRequests, task.Encoding)
+	if adaptive != nil {
+		summary.Adaptive = adaptive.summarize()
+	}
+	live.finish(&summary)
+	opt.Results.Done(taskIndex, totalSeconds, clients.peak())
+	dir := filepath.Join(opt.OutputDir, fmt.Sprintf("task-%d-slowest", taskIndex+1))
+	if err := slowestResponses.save(dir); err != nil {
+		live.fail("Failed saving the slowest requests", err)
 	}
+
+	return summary
 }
 
-func main() {
-	// Parse CLI options
-	imagePath := flag.String("image", defaultImage, "path of the image to shoot with")
-	schedule := flag.String("schedule", defaultSchedule, "requests load schedule (5@1,10@2)")
-	numRequests := flag.Int("num-requests", defaultNumRequests, "total number of requests")
-	numClients := flag.Int("num-clients", defaultNumClients, "number of parallel requests")
-	noisy := flag.Bool("noisy", false, "add random noise to each request")
-	timeout := flag.Float64("timeout", defaultTimeout, "request timeout limit")
-	apikey := flag.String("apikey", "", "api key to use as a query parameter")
-	verbose := flag.Bool("verbose", false, "print every response to stdout")
-	metrics := flag.Bool("metrics", false, "save latencies to metrics.log file")
-	progress := flag.Bool("progress", false, "show progressbar")
-	silent := flag.Bool("silent", false, "disable any output but errors")
-	flag.Parse()
-	args := flag.Args()
-	if len(args) == 0 {
-		fmt.Println("Provide an endpoint to shoot at!")
-		os.Exit(1)
-	}
-	endpoint := args[0]
-
-	// Check options compatibility
-	if *progress && *verbose {
-		fmt.Println("Cannot use progress and verbose flags together")
-		os.Exit(1)
-	}
-
-	// Open an image to shoot with
-	img, err := readImage(*imagePath)
-	if err != nil {
-		fmt.Printf("Failed reading the image: %s\n", err)
-		os.Exit(1)
+// collector : Accumulates the responses of a single task
+type collector struct {
+	latencies   *latency.Accumulator
+	percentiles percentileSet
+	fairness    fairnessTracker
+	scheduling  *schedulingStats
+	perTarget   *breakdown
+	perBackend  *breakdown
+	perRequest  *breakdown
+	perHost     *breakdown
+	perWorker   *breakdown
+	sent        int64
+	received    int64
+	busy        float64 // seconds spent in the requests
+	tripped     int
+	oversized   int
+	polls       int
+	jobs        int
+	connections *connectionStats
+	caching     *cacheStats
+	fuzzing     *fuzzStats
+	rateLimit   *rateLimitStats
+	heatmap     *heatmap
+	apdex       *apdex
+	failures    map[string]int
+	firstFailed map[string]string // request id of the first failure of every class
+	failedTimes map[string]*latency.Accumulator
+	compression *Compression
+}
+
+func newCollector(perTarget bool, perBackend bool, perWorker bool, percentiles percentileSet) *collector {
+	c := &collector{
+		latencies:   newAccumulator(percentiles.exact),
+		percentiles: percentiles,
+		scheduling:  newSchedulingStats(percentiles.exact),
+		perRequest:  newBreakdown(percentiles.exact),
+		perHost:     newBreakdown(percentiles.exact),
+		failures:    make(map[string]int),
+		firstFailed: make(map[string]string),
+		failedTimes: make(map[string]*latency.Accumulator),
+		connections: newConnectionStats(),
+		caching:     newCacheStats(),
+		fuzzing:     newFuzzStats(),
+		rateLimit:   &rateLimitStats{},
+	}
+	if perTarget {
+		c.perTarget = newBreakdown(percentiles.exact)
+	}
+	if perBackend {
+		c.perBackend = newBreakdown(percentiles.exact)
 	}
+	if perWorker {
+		c.perWorker = newBreakdown(percentiles.exact)
+	}
+	return c
+}
 
-	task := Task{
-		Endpoint:    endpoint,
-		Image:       img,
-		Noisy:       *noisy,
-		NumClients:  *numClients,
-		NumRequests: *numRequests,
+func (c *collector) add(response *Response) {
+	millis := float64(response.Latency) / math.Pow10(6)
+
+	c.latencies.Add(millis, response.Success)
+	c.busy += response.Latency.Seconds()
+	if response.Tripped {
+		c.tripped++
+	}
+	c.sent += int64(response.Sent)
+	c.received += int64(response.Bytes)
+	if response.Oversized {
+		c.oversized++
+	}
+	if !response.Success {
+		c.failures[response.Class]++
+		if _, ok := c.firstFailed[response.Class]; !ok && response.RequestID != "" {
+			c.firstFailed[response.Class] = response.RequestID
+		}
+		times, ok := c.failedTimes[response.Class]
+		if !ok {
+			times = newAccumulator(c.percentiles.exact)
+			c.failedTimes[response.Class] = times
+		}
+		times.Add(millis, false)
+	}
+	if response.Polls > 0 {
+		c.polls += response.Polls
+		c.jobs++
+	}
+	c.connections.add(&response.Timing)
+	c.caching.add(response)
+	c.fuzzing.add(response)
+	c.rateLimit.add(response)
+	if c.heatmap != nil {
+		c.heatmap.add(response.End, millis, response.Success)
+	}
+	if c.apdex != nil {
+		c.apdex.add(millis, response.Success)
+	}
+	if response.Compression != nil {
+		if c.compression == nil {
+			c.compression = &Compression{}
+		}
+		c.compression.add(response.Compression)
+	}
+	c.fairness.add(response.Worker)
+	if !response.Intended.IsZero() {
+		c.scheduling.add(float64(response.Fired.Sub(response.Intended)) / math.Pow10(6))
 	}
-	opt := Options{
-		Silent:   *silent,
-		Verbose:  *verbose,
-		Metrics:  *metrics,
-		Progress: *progress,
-		Timeout:  *timeout,
-		ApiKey:   *apikey,
+	if c.perTarget != nil {
+		c.perTarget.add(response.Target, millis, response.Success)
 	}
+	if c.perBackend != nil {
+		backend := response.Backend
+		if backend == "" {
+			backend = response.Target
+		}
+		c.perBackend.add(backend, millis, response.Success)
+	}
+	if response.Label != "" {
+		c.perRequest.add(response.Label, millis, response.Success)
+	}
+	if response.Host != "" {
+		c.perHost.add(response.Host, millis, response.Success)
+	}
+	if c.perWorker != nil {
+		c.perWorker.add(workerName(response.Worker), millis, response.Success)
+	}
+}
 
-	if *schedule == "" {
-		*schedule = fmt.Sprintf("%d@%d", *numRequests, *numClients)
+func (c *collector) summarize(totalSeconds float64, numClients int, numWorkers int) Summary {
+	summary := summarize(c.latencies, totalSeconds, c.percentiles)
+	summary.NumClients = numClients
+	summary.BytesSent = c.sent
+	summary.BytesReceived = c.received
+	summary.NumOversized = c.oversized
+	summary.Compression = c.compression
+	summary.Connections = c.connections.summarize()
+	summary.Caching = c.caching.summarize()
+	summary.Fuzzing = c.fuzzing.summarize()
+	summary.RateLimit = c.rateLimit.summarize(totalSeconds)
+	summary.CircuitOpened = c.tripped
+	summary.Concurrency = newConcurrency(c.busy, totalSeconds, summary.NumRequests, numClients)
+	if c.heatmap != nil {
+		summary.Heatmap = c.heatmap.summarize()
+	}
+	if c.apdex != nil {
+		summary.Apdex = c.apdex.summarize()
+	}
+	if c.jobs > 0 {
+		summary.AvgPolls = float64(c.polls) / float64(c.jobs)
+	}
+	if len(c.failures) > 0 {
+		summary.Failures = summarizeFailures(c.failures)
+		for i := range summary.Failures {
+			failure := &summary.Failures[i]
+			failure.RequestID = c.firstFailed[failure.Class]
+			stats := c.failedTimes[failure.Class].FailedStats()
+			failure.Median, failure.Max = Millis(stats.Median), Millis(stats.Max)
+		}
+		summary.TimeToError = newTimeToError(c.latencies)
+	}
+	if summary.NumRequests > 0 {
+		summary.AvgResponseBytes = float64(c.received) / float64(summary.NumRequests)
+	}
+	if totalSeconds > 0 {
+		summary.Throughput = float64(c.received) / totalSeconds / megabyte
+	}
+	if c.perTarget != nil {
+		summary.Targets = c.perTarget.summarize()
 	}
+	if c.perBackend != nil {
+		summary.Backends = c.perBackend.summarize()
+	}
+	if len(c.perRequest.names) > 0 {
+		summary.Requests = c.perRequest.summarize()
+	}
+	if len(c.perHost.names) > 0 {
+		summary.Hosts = c.perHost.summarize()
+	}
+	if c.perWorker != nil {
+		summary.Workers = summarizeWorkers(c.perWorker, numWorkers)
+	}
+	summary.Scheduling = c.scheduling.summarize()
+	if numWorkers > 1 {
+		fairness := c.fairness.analyze(numWorkers)
+		summary.Fairness = &fairness
+	}
+	return summary
+}
 
-	for _, milestone := range strings.Split(*schedule, ",") {
-		numRequests, err := strconv.Atoi(strings.Split(milestone, "@")[0])
-		panicIf(err)
-		task.NumRequests = numRequests
+// version is stamped by the release builds
+var version = "dev"
 
-		numClients, err := strconv.Atoi(strings.Split(milestone, "@")[1])
-		panicIf(err)
-		task.NumClients = numClients
+func versionCommand(args []string) int {
+	fmt.Printf("cannonade %s %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
+	return 0
+}
+
+var commands = map[string]func(args []string) int{
+	"attack":         attackCommand,
+	"compare":        compareCommand,
+	"probe":          probeCommand,
+	"report":         reportCommand,
+	"replay":         replayCommand,
+	"parallel":       parallelCommand,
+	"replay-log":     replayLogCommand,
+	"record":         recordCommand,
+	"retry-failures": retryFailuresCommand,
+	"serve":          serveCommand,
+	"serve-mock":     serveMockCommand,
+	"trend":          trendCommand,
+	"version":        versionCommand,
+}
 
-		runTask(&task, &opt)
+func main() {
+	command, args := "attack", os.Args[1:]
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			command, args = args[0], args[1:]
+		}
 	}
+	os.Exit(commands[command](args))
 }
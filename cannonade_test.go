@@ -0,0 +1,320 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		successes  []float64
+		fails      int
+		seconds    float64
+		avg        float64
+		rps        float64
+		successRPS float64
+	}{
+		{[]float64{10, 20, 30}, 0, 1, 20, 3, 3},
+		{[]float64{10, 20, 30}, 3, 2, 20, 3, 1.5},
+		{[]float64{}, 4, 2, math.NaN(), 2, 0},
+		{[]float64{10}, 0, 0, 10, 0, 0},
+	}
+	for i, test := range tests {
+		acc := latency.New()
+		for _, millis := range test.successes {
+			acc.Add(millis, true)
+		}
+		for f := 0; f < test.fails; f++ {
+			acc.Add(10000, false)
+		}
+		summary := summarize(acc, test.seconds, percentileSet{thresholds: []float64{50, 95}})
+		avg := float64(summary.Avg)
+		if avg != test.avg && !(math.IsNaN(avg) && math.IsNaN(test.avg)) {
+			t.Errorf("#%d: got avg %g, want %g", i, avg, test.avg)
+		}
+		if summary.RPS != test.rps || summary.SuccessRPS != test.successRPS {
+			t.Errorf("#%d: got %g and %g req/s, want %g and %g", i, summary.RPS, summary.SuccessRPS, test.rps, test.successRPS)
+		}
+		if summary.NumRequests != len(test.successes)+test.fails || summary.NumFails != test.fails {
+			t.Errorf("#%d: got %d requests and %d fails", i, summary.NumRequests, summary.NumFails)
+		}
+	}
+}
+
+func TestSummarizeEstimated(t *testing.T) {
+	acc := latency.NewLimited(10)
+	for i := 1; i <= 20; i++ {
+		acc.Add(float64(i)/10, true)
+	}
+	summary := summarize(acc, 1, percentileSet{thresholds: []float64{50}})
+	if !summary.Estimated || summary.NumRequests != 20 || summary.Median != 1.05 {
+		t.Errorf("got estimated %v, %d requests, median %g, want true, 20, 1.05", summary.Estimated,
+			summary.NumRequests, summary.Median)
+	}
+	var out bytes.Buffer
+	printStats(&out, &summary)
+	if !strings.Contains(out.String(), estimatedNote) {
+		t.Errorf("printStats() does not tell the percentiles are estimated:\n%s", out.String())
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			rgba.Set(x, y, color.RGBA{R: uint8(16 * x), G: uint8(16 * y), B: 128, A: 255})
+		}
+	}
+	var img image.Image = rgba
+
+	tests := []struct {
+		encoding Encoding
+		format   string
+	}{
+		{Encoding{Format: formatJPEG, Quality: 50}, "jpeg"},
+		{Encoding{Format: formatPNG}, "png"},
+	}
+	for _, test := range tests {
+		data, err := base64.StdEncoding.DecodeString(encodeImage(&img, test.encoding))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil || format != test.format || decoded.Bounds() != img.Bounds() {
+			t.Errorf("%+v: got %s of %v, %v", test.encoding, format, decoded, err)
+		}
+	}
+	// PNG is lossless, so the very same pixels come back
+	data, _ := base64.StdEncoding.DecodeString(encodeImage(&img, Encoding{Format: formatPNG}))
+	decoded, _, _ := image.Decode(bytes.NewReader(data))
+	if got := decoded.(*image.RGBA).Pix; !bytes.Equal(got, rgba.Pix) {
+		t.Errorf("png changed the pixels")
+	}
+}
+
+func TestMakeCannonball(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = uint8(i)
+	}
+	var img image.Image = rgba
+
+	tests := []struct {
+		batch    int
+		encoding Encoding
+	}{
+		{1, Encoding{Format: formatJPEG, Quality: 90}},
+		{3, Encoding{Format: formatJPEG, Quality: 90}},
+		{2, Encoding{Format: formatPNG}},
+	}
+	for _, test := range tests {
+		encoded := make([]string, test.batch)
+		for i := range encoded {
+			encoded[i] = encodeImage(&img, test.encoding)
+		}
+		req := Request{Image: encoded[0]}
+		if test.batch > 1 {
+			req = Request{Images: encoded}
+		}
+		want, _ := json.Marshal(&req)
+
+		body := makeCannonball(img, nil, test.batch, test.encoding).Body
+		if !bytes.Equal(body, want) {
+			t.Errorf("%d of %+v: got %.60q, want %.60q", test.batch, test.encoding, body, want)
+		}
+		if cap(body) != len(body) {
+			t.Errorf("%d of %+v: got %d bytes of room for a body of %d", test.batch, test.encoding, cap(body), len(body))
+		}
+	}
+}
+
+func TestCollectorFailedRequestIDs(t *testing.T) {
+	c := newCollector(false, false, false, percentileSet{thresholds: []float64{50}})
+	responses := []Response{
+		{Success: true, RequestID: "ok"},
+		{Class: classTimeout, RequestID: "first timeout"},
+		{Class: classTimeout, RequestID: "second timeout"},
+		{Class: "http 500"},
+		{Class: "http 500", RequestID: "first 500 with an id"},
+	}
+	for i := range responses {
+		c.add(&responses[i])
+	}
+	summary := c.summarize(1, 1, 1)
+	want := map[string]string{classTimeout: "first timeout", "http 500": "first 500 with an id"}
+	for _, failure := range summary.Failures {
+		if failure.RequestID != want[failure.Class] {
+			t.Errorf("%s: got request id %q, want %q", failure.Class, failure.RequestID, want[failure.Class])
+		}
+	}
+}
+
+func TestCollectorTimeToError(t *testing.T) {
+	c := newCollector(false, false, false, percentileSet{thresholds: []float64{50}})
+	responses := []Response{
+		{Success: true, Latency: 20 * time.Millisecond},
+		{Class: classTimeout, Latency: 10 * time.Second},
+		{Class: classTimeout, Latency: 10002 * time.Millisecond},
+		{Class: classRefused, Latency: time.Millisecond},
+	}
+	for i := range responses {
+		c.add(&responses[i])
+	}
+	summary := c.summarize(1, 1, 1)
+	want := map[string][2]Millis{classTimeout: {10001, 10002}, classRefused: {1, 1}}
+	for _, failure := range summary.Failures {
+		if got := [2]Millis{failure.Median, failure.Max}; got != want[failure.Class] {
+			t.Errorf("%s: got median and max %v, want %v", failure.Class, got, want[failure.Class])
+		}
+	}
+	// The failures stay out of the latencies but get a distribution of their own
+	if tte := summary.TimeToError; summary.Avg != 20 || tte == nil || tte.Median != 10000 || tte.Max != 10002 {
+		t.Errorf("got avg %g and time to error %+v, want 20 and a median of 10000", summary.Avg, tte)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	go func() {
+		w.Write([]byte("piped"))
+		w.Close()
+	}()
+
+	got, err := readInput(stdinPath)
+	if err != nil || string(got) != "piped" {
+		t.Errorf("got %q, %v from stdin", got, err)
+	}
+	if _, err := readInput("missing.file"); err == nil {
+		t.Errorf("got no error for a missing file")
+	}
+}
+
+func TestFireHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+
+	for _, host := range []string{"", "api.internal"} {
+		opt := &Options{Timeout: 1, Transport: &http.Transport{}, Host: host}
+		response := fire(server.URL, &Cannonball{Method: "GET"}, http.Header{"Host": {"ignored"}}, opt)
+		want := host
+		if want == "" {
+			want = strings.TrimPrefix(server.URL, "http://")
+		}
+		if got := string(response.raw); got != want {
+			t.Errorf("got host %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFireTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/late-headers" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path          string
+		timeout       float64
+		headerTimeout time.Duration
+		class         string
+	}{
+		{"/late-headers", 1, 50 * time.Millisecond, classHeaderTimeout},
+		{"/late-body", 1, 50 * time.Millisecond, ""},
+		{"/late-body", 0.05, 0, classTimeout},
+	}
+	for _, test := range tests {
+		opt := &Options{Timeout: test.timeout, Transport: &http.Transport{ResponseHeaderTimeout: test.headerTimeout}}
+		response := fire(server.URL+test.path, &Cannonball{Method: "GET"}, nil, opt)
+		if response.Class != test.class {
+			t.Errorf("%s with %v/%v: got class %q, want %q (%s)", test.path, test.timeout, test.headerTimeout,
+				response.Class, test.class, response.Body)
+		}
+	}
+}
+
+func TestFireMaxResponseBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 100)
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", "100")
+		}
+		w.Write([]byte(body))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		limit     int64
+		chunked   bool
+		oversized bool
+	}{
+		{0, false, false},
+		{100, false, false},
+		{99, false, true},
+		{100, true, false},
+		{99, true, true},
+	}
+	for _, test := range tests {
+		endpoint := server.URL
+		if test.chunked {
+			endpoint += "/?chunked=1"
+		}
+		opt := &Options{Timeout: 5, MaxResponseBytes: test.limit, Transport: newTransport(SocketOptions{NoDelay: true})}
+		response := fire(endpoint, &Cannonball{Method: "GET"}, nil, opt)
+		if response.Oversized != test.oversized || response.Success == test.oversized {
+			t.Errorf("limit %d, chunked %v: got oversized %v, success %v (%s)",
+				test.limit, test.chunked, response.Oversized, response.Success, response.Body)
+		}
+		if !test.oversized && len(response.raw) != 100 {
+			t.Errorf("limit %d, chunked %v: got %d bytes of the body", test.limit, test.chunked, len(response.raw))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// chunking : Sending the bodies without a length, in chunks of a size with a
+// pause before every one of them after the first
+type chunking struct {
+	size     int
+	interval time.Duration
+}
+
+func (c *chunking) String() string {
+	description := fmt.Sprintf("streamed in chunks of %s", formatBytes(float64(c.size)))
+	if c.interval > 0 {
+		description += fmt.Sprintf(" every %v", c.interval)
+	}
+	return description
+}
+
+// stream reads the body out a chunk at a time, the transport writes every
+// read as a chunk of its own and flushes it on the wire
+func (c *chunking) stream(ctx context.Context, body []byte) io.Reader {
+	return &chunkedReader{ctx: ctx, body: body, chunking: c}
+}
+
+// chunkedReader : A body handed out in chunks no larger than the size, the
+// reads a short buffer cuts a chunk into do not pause
+type chunkedReader struct {
+	*chunking
+	ctx  context.Context
+	body []byte
+	sent int
+	left int
+}
+
+func (r *chunkedReader) Read(b []byte) (int, error) {
+	if r.sent == len(r.body) {
+		return 0, io.EOF
+	}
+	if r.left == 0 {
+		if r.sent > 0 && r.interval > 0 {
+			timer := time.NewTimer(r.interval)
+			select {
+			case <-timer.C:
+			case <-r.ctx.Done():
+				timer.Stop()
+				return 0, r.ctx.Err()
+			}
+		}
+		r.left = r.size
+		if rest := len(r.body) - r.sent; r.left > rest {
+			r.left = rest
+		}
+	}
+	if len(b) > r.left {
+		b = b[:r.left]
+	}
+	n := copy(b, r.body[r.sent:])
+	r.sent += n
+	r.left -= n
+	return n, nil
+}
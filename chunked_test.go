@@ -0,0 +1,122 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChunkedReader(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 25)
+	tests := []struct {
+		size   int
+		buffer int
+		reads  []int
+	}{
+		{size: 100, buffer: 1024, reads: []int{100, 100, 50}},
+		{size: 100, buffer: 60, reads: []int{60, 40, 60, 40, 50}},
+		{size: 1000, buffer: 1024, reads: []int{250}},
+	}
+	for _, test := range tests {
+		reader := (&chunking{size: test.size}).stream(context.Background(), body)
+		var reads []int
+		var streamed []byte
+		buf := make([]byte, test.buffer)
+		for {
+			n, err := reader.Read(buf)
+			if err == io.EOF {
+				break
+			}
+			reads = append(reads, n)
+			streamed = append(streamed, buf[:n]...)
+		}
+		if !reflect.DeepEqual(reads, test.reads) || !bytes.Equal(streamed, body) {
+			t.Errorf("%d byte chunks read into %d bytes: got %v, want %v", test.size, test.buffer, reads, test.reads)
+		}
+	}
+
+	// Only the start of a chunk waits
+	start := time.Now()
+	reader := (&chunking{size: 100, interval: 30 * time.Millisecond}).stream(context.Background(), body)
+	if _, err := io.CopyBuffer(ioutil.Discard, struct{ io.Reader }{reader}, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("streamed 3 chunks in %v, want 2 pauses of 30ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader = (&chunking{size: 100, interval: time.Second}).stream(ctx, body)
+	if _, err := ioutil.ReadAll(reader); err != context.Canceled {
+		t.Errorf("got %v, want the cancellation of the context", err)
+	}
+}
+
+func TestFireChunked(t *testing.T) {
+	type upload struct {
+		length   int64
+		encoding []string
+		body     []byte
+	}
+	uploads := make(chan upload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		uploads <- upload{r.ContentLength, r.TransferEncoding, body}
+	}))
+	defer server.Close()
+
+	body := bytes.Repeat([]byte("a"), 5000)
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true}),
+		Chunked: &chunking{size: 1000, interval: 20 * time.Millisecond}}
+	start := time.Now()
+	response := fire(server.URL, &Cannonball{Method: "POST", Body: body}, nil, opt)
+	if elapsed := time.Since(start); !response.Success || elapsed < 80*time.Millisecond {
+		t.Errorf("got %d %q in %v, want a success after 4 pauses", response.Status, response.Body, elapsed)
+	}
+	got := <-uploads
+	if got.length != -1 || !reflect.DeepEqual(got.encoding, []string{"chunked"}) || !bytes.Equal(got.body, body) {
+		t.Errorf("got %d bytes of length %d encoded with %v", len(got.body), got.length, got.encoding)
+	}
+
+	// The requests without a body are left alone
+	response = fire(server.URL, &Cannonball{Method: "GET"}, nil, opt)
+	if got := <-uploads; !response.Success || got.length != 0 || got.encoding != nil {
+		t.Errorf("got length %d encoded with %v for a GET", got.length, got.encoding)
+	}
+}
+
+func TestChunkingString(t *testing.T) {
+	if got := (&chunking{size: 16384, interval: 50 * time.Millisecond}).String(); got != "streamed in chunks of 16.0 KB every 50ms" {
+		t.Errorf("got %q", got)
+	}
+	if got := (&chunking{size: 512}).String(); got != "streamed in chunks of 512 B" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+)
+
+// defaultRegression is the change in percent a metric may make for the worse
+const defaultRegression = 10.0
+
+// Delta : The change of a metric of a task from the baseline to the current run
+type Delta struct {
+	Task      string
+	Metric    string
+	Baseline  float64
+	Current   float64
+	Change    float64 // in percent of the baseline, NaN when there is nothing to compare with
+	Regressed bool
+}
+
+func readReport(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	if len(report.Tasks) == 0 {
+		return nil, fmt.Errorf("%s has no tasks, it should be a json report", path)
+	}
+	return &report, nil
+}
+
+// change is the difference of the current value from the baseline in percent
+func change(baseline float64, current float64) float64 {
+	if baseline == 0 || math.IsNaN(baseline) || math.IsNaN(current) {
+		return math.NaN()
+	}
+	return (current - baseline) / baseline * 100
+}
+
+// compareSummaries finds the deltas of the rate, the apdex and the percentiles
+// the runs have in common, the rate and the apdex regress by going down and the
+// latencies by going up
+func compareSummaries(task string, baseline *Summary, current *Summary, threshold float64) []Delta {
+	rps := Delta{Task: task, Metric: "req/s", Baseline: baseline.RPS, Current: current.RPS,
+		Change: change(baseline.RPS, current.RPS)}
+	rps.Regressed = rps.Change < -threshold
+	deltas := []Delta{rps}
+	if baseline.Apdex != nil && current.Apdex != nil {
+		score := Delta{Task: task, Metric: "apdex", Baseline: baseline.Apdex.Score, Current: current.Apdex.Score,
+			Change: change(baseline.Apdex.Score, current.Apdex.Score)}
+		score.Regressed = score.Change < -threshold
+		deltas = append(deltas, score)
+	}
+	for _, percentile := range baseline.Percentiles {
+		value := summaryPercentile(current, percentile.Threshold)
+		if math.IsNaN(float64(value)) && math.IsNaN(float64(percentile.Value)) {
+			continue
+		}
+		delta := Delta{Task: task, Metric: "p" + formatThreshold(percentile.Threshold),
+			Baseline: float64(percentile.Value), Current: float64(value)}
+		delta.Change = change(delta.Baseline, delta.Current)
+		delta.Regressed = delta.Change > threshold
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+// compareReports pairs the tasks of the runs up in order, along with the overall
+// stats of the schedules when both have them
+func compareReports(baseline *Report, current *Report, threshold float64) []Delta {
+	var deltas []Delta
+	for i := 0; i < len(baseline.Tasks) && i < len(current.Tasks); i++ {
+		task := fmt.Sprintf("%d %s", i+1, phaseName(&current.Tasks[i]))
+		deltas = append(deltas, compareSummaries(task, &baseline.Tasks[i], &current.Tasks[i], threshold)...)
+	}
+	if baseline.Overall != nil && current.Overall != nil {
+		deltas = append(deltas, compareSummaries("Overall", baseline.Overall, current.Overall, threshold)...)
+	}
+	return deltas
+}
+
+func printDeltas(w io.Writer, deltas []Delta) {
+	fmt.Fprintf(w, "\n %-14s %-8s %10s %10s %9s  \n", "Task", "Metric", "Baseline", "Current", "Delta")
+	fmt.Fprintln(w, strings.Repeat("-", 58))
+	for _, delta := range deltas {
+		changed := "-"
+		if !math.IsNaN(delta.Change) {
+			changed = fmt.Sprintf("%+.1f%%", delta.Change)
+		}
+		fmt.Fprintf(w, " %-14s %-8s %10.2f %10.2f %9s", delta.Task, delta.Metric, delta.Baseline, delta.Current, changed)
+		if delta.Regressed {
+			fmt.Fprint(w, "  regression")
+		}
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprint(w, "\n")
+}
+
+func compareCommand(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	threshold := fs.Float64("threshold", defaultRegression,
+		"percent the rps may drop or a percentile may grow by before it counts as a regression")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade compare [options...] <baseline.json> <current.json>\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() != 2 {
+		fmt.Println("Provide a baseline and a current json report to compare!")
+		return 1
+	}
+
+	baseline, err := readReport(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed reading the baseline: %s\n", err)
+		return 1
+	}
+	current, err := readReport(fs.Arg(1))
+	if err != nil {
+		fmt.Printf("Failed reading the current report: %s\n", err)
+		return 1
+	}
+	if len(baseline.Tasks) != len(current.Tasks) {
+		compared := len(baseline.Tasks)
+		if len(current.Tasks) < compared {
+			compared = len(current.Tasks)
+		}
+		fmt.Printf("Runs have %d and %d tasks, only the first %d are compared\n",
+			len(baseline.Tasks), len(current.Tasks), compared)
+	}
+
+	deltas := compareReports(baseline, current, *threshold)
+	printDeltas(os.Stdout, deltas)
+	regressions := 0
+	for _, delta := range deltas {
+		if delta.Regressed {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		fmt.Printf("%d metrics regressed by more than %.1f%%\n", regressions, *threshold)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func summaryOf(rps float64, p50 float64, p99 float64) Summary {
+	return Summary{NumRequests: 100, NumClients: 4, RPS: rps,
+		Percentiles: []Percentile{{Threshold: 50, Value: Millis(p50)}, {Threshold: 99, Value: Millis(p99)}}}
+}
+
+func TestCompareSummaries(t *testing.T) {
+	tests := []struct {
+		baseline, current Summary
+		regressed         []string
+	}{
+		{summaryOf(100, 10, 20), summaryOf(100, 10, 20), nil},
+		{summaryOf(100, 10, 20), summaryOf(95, 10.5, 21), nil},
+		{summaryOf(100, 10, 20), summaryOf(80, 10, 20), []string{"req/s"}},
+		{summaryOf(100, 10, 20), summaryOf(100, 10, 25), []string{"p99"}},
+		{summaryOf(100, 10, 20), summaryOf(150, 5, 10), nil},
+		{summaryOf(0, math.NaN(), math.NaN()), summaryOf(100, 10, 20), nil},
+	}
+	for i, test := range tests {
+		var regressed []string
+		for _, delta := range compareSummaries("1 100@4", &test.baseline, &test.current, 10) {
+			if delta.Regressed {
+				regressed = append(regressed, delta.Metric)
+			}
+		}
+		if len(regressed) != len(test.regressed) {
+			t.Errorf("case %d: regressed %v, want %v", i, regressed, test.regressed)
+			continue
+		}
+		for j := range regressed {
+			if regressed[j] != test.regressed[j] {
+				t.Errorf("case %d: regressed %v, want %v", i, regressed, test.regressed)
+			}
+		}
+	}
+}
+
+func TestCompareApdex(t *testing.T) {
+	baseline, current := summaryOf(100, 10, 20), summaryOf(100, 10, 20)
+	baseline.Apdex, current.Apdex = &Apdex{Score: 0.95}, &Apdex{Score: 0.8}
+	deltas := compareSummaries("1 100@4", &baseline, &current, 10)
+	if len(deltas) != 4 || deltas[1].Metric != "apdex" || !deltas[1].Regressed || deltas[0].Regressed {
+		t.Errorf("got deltas %+v, want the apdex regressed alone", deltas)
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	baseline := &Report{Tasks: []Summary{summaryOf(100, 10, 20), summaryOf(200, 12, 30)}}
+	current := &Report{Tasks: []Summary{summaryOf(100, 10, 20)}}
+	deltas := compareReports(baseline, current, 10)
+	if len(deltas) != 3 {
+		t.Fatalf("compared %d metrics, want 3 of the only common task", len(deltas))
+	}
+	if deltas[0].Task != "1 100@4" || deltas[1].Metric != "p50" || deltas[2].Metric != "p99" {
+		t.Errorf("unexpected deltas %+v", deltas)
+	}
+
+	overall := summaryOf(150, 11, 25)
+	baseline.Overall, current.Overall = &overall, &overall
+	if deltas = compareReports(baseline, current, 10); deltas[len(deltas)-1].Task != "Overall" {
+		t.Errorf("overall stats are not compared: %+v", deltas)
+	}
+}
+
+func TestMillisRoundTrip(t *testing.T) {
+	data, err := json.Marshal([]Millis{Millis(math.NaN()), 12.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []Millis
+	if err := json.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(float64(values[0])) || values[1] != 12.5 {
+		t.Errorf("read %s back as %v", data, values)
+	}
+}
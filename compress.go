@@ -0,0 +1,163 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is advertised instead of the transparent gzip of the transport
+const acceptEncoding = "zstd, gzip"
+
+// errTooLarge tells that a decompressed body went over the response size limit
+var errTooLarge = fmt.Errorf("decompressed body is over the limit")
+
+// Compression : Body sizes of the requests sent and the responses received
+// compressed, along with the sizes they had before and after the transfer
+type Compression struct {
+	Sent        int64 `json:"sent"`
+	SentRaw     int64 `json:"sent_raw"`
+	Received    int64 `json:"received"`
+	ReceivedRaw int64 `json:"received_raw"`
+}
+
+func (c *Compression) add(other *Compression) {
+	c.Sent += other.Sent
+	c.SentRaw += other.SentRaw
+	c.Received += other.Received
+	c.ReceivedRaw += other.ReceivedRaw
+}
+
+// codec : Compresses the request bodies with one content encoding and
+// decompresses the responses in any of the advertised ones
+type codec struct {
+	name    string
+	limit   int64
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// newCodec prepares the encoding, the limit caps the decompressed response sizes
+func newCodec(name string, limit int64) (*codec, error) {
+	if name != "gzip" && name != "zstd" {
+		return nil, fmt.Errorf("unknown compression %q (gzip, zstd)", name)
+	}
+	c := &codec{name: name, limit: limit}
+	var err error
+	if name == "zstd" {
+		c.encoder, err = zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	options := make([]zstd.DOption, 0)
+	if limit > 0 {
+		options = append(options, zstd.WithDecoderMaxMemory(uint64(limit)))
+	}
+	c.decoder, err = zstd.NewReader(nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// compress makes a copy of the cannonball with its body compressed, the ones
+// without a body or with an encoding of their own are left as they are
+func (c *codec) compress(ball *Cannonball) *Cannonball {
+	if len(ball.Body) == 0 || ball.Header.Get("Content-Encoding") != "" {
+		return ball
+	}
+	compressed := *ball
+	compressed.Header = ball.Header.Clone()
+	if compressed.Header == nil {
+		compressed.Header = make(http.Header)
+	}
+	compressed.Header.Set("Content-Encoding", c.name)
+	compressed.RawSize = len(ball.Body)
+	switch c.name {
+	case "zstd":
+		compressed.Body = c.encoder.EncodeAll(ball.Body, nil)
+	default:
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		_, err := w.Write(ball.Body)
+		panicIf(err)
+		panicIf(w.Close())
+		compressed.Body = buf.Bytes()
+	}
+	return &compressed
+}
+
+// decompress decodes the response body by its content encoding
+func (c *codec) decompress(encoding string, body []byte) ([]byte, error) {
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "zstd":
+		decoded, err := c.decoder.DecodeAll(body, nil)
+		// the decoder refuses the frames with a window over the limit up front
+		if err == zstd.ErrDecoderSizeExceeded || err == zstd.ErrWindowSizeExceeded {
+			return nil, errTooLarge
+		}
+		return decoded, err
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		var decoded io.Reader = r
+		if c.limit > 0 {
+			decoded = io.LimitReader(r, c.limit+1)
+		}
+		raw, err := ioutil.ReadAll(decoded)
+		if err == nil && c.limit > 0 && int64(len(raw)) > c.limit {
+			return nil, errTooLarge
+		}
+		return raw, err
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// describeCompression tells the compressed sizes against the original ones
+func describeCompression(c *Compression) string {
+	parts := make([]string, 0, 2)
+	if c.SentRaw > 0 {
+		parts = append(parts, fmt.Sprintf("sent %s of %s (%.1fx)", formatBytes(float64(c.Sent)),
+			formatBytes(float64(c.SentRaw)), float64(c.SentRaw)/float64(c.Sent)))
+	}
+	if c.ReceivedRaw > 0 {
+		parts = append(parts, fmt.Sprintf("received %s of %s (%.1fx)", formatBytes(float64(c.Received)),
+			formatBytes(float64(c.ReceivedRaw)), float64(c.ReceivedRaw)/float64(c.Received)))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCodecRoundtrip(t *testing.T) {
+	body := []byte(strings.Repeat(`{"image": "cannonball"}`, 100))
+	tests := []struct {
+		name    string
+		limit   int64
+		tooLong bool
+	}{
+		{"gzip", 0, false},
+		{"gzip", int64(len(body)), false},
+		{"gzip", int64(len(body)) - 1, true},
+		{"zstd", 0, false},
+		{"zstd", int64(len(body)), false},
+		{"zstd", int64(len(body)) - 1, true},
+	}
+	for _, test := range tests {
+		c, err := newCodec(test.name, test.limit)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		ball := &Cannonball{Method: "POST", Header: http.Header{"Content-Type": {"application/json"}}, Body: body}
+		compressed := c.compress(ball)
+		if compressed == ball || ball.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s: the original cannonball got changed", test.name)
+		}
+		if compressed.Header.Get("Content-Encoding") != test.name || compressed.RawSize != len(body) {
+			t.Errorf("%s: got encoding %q and raw size %d", test.name, compressed.Header.Get("Content-Encoding"), compressed.RawSize)
+		}
+		if len(compressed.Body) >= len(body) {
+			t.Errorf("%s: got %d bytes compressed out of %d", test.name, len(compressed.Body), len(body))
+		}
+		decoded, err := c.decompress(test.name, compressed.Body)
+		if test.tooLong {
+			if err != errTooLarge {
+				t.Errorf("%s, limit %d: got error %v, want %v", test.name, test.limit, err, errTooLarge)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(decoded, body) {
+			t.Errorf("%s, limit %d: got %d bytes back (%v)", test.name, test.limit, len(decoded), err)
+		}
+	}
+}
+
+func TestCodecSkips(t *testing.T) {
+	c, err := newCodec("gzip", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balls := []*Cannonball{
+		{Method: "GET"},
+		{Method: "POST", Header: http.Header{"Content-Encoding": {"br"}}, Body: []byte("already")},
+	}
+	for i, ball := range balls {
+		if c.compress(ball) != ball {
+			t.Errorf("#%d: got the cannonball compressed", i)
+		}
+	}
+	if _, err := newCodec("br", 0); err == nil {
+		t.Errorf("got no error for an unknown compression")
+	}
+	if _, err := c.decompress("br", []byte("already")); err == nil {
+		t.Errorf("got no error for an unsupported content encoding")
+	}
+}
+
+func TestFireCompressed(t *testing.T) {
+	reply := []byte(strings.Repeat(`{"ok": true}`, 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err == nil {
+				body, err = ioutil.ReadAll(zr)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		case "zstd":
+			zr, _ := zstd.NewReader(r.Body)
+			defer zr.Close()
+			var err error
+			if body, err = ioutil.ReadAll(zr); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if string(body) != `{"image": "cannonball"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		accepted := r.Header.Get("Accept-Encoding")
+		switch {
+		case strings.Contains(accepted, "zstd"):
+			w.Header().Set("Content-Encoding", "zstd")
+			zw, _ := zstd.NewWriter(w)
+			zw.Write(reply)
+			zw.Close()
+		case strings.Contains(accepted, "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			zw.Write(reply)
+			zw.Close()
+		default:
+			w.Write(reply)
+		}
+	}))
+	defer server.Close()
+
+	for _, name := range []string{"gzip", "zstd"} {
+		c, err := newCodec(name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opt := &Options{Timeout: 5, Compress: c, Transport: newTransport(SocketOptions{NoDelay: true})}
+		ball := c.compress(&Cannonball{Method: "POST", Body: []byte(`{"image": "cannonball"}`)})
+		response := fire(server.URL, ball, nil, opt)
+		decode(&response, opt)
+		if !response.Success || response.Body != string(reply) {
+			t.Errorf("%s: got status %d and %d bytes of the body", name, response.Status, len(response.Body))
+			continue
+		}
+		compression := response.Compression
+		if compression == nil || compression.SentRaw != int64(len(`{"image": "cannonball"}`)) ||
+			compression.ReceivedRaw != int64(len(reply)) || compression.Received >= compression.ReceivedRaw {
+			t.Errorf("%s: got compression %+v", name, compression)
+		}
+	}
+}
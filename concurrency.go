@@ -0,0 +1,75 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+)
+
+// The shares of the clients busy on average past which a task counts as bound
+// by the latency of the target, or under which as bound by the clients
+const (
+	targetBound = 0.9
+	clientBound = 0.5
+)
+
+// Concurrency : Mean number of the requests in flight by Little's law, the
+// time spent in the requests over the duration of the task, next to the
+// clients which could have had them in flight
+type Concurrency struct {
+	Mean        float64 `json:"mean"`
+	Clients     int     `json:"clients"`
+	Utilization float64 `json:"utilization"`
+	Bound       string  `json:"bound,omitempty"` // target or client
+	CappedRPS   float64 `json:"capped_rps,omitempty"`
+}
+
+// newConcurrency tells whether the clients were busy waiting on the target all
+// along, so that the latency capped the rate of the closed model at the clients
+// over the latency, or idle for the most part, so that the rate was set by the
+// pacing or the client side rather than by the target
+func newConcurrency(busySeconds float64, totalSeconds float64, numRequests int, numClients int) *Concurrency {
+	if totalSeconds <= 0 || numRequests == 0 || numClients <= 0 {
+		return nil
+	}
+	c := &Concurrency{Mean: busySeconds / totalSeconds, Clients: numClients}
+	c.Utilization = c.Mean / float64(numClients)
+	switch {
+	case c.Utilization >= targetBound:
+		c.Bound = "target"
+		c.CappedRPS = float64(numClients) / (busySeconds / float64(numRequests))
+	case c.Utilization <= clientBound:
+		c.Bound = "client"
+	}
+	return c
+}
+
+func describeConcurrency(c *Concurrency) string {
+	description := fmt.Sprintf("%.2f requests in flight on average out of %d clients (%.0f%%)",
+		c.Mean, c.Clients, 100*c.Utilization)
+	switch c.Bound {
+	case "target":
+		description += fmt.Sprintf(", the latency capped the rate at %.2f req/s", c.CappedRPS)
+	case "client":
+		description += ", the clients were idle for the most part, the rate was set by the pacing or the client side"
+	}
+	return description
+}
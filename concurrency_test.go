@@ -0,0 +1,64 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewConcurrency(t *testing.T) {
+	tests := []struct {
+		busy, seconds float64
+		requests      int
+		clients       int
+		mean          float64
+		bound         string
+		capped        float64
+	}{
+		// 8 clients busy for 9.5 of 10 seconds with 10 ms requests
+		{76, 10, 7600, 8, 7.6, "target", 800},
+		{48, 10, 4800, 8, 4.8, "", 0},
+		{4, 10, 400, 8, 0.4, "client", 0},
+		{0, 0, 0, 8, 0, "", 0},
+	}
+	for i, test := range tests {
+		c := newConcurrency(test.busy, test.seconds, test.requests, test.clients)
+		if test.requests == 0 {
+			if c != nil {
+				t.Errorf("#%d: got %+v without requests", i, c)
+			}
+			continue
+		}
+		if c.Mean != test.mean || c.Bound != test.bound || c.CappedRPS != test.capped {
+			t.Errorf("#%d: got mean %g, bound %q, capped at %g, want %g, %q, %g", i, c.Mean, c.Bound, c.CappedRPS,
+				test.mean, test.bound, test.capped)
+		}
+	}
+}
+
+func TestDescribeConcurrency(t *testing.T) {
+	c := newConcurrency(76, 10, 7600, 8)
+	if got := describeConcurrency(c); !strings.HasPrefix(got, "7.60 requests in flight on average out of 8 clients (95%)") ||
+		!strings.Contains(got, "capped the rate at 800.00 req/s") {
+		t.Errorf("describeConcurrency() = %q", got)
+	}
+}
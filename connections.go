@@ -0,0 +1,85 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// Connections : How the requests got their connections, to tell whether
+// keep-alive holds up, and how long the host lookups took
+type Connections struct {
+	Reused  int    `json:"reused"`
+	Opened  int    `json:"opened"`
+	Lookups int    `json:"lookups"`
+	DNSAvg  Millis `json:"dns_avg,omitempty"`
+	DNSMax  Millis `json:"dns_max,omitempty"`
+}
+
+// connectionStats : Accumulates the connections of the requests of a task
+type connectionStats struct {
+	reused int
+	opened int
+	dns    *latency.Accumulator
+}
+
+func newConnectionStats() *connectionStats {
+	return &connectionStats{dns: latency.New()}
+}
+
+func (s *connectionStats) add(timing *Timing) {
+	if timing.Connected {
+		if timing.Reused {
+			s.reused++
+		} else {
+			s.opened++
+		}
+	}
+	if timing.Lookup {
+		s.dns.Add(float64(timing.DNS)/float64(time.Millisecond), true)
+	}
+}
+
+// summarize is nil unless a single request went through a traced connection
+func (s *connectionStats) summarize() *Connections {
+	if s.reused+s.opened == 0 && s.dns.Count() == 0 {
+		return nil
+	}
+	connections := &Connections{Reused: s.reused, Opened: s.opened, Lookups: s.dns.Count()}
+	if connections.Lookups > 0 {
+		stats := s.dns.Stats()
+		connections.DNSAvg, connections.DNSMax = Millis(stats.Mean), Millis(stats.Max)
+	}
+	return connections
+}
+
+// describeConnections tells the share of the reused connections and the lookups
+func describeConnections(c *Connections) string {
+	description := fmt.Sprintf("%d of %d requests reused a connection, %d opened a new one", c.Reused, c.Reused+c.Opened, c.Opened)
+	if c.Lookups > 0 {
+		return fmt.Sprintf("%s, %d DNS lookups taking %.2f ms on average (max %.2f)",
+			description, c.Lookups, c.DNSAvg, c.DNSMax)
+	}
+	return description + ", no DNS lookups"
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestConnectionStats(t *testing.T) {
+	stats := newConnectionStats()
+	if stats.summarize() != nil {
+		t.Errorf("got connections without any request")
+	}
+	timings := []Timing{
+		{Connected: true, Lookup: true, DNS: 2 * time.Millisecond},
+		{Connected: true, Reused: true},
+		{Connected: true, Reused: true},
+		{Lookup: true, DNS: 4 * time.Millisecond},
+		{},
+	}
+	for i := range timings {
+		stats.add(&timings[i])
+	}
+	got := *stats.summarize()
+	want := Connections{Reused: 2, Opened: 1, Lookups: 2, DNSAvg: 3, DNSMax: 4}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	description := "2 of 3 requests reused a connection, 1 opened a new one, 2 DNS lookups taking 3.00 ms on average (max 4.00)"
+	if got := describeConnections(&got); got != description {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFireConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	endpoints := []string{"http://localhost:" + u.Port(), server.URL}
+
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true})}
+	stats := newConnectionStats()
+	for _, endpoint := range endpoints {
+		for i := 0; i < 3; i++ {
+			response := fire(endpoint, &Cannonball{Method: "GET"}, nil, opt)
+			if !response.Success {
+				t.Fatalf("%s: %s", endpoint, response.Body)
+			}
+			stats.add(&response.Timing)
+		}
+	}
+	// The hosts differ, so each one opens a connection of its own and only looks up localhost
+	got := stats.summarize()
+	if got.Opened != 2 || got.Reused != 4 || got.Lookups != 1 {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/progressbar/v2"
+)
+
+// Levels of the console lines, the warnings and the errors go to stderr
+const (
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+// console : The live output of a task, either for a terminal or as logfmt
+// lines of key=value pairs for the CI logs to grep, the lines of a named
+// task are tagged with its name to tell the parallel ones apart
+type console struct {
+	name     string
+	out      io.Writer
+	err      io.Writer
+	silent   bool
+	verbose  bool
+	progress bool
+	windows  bool
+	ci       bool
+	sample   int
+	maxBody  int
+	rnd      *rand.Rand
+	task     int
+	bar      *progressbar.ProgressBar
+}
+
+func newConsole(opt *Options, taskIndex int) *console {
+	return &console{
+		name:     opt.Name,
+		out:      os.Stdout,
+		err:      os.Stderr,
+		silent:   opt.Silent,
+		verbose:  opt.Verbose,
+		progress: opt.Progress && !opt.CI,
+		windows:  opt.PrintWindows,
+		ci:       opt.CI,
+		sample:   opt.SampleResponses,
+		maxBody:  opt.MaxBodyPrint,
+		rnd:      opt.Random.stream(streamConsole + int64(taskIndex)),
+		task:     taskIndex + 1,
+	}
+}
+
+// logLine writes a logfmt line, the fields come as key, value pairs
+func logLine(w io.Writer, level string, event string, fields ...interface{}) {
+	var line strings.Builder
+	line.WriteString("level=" + level + " event=" + event)
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := ""
+		switch v := fields[i+1].(type) {
+		case string:
+			value = v
+			if value == "" || strings.ContainsAny(value, " \"=") {
+				value = strconv.Quote(value)
+			}
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case Millis:
+			value = strconv.FormatFloat(float64(v), 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+		fmt.Fprintf(&line, " %s=%s", fields[i], value)
+	}
+	fmt.Fprintln(w, line.String())
+}
+
+// start opens the progress bar of the task, or tells the task started
+func (c *console) start(task *Task, payload string) {
+	if c.silent {
+		return
+	}
+	if c.ci {
+		logLine(c.out, levelInfo, "start", c.tag("task", c.task, "phase", fmt.Sprintf("%d@%d", task.NumRequests, task.NumClients),
+			"payload", payload)...)
+		return
+	}
+	if c.progress {
+		c.bar = progressbar.New(task.NumRequests)
+		panicIf(c.bar.RenderBlank())
+		fmt.Fprint(c.out, "\r")
+	}
+}
+
+func (c *console) window(window *Window) {
+	if c.silent || c.verbose || !c.windows {
+		return
+	}
+	if c.ci {
+		logLine(c.out, levelInfo, "window", c.tag("task", c.task, "elapsed", round(window.Elapsed, 3),
+			"requests", window.NumRequests, "fails", window.NumFails, "rps", round(window.RPS, 2),
+			"p95", window.P95, "error_rate", round(window.ErrorRate, 4))...)
+		return
+	}
+	if c.bar != nil {
+		fmt.Fprint(c.out, "\r")
+	}
+	// The line goes out in a single write not to tear among the ones of the other tasks
+	var line bytes.Buffer
+	if c.name != "" {
+		fmt.Fprintf(&line, "%s ", c.name)
+	}
+	printWindow(&line, window)
+	_, err := line.WriteTo(c.out)
+	panicIf(err)
+}
+
+// response prints the body in the verbose mode and moves the progress bar on,
+// the failures are always printed in full after their request id, the
+// successes may be sampled and cut
+func (c *console) response(response *Response, description string) {
+	if c.silent {
+		return
+	}
+	if c.verbose && (!response.Success || c.sample <= 1 || c.rnd.Intn(c.sample) == 0) {
+		body := response.Body
+		if response.Success && c.maxBody > 0 {
+			body = previewBody([]byte(body), c.maxBody)
+		}
+		if !response.Success && response.RequestID != "" {
+			body = response.RequestID + " " + body
+		}
+		_, err := fmt.Fprintln(c.out, body)
+		panicIf(err)
+	}
+	if c.bar != nil {
+		if description != "" {
+			c.bar.Describe(description)
+		}
+		panicIf(c.bar.Add(1))
+	}
+}
+
+// finish closes the progress bar, or tells the task is done and how it went
+func (c *console) finish(summary *Summary) {
+	if c.silent {
+		return
+	}
+	if c.ci {
+		logLine(c.out, levelInfo, "done", c.tag("task", c.task, "requests", summary.NumRequests, "fails", summary.NumFails,
+			"seconds", round(summary.Seconds, 3), "rps", round(summary.RPS, 2), "ok_rps", round(summary.SuccessRPS, 2),
+			"avg", summary.Avg, "p50", summaryPercentile(summary, 50), "p95", summaryPercentile(summary, 95),
+			"p99", summaryPercentile(summary, 99))...)
+		return
+	}
+	if c.progress {
+		fmt.Fprintln(c.out)
+	}
+}
+
+// warn points out something off which does not stop the run
+func (c *console) warn(message string) {
+	if c.ci {
+		logLine(c.err, levelWarn, "warning", c.tag("msg", message)...)
+		return
+	}
+	if c.name != "" {
+		message = c.name + ": " + message
+	}
+	fmt.Fprintf(c.err, "Warning: %s\n", message)
+}
+
+// fail reports an error which does not stop the run
+func (c *console) fail(message string, err error) {
+	if c.ci {
+		logLine(c.err, levelError, "error", c.tag("msg", message, "err", err.Error())...)
+		return
+	}
+	if c.name != "" {
+		message = c.name + ": " + message
+	}
+	fmt.Fprintf(c.err, "%s: %s\n", message, err)
+}
+
+// tag puts the name of the task in front of the fields of a logfmt line
+func (c *console) tag(fields ...interface{}) []interface{} {
+	if c.name == "" {
+		return fields
+	}
+	return append([]interface{}{"name", c.name}, fields...)
+}
+
+// round keeps the given number of digits past the point
+func round(value float64, digits int) float64 {
+	scale := math.Pow10(digits)
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLogLine(t *testing.T) {
+	tests := []struct {
+		fields []interface{}
+		want   string
+	}{
+		{nil, "level=info event=start\n"},
+		{[]interface{}{"task", 1, "rps", 12.5}, "level=info event=start task=1 rps=12.5\n"},
+		{[]interface{}{"p95", Millis(24.017)}, "level=info event=start p95=24.017\n"},
+		{[]interface{}{"payload", ""}, "level=info event=start payload=\"\"\n"},
+		{[]interface{}{"msg", "too many files"}, "level=info event=start msg=\"too many files\"\n"},
+		{[]interface{}{"phase", "a=b"}, "level=info event=start phase=\"a=b\"\n"},
+		{[]interface{}{"task", 1, "dangling"}, "level=info event=start task=1\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		logLine(&out, levelInfo, "start", test.fields...)
+		if out.String() != test.want {
+			t.Errorf("logLine(%v) = %q, want %q", test.fields, out.String(), test.want)
+		}
+	}
+}
+
+func TestConsoleCI(t *testing.T) {
+	var out, errs bytes.Buffer
+	live := &console{out: &out, err: &errs, windows: true, ci: true, task: 2}
+	live.start(&Task{NumRequests: 100, NumClients: 4}, "noisy 640x480")
+	live.window(&Window{Elapsed: 1.0004, NumRequests: 50, NumFails: 1, RPS: 49.987, P95: 12, ErrorRate: 0.02})
+	live.response(&Response{Body: "ok"}, "")
+	live.warn("raise the open files limit")
+	live.fail("Failed to save", errors.New("disk full"))
+
+	want := "level=info event=start task=2 phase=100@4 payload=\"noisy 640x480\"\n" +
+		"level=info event=window task=2 elapsed=1 requests=50 fails=1 rps=49.99 p95=12 error_rate=0.02\n"
+	if out.String() != want {
+		t.Errorf("console output = %q, want %q", out.String(), want)
+	}
+	wantErrs := "level=warn event=warning msg=\"raise the open files limit\"\n" +
+		"level=error event=error msg=\"Failed to save\" err=\"disk full\"\n"
+	if errs.String() != wantErrs {
+		t.Errorf("console errors = %q, want %q", errs.String(), wantErrs)
+	}
+}
+
+func TestConsoleNamed(t *testing.T) {
+	var out, errs bytes.Buffer
+	live := &console{name: "health", out: &out, err: &errs, windows: true}
+	live.window(&Window{Elapsed: 1, NumRequests: 50, RPS: 50, P95: 12})
+	live.warn("raise the open files limit")
+	if want := "health [    1.0s]      50 reqs    50.00 req/s   p95     12 ms   errors   0.0%\n"; out.String() != want {
+		t.Errorf("console output = %q, want %q", out.String(), want)
+	}
+	if want := "Warning: health: raise the open files limit\n"; errs.String() != want {
+		t.Errorf("console errors = %q, want %q", errs.String(), want)
+	}
+
+	out.Reset()
+	live.ci = true
+	live.start(&Task{NumRequests: 10, NumClients: 1}, "")
+	if want := "level=info event=start name=health task=0 phase=10@1 payload=\"\"\n"; out.String() != want {
+		t.Errorf("console output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestConsoleSilent(t *testing.T) {
+	var out bytes.Buffer
+	live := &console{out: &out, err: &out, silent: true, windows: true, ci: true}
+	live.start(&Task{NumRequests: 10, NumClients: 1}, "")
+	live.window(&Window{})
+	live.finish(&Summary{})
+	if out.Len() != 0 {
+		t.Errorf("silent console printed %q", out.String())
+	}
+}
+
+func TestConsoleVerbose(t *testing.T) {
+	success := `{"label": "cat", "score": 0.99}`
+	failure := "Error while sending the request: connection reset"
+	tests := []struct {
+		sample   int
+		maxBody  int
+		min, max int // successes printed out of 100
+		want     string
+	}{
+		{0, 0, 100, 100, success},
+		{1, 8, 100, 100, `{"label"... (23 more bytes)`},
+		{10, 0, 3, 20, success},
+		{100, 100, 0, 5, success},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		live := &console{out: &out, verbose: true, sample: test.sample, maxBody: test.maxBody, rnd: rand.New(rand.NewSource(1))}
+		for i := 0; i < 100; i++ {
+			live.response(&Response{Success: true, Body: success}, "")
+		}
+		live.response(&Response{Body: failure}, "")
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		successes := lines[:len(lines)-1]
+		if len(successes) < test.min || len(successes) > test.max {
+			t.Errorf("sample %d printed %d of 100 successes, want %d to %d", test.sample, len(successes), test.min, test.max)
+		}
+		for _, line := range successes {
+			if line != test.want {
+				t.Errorf("max body %d printed %q, want %q", test.maxBody, line, test.want)
+				break
+			}
+		}
+		if lines[len(lines)-1] != failure {
+			t.Errorf("sample %d printed the failure as %q", test.sample, lines[len(lines)-1])
+		}
+	}
+	var out bytes.Buffer
+	live := &console{out: &out, verbose: true}
+	live.response(&Response{Success: true, Body: success, RequestID: "id-1"}, "")
+	live.response(&Response{Body: failure, RequestID: "id-2"}, "")
+	if want := success + "\nid-2 " + failure + "\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fleet : The set of clients of the running task which can grow or shrink on the fly
+type fleet struct {
+	mu     sync.Mutex
+	quits  []chan struct{}
+	size   int
+	spawn  func(worker int, quit <-chan struct{})
+	wg     sync.WaitGroup
+	closed bool
+	min    int // clients the run needs, one per group of them
+}
+
+func newFleet(spawn func(worker int, quit <-chan struct{})) *fleet {
+	return &fleet{spawn: spawn}
+}
+
+// resize starts or stops the clients so that exactly n of them are running,
+// a closed fleet can only shrink
+func (f *fleet) resize(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for !f.closed && len(f.quits) < n {
+		quit := make(chan struct{})
+		worker := len(f.quits)
+		f.quits = append(f.quits, quit)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.spawn(worker, quit)
+		}()
+	}
+	for len(f.quits) > n {
+		close(f.quits[len(f.quits)-1])
+		f.quits = f.quits[:len(f.quits)-1]
+	}
+	if len(f.quits) > f.size {
+		f.size = len(f.quits)
+	}
+}
+
+// close stops all the clients for good, the wait group can be waited on after it
+func (f *fleet) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for _, quit := range f.quits {
+		close(quit)
+	}
+	f.quits = nil
+}
+
+// count is the number of clients running at the moment
+func (f *fleet) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.quits)
+}
+
+// peak is the largest number of clients that were running at once
+func (f *fleet) peak() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
+
+// Control : Live adjustments of a running schedule
+type Control struct {
+	limiter   *Limiter
+	mu        sync.Mutex
+	fleet     *fleet
+	task      string
+	completed int64
+	stopped   chan struct{}
+	stopOnce  sync.Once
+	aborted   string
+
+	// The whole schedule, unknown for the searches that pick the next step as they go
+	phase     int
+	phases    int
+	total     int64
+	done      int64
+	startedAt time.Time
+}
+
+func newControl(rate float64) *Control {
+	return &Control{
+		limiter: newLimiter(rate),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (c *Control) attach(f *fleet) {
+	c.mu.Lock()
+	c.fleet = f
+	c.mu.Unlock()
+}
+
+// plan sets the schedule the run goes through for the overall progress
+func (c *Control) plan(milestones []Milestone) {
+	c.mu.Lock()
+	c.phases, c.total, c.startedAt = len(milestones), 0, time.Now()
+	for _, milestone := range milestones {
+		c.total += int64(milestone.NumRequests)
+	}
+	c.mu.Unlock()
+}
+
+// track starts counting the completed requests of a new task
+func (c *Control) track(task string) {
+	c.mu.Lock()
+	c.task = task
+	c.phase++
+	c.mu.Unlock()
+	atomic.StoreInt64(&c.completed, 0)
+}
+
+func (c *Control) complete() {
+	atomic.AddInt64(&c.completed, 1)
+	atomic.AddInt64(&c.done, 1)
+}
+
+// eta extrapolates the pace so far onto the requests left in the whole schedule
+func (c *Control) eta() (time.Duration, bool) {
+	c.mu.Lock()
+	total, startedAt := c.total, c.startedAt
+	c.mu.Unlock()
+	done := atomic.LoadInt64(&c.done)
+	if total == 0 || done == 0 {
+		return 0, false
+	}
+	left := total - done
+	if left < 0 {
+		left = 0
+	}
+	return time.Duration(float64(time.Since(startedAt)) / float64(done) * float64(left)), true
+}
+
+// progress describes where a planned run of several phases stands, it is
+// empty for a single phase which its own progress tells all about
+func (c *Control) progress() string {
+	c.mu.Lock()
+	phase, phases, total := c.phase, c.phases, c.total
+	c.mu.Unlock()
+	if phases < 2 {
+		return ""
+	}
+	done := atomic.LoadInt64(&c.done)
+	description := fmt.Sprintf("phase %d/%d, run %d%%", phase, phases, 100*done/total)
+	if eta, ok := c.eta(); ok {
+		description += fmt.Sprintf(", eta %v", eta.Round(time.Second))
+	}
+	return description
+}
+
+// Status : A snapshot of the running schedule
+type Status struct {
+	Task      string  `json:"task"`
+	Completed int64   `json:"completed"`
+	Clients   int     `json:"clients"`
+	Rate      float64 `json:"rate"`
+	Stopped   bool    `json:"stopped"`
+	Phase     int     `json:"phase,omitempty"`
+	Phases    int     `json:"phases,omitempty"`
+	Done      int64   `json:"done,omitempty"`
+	Total     int64   `json:"total,omitempty"`
+	ETA       float64 `json:"eta,omitempty"`
+	Aborted   string  `json:"aborted,omitempty"`
+}
+
+// Status reports the progress of the current task
+func (c *Control) Status() Status {
+	c.mu.Lock()
+	status := Status{Task: c.task, Stopped: c.IsStopped(), Phase: c.phase, Phases: c.phases, Total: c.total,
+		Aborted: c.aborted}
+	if c.fleet != nil {
+		status.Clients = c.fleet.count()
+	}
+	c.mu.Unlock()
+
+	status.Done = atomic.LoadInt64(&c.done)
+	if eta, ok := c.eta(); ok {
+		status.ETA = eta.Seconds()
+	}
+
+	status.Completed = atomic.LoadInt64(&c.completed)
+	status.Rate = c.limiter.Rate()
+	return status
+}
+
+// Stopped is closed as soon as the run is requested to stop
+func (c *Control) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+// IsStopped tells whether the run was requested to stop
+func (c *Control) IsStopped() bool {
+	select {
+	case <-c.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop ends the run after the requests in flight are done
+func (c *Control) Stop() {
+	c.stopOnce.Do(func() { close(c.stopped) })
+}
+
+// Abort stops the run for the reason, unless it is stopped already
+func (c *Control) Abort(reason string) {
+	c.stopOnce.Do(func() {
+		c.mu.Lock()
+		c.aborted = reason
+		c.mu.Unlock()
+		close(c.stopped)
+	})
+}
+
+// Aborted is the reason the run was aborted for, empty unless it was
+func (c *Control) Aborted() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.aborted
+}
+
+// Apply executes a single control command: rate N, clients N or stop
+func (c *Control) Apply(command string) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "stop":
+		c.Stop()
+		return nil
+	case "rate":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: rate <requests per second>")
+		}
+		rate, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || rate < 0 {
+			return fmt.Errorf("invalid rate %q", fields[1])
+		}
+		c.limiter.SetRate(rate)
+		return nil
+	case "clients":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: clients <number of parallel requests>")
+		}
+		clients, err := strconv.Atoi(fields[1])
+		if err != nil || clients < 1 {
+			return fmt.Errorf("invalid number of clients %q", fields[1])
+		}
+		if c.IsStopped() {
+			return fmt.Errorf("the run is stopped")
+		}
+		c.mu.Lock()
+		f := c.fleet
+		c.mu.Unlock()
+		if f != nil && clients < f.min {
+			return fmt.Errorf("at least %d clients are needed, one per address", f.min)
+		}
+		if f != nil {
+			f.resize(clients)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", fields[0])
+	}
+}
+
+// listen applies the commands read line by line until the input is over
+func (c *Control) listen(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := c.Apply(scanner.Text()); err != nil {
+			fmt.Fprintln(w, err)
+		}
+	}
+}
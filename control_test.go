@@ -0,0 +1,56 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlProgress(t *testing.T) {
+	ctl := newControl(0)
+	ctl.track("10@1")
+	if got := ctl.progress(); got != "" {
+		t.Errorf("got %q for an unplanned run", got)
+	}
+
+	ctl = newControl(0)
+	ctl.plan([]Milestone{{NumRequests: 10, NumClients: 1}, {NumRequests: 30, NumClients: 2}})
+	ctl.startedAt = time.Now().Add(-10 * time.Second)
+	ctl.track("10@1")
+	if got := ctl.progress(); got != "phase 1/2, run 0%" {
+		t.Errorf("got %q before the first request", got)
+	}
+	for i := 0; i < 10; i++ {
+		ctl.complete()
+	}
+	ctl.track("30@2")
+	// A quarter of the run took 10 seconds, so the rest takes some 30 more
+	if got := ctl.progress(); !strings.HasPrefix(got, "phase 2/2, run 25%, eta 30s") {
+		t.Errorf("got %q", got)
+	}
+	status := ctl.Status()
+	if status.Phase != 2 || status.Phases != 2 || status.Done != 10 || status.Total != 40 ||
+		status.Completed != 0 || status.ETA < 29 || status.ETA > 31 {
+		t.Errorf("got status %+v", status)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+const defaultCooldownRate = 1.0
+
+// A probe is healthy when it succeeds within this many times the baseline,
+// and the target has recovered once this many healthy probes go in a row
+const recoverySlack = 1.5
+const recoveryStreak = 5
+
+// Probe : A single request of the cooldown
+type Probe struct {
+	Elapsed float64 `json:"elapsed"`
+	Latency Millis  `json:"latency"`
+	Success bool    `json:"success"`
+}
+
+// Cooldown : Requests sent at a low rate once the load is over, telling how
+// quickly the target gets back to its unloaded latency
+type Cooldown struct {
+	Seconds     float64  `json:"seconds"`
+	Rate        float64  `json:"rate"`
+	NumRequests int      `json:"num_requests"`
+	NumFails    int      `json:"num_fails"`
+	Median      Millis   `json:"median"`
+	P95         Millis   `json:"p95"`
+	Max         Millis   `json:"max"`
+	Baseline    Millis   `json:"baseline"`
+	Recovered   *float64 `json:"recovered"`
+	Probes      []Probe  `json:"probes"`
+}
+
+// runCooldown sends one request after another at the rate for the duration,
+// never more than one at a time so that the probes themselves add no load
+func runCooldown(task *Task, opt *Options, duration time.Duration, rate float64, stop <-chan struct{}) *Cooldown {
+	interval := time.Duration(float64(time.Second) / rate)
+	probing := *task
+	probing.NumRequests = int(math.Ceil(duration.Seconds() * rate))
+	quit := make(chan struct{})
+	defer close(quit)
+	pipeline := producePayloads(&probing, opt, 1, quit)
+
+	rnd := opt.Random.stream(streamWorkers)
+	var user *virtualUser
+	if opt.Scenario != nil {
+		user = newVirtualUser(opt.Scenario)
+	}
+	var hooks *scriptState
+	if opt.Script != nil {
+		var err error
+		hooks, err = opt.Script.instance()
+		panicIf(err)
+		defer hooks.close()
+	}
+	var sockets *wsClient
+	if opt.Protocol == protocolWS {
+		sockets = newWSClient(opt)
+		defer sockets.close()
+	}
+	targets := newTargetPool(task.Targets)
+
+	start := time.Now()
+	probes := make([]Probe, 0, probing.NumRequests)
+	for i := 0; i < probing.NumRequests; i++ {
+		if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+			select {
+			case <-stop:
+				return summarizeCooldown(probes, time.Since(start), rate)
+			case <-time.After(wait):
+			}
+		}
+		ball, ok := <-pipeline
+		if !ok {
+			break
+		}
+		ball = aim(ball, user, opt, rnd)
+		if hooks != nil {
+			ball = hooks.beforeRequest(ball)
+		}
+		target := targets.pick()
+		sent := time.Now()
+		var response Response
+		if ball.err != nil {
+			response = Response{Body: fmt.Sprintf("Error while preparing the request: %s", ball.err), Class: classPrepare}
+		} else if sockets != nil {
+			response = sockets.fire(target.URL, ball, nil, opt)
+		} else {
+			response = fire(target.URL, ball, nil, opt)
+		}
+		if opt.Poll != nil {
+			response = opt.Poll.follow(target.URL, response, nil, opt, stop)
+		}
+		took := time.Since(sent)
+		if user != nil {
+			user.advance(&response, opt)
+		}
+		if hooks != nil {
+			hooks.afterResponse(&response, opt)
+		}
+		decode(&response, opt)
+		probes = append(probes, Probe{Elapsed: sent.Sub(start).Seconds(), Latency: Millis(millis(took)),
+			Success: response.Success})
+	}
+	select {
+	case <-stop:
+	case <-time.After(time.Until(start.Add(duration))):
+	}
+	return summarizeCooldown(probes, time.Since(start), rate)
+}
+
+// summarizeCooldown takes the median of the successful probes of the second
+// half as the baseline the target recovers to, the recovery is the start of
+// the first streak of probes back within the slack of it
+func summarizeCooldown(probes []Probe, elapsed time.Duration, rate float64) *Cooldown {
+	cooldown := &Cooldown{Seconds: elapsed.Seconds(), Rate: rate, NumRequests: len(probes), Probes: probes}
+	all, settled := latency.New(), latency.New()
+	for i, probe := range probes {
+		all.Add(float64(probe.Latency), probe.Success)
+		if i >= len(probes)/2 {
+			settled.Add(float64(probe.Latency), probe.Success)
+		}
+	}
+	stats := all.Stats(95)
+	cooldown.NumFails = stats.Fails
+	cooldown.Median, cooldown.P95, cooldown.Max = Millis(stats.Median), Millis(stats.Percentiles[0]), Millis(stats.Max)
+	cooldown.Baseline = Millis(settled.Stats().Median)
+	if settled.Stats().Successes == 0 {
+		return cooldown
+	}
+
+	// A run too short for a whole streak needs all of its probes healthy
+	need := recoveryStreak
+	if len(probes) < need {
+		need = len(probes)
+	}
+	streak := 0
+	for i, probe := range probes {
+		if !probe.Success || float64(probe.Latency) > recoverySlack*float64(cooldown.Baseline) {
+			streak = 0
+			continue
+		}
+		streak++
+		if streak == need {
+			recovered := probes[i-streak+1].Elapsed
+			cooldown.Recovered = &recovered
+			break
+		}
+	}
+	return cooldown
+}
+
+// describeRecovery tells when the probes got back to the baseline
+func describeRecovery(cooldown *Cooldown) string {
+	if cooldown.Recovered == nil {
+		return fmt.Sprintf("not recovered within %.1fs", cooldown.Seconds)
+	}
+	return fmt.Sprintf("recovered after %.1fs, back within %gx of the %.0f ms baseline", *cooldown.Recovered,
+		recoverySlack, cooldown.Baseline)
+}
+
+func printCooldown(w io.Writer, cooldown *Cooldown) {
+	fmt.Fprintf(w, "Cooldown: %d probes over %.1fs at %g req/s, %d failed, median %.0f ms, 95%% %.0f ms, max %.0f ms\n",
+		cooldown.NumRequests, cooldown.Seconds, cooldown.Rate, cooldown.NumFails, cooldown.Median, cooldown.P95,
+		cooldown.Max)
+	fmt.Fprintf(w, "Target %s\n", describeRecovery(cooldown))
+}
+
+func markdownCooldown(w io.Writer, cooldown *Cooldown) {
+	fmt.Fprintf(w, "\n### Cooldown\n\n%d probes over %.1fs at %g req/s, %d failed, median %.0f ms, 95%% %.0f ms, max %.0f ms\n",
+		cooldown.NumRequests, cooldown.Seconds, cooldown.Rate, cooldown.NumFails, cooldown.Median, cooldown.P95,
+		cooldown.Max)
+	fmt.Fprintf(w, "\nTarget **%s**\n", describeRecovery(cooldown))
+}
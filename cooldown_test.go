@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSummarizeCooldown(t *testing.T) {
+	probe := func(latency float64, success bool) Probe {
+		return Probe{Latency: Millis(latency), Success: success}
+	}
+	tests := []struct {
+		name      string
+		probes    []Probe
+		baseline  Millis
+		recovered int
+	}{
+		{"healthy", []Probe{probe(10, true), probe(11, true), probe(10, true), probe(12, true), probe(10, true),
+			probe(11, true)}, 11, 0},
+		{"slow start", []Probe{probe(90, true), probe(40, true), probe(10, true), probe(11, true), probe(10, true),
+			probe(12, true), probe(10, true), probe(11, true)}, 10.5, 2},
+		{"failures", []Probe{probe(5, false), probe(10, true), probe(5, false), probe(11, true), probe(10, true),
+			probe(12, true), probe(10, true), probe(11, true)}, 10.5, 3},
+		{"flapping", []Probe{probe(10, true), probe(10, true), probe(50, true), probe(10, true), probe(10, true),
+			probe(50, true), probe(10, true), probe(10, true)}, 10, -1},
+		{"short", []Probe{probe(10, true), probe(11, true)}, 11, 0},
+		{"short and slow", []Probe{probe(30, true), probe(10, true)}, 10, -1},
+		{"down", []Probe{probe(5, false), probe(5, false)}, -1, -1},
+	}
+	for _, test := range tests {
+		for i := range test.probes {
+			test.probes[i].Elapsed = float64(i)
+		}
+		cooldown := summarizeCooldown(test.probes, 8*time.Second, 1)
+		// There is no baseline without a successful probe
+		if test.baseline < 0 && !math.IsNaN(float64(cooldown.Baseline)) ||
+			test.baseline >= 0 && cooldown.Baseline != test.baseline {
+			t.Errorf("%s: got baseline %v, want %v", test.name, cooldown.Baseline, test.baseline)
+		}
+		switch {
+		case test.recovered < 0 && cooldown.Recovered != nil:
+			t.Errorf("%s: got recovered after %gs, want never", test.name, *cooldown.Recovered)
+		case test.recovered >= 0 && (cooldown.Recovered == nil || *cooldown.Recovered != float64(test.recovered)):
+			t.Errorf("%s: got recovered %v, want after %ds", test.name, cooldown.Recovered, test.recovered)
+		}
+	}
+}
+
+func TestRunCooldown(t *testing.T) {
+	var mutex sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		n := requests
+		mutex.Unlock()
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// Keep the healthy latency well above the jitter of the test run
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	task := &Task{Targets: []Target{{Name: server.URL, URL: server.URL}}, Corpus: []*Cannonball{{Method: "GET"}}}
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true}), Decoders: 1}
+	start := time.Now()
+	cooldown := runCooldown(task, opt, 200*time.Millisecond, 50, nil)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("cooldown took %v, want the whole duration", elapsed)
+	}
+	if cooldown.NumRequests != 10 || cooldown.NumFails != 2 || requests != 10 {
+		t.Errorf("got %d probes with %d fails of %d requests, want 10 with 2", cooldown.NumRequests,
+			cooldown.NumFails, requests)
+	}
+	// The probes keep the pace of the rate, none is sent ahead of its time
+	for i, probe := range cooldown.Probes {
+		if probe.Elapsed < float64(i)*0.02 {
+			t.Errorf("probe %d was sent at %.3fs, ahead of %.3fs", i, probe.Elapsed, float64(i)*0.02)
+		}
+	}
+	if cooldown.Recovered == nil || *cooldown.Recovered < cooldown.Probes[2].Elapsed {
+		t.Errorf("got recovered %v, want after the third probe", cooldown.Recovered)
+	}
+
+	var text bytes.Buffer
+	printCooldown(&text, cooldown)
+	if !strings.Contains(text.String(), "10 probes over") || !strings.Contains(text.String(), "Target recovered after") {
+		t.Errorf("got %q", text.String())
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultRecordListen = "127.0.0.1:8081"
+const defaultCorpus = "corpus"
+
+// hopHeaders are meaningful for a single connection only and are never recorded
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length",
+}
+
+// CorpusEntry : A captured request saved as a single file of the corpus
+type CorpusEntry struct {
+	Method string      `json:"method"`
+	URI    string      `json:"uri"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func (e *CorpusEntry) cannonball() *Cannonball {
+	return &Cannonball{Method: e.Method, Path: e.URI, Header: e.Header, Body: e.Body}
+}
+
+// loadCorpus reads all the captured requests of the directory in the order
+// they were recorded, or those under an s3:// or gs:// prefix
+func loadCorpus(dir string) ([]*Cannonball, error) {
+	var paths []string
+	var err error
+	if objectURL(dir) {
+		paths, err = corpusObjects(dir)
+	} else {
+		paths, err = filepath.Glob(filepath.Join(dir, "*.json"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	corpus := make([]*Cannonball, 0, len(paths))
+	for _, path := range paths {
+		data, err := readInput(path)
+		if err != nil {
+			return nil, err
+		}
+		var entry CorpusEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		corpus = append(corpus, entry.cannonball())
+	}
+	if len(corpus) == 0 {
+		return nil, fmt.Errorf("no requests found in %s", dir)
+	}
+
+	return corpus, nil
+}
+
+// corpusObjects lists the json objects right under the prefix, as a directory would hold them
+func corpusObjects(prefix string) ([]string, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	keys, err := listObjects(prefix)
+	if err != nil {
+		return nil, err
+	}
+	scheme, bucket, under, _ := splitObjectURL(prefix)
+	paths := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, under)
+		if strings.HasSuffix(name, ".json") && !strings.Contains(name, "/") {
+			paths = append(paths, fmt.Sprintf("%s://%s/%s", scheme, bucket, key))
+		}
+	}
+	return paths, nil
+}
+
+// recorder : A reverse proxy saving every request it forwards into the corpus
+type recorder struct {
+	dir   string
+	count int64
+	proxy *httputil.ReverseProxy
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := r.Header.Clone()
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+	entry := CorpusEntry{Method: r.Method, URI: r.URL.RequestURI(), Header: header, Body: body}
+	data, err := json.Marshal(&entry)
+	panicIf(err)
+
+	n := atomic.AddInt64(&rec.count, 1)
+	path := filepath.Join(rec.dir, fmt.Sprintf("%06d.json", n))
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed saving the request: %s\n", err)
+	}
+
+	rec.proxy.ServeHTTP(w, r)
+}
+
+func recordCommand(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	listen := fs.String("listen", defaultRecordListen, "address to accept the traffic at")
+	dir := fs.String("corpus", defaultCorpus, "directory to save the captured requests to")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade record [options...] <url>\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() == 0 {
+		fmt.Println("Provide a target to record the traffic of!")
+		return 1
+	}
+
+	target, err := url.Parse(fs.Arg(0))
+	if err != nil || target.Host == "" {
+		fmt.Printf("Invalid target %q\n", fs.Arg(0))
+		return 1
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Printf("Failed creating the corpus: %s\n", err)
+		return 1
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+
+	fmt.Printf("Recording %s through http://%s into %s\n", target, *listen, strings.TrimSuffix(*dir, "/")+"/")
+	if err := http.ListenAndServe(*listen, &recorder{dir: *dir, proxy: proxy}); err != nil {
+		fmt.Printf("Failed serving the proxy: %s\n", err)
+		return 1
+	}
+	return 0
+}
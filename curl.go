@@ -0,0 +1,393 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// curlValued lists the short curl options taking an argument, any other letter
+// of a combined option like -sSL is a switch
+const curlValued = "XHdubAeoxmwcEKTrFYyzC"
+
+// curlSkipped lists the curl options taking an argument which do not change the request
+var curlSkipped = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-w": true, "--write-out": true, "--retry": true, "-x": true, "--proxy": true,
+	"--cacert": true, "--cert": true, "--key": true, "-c": true, "--cookie-jar": true,
+	"-E": true, "-K": true, "--config": true, "-r": true, "--range": true, "-Y": true,
+	"-y": true, "-z": true, "-C": true, "-T": true, "--upload-file": true,
+}
+
+// shellEscapes maps the single letter escapes of the $'...' quoting
+var shellEscapes = map[byte]string{
+	'a': "\a", 'b': "\b", 'e': "\x1b", 'E': "\x1b", 'f': "\f", 'n': "\n", 'r': "\r",
+	't': "\t", 'v': "\v", '\\': "\\", '\'': "'", '"': "\"", '?': "?",
+}
+
+// ansiQuoted decodes the body of a $'...' word starting right after the
+// opening quote, it returns the text and the length consumed with the quote
+func ansiQuoted(s string) (string, int, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			return out.String(), i + 1, nil
+		}
+		if c != '\\' || i+1 >= len(s) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		if escaped, ok := shellEscapes[s[i]]; ok {
+			out.WriteString(escaped)
+			continue
+		}
+		digits, base, size := 0, 16, 0
+		switch s[i] {
+		case 'x':
+			digits, size = 2, 1
+		case 'u':
+			digits = 4
+		case 'U':
+			digits = 8
+		default:
+			if s[i] >= '0' && s[i] <= '7' {
+				digits, base, size = 3, 8, 1
+				i--
+			}
+		}
+		if digits == 0 {
+			out.WriteByte('\\')
+			out.WriteByte(s[i])
+			continue
+		}
+		end := i + 1
+		for end < len(s) && end-i-1 < digits && isDigit(s[end], base) {
+			end++
+		}
+		code, err := strconv.ParseUint(s[i+1:end], base, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid escape in %q", s[:end])
+		}
+		if size == 1 {
+			out.WriteByte(byte(code))
+		} else {
+			var buf [utf8.UTFMax]byte
+			out.Write(buf[:utf8.EncodeRune(buf[:], rune(code))])
+		}
+		i = end - 1
+	}
+	return "", 0, fmt.Errorf("unterminated $' quote")
+}
+
+func isDigit(c byte, base int) bool {
+	if base == 8 {
+		return c >= '0' && c <= '7'
+	}
+	return strings.IndexByte("0123456789abcdefABCDEF", c) >= 0
+}
+
+// splitShell breaks a script into commands of words the way a posix shell
+// does, commands end with an unquoted newline or semicolon
+func splitShell(text string) ([][]string, error) {
+	var commands [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			i++
+			if text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n' {
+				i++
+			}
+			if text[i] != '\n' {
+				word.WriteByte(text[i])
+				inWord = true
+			}
+		case c == '$' && i+1 < len(text) && text[i+1] == '\'':
+			decoded, n, err := ansiQuoted(text[i+2:])
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(decoded)
+			i += 1 + n
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(text[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) && strings.IndexByte("\\\"$`\n", text[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(text[i])
+			}
+			if i >= len(text) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == '#' && !inWord:
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			endCommand()
+		case c == '\n' || c == ';':
+			endCommand()
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// expandCurlArgs splits the combined short options like -sSX POST or -XPOST
+// into separate words so that every option is followed by its own value
+func expandCurlArgs(words []string) []string {
+	expanded := make([]string, 0, len(words))
+	for _, word := range words {
+		if len(word) <= 2 || word[0] != '-' || word[1] == '-' {
+			expanded = append(expanded, word)
+			continue
+		}
+		for j := 1; j < len(word); j++ {
+			expanded = append(expanded, "-"+word[j:j+1])
+			if strings.IndexByte(curlValued, word[j]) >= 0 {
+				if j+1 < len(word) {
+					expanded = append(expanded, word[j+1:])
+				}
+				break
+			}
+		}
+	}
+	return expanded
+}
+
+// parseCurl turns the words of a curl invocation into a request to shoot with
+func parseCurl(words []string, rebased bool) (*Cannonball, string, error) {
+	if len(words) == 0 || words[0] != "curl" {
+		return nil, "", fmt.Errorf("not a curl command: %q", strings.Join(words, " "))
+	}
+	words = expandCurlArgs(words)
+
+	ball := &Cannonball{Header: make(http.Header)}
+	var rawURL string
+	var data []string
+	get, head := false, false
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		name, value, inline := word, "", false
+		if strings.HasPrefix(word, "--") {
+			if eq := strings.IndexByte(word, '='); eq > 0 {
+				name, value, inline = word[:eq], word[eq+1:], true
+			}
+		}
+		arg := func() (string, error) {
+			if inline {
+				return value, nil
+			}
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("missing value for %s", name)
+			}
+			i++
+			return words[i], nil
+		}
+
+		var err error
+		switch name {
+		case "-X", "--request", "-H", "--header", "-d", "--data", "--data-raw", "--data-binary",
+			"--data-ascii", "--data-urlencode", "--json", "-u", "--user", "-A", "--user-agent",
+			"-e", "--referer", "-b", "--cookie", "--url":
+			value, err = arg()
+			if err != nil {
+				return nil, "", err
+			}
+		}
+
+		switch name {
+		case "-X", "--request":
+			ball.Method = value
+		case "-H", "--header":
+			colon := strings.IndexByte(value, ':')
+			if colon < 0 {
+				return nil, "", fmt.Errorf("invalid header %q", value)
+			}
+			// A copied Accept-Encoding would turn off the transparent decompression
+			key := strings.TrimSpace(value[:colon])
+			if !skipHARHeader(key) && !strings.EqualFold(key, "Accept-Encoding") {
+				ball.Header.Add(key, strings.TrimSpace(value[colon+1:]))
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--json":
+			if strings.HasPrefix(value, "@") && name != "--data-raw" {
+				content, err := ioutil.ReadFile(value[1:])
+				if err != nil {
+					return nil, "", err
+				}
+				value = string(content)
+			}
+			data = append(data, value)
+			if name == "--json" {
+				ball.Header.Set("Content-Type", "application/json")
+				ball.Header.Set("Accept", "application/json")
+			}
+		case "--data-urlencode":
+			if eq := strings.IndexByte(value, '='); eq >= 0 {
+				value = value[:eq+1] + url.QueryEscape(value[eq+1:])
+			} else {
+				value = url.QueryEscape(value)
+			}
+			data = append(data, value)
+		case "-u", "--user":
+			ball.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+		case "-A", "--user-agent":
+			ball.Header.Set("User-Agent", value)
+		case "-e", "--referer":
+			ball.Header.Set("Referer", value)
+		case "-b", "--cookie":
+			ball.Header.Add("Cookie", value)
+		case "--url":
+			rawURL = value
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		case "-F", "--form":
+			return nil, "", fmt.Errorf("multipart forms are not supported")
+		default:
+			if curlSkipped[name] {
+				if !inline {
+					i++
+				}
+			} else if !strings.HasPrefix(word, "-") && rawURL == "" {
+				rawURL = word
+			}
+		}
+	}
+
+	// Like curl itself, take the urls without a scheme for http ones
+	if rawURL != "" && !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid url %q", rawURL)
+	}
+	body := strings.Join(data, "&")
+	if get && body != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		body = ""
+	}
+	if body != "" {
+		ball.Body = []byte(body)
+		if ball.Header.Get("Content-Type") == "" {
+			ball.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if ball.Method == "" {
+		switch {
+		case head:
+			ball.Method = http.MethodHead
+		case body != "":
+			ball.Method = http.MethodPost
+		default:
+			ball.Method = http.MethodGet
+		}
+	}
+
+	ball.Path = u.String()
+	if rebased {
+		ball.Path = u.RequestURI()
+	}
+	ball.Label = ball.Method + " " + u.Path
+	return ball, u.Scheme + "://" + u.Host, nil
+}
+
+// loadCurl reads either a single curl command or a file of them, written one
+// per line with backslash continuations or separated by semicolons the way
+// the browsers copy them
+func loadCurl(spec string, rebased bool) ([]*Cannonball, string, error) {
+	text := spec
+	if !strings.HasPrefix(strings.TrimSpace(spec), "curl ") {
+		data, err := ioutil.ReadFile(spec)
+		if err != nil {
+			return nil, "", err
+		}
+		text = string(data)
+	}
+	commands, err := splitShell(text)
+	if err != nil {
+		return nil, "", err
+	}
+
+	origin := ""
+	corpus := make([]*Cannonball, 0, len(commands))
+	for _, command := range commands {
+		ball, host, err := parseCurl(command, rebased)
+		if err != nil {
+			return nil, "", err
+		}
+		if origin == "" {
+			origin = host
+		}
+		corpus = append(corpus, ball)
+	}
+	if len(corpus) == 0 {
+		return nil, "", fmt.Errorf("no curl commands found in %s", spec)
+	}
+	return corpus, origin, nil
+}
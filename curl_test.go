@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShell(t *testing.T) {
+	tests := []struct {
+		text string
+		want [][]string
+	}{
+		{`curl http://h/p`, [][]string{{"curl", "http://h/p"}}},
+		{`curl -H 'A: b c' "x\"y"`, [][]string{{"curl", "-H", "A: b c", `x"y`}}},
+		{"curl \\\n  -d a=1 \\\r\n  h/p", [][]string{{"curl", "-d", "a=1", "h/p"}}},
+		{`curl --data-raw $'{"a":"b\'c"}'`, [][]string{{"curl", "--data-raw", `{"a":"b'c"}`}}},
+		{`curl $'a\nb\x41é\101'`, [][]string{{"curl", "a\nbAéA"}}},
+		{"curl a ;\ncurl b\n\n# comment\ncurl c", [][]string{{"curl", "a"}, {"curl", "b"}, {"curl", "c"}}},
+		{`curl 'a;b' "c#d" e#f`, [][]string{{"curl", "a;b", "c#d", "e#f"}}},
+	}
+	for _, test := range tests {
+		got, err := splitShell(test.text)
+		if err != nil {
+			t.Errorf("splitShell(%q) failed: %s", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitShell(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSplitShellUnterminated(t *testing.T) {
+	for _, text := range []string{`curl 'a`, `curl "a`, `curl $'a\'`} {
+		if _, err := splitShell(text); err == nil {
+			t.Errorf("splitShell(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		words   []string
+		rebased bool
+		method  string
+		path    string
+		body    string
+		header  map[string]string
+	}{
+		{[]string{"curl", "http://h/p"}, false, "GET", "http://h/p", "", nil},
+		{[]string{"curl", "-sX", "POST", "http://h/p"}, false, "POST", "http://h/p", "", nil},
+		{[]string{"curl", "-XPUT", "-sSL", "http://h/p"}, false, "PUT", "http://h/p", "", nil},
+		{[]string{"curl", "h.example/p?q=1"}, true, "GET", "/p?q=1", "", nil},
+		{[]string{"curl", "-d", "a=1", "--data", "b=2", "http://h/p"}, false, "POST", "http://h/p", "a=1&b=2",
+			map[string]string{"Content-Type": "application/x-www-form-urlencoded"}},
+		{[]string{"curl", "-G", "-d", "a=1", "http://h/p?q=1"}, false, "GET", "http://h/p?q=1&a=1", "", nil},
+		{[]string{"curl", "--json", `{"a":1}`, "http://h/p"}, false, "POST", "http://h/p", `{"a":1}`,
+			map[string]string{"Content-Type": "application/json"}},
+		{[]string{"curl", "-I", "--url=http://h/p"}, false, "HEAD", "http://h/p", "", nil},
+		{[]string{"curl", "-u", "user:pass", "-o", "out.txt", "http://h/p"}, false, "GET", "http://h/p", "",
+			map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}},
+		{[]string{"curl", "-H", "Accept-Encoding: gzip", "-H", "Host: x", "-H", "X-A: 1", "http://h/p"},
+			false, "GET", "http://h/p", "", map[string]string{"Accept-Encoding": "", "Host": "", "X-A": "1"}},
+	}
+	for _, test := range tests {
+		ball, origin, err := parseCurl(test.words, test.rebased)
+		if err != nil {
+			t.Errorf("parseCurl(%q) failed: %s", test.words, err)
+			continue
+		}
+		if ball.Method != test.method || ball.Path != test.path || string(ball.Body) != test.body {
+			t.Errorf("parseCurl(%q) = %s %s %q, want %s %s %q", test.words,
+				ball.Method, ball.Path, ball.Body, test.method, test.path, test.body)
+		}
+		if origin != "http://h" && origin != "http://h.example" {
+			t.Errorf("parseCurl(%q) origin = %q", test.words, origin)
+		}
+		for key, value := range test.header {
+			if got := ball.Header.Get(key); got != value {
+				t.Errorf("parseCurl(%q) header %s = %q, want %q", test.words, key, got, value)
+			}
+		}
+	}
+}
+
+func TestParseCurlErrors(t *testing.T) {
+	tests := [][]string{
+		{"wget", "http://h/p"},
+		{"curl"},
+		{"curl", "-H"},
+		{"curl", "-H", "no colon", "http://h/p"},
+		{"curl", "-F", "a=@b", "http://h/p"},
+	}
+	for _, words := range tests {
+		if _, _, err := parseCurl(words, false); err == nil {
+			t.Errorf("parseCurl(%q) succeeded, want an error", words)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	dataCycle  = "cycle"
+	dataRandom = "random"
+)
+
+// dataFeed : Rows of values handed out to the requests one by one, either
+// cycling through the rows in order or picking them at random
+type dataFeed struct {
+	columns []string
+	rows    []map[string]string
+	random  bool
+	next    uint64
+}
+
+// loadData reads a csv file with a header row or a jsonl file of objects
+func loadData(path string, random bool) (*dataFeed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	feed := &dataFeed{random: random}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = feed.readCSV(file)
+	case ".jsonl", ".ndjson":
+		err = feed.readJSONL(file)
+	default:
+		return nil, fmt.Errorf("unknown data format of %s (csv, jsonl)", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(feed.rows) == 0 {
+		return nil, fmt.Errorf("no rows in %s", path)
+	}
+	return feed, nil
+}
+
+func (d *dataFeed) readCSV(file *os.File) error {
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	d.columns = records[0]
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(record))
+		for i, value := range record {
+			row[d.columns[i]] = value
+		}
+		d.rows = append(d.rows, row)
+	}
+	return nil
+}
+
+// readJSONL takes the strings as they are and the other values as json,
+// every line should have the same keys
+func (d *dataFeed) readJSONL(file *os.File) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &object); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		row := make(map[string]string, len(object))
+		for key, raw := range object {
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				row[key] = s
+			} else {
+				row[key] = string(raw)
+			}
+		}
+		if d.columns == nil {
+			for key := range row {
+				d.columns = append(d.columns, key)
+			}
+			sort.Strings(d.columns)
+		}
+		if len(row) != len(d.columns) {
+			return fmt.Errorf("line %d: keys differ from the first line", line)
+		}
+		for _, column := range d.columns {
+			if _, ok := row[column]; !ok {
+				return fmt.Errorf("line %d: no %s", line, column)
+			}
+		}
+		d.rows = append(d.rows, row)
+	}
+	return scanner.Err()
+}
+
+// columnNames lists the names of the values, it is safe to call on a nil feed
+func (d *dataFeed) columnNames() []string {
+	if d == nil {
+		return nil
+	}
+	return d.columns
+}
+
+// row hands out the values for the next request, it is safe to call on a nil feed
+func (d *dataFeed) row(rnd *rand.Rand) map[string]string {
+	if d == nil {
+		return nil
+	}
+	if d.random {
+		return d.rows[rnd.Intn(len(d.rows))]
+	}
+	i := atomic.AddUint64(&d.next, 1) - 1
+	return d.rows[i%uint64(len(d.rows))]
+}
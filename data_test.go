@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cannonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		columns []string
+		rows    []map[string]string
+		fails   string
+	}{
+		{"users.csv", "id,name\n1,ann\n2,\"bob, jr\"\n", []string{"id", "name"},
+			[]map[string]string{{"id": "1", "name": "ann"}, {"id": "2", "name": "bob, jr"}}, ""},
+		{"users.jsonl", "{\"id\": 1, \"name\": \"ann\"}\n\n{\"name\": \"bob\", \"id\": 2.5}\n", []string{"id", "name"},
+			[]map[string]string{{"id": "1", "name": "ann"}, {"id": "2.5", "name": "bob"}}, ""},
+		{"nested.ndjson", "{\"tags\": [\"a\"], \"on\": true}\n", []string{"on", "tags"},
+			[]map[string]string{{"on": "true", "tags": `["a"]`}}, ""},
+		{"ragged.csv", "id,name\n1\n", nil, nil, "record on line 2"},
+		{"ragged.jsonl", "{\"id\": 1}\n{\"name\": \"bob\"}\n", nil, nil, "line 2: no id"},
+		{"header.csv", "id,name\n", nil, nil, "no rows"},
+		{"users.txt", "id\n1\n", nil, nil, "unknown data format"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		feed, err := loadData(path, false)
+		if test.fails != "" {
+			if err == nil || !strings.Contains(err.Error(), test.fails) {
+				t.Errorf("%s: got %v, want %s", test.name, err, test.fails)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(feed.columns, test.columns) || !reflect.DeepEqual(feed.rows, test.rows) {
+			t.Errorf("%s: got %v and %v", test.name, feed.columns, feed.rows)
+		}
+	}
+}
+
+func TestDataFeedRow(t *testing.T) {
+	rows := []map[string]string{{"id": "1"}, {"id": "2"}, {"id": "3"}}
+	feed := &dataFeed{columns: []string{"id"}, rows: rows}
+	rnd := rand.New(rand.NewSource(1))
+	got := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		got = append(got, feed.row(rnd)["id"])
+	}
+	if strings.Join(got, ",") != "1,2,3,1,2" {
+		t.Errorf("got rows %v cycling", got)
+	}
+	feed.random = true
+	for i := 0; i < 20; i++ {
+		if id := feed.row(rnd)["id"]; id < "1" || id > "3" {
+			t.Errorf("got row %q at random", id)
+		}
+	}
+	var none *dataFeed
+	if none.row(rnd) != nil || none.columnNames() != nil {
+		t.Errorf("got values from a nil feed")
+	}
+}
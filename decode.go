@@ -0,0 +1,188 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// decoders : The pool finishing the responses off the firing path, so that
+// validating the bodies never throttles the request rate being measured. The
+// responses leave the pool in the order they came in, which is the order the
+// workers completed them in.
+type decoders struct {
+	wg sync.WaitGroup
+}
+
+type decodeJob struct {
+	seq      int
+	response Response
+}
+
+func startDecoders(n int, opt *Options, raw <-chan Response, responses chan<- Response) *decoders {
+	d := &decoders{}
+	if n < 1 {
+		n = 1
+	}
+
+	jobs := make(chan decodeJob, n)
+	decoded := make(chan decodeJob, n)
+	go func() {
+		seq := 0
+		for response := range raw {
+			jobs <- decodeJob{seq, response}
+			seq++
+		}
+		close(jobs)
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < n; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				decode(&job.response, opt)
+				decoded <- job
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(decoded)
+	}()
+
+	// Put the decoded responses back in order, only a few of them are ever pending
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		pending := make(map[int]Response)
+		next := 0
+		for job := range decoded {
+			pending[job.seq] = job.response
+			for {
+				response, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				responses <- response
+				next++
+			}
+		}
+	}()
+	return d
+}
+
+// wait blocks until all the responses are decoded, the raw channel must be closed
+func (d *decoders) wait() {
+	d.wg.Wait()
+}
+
+// decode converts and validates the body, then emits the per-request metrics
+func decode(response *Response, opt *Options) {
+	verify(response, opt)
+
+	opt.Statsd.Count("requests", 1)
+	if response.Success {
+		opt.Statsd.Timing("latency", response.Latency)
+	} else {
+		opt.Statsd.Count("errors", 1)
+	}
+	if response.Oversized {
+		opt.Statsd.Count("oversized", 1)
+	}
+	if opt.Metrics != nil {
+		opt.Metrics.Record(response.Latency, response.Success)
+	}
+	if response.span != nil {
+		response.span.Status, response.span.Success = response.Status, response.Success
+		opt.Exporter.Export(*response.span)
+		response.span = nil
+	}
+}
+
+// verify converts and validates the body only once, the clients with a
+// circuit breaker do it themselves to know the final verdict right away
+func verify(response *Response, opt *Options) {
+	if response.verified {
+		return
+	}
+	response.verified = true
+	if response.raw != nil && response.encoding != "" {
+		decompress(response, opt)
+	}
+	if response.Extracted == nil {
+		extractValues(response, opt.Extract, opt)
+	}
+	if response.raw != nil {
+		response.Body = string(response.raw)
+		response.digest = digest(response.raw)
+		// The rejections of the fuzzed requests are the bodies of errors
+		if response.Success && response.Fuzz == "" {
+			if err := validate(response.raw, opt); err != nil {
+				response.Success = false
+				response.Class = classInvalid
+				response.Body = fmt.Sprintf("Invalid response: %s", err)
+			} else if opt.Golden != nil {
+				if err := opt.Golden.check(response.raw); err != nil {
+					response.Success = false
+					response.Class = classGolden
+					response.Body = fmt.Sprintf("Response differs from the golden one: %s", err)
+				}
+			}
+		}
+		response.raw = nil
+	}
+}
+
+func validate(body []byte, opt *Options) error {
+	if opt.ValidateJSON && !json.Valid(body) {
+		return fmt.Errorf("body is not a valid json")
+	}
+	return nil
+}
+
+// decompress decodes the compressed body in place, a body over the size
+// limit once decompressed counts as oversized
+func decompress(response *Response, opt *Options) {
+	raw, err := opt.Compress.decompress(response.encoding, response.raw)
+	if response.Compression == nil {
+		response.Compression = &Compression{}
+	}
+	response.Compression.Received = int64(len(response.raw))
+	response.encoding = ""
+	switch {
+	case err == errTooLarge:
+		response.Success, response.Oversized, response.Class = false, true, classOversized
+		response.Body = fmt.Sprintf("Response is over the limit of %d bytes once decompressed", opt.MaxResponseBytes)
+		response.raw = nil
+	case err != nil:
+		response.Success, response.Class = false, classInvalid
+		response.Body = fmt.Sprintf("Invalid response: %s", err)
+		response.raw = nil
+	default:
+		response.Compression.ReceivedRaw = int64(len(raw))
+		response.raw = raw
+	}
+}
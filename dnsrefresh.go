@@ -0,0 +1,211 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// dnsTimeout bounds the lookups of a refresh
+const dnsTimeout = 5 * time.Second
+
+// dnsRefresher : Resolves the hosts of the targets again every interval, and
+// once their addresses change closes the idle connections and has every client
+// send its next request with Connection: close, so that the persistent
+// connections move over to the new addresses
+type dnsRefresher struct {
+	generation int64 // first for its alignment on 32 bits
+	hosts      []string
+	interval   time.Duration
+	ipVersion  int
+	transport  *http.Transport
+	lookup     func(ctx context.Context, host string) ([]net.IPAddr, error)
+	log        io.Writer
+	addrs      map[string]string
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// refreshedHosts are the host names of the targets, without the addresses and
+// the hosts pinned with -resolve, which have nothing to resolve
+func refreshedHosts(targets []Target, sockets SocketOptions) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, target := range targets {
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" || u.Scheme == "wss" {
+				port = "443"
+			}
+		}
+		address := net.JoinHostPort(host, port)
+		if seen[host] || net.ParseIP(host) != nil || sockets.Resolve.pin(address) != address {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// startDNSRefresh resolves the hosts of the targets for the first time and
+// keeps refreshing them, it returns nil when there is no host to resolve
+func startDNSRefresh(targets []Target, sockets SocketOptions, interval time.Duration,
+	transport *http.Transport, log io.Writer) *dnsRefresher {
+
+	hosts := refreshedHosts(targets, sockets)
+	if len(hosts) == 0 {
+		return nil
+	}
+	r := &dnsRefresher{
+		hosts:     hosts,
+		interval:  interval,
+		ipVersion: sockets.IPVersion,
+		transport: transport,
+		lookup:    net.DefaultResolver.LookupIPAddr,
+		log:       log,
+		addrs:     make(map[string]string),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	r.refresh()
+	go r.run()
+	return r
+}
+
+func (r *dnsRefresher) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// resolve lists the addresses of the host in order, of the ip version if any
+func (r *dnsRefresher) resolve(host string) (string, error) {
+	addrs, err := lookupAddrs(r.lookup, host, r.ipVersion)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(addrs, ", "), nil
+}
+
+// lookupAddrs resolves the host to its addresses in order, keeping those of
+// the ip version only when one is set
+func lookupAddrs(lookup func(ctx context.Context, host string) ([]net.IPAddr, error),
+	host string, ipVersion int) ([]string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	found, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	addrs := make([]string, 0, len(found))
+	for _, addr := range found {
+		v4 := addr.IP.To4() != nil
+		if (ipVersion == 4 && !v4) || (ipVersion == 6 && v4) || seen[addr.IP.String()] {
+			continue
+		}
+		seen[addr.IP.String()] = true
+		addrs = append(addrs, addr.IP.String())
+	}
+	if len(addrs) == 0 && ipVersion != 0 {
+		return nil, fmt.Errorf("no ipv%d address", ipVersion)
+	} else if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address")
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// refresh resolves every host again and rotates the connections if any of
+// them moved, a host failing to resolve keeps its previous addresses
+func (r *dnsRefresher) refresh() {
+	changed := false
+	for _, host := range r.hosts {
+		addrs, err := r.resolve(host)
+		if err != nil {
+			r.logf("Failed resolving %s again: %s\n", host, err)
+			continue
+		}
+		if previous, ok := r.addrs[host]; ok && previous != addrs {
+			r.logf("Addresses of %s changed from %s to %s, reconnecting\n", host, previous, addrs)
+			changed = true
+		}
+		r.addrs[host] = addrs
+	}
+	if changed {
+		atomic.AddInt64(&r.generation, 1)
+		r.transport.CloseIdleConnections()
+	}
+}
+
+func (r *dnsRefresher) logf(format string, args ...interface{}) {
+	if r.log != nil {
+		fmt.Fprintf(r.log, format, args...)
+	}
+}
+
+// moved tells a client whether the addresses changed since it last asked, so
+// that it closes the connection of its next request, it is safe to call on a
+// nil refresher
+func (r *dnsRefresher) moved(seen *int64) bool {
+	if r == nil {
+		return false
+	}
+	generation := atomic.LoadInt64(&r.generation)
+	if generation == *seen {
+		return false
+	}
+	*seen = generation
+	return true
+}
+
+// Close stops the refreshing, it is safe to call on a nil refresher
+func (r *dnsRefresher) Close() {
+	if r != nil {
+		close(r.stop)
+		<-r.done
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRefreshedHosts(t *testing.T) {
+	pinned := resolveFlag{}
+	pinned.Set("pinned.local:10.0.0.9")
+	targets := []Target{
+		{URL: "http://api.local:5000/predict"},
+		{URL: "http://API.local:5001/predict"},
+		{URL: "https://secure.local/predict"},
+		{URL: "http://10.0.0.1:5000/predict"},
+		{URL: "http://[::1]:5000/predict"},
+		{URL: "http://pinned.local/predict"},
+	}
+	got := refreshedHosts(targets, SocketOptions{Resolve: pinned})
+	if want := []string{"api.local", "secure.local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refreshedHosts() = %v, want %v", got, want)
+	}
+}
+
+func TestDNSRefresh(t *testing.T) {
+	addrs := map[string][]string{"api.local": {"10.0.0.2", "10.0.0.1", "fd00::1"}}
+	var log bytes.Buffer
+	r := &dnsRefresher{
+		hosts:     []string{"api.local"},
+		ipVersion: 4,
+		transport: &http.Transport{},
+		log:       &log,
+		addrs:     make(map[string]string),
+		lookup: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			if addrs[host] == nil {
+				return nil, errors.New("no such host")
+			}
+			var found []net.IPAddr
+			for _, addr := range addrs[host] {
+				found = append(found, net.IPAddr{IP: net.ParseIP(addr)})
+			}
+			return found, nil
+		},
+	}
+	var seen int64
+	r.refresh()
+	if r.addrs["api.local"] != "10.0.0.1, 10.0.0.2" || r.moved(&seen) {
+		t.Fatalf("first resolved %q, moved %v, want the ipv4 addresses in order and no move", r.addrs["api.local"], r.moved(&seen))
+	}
+
+	// The same addresses in another order are no change
+	addrs["api.local"] = []string{"10.0.0.1", "10.0.0.2"}
+	r.refresh()
+	if r.moved(&seen) {
+		t.Errorf("moved without a change of the addresses")
+	}
+
+	addrs["api.local"] = []string{"10.0.0.3"}
+	r.refresh()
+	if !r.moved(&seen) || r.moved(&seen) {
+		t.Errorf("a change of the addresses should move a client exactly once")
+	}
+	if !strings.Contains(log.String(), "Addresses of api.local changed from 10.0.0.1, 10.0.0.2 to 10.0.0.3") {
+		t.Errorf("logged %q, want the change", log.String())
+	}
+
+	// A failed lookup keeps the addresses it had
+	addrs["api.local"] = nil
+	r.refresh()
+	if r.addrs["api.local"] != "10.0.0.3" || r.moved(&seen) || !strings.Contains(log.String(), "Failed resolving api.local again") {
+		t.Errorf("after a failed lookup got %q and logged %q", r.addrs["api.local"], log.String())
+	}
+
+	var none *dnsRefresher
+	if none.moved(&seen) {
+		t.Errorf("a nil refresher moved")
+	}
+	none.Close()
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+)
+
+// dryRunPreview is the number of bytes of the body shown by the dry run
+const dryRunPreview = 512
+
+// firstCannonball builds the first cannonball of the task the way a client
+// would right before firing it
+func firstCannonball(task *Task, opt *Options) *Cannonball {
+	first := *task
+	first.NumRequests = 1
+	quit := make(chan struct{})
+	defer close(quit)
+	ball := <-producePayloads(&first, opt, 1, quit)
+
+	var user *virtualUser
+	if opt.Scenario != nil {
+		user = newVirtualUser(opt.Scenario)
+	}
+	ball = aim(ball, user, opt, opt.Random.stream(streamWorkers))
+	if opt.Script != nil {
+		hooks, err := opt.Script.instance()
+		if err != nil {
+			return &Cannonball{err: err}
+		}
+		defer hooks.close()
+		ball = hooks.beforeRequest(ball)
+	}
+	return ball
+}
+
+// dryRun prints the first request of the task instead of sending it
+func dryRun(w io.Writer, task *Task, opt *Options) error {
+	ball := firstCannonball(task, opt)
+	if err := printRequest(w, "", task.Targets[0].URL, ball, opt); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nPayload: %s", formatBytes(float64(len(ball.Body))))
+	if ball.RawSize > 0 {
+		fmt.Fprintf(w, " (%s before compression)", formatBytes(float64(ball.RawSize)))
+	}
+	fmt.Fprint(w, "\n")
+	if len(ball.Body) > 0 {
+		fmt.Fprintln(w, previewBody(ball.Body, dryRunPreview))
+	}
+	return nil
+}
+
+// printRequest writes the request line and the headers the cannonball is sent
+// with, every line behind the prefix
+func printRequest(w io.Writer, prefix string, endpoint string, ball *Cannonball, opt *Options) error {
+	if ball.err != nil {
+		return ball.err
+	}
+	req, err := newRequest(endpoint, ball, nil, opt)
+	if err != nil {
+		return err
+	}
+	if opt.Protocol == protocolWS {
+		target, err := wsURL(endpoint, ball.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%sWS %s\n", prefix, target)
+	} else {
+		fmt.Fprintf(w, "%s%s %s\n", prefix, req.Method, req.URL)
+	}
+	if req.Host != req.URL.Host {
+		fmt.Fprintf(w, "%sHost: %s\n", prefix, req.Host)
+	}
+	printHeader(w, prefix, req.Header)
+	return nil
+}
+
+// printHeader writes the header lines sorted by name
+func printHeader(w io.Writer, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// previewBody cuts the body down to the limit on a character boundary, the
+// binary bodies are only told apart
+func previewBody(body []byte, limit int) string {
+	if !utf8.Valid(body) {
+		return "(binary body)"
+	}
+	if len(body) <= limit {
+		return string(body)
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:cut], len(body)-cut)
+}
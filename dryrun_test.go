@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestPreviewBody(t *testing.T) {
+	tests := []struct {
+		body  string
+		limit int
+		want  string
+	}{
+		{"", 8, ""},
+		{`{"id":1}`, 8, `{"id":1}`},
+		{`{"id":12}`, 8, `{"id":12... (1 more bytes)`},
+		{"abécd", 3, "ab... (4 more bytes)"},
+		{"\x1f\x8b\x08\x00\xff", 8, "(binary body)"},
+	}
+	for _, test := range tests {
+		if got := previewBody([]byte(test.body), test.limit); got != test.want {
+			t.Errorf("previewBody(%q, %d) = %q, want %q", test.body, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	task := &Task{
+		Targets: []Target{{Name: "api", URL: "http://127.0.0.1:8080"}},
+		Corpus: []*Cannonball{{Method: "PUT", Path: "/items/7", Body: []byte(`{"id":7}`),
+			Header: http.Header{"Content-Type": {"application/json"}}}},
+		NumRequests: 100,
+	}
+	opt := &Options{Host: "api.example.com", Auth: &bearerAuth{token: "secret"}}
+	var out bytes.Buffer
+	if err := dryRun(&out, task, opt); err != nil {
+		t.Fatalf("dryRun failed: %s", err)
+	}
+	want := "PUT http://127.0.0.1:8080/items/7\n" +
+		"Host: api.example.com\n" +
+		"Authorization: Bearer secret\n" +
+		"Content-Type: application/json\n" +
+		"\n" +
+		"Payload: 8 B\n" +
+		"{\"id\":7}\n"
+	if out.String() != want {
+		t.Errorf("dryRun printed %q, want %q", out.String(), want)
+	}
+}
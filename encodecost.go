@@ -0,0 +1,149 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// encodeCost : Time a payload took to make on the client, stage by stage
+type encodeCost struct {
+	noise  time.Duration
+	image  time.Duration
+	base64 time.Duration
+	json   time.Duration
+}
+
+func (c encodeCost) total() time.Duration {
+	return c.noise + c.image + c.base64 + c.json
+}
+
+// ClientCost : Client time spent making the payloads of a task, kept apart
+// from the latencies which only cover the network and the server
+type ClientCost struct {
+	Payloads    int     `json:"payloads"`
+	Noise       Millis  `json:"noise"`
+	Image       Millis  `json:"image"`
+	Base64      Millis  `json:"base64"`
+	JSON        Millis  `json:"json"`
+	Compressed  int     `json:"compressed,omitempty"`
+	Compression Millis  `json:"compression,omitempty"`
+	Seconds     float64 `json:"seconds"`
+	PerRequest  Millis  `json:"per_request"`
+	Format      string  `json:"format"`
+}
+
+// encodeStats : Accumulates the costs of the payloads as the producers make
+// them, a nil one records nothing
+type encodeStats struct {
+	mu          sync.Mutex
+	payloads    int
+	cost        encodeCost
+	compressed  int
+	compression time.Duration
+}
+
+func newEncodeStats() *encodeStats {
+	return &encodeStats{}
+}
+
+// made records the cost of a freshly encoded payload and passes it through
+func (s *encodeStats) made(ball *Cannonball) *Cannonball {
+	if s == nil {
+		return ball
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads++
+	s.cost.noise += ball.cost.noise
+	s.cost.image += ball.cost.image
+	s.cost.base64 += ball.cost.base64
+	s.cost.json += ball.cost.json
+	return ball
+}
+
+// compressedIn records the time a body took to compress
+func (s *encodeStats) compressedIn(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compressed++
+	s.compression += d
+}
+
+// summarize is nil unless an image got encoded, the stages are averaged per
+// payload and the whole cost is spread over the requests of the task
+func (s *encodeStats) summarize(numRequests int, encoding Encoding) *ClientCost {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.payloads == 0 {
+		return nil
+	}
+	perPayload := func(d time.Duration) Millis {
+		return Millis(d.Seconds() * 1000 / float64(s.payloads))
+	}
+	total := s.cost.total() + s.compression
+	cost := &ClientCost{
+		Payloads: s.payloads,
+		Noise:    perPayload(s.cost.noise),
+		Image:    perPayload(s.cost.image),
+		Base64:   perPayload(s.cost.base64),
+		JSON:     perPayload(s.cost.json),
+		Seconds:  total.Seconds(),
+		Format:   encoding.Format,
+	}
+	if s.compressed > 0 {
+		cost.Compressed = s.compressed
+		cost.Compression = Millis(s.compression.Seconds() * 1000 / float64(s.compressed))
+	}
+	if numRequests > 0 {
+		cost.PerRequest = Millis(total.Seconds() * 1000 / float64(numRequests))
+	}
+	return cost
+}
+
+func describeClientCost(cost *ClientCost, avg Millis) string {
+	stages := []string{
+		fmt.Sprintf("noise %.2f", float64(cost.Noise)),
+		fmt.Sprintf("%s %.2f", cost.Format, float64(cost.Image)),
+		fmt.Sprintf("base64 %.2f", float64(cost.Base64)),
+		fmt.Sprintf("json %.2f", float64(cost.JSON)),
+	}
+	payloads := "payloads"
+	if cost.Payloads == 1 {
+		payloads = "payload"
+	}
+	description := fmt.Sprintf("%d %s at %.2f ms each (%s)", cost.Payloads, payloads,
+		float64(cost.Noise+cost.Image+cost.Base64+cost.JSON), strings.Join(stages, ", "))
+	if cost.Compressed > 0 {
+		description += fmt.Sprintf(", %d bodies compressed at %.2f ms each", cost.Compressed, float64(cost.Compression))
+	}
+	return description + fmt.Sprintf(", %.2f ms of client time per request next to %.2f ms of latency",
+		float64(cost.PerRequest), float64(avg))
+}
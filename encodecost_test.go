@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"image"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMakeCannonballCost(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	tests := []struct {
+		rnd   *rand.Rand
+		noise bool
+	}{
+		{rnd: nil, noise: false},
+		{rnd: rand.New(rand.NewSource(1)), noise: true},
+	}
+	for _, test := range tests {
+		ball := makeCannonball(img, test.rnd, 2, Encoding{Format: formatJPEG, Quality: 90})
+		if ball.cost.image <= 0 || ball.cost.base64 <= 0 || ball.cost.json <= 0 {
+			t.Errorf("noise %v: got no time of a stage, %+v", test.noise, ball.cost)
+		}
+		if (ball.cost.noise > 0) != test.noise {
+			t.Errorf("noise %v: got %v of noise", test.noise, ball.cost.noise)
+		}
+	}
+}
+
+func TestEncodeStats(t *testing.T) {
+	var none *encodeStats
+	none.made(&Cannonball{})
+	none.compressedIn(time.Millisecond)
+	if cost := none.summarize(10, Encoding{Format: formatJPEG}); cost != nil {
+		t.Errorf("got %+v from no stats", cost)
+	}
+	if cost := newEncodeStats().summarize(10, Encoding{Format: formatJPEG}); cost != nil {
+		t.Errorf("got %+v without any payload", cost)
+	}
+
+	stats := newEncodeStats()
+	for _, noise := range []time.Duration{2 * time.Millisecond, 4 * time.Millisecond} {
+		stats.made(&Cannonball{cost: encodeCost{
+			noise: noise, image: 10 * time.Millisecond, base64: time.Millisecond, json: time.Millisecond,
+		}})
+	}
+	stats.compressedIn(3 * time.Millisecond)
+	cost := stats.summarize(10, Encoding{Format: formatPNG})
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{name: "noise", got: float64(cost.Noise), want: 3},
+		{name: "image", got: float64(cost.Image), want: 10},
+		{name: "base64", got: float64(cost.Base64), want: 1},
+		{name: "json", got: float64(cost.JSON), want: 1},
+		{name: "compression", got: float64(cost.Compression), want: 3},
+		{name: "per request", got: float64(cost.PerRequest), want: 3.3},
+		{name: "seconds", got: cost.Seconds, want: 0.033},
+	}
+	for _, test := range tests {
+		if test.got < test.want-1e-9 || test.got > test.want+1e-9 {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	if cost.Payloads != 2 || cost.Compressed != 1 || cost.Format != formatPNG {
+		t.Errorf("got %+v", cost)
+	}
+
+	description := describeClientCost(cost, 20)
+	for _, part := range []string{"2 payloads at 15.00 ms each", "png 10.00", "1 bodies compressed at 3.00 ms",
+		"3.30 ms of client time per request next to 20.00 ms of latency"} {
+		if !strings.Contains(description, part) {
+			t.Errorf("%q is missing %q", description, part)
+		}
+	}
+}
+
+func TestProducePayloadsCost(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rand.Intn(256))
+	}
+	tests := []struct {
+		noise    float64
+		payloads int
+	}{
+		{noise: 0, payloads: 1},
+		{noise: 1, payloads: 6},
+	}
+	for _, test := range tests {
+		task := &Task{Image: img, Scale: 1, Batch: 1, Noise: test.noise, NumRequests: 5,
+			Encoding: Encoding{Format: formatJPEG, Quality: 90}, costs: newEncodeStats()}
+		quit := make(chan struct{})
+		for range producePayloads(task, &Options{}, 1, quit) {
+		}
+		close(quit)
+		cost := task.costs.summarize(task.NumRequests, task.Encoding)
+		if cost == nil || cost.Payloads != test.payloads {
+			t.Errorf("noise %v: got %+v, want %d payloads", test.noise, cost, test.payloads)
+		}
+	}
+}
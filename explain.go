@@ -0,0 +1,262 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// authHeaders are the request headers telling that the recorded requests carry credentials
+var authHeaders = []string{"Authorization", "Cookie", "X-Api-Key"}
+
+// explainPlan prints what the run is going to do without firing a single request
+func explainPlan(w io.Writer, f *attackFlags, endpoint string, targets []Target, corpus []*Cannonball,
+	generator payloadGenerator, img image.Image, source string, scenario *Scenario, mix *Mix, feed *dataFeed, auth Authenticator,
+	sign *signer, proxy *url.URL, milestones []Milestone, search *sweep, shape *pattern) {
+
+	fmt.Fprintf(w, "Plan for %s\n\n", endpoint)
+
+	names := make([]string, len(targets))
+	for i, target := range targets {
+		names[i] = target.Name
+	}
+	fmt.Fprintf(w, "Targets:   %s", strings.Join(names, ", "))
+	if *f.k8sService != "" {
+		fmt.Fprintf(w, " (pods of %s)", *f.k8sService)
+	}
+	if *f.fanOut != "" {
+		fmt.Fprintf(w, " (addresses of the host, %s)", *f.fanOut)
+	}
+	if *f.unixSocket != "" {
+		fmt.Fprintf(w, " (over %s)", *f.unixSocket)
+	}
+	fmt.Fprint(w, "\n")
+	if *f.host != "" {
+		fmt.Fprintf(w, "Host:      %s\n", *f.host)
+	}
+	if len(f.resolve) > 0 {
+		fmt.Fprintf(w, "Resolve:   %s\n", f.resolve)
+	}
+	if *f.ipVersion != 0 {
+		fmt.Fprintf(w, "Network:   ipv%d only\n", *f.ipVersion)
+	}
+	if *f.protocol == protocolWS {
+		fmt.Fprintf(w, "Protocol:  websocket, a connection per client, each message waits for its reply\n")
+	}
+
+	switch {
+	case corpus != nil && f.speed > 0:
+		fmt.Fprintf(w, "Payload:   %d logged requests at their times over %v", len(corpus), corpus[len(corpus)-1].At)
+		if f.speed != 1 {
+			fmt.Fprintf(w, ", %gx as fast", f.speed)
+		}
+		fmt.Fprint(w, "\n")
+	case corpus != nil:
+		fmt.Fprintf(w, "Payload:   %d recorded requests\n", len(corpus))
+	case generator != nil:
+		fmt.Fprintf(w, "Payload:   generated by %s\n", generator)
+	case *f.body != "":
+		fmt.Fprint(w, "Payload:   body template\n")
+	default:
+		bounds := img.Bounds()
+		origin := *f.imagePath
+		if *f.synthetic != "" {
+			origin = "synthetic image"
+		}
+		fmt.Fprintf(w, "Payload:   %s encoded at %dx%d", origin, bounds.Dx(), bounds.Dy())
+		if source != "" {
+			fmt.Fprintf(w, " (%s)", source)
+		}
+		fmt.Fprint(w, "\n")
+	}
+	if scenario != nil {
+		fmt.Fprintf(w, "Scenario:  %s, a step per request\n", scenario)
+	}
+	if mix != nil {
+		fmt.Fprintf(w, "Mix:       %s\n", mix)
+	}
+	if feed != nil {
+		order := "cycled through"
+		if feed.random {
+			order = "picked at random"
+		}
+		fmt.Fprintf(w, "Data:      %d rows of %s %s\n", len(feed.rows), strings.Join(feed.columns, ", "), order)
+	}
+	if *f.body != "" || len(f.header) > 0 {
+		parts := make([]string, 0, 2)
+		if *f.body != "" {
+			parts = append(parts, "body")
+		}
+		if len(f.header) > 0 {
+			parts = append(parts, f.header.String())
+		}
+		fmt.Fprintf(w, "Template:  %s\n", strings.Join(parts, ", "))
+	}
+	if *f.poll != "" {
+		until := "a 200 response"
+		if *f.pollUntil != "" {
+			until = *f.pollUntil
+		}
+		fmt.Fprintf(w, "Polling:   %s every %v until %s, failing after %v\n", *f.poll, *f.pollInterval, until, *f.pollTimeout)
+	}
+	fmt.Fprintf(w, "Auth:      %s\n", describeAuth(auth, corpus))
+	if *f.cookies || len(f.sticky) > 0 {
+		fmt.Fprintf(w, "Identity:  %s\n", &identityTemplate{Cookies: *f.cookies, Header: http.Header(f.sticky)})
+	}
+	if sign != nil {
+		fmt.Fprintf(w, "Signature: %s\n", sign)
+	}
+	if proxy != nil {
+		fmt.Fprintf(w, "Proxy:     %s://%s", proxy.Scheme, proxy.Host)
+		if proxy.User != nil {
+			fmt.Fprintf(w, " as %s", proxy.User.Username())
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	if *f.waitReady != "" {
+		fmt.Fprintf(w, "Readiness: %s answers 2xx, waiting up to %v\n", *f.waitReady, *f.readyTimeout)
+	}
+
+	if search != nil {
+		fmt.Fprintf(w, "\nFind max:  %s from %g doubling, then bisecting, %d requests per step, up to %d steps\n",
+			search.result.Mode, search.start, milestones[0].NumRequests, sweepMaxSteps)
+		fmt.Fprintf(w, "Limits:    %s\n", search.result.Limits.describe())
+	} else {
+		fmt.Fprint(w, "\nStages:\n")
+		fmt.Fprintln(w, "      #   requests   clients  payload")
+		total := 0
+		for i, milestone := range milestones {
+			payload := milestone.Payload()
+			if corpus != nil {
+				payload = "recorded"
+			} else if payload == "" {
+				payload = "clean"
+			}
+			fmt.Fprintf(w, "  %5d%11d%10d  %s\n", i+1, milestone.NumRequests, milestone.NumClients, payload)
+			total += milestone.NumRequests
+		}
+		fmt.Fprintf(w, "\nTotal:     %d requests", total)
+		if *f.maxRPS > 0 {
+			least := time.Duration(float64(total) / *f.maxRPS * float64(time.Second))
+			fmt.Fprintf(w, ", at least %v at %g req/s", least.Round(time.Second), *f.maxRPS)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	pacing := "as fast as the clients go"
+	if search != nil && search.result.Mode == "rps" {
+		pacing = fmt.Sprintf("rate set by the search, %d clients", *f.numClients)
+	} else if shape != nil {
+		pacing = shape.String()
+	} else if *f.maxRPS > 0 {
+		pacing = fmt.Sprintf("capped at %g req/s", *f.maxRPS)
+	}
+	if *f.arrival == arrivalPoisson {
+		pacing += ", poisson arrivals"
+	}
+	if *f.honor429 {
+		pacing += ", clients back off on 429"
+	}
+	if *f.think > 0 || *f.thinkJitter > 0 {
+		pause := (*f.think).String()
+		if *f.thinkJitter > 0 {
+			pause += " ± " + (*f.thinkJitter).String()
+		}
+		pacing += ", clients pause " + pause + " between requests"
+	}
+	fmt.Fprintf(w, "Pacing:    %s\n", pacing)
+	if *f.chunked > 0 {
+		fmt.Fprintf(w, "Bodies:    %s\n", &chunking{size: *f.chunked, interval: *f.chunkInterval})
+	}
+	if *f.uploadRate != "" || *f.readRate != "" {
+		var limits []string
+		if *f.uploadRate != "" {
+			limits = append(limits, "sends at "+*f.uploadRate)
+		}
+		if *f.readRate != "" {
+			limits = append(limits, "reads at "+*f.readRate)
+		}
+		fmt.Fprintf(w, "Bandwidth: every request %s\n", strings.Join(limits, ", "))
+	}
+	if f.isSet("seed") {
+		producers := "a single producer"
+		if n := f.numProducers(); n > 1 {
+			producers = fmt.Sprintf("%d producers", n)
+		}
+		fmt.Fprintf(w, "Seed:      %d, payloads made by %s\n", *f.seed, producers)
+	}
+	if *f.cooldown > 0 {
+		fmt.Fprintf(w, "Cooldown:  %v of probes at %g req/s once the load is over\n", *f.cooldown, *f.cooldownRate)
+	}
+
+	checks := []string{fmt.Sprintf("timeout %gs", *f.timeout), "status 200 counts as success"}
+	if *f.maxResponse > 0 {
+		checks = append(checks, fmt.Sprintf("responses up to %s", formatBytes(float64(*f.maxResponse))))
+	}
+	if *f.validateJSON {
+		checks = append(checks, "json bodies validated")
+	}
+	if *f.script != "" {
+		checks = append(checks, "hooks of "+*f.script)
+	}
+	if *f.golden != "" {
+		checks = append(checks, "bodies compared to "+*f.golden)
+	}
+	if *f.fuzz > 0 {
+		checks = append(checks, fmt.Sprintf("%g%% of the bodies fuzzed expecting a 4xx", 100*(*f.fuzz)))
+	}
+	if *f.extract != "" {
+		checks = append(checks, "captures "+*f.extract)
+	}
+	fmt.Fprintf(w, "Checks:    %s\n", strings.Join(checks, ", "))
+}
+
+// describeAuth tells how the requests are authenticated
+func describeAuth(auth Authenticator, corpus []*Cannonball) string {
+	if auth != nil {
+		return auth.String()
+	}
+	counts := make(map[string]int)
+	for _, ball := range corpus {
+		for _, name := range authHeaders {
+			if ball.Header.Get(name) != "" {
+				counts[name]++
+			}
+		}
+	}
+	parts := make([]string, 0)
+	for _, name := range authHeaders {
+		if counts[name] > 0 {
+			parts = append(parts, fmt.Sprintf("%s header on %d of %d recorded requests", name, counts[name], len(corpus)))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
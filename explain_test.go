@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDescribeAuth(t *testing.T) {
+	ball := func(header string, value string) *Cannonball {
+		h := http.Header{}
+		if header != "" {
+			h.Set(header, value)
+		}
+		return &Cannonball{Method: "GET", Header: h}
+	}
+	tests := []struct {
+		auth   Authenticator
+		corpus []*Cannonball
+		want   string
+	}{
+		{nil, nil, "none"},
+		{&apikeyAuth{key: "secret"}, nil, "api key in the apikey query parameter"},
+		{&bearerAuth{token: "secret"}, []*Cannonball{ball("Authorization", "Bearer x")}, "bearer token"},
+		{nil, []*Cannonball{ball("", ""), ball("Accept", "*/*")}, "none"},
+		{nil, []*Cannonball{ball("Authorization", "Bearer x"), ball("", "")},
+			"Authorization header on 1 of 2 recorded requests"},
+		{nil, []*Cannonball{ball("Cookie", "a=b"), ball("X-Api-Key", "k")},
+			"Cookie header on 1 of 2 recorded requests, X-Api-Key header on 1 of 2 recorded requests"},
+	}
+	for i, test := range tests {
+		if got := describeAuth(test.auth, test.corpus); got != test.want {
+			t.Errorf("#%d: got %q, want %q", i, got, test.want)
+		}
+	}
+}
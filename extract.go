@@ -0,0 +1,96 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// extraction : A value to capture from the json responses
+type extraction struct {
+	name string
+	path *jsonPath
+}
+
+// parseExtracts reads a comma-separated list of name=$.path captures
+func parseExtracts(spec string) ([]extraction, error) {
+	extracts := make([]extraction, 0)
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf("capture %q should be name=$.path", part)
+		}
+		if seen[pair[0]] {
+			return nil, fmt.Errorf("value %s is captured twice", pair[0])
+		}
+		seen[pair[0]] = true
+		path, err := parseJSONPath(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		extracts = append(extracts, extraction{name: pair[0], path: path})
+	}
+	return extracts, nil
+}
+
+// compileExtracts turns a name to path map into captures ordered by the names
+func compileExtracts(paths map[string]string) ([]extraction, error) {
+	extracts := make([]extraction, 0, len(paths))
+	for name, expr := range paths {
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		extracts = append(extracts, extraction{name: name, path: path})
+	}
+	sort.Slice(extracts, func(i, j int) bool { return extracts[i].name < extracts[j].name })
+	return extracts, nil
+}
+
+// extractValues captures the values from a successful response into its
+// extracted ones, a value missing from the response fails it
+func extractValues(response *Response, extracts []extraction, opt *Options) {
+	if !response.Success || len(extracts) == 0 {
+		return
+	}
+	if response.raw != nil && response.encoding != "" {
+		decompress(response, opt)
+		if !response.Success {
+			return
+		}
+	}
+	if response.Extracted == nil {
+		response.Extracted = make(map[string]string, len(extracts))
+	}
+	for _, extract := range extracts {
+		value, err := extract.path.extract(response.raw)
+		if err != nil {
+			response.Success, response.Class = false, classExtract
+			response.Body = fmt.Sprintf("Failed extracting %s: %s", extract.name, err)
+			response.raw = nil
+			return
+		}
+		response.Extracted[extract.name] = value
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExtracts(t *testing.T) {
+	tests := []struct {
+		spec  string
+		names []string
+		fails bool
+	}{
+		{"id=$.prediction_id", []string{"id"}, false},
+		{"id=$.job.id, status=$.status", []string{"id", "status"}, false},
+		{"id", nil, true},
+		{"=$.id", nil, true},
+		{"id=job.id", nil, true},
+		{"id=$.a,id=$.b", nil, true},
+	}
+	for _, test := range tests {
+		extracts, err := parseExtracts(test.spec)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got no error", test.spec)
+			}
+			continue
+		}
+		names := make([]string, len(extracts))
+		for i, extract := range extracts {
+			names[i] = extract.name
+		}
+		if err != nil || !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: got %v (%v), want %v", test.spec, names, err, test.names)
+		}
+	}
+}
+
+func TestExtractValues(t *testing.T) {
+	extracts, err := parseExtracts("id=$.prediction_id,score=$.scores[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body      string
+		success   bool
+		extracted map[string]string
+	}{
+		{`{"prediction_id": "p1", "scores": [0.5]}`, true, map[string]string{"id": "p1", "score": "0.5"}},
+		{`{"prediction_id": "p1"}`, false, map[string]string{"id": "p1"}},
+		{`not json`, false, map[string]string{}},
+	}
+	for _, test := range tests {
+		response := &Response{Success: true, raw: []byte(test.body)}
+		extractValues(response, extracts, &Options{})
+		if response.Success != test.success || !reflect.DeepEqual(response.Extracted, test.extracted) {
+			t.Errorf("%s: got success %v and %v", test.body, response.Success, response.Extracted)
+		}
+		if !test.success && response.Class != classExtract {
+			t.Errorf("%s: got class %q", test.body, response.Class)
+		}
+	}
+	failed := &Response{Success: false, raw: []byte(`{"prediction_id": "p1"}`)}
+	if extractValues(failed, extracts, &Options{}); failed.Extracted != nil {
+		t.Errorf("got values captured from a failed response")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxSavedFailures keeps a service failing every request from filling the disk
+const maxSavedFailures = 10000
+
+// failureRecord : A failed request with what came back of it, as saved by
+// -save-failures for a postmortem and for the retry-failures command
+type failureRecord struct {
+	Number    int             `json:"number"`
+	Task      int             `json:"task"`
+	Time      time.Time       `json:"time"`
+	Class     string          `json:"class"`
+	Error     string          `json:"error,omitempty"`
+	Latency   float64         `json:"latency"`
+	Worker    int             `json:"worker"`
+	Target    string          `json:"target,omitempty"`
+	TraceID   string          `json:"trace_id,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Timing    slowestTiming   `json:"timing"`
+	Request   failedRequest   `json:"request"`
+	Response  *failedResponse `json:"response,omitempty"`
+}
+
+// failedRequest : The request as it was fired, the body is base64 in json
+type failedRequest struct {
+	Protocol string      `json:"protocol"`
+	Endpoint string      `json:"endpoint"`
+	Method   string      `json:"method,omitempty"`
+	Path     string      `json:"path,omitempty"`
+	URL      string      `json:"url,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body"`
+}
+
+type failedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// failureLog : Writes every failed request of the run to a numbered file of
+// the directory, the numbers go on after the files already there
+type failureLog struct {
+	dir      string
+	protocol string
+	limit    int
+	saved    int
+	next     int
+	full     bool
+}
+
+func createFailureLog(dir string, protocol string) (*failureLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "[0-9]*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &failureLog{dir: dir, protocol: protocol, limit: maxSavedFailures, next: len(existing) + 1}, nil
+}
+
+// Save writes the failed response, once the log is full it tells so a single
+// time and then keeps quiet, it is safe to call on a nil log
+func (l *failureLog) Save(taskIndex int, response *Response) error {
+	if l == nil || response.Success || l.full {
+		return nil
+	}
+	if l.saved == l.limit {
+		l.full = true
+		return fmt.Errorf("saved %d failures, the rest are only counted", l.limit)
+	}
+
+	record := newFailureRecord(l.next, taskIndex, l.protocol, response)
+	data, err := json.MarshalIndent(&record, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(l.dir, fmt.Sprintf("%06d.json", l.next))
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		// A disk failing once will most likely fail the rest too
+		l.full = true
+		return err
+	}
+	l.saved++
+	l.next++
+	return nil
+}
+
+// newFailureRecord tells the error messages apart from the bodies of the
+// responses which came back with an unexpected status
+func newFailureRecord(number int, taskIndex int, protocol string, response *Response) failureRecord {
+	record := failureRecord{
+		Number:    number,
+		Task:      taskIndex + 1,
+		Time:      response.Fired,
+		Class:     response.Class,
+		Latency:   millis(response.Latency),
+		Worker:    response.Worker,
+		Target:    response.Target,
+		TraceID:   response.TraceID,
+		RequestID: response.RequestID,
+		Timing: slowestTiming{
+			DNS:     millis(response.Timing.DNS),
+			Connect: millis(response.Timing.Connect),
+			TLS:     millis(response.Timing.TLS),
+			Send:    millis(response.Timing.Send),
+			Wait:    millis(response.Timing.Wait),
+			Receive: millis(response.Timing.Receive),
+			Reused:  response.Timing.Reused,
+		},
+		Request: failedRequest{Protocol: protocol, Endpoint: response.endpoint},
+	}
+	if ball := response.ball; ball != nil {
+		record.Request.Method, record.Request.Path = ball.Method, ball.Path
+		record.Request.Header, record.Request.Body = ball.Header, ball.Body
+	}
+	if detail := response.Detail; detail != nil {
+		record.Request.URL, record.Request.Header = detail.URL, detail.RequestHeader
+	}
+
+	if response.Status == 0 || response.Class != statusClass(response.Status) {
+		record.Error = response.Body
+	}
+	if response.Status != 0 {
+		record.Response = &failedResponse{Status: response.Status}
+		if record.Error == "" {
+			record.Response.Body = response.Body
+		}
+		if response.Detail != nil {
+			record.Response.Header = response.Detail.ResponseHeader
+		}
+	}
+	return record
+}
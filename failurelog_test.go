@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFailureLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A previous run left a failure behind
+	if err := ioutil.WriteFile(filepath.Join(dir, "000001.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := createFailureLog(dir, protocolHTTP)
+	if err != nil {
+		t.Fatalf("createFailureLog() failed: %s", err)
+	}
+	failures.limit = 2
+	ball := &Cannonball{Method: "POST", Path: "/v1", Body: []byte{0xff, 0xd8}}
+	sent := http.Header{"Content-Type": {"image/jpeg"}, "Authorization": {"Bearer x"}}
+	responses := []Response{
+		{Success: true, Status: 200, Body: "fine"},
+		{Body: "Error while sending the request: connection refused", Class: classRefused,
+			Latency: 2 * time.Millisecond, ball: ball, endpoint: "http://api"},
+		{Body: "overloaded", Status: 503, Class: statusClass(503), Worker: 3, ball: ball, endpoint: "http://api",
+			Detail: &Detail{URL: "http://api/v1", RequestHeader: sent, ResponseHeader: http.Header{"Retry-After": {"1"}}}},
+		{Body: "Error while sending the request: timeout", Class: classTimeout},
+	}
+	errs := 0
+	for _, response := range responses {
+		if failures.Save(1, &response) != nil {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Errorf("Save() failed %d times, want once at the limit", errs)
+	}
+	var nothing *failureLog
+	if err := nothing.Save(0, &responses[1]); err != nil {
+		t.Errorf("Save() on a nil log failed: %s", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("saved %v, want 000002.json and 000003.json next to 000001.json", files)
+	}
+	want := []failureRecord{
+		{Number: 2, Task: 2, Class: classRefused, Error: "Error while sending the request: connection refused", Latency: 2,
+			Request: failedRequest{Protocol: protocolHTTP, Endpoint: "http://api", Method: "POST", Path: "/v1", Body: ball.Body}},
+		{Number: 3, Task: 2, Class: "http 503", Worker: 3,
+			Request: failedRequest{Protocol: protocolHTTP, Endpoint: "http://api", Method: "POST", Path: "/v1",
+				URL: "http://api/v1", Header: sent, Body: ball.Body},
+			Response: &failedResponse{Status: 503, Header: http.Header{"Retry-After": {"1"}}, Body: "overloaded"}},
+	}
+	for i, file := range files[1:] {
+		data, _ := ioutil.ReadFile(file)
+		var got failureRecord
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		got.Time = time.Time{}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("%s = %+v, want %+v", file, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// Failure classes of the requests which never got a proper response
+const (
+	classPrepare        = "prepare"
+	classTimeout        = "timeout"
+	classConnectTimeout = "connect timeout"
+	classTLSTimeout     = "tls timeout"
+	classHeaderTimeout  = "header timeout"
+	classDNS            = "dns"
+	classRefused        = "refused"
+	classConnect        = "connect"
+	classTLS            = "tls"
+	classSend           = "send"
+	classRead           = "read"
+	classOversized      = "oversized"
+	classInvalid        = "invalid body"
+	classGolden         = "golden mismatch"
+	classScript         = "script"
+	classExtract        = "extract"
+	classPoll           = "poll timeout"
+)
+
+// statusClass is the class of a response with an unexpected status code
+func statusClass(status int) string {
+	return fmt.Sprintf("http %d", status)
+}
+
+// classifyError tells what went wrong with a request that failed to complete
+func classifyError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return timeoutClass(err)
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return classDNS
+	}
+	var (
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		invalidErr   x509.CertificateInvalidError
+		hostnameErr  x509.HostnameError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &authorityErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr) || strings.Contains(err.Error(), "tls: ") ||
+		strings.Contains(err.Error(), "HTTP response to HTTPS client") {
+		return classTLS
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		// The errno differs between the platforms, the messages all say refused
+		if strings.Contains(opErr.Err.Error(), "refused") {
+			return classRefused
+		}
+		return classConnect
+	}
+	return classSend
+}
+
+// timeoutClass tells the phase which ran out of time, a connect, a handshake
+// or the wait for the response headers, or else the request as a whole
+func timeoutClass(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return classConnectTimeout
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		return classTLSTimeout
+	case strings.Contains(err.Error(), "timeout awaiting response headers"):
+		return classHeaderTimeout
+	}
+	return classTimeout
+}
+
+// Failure : The number of the failed requests of a single class and the
+// time it took them to fail
+type Failure struct {
+	Class     string `json:"class"`
+	Count     int    `json:"count"`
+	Median    Millis `json:"median"`
+	Max       Millis `json:"max"`
+	RequestID string `json:"request_id,omitempty"` // of the first failure of the class
+}
+
+// TimeToError : Latencies of the failed requests, left out of the stats unless
+// the failures are included, telling how long the clients wait for an error
+type TimeToError struct {
+	Mean   Millis `json:"mean"`
+	Median Millis `json:"median"`
+	P95    Millis `json:"p95"`
+	P99    Millis `json:"p99"`
+	Max    Millis `json:"max"`
+}
+
+func newTimeToError(latencies *latency.Accumulator) *TimeToError {
+	stats := latencies.FailedStats(95, 99)
+	if stats.Fails == 0 {
+		return nil
+	}
+	return &TimeToError{Millis(stats.Mean), Millis(stats.Median), Millis(stats.Percentiles[0]),
+		Millis(stats.Percentiles[1]), Millis(stats.Max)}
+}
+
+func describeTimeToError(t *TimeToError) string {
+	return fmt.Sprintf("mean %.0f ms, median %.0f, 95%% %.0f, 99%% %.0f, max %.0f", t.Mean, t.Median, t.P95, t.P99, t.Max)
+}
+
+// summarizeFailures orders the classes from the most frequent one
+func summarizeFailures(counts map[string]int) []Failure {
+	failures := make([]Failure, 0, len(counts))
+	for class, count := range counts {
+		failures = append(failures, Failure{Class: class, Count: count})
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Count != failures[j].Count {
+			return failures[i].Count > failures[j].Count
+		}
+		return failures[i].Class < failures[j].Class
+	})
+	return failures
+}
+
+// printFailures adds the request id of the first failure of every class
+// when the requests carried them
+func printFailures(w io.Writer, failures []Failure, numFails int) {
+	if !failuresIdentified(failures) {
+		fmt.Fprintln(w, " Failure          # reqs   share   median     max  ")
+		fmt.Fprintln(w, strings.Repeat("-", 52))
+		for _, failure := range failures {
+			fmt.Fprintf(w, " %-14s%9d%7.1f%%%9.0f%8.0f\n", failure.Class, failure.Count,
+				100*float64(failure.Count)/float64(numFails), failure.Median, failure.Max)
+		}
+		return
+	}
+	fmt.Fprintln(w, " Failure          # reqs   share   median     max   first request id                     ")
+	fmt.Fprintln(w, strings.Repeat("-", 90))
+	for _, failure := range failures {
+		fmt.Fprintf(w, " %-14s%9d%7.1f%%%9.0f%8.0f   %-36s\n", failure.Class, failure.Count,
+			100*float64(failure.Count)/float64(numFails), failure.Median, failure.Max, failure.RequestID)
+	}
+}
+
+func markdownFailures(w io.Writer, failures []Failure, numFails int) {
+	if !failuresIdentified(failures) {
+		fmt.Fprintln(w, "| Failure | # reqs | share | median | max |")
+		fmt.Fprintln(w, "|:--------|-------:|------:|-------:|----:|")
+		for _, failure := range failures {
+			fmt.Fprintf(w, "| %s | %d | %.1f%% | %.0f | %.0f |\n", failure.Class, failure.Count,
+				100*float64(failure.Count)/float64(numFails), failure.Median, failure.Max)
+		}
+		return
+	}
+	fmt.Fprintln(w, "| Failure | # reqs | share | median | max | first request id |")
+	fmt.Fprintln(w, "|:--------|-------:|------:|-------:|----:|:-----------------|")
+	for _, failure := range failures {
+		fmt.Fprintf(w, "| %s | %d | %.1f%% | %.0f | %.0f | %s |\n", failure.Class, failure.Count,
+			100*float64(failure.Count)/float64(numFails), failure.Median, failure.Max, failure.RequestID)
+	}
+}
+
+func failuresIdentified(failures []Failure) bool {
+	for _, failure := range failures {
+		if failure.RequestID != "" {
+			return true
+		}
+	}
+	return false
+}
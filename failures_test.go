@@ -0,0 +1,109 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// timeoutError : The timeouts of the transport, which only tell themselves apart by the message
+type timeoutError string
+
+func (e timeoutError) Error() string   { return string(e) }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Post", URL: "http://localhost/", Err: err}
+	}
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{wrap(context.DeadlineExceeded), classTimeout},
+		{wrap(&net.OpError{Op: "read", Net: "tcp", Err: context.DeadlineExceeded}), classTimeout},
+		{wrap(&net.OpError{Op: "dial", Net: "tcp", Err: context.DeadlineExceeded}), classConnectTimeout},
+		{wrap(timeoutError("net/http: TLS handshake timeout")), classTLSTimeout},
+		{wrap(timeoutError("net/http: timeout awaiting response headers")), classHeaderTimeout},
+		{wrap(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nowhere"}}), classDNS},
+		{wrap(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errors.New("connection refused"))}), classRefused},
+		{wrap(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errors.New("network is unreachable"))}), classConnect},
+		{wrap(x509.UnknownAuthorityError{}), classTLS},
+		{wrap(errors.New("http: server gave HTTP response to HTTPS client")), classTLS},
+		{wrap(errors.New("EOF")), classSend},
+	}
+	for _, test := range tests {
+		if class := classifyError(test.err); class != test.class {
+			t.Errorf("%v: got %q, want %q", test.err, class, test.class)
+		}
+	}
+}
+
+func TestSummarizeFailures(t *testing.T) {
+	failures := summarizeFailures(map[string]int{"http 500": 3, classTimeout: 7, classDNS: 3})
+	want := []Failure{{Class: classTimeout, Count: 7}, {Class: classDNS, Count: 3}, {Class: "http 500", Count: 3}}
+	if !reflect.DeepEqual(failures, want) {
+		t.Errorf("got %v, want %v", failures, want)
+	}
+}
+
+func TestPrintFailures(t *testing.T) {
+	id := "0f8fad5b-d9cb-469f-a165-70867728950e"
+	tests := []struct {
+		failures []Failure
+		markdown bool
+		want     string
+	}{
+		{[]Failure{{Class: classTimeout, Count: 2, Median: 10000, Max: 10002}}, false,
+			" timeout               2  100.0%    10000   10002\n"},
+		{[]Failure{{Class: classTimeout, Count: 2, Median: 10000, Max: 10002, RequestID: id}}, false,
+			" timeout               2  100.0%    10000   10002   " + id + "\n"},
+		{[]Failure{{Class: classTimeout, Count: 2, Median: 10000, Max: 10002}}, true,
+			"| timeout | 2 | 100.0% | 10000 | 10002 |\n"},
+		{[]Failure{{Class: classTimeout, Count: 2, Median: 10000, Max: 10002, RequestID: id}}, true,
+			"| timeout | 2 | 100.0% | 10000 | 10002 | " + id + " |\n"},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		if test.markdown {
+			markdownFailures(&buf, test.failures, 2)
+		} else {
+			printFailures(&buf, test.failures, 2)
+		}
+		lines := strings.SplitAfter(buf.String(), "\n")
+		if got := lines[2]; got != test.want {
+			t.Errorf("#%d: got %q, want %q", i, got, test.want)
+		}
+		if header := lines[0]; strings.Contains(header, "request id") != (test.failures[0].RequestID != "") {
+			t.Errorf("#%d: got header %q", i, header)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+const starvationFactor = 4
+
+// idleFactor is how many times fewer requests than its typical peer make a worker idle
+const idleFactor = 2
+
+// Fairness : Completion interleaving analysis of the workers within a task
+type Fairness struct {
+	Index         float64 `json:"index"`
+	StarvedWorker int     `json:"starved_worker"`
+	MaxGap        int     `json:"max_gap"`
+	ExpectedGap   int     `json:"expected_gap"`
+}
+
+// fairnessTracker : Per-worker completion counts and the longest gaps
+// between them, kept as the completions come in so that the memory stays
+// the same however long the run
+type fairnessTracker struct {
+	completed int
+	counts    []int
+	last      []int
+	gaps      []int
+}
+
+func (f *fairnessTracker) add(worker int) {
+	for len(f.counts) <= worker {
+		f.counts, f.last, f.gaps = append(f.counts, 0), append(f.last, -1), append(f.gaps, 0)
+	}
+	f.counts[worker]++
+	if gap := f.completed - f.last[worker] - 1; gap > f.gaps[worker] {
+		f.gaps[worker] = gap
+	}
+	f.last[worker] = f.completed
+	f.completed++
+}
+
+// analyze computes Jain's fairness index over per-worker completion counts
+// and finds the worker that waited the longest between completions
+func (f *fairnessTracker) analyze(numWorkers int) Fairness {
+	counts := make([]int, numWorkers)
+	gaps := make([]int, numWorkers)
+	for w := range gaps {
+		last := -1
+		if w < len(f.counts) {
+			counts[w], gaps[w], last = f.counts[w], f.gaps[w], f.last[w]
+		}
+		if gap := f.completed - last - 1; gap > gaps[w] {
+			gaps[w] = gap
+		}
+	}
+
+	var sum, sumSquares float64
+	for _, count := range counts {
+		sum += float64(count)
+		sumSquares += float64(count * count)
+	}
+
+	fairness := Fairness{Index: 1, ExpectedGap: numWorkers - 1}
+	if sumSquares > 0 {
+		fairness.Index = sum * sum / (float64(numWorkers) * sumSquares)
+	}
+	for w, gap := range gaps {
+		if gap > fairness.MaxGap {
+			fairness.MaxGap = gap
+			fairness.StarvedWorker = w
+		}
+	}
+
+	return fairness
+}
+
+func printFairness(w io.Writer, fairness *Fairness) {
+	fmt.Fprintf(w, "Fairness index: %.3f\n", fairness.Index)
+	fmt.Fprintf(w, "Longest wait: worker #%d skipped %d completions (expected ~%d)",
+		fairness.StarvedWorker, fairness.MaxGap, fairness.ExpectedGap)
+	if fairness.MaxGap > starvationFactor*(fairness.ExpectedGap+1) {
+		fmt.Fprint(w, ", possible head-of-line blocking")
+	}
+	fmt.Fprint(w, "\n")
+}
+
+func workerName(worker int) string {
+	return fmt.Sprintf("#%d", worker)
+}
+
+// summarizeWorkers lists every worker in order, the ones which never completed
+// a request included, and flags the idle ones next to the slow and failing
+func summarizeWorkers(b *breakdown, numWorkers int) []Breakdown {
+	rows := b.summarize()
+	byName := make(map[string]Breakdown, len(rows))
+	for _, row := range rows {
+		byName[row.Name] = row
+	}
+
+	workers := make([]Breakdown, numWorkers)
+	counts := make([]float64, numWorkers)
+	for w := range workers {
+		name := workerName(w)
+		row, ok := byName[name]
+		if !ok {
+			stats := latency.New().Stats(95)
+			row = Breakdown{Name: name, Avg: Millis(stats.Mean), Median: Millis(stats.Median),
+				P95: Millis(stats.Percentiles[0]), Max: Millis(stats.Max)}
+		}
+		workers[w], counts[w] = row, float64(row.NumRequests)
+	}
+
+	sort.Float64s(counts)
+	typical := latency.Percentile(counts, 50)
+	for w := range workers {
+		if numWorkers > 1 && float64(workers[w].NumRequests)*idleFactor < typical {
+			workers[w].Outlier = true
+		}
+	}
+	return workers
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyzeFairness(t *testing.T) {
+	tests := []struct {
+		name        string
+		completions []int
+		numWorkers  int
+		index       float64
+		starved     int
+		maxGap      int
+	}{
+		{"round robin", []int{0, 1, 2, 0, 1, 2}, 3, 1, 0, 2},
+		{"single worker", []int{0, 0, 0}, 1, 1, 0, 0},
+		{"one idle worker", []int{0, 0, 0, 0}, 2, 0.5, 1, 4},
+		{"late starter", []int{0, 0, 0, 0, 0, 0, 1, 0}, 2, 0.64, 1, 6},
+		{"no completions", []int{}, 2, 1, 0, 0},
+	}
+	for _, test := range tests {
+		var tracker fairnessTracker
+		for _, worker := range test.completions {
+			tracker.add(worker)
+		}
+		fairness := tracker.analyze(test.numWorkers)
+		if math.Abs(fairness.Index-test.index) > 1e-9 {
+			t.Errorf("%s: index = %g, want %g", test.name, fairness.Index, test.index)
+		}
+		if fairness.StarvedWorker != test.starved || fairness.MaxGap != test.maxGap {
+			t.Errorf("%s: worker #%d waited %d, want worker #%d waited %d", test.name,
+				fairness.StarvedWorker, fairness.MaxGap, test.starved, test.maxGap)
+		}
+		if fairness.ExpectedGap != test.numWorkers-1 {
+			t.Errorf("%s: expected gap = %d, want %d", test.name, fairness.ExpectedGap, test.numWorkers-1)
+		}
+	}
+}
+
+func TestSummarizeWorkers(t *testing.T) {
+	tests := []struct {
+		name       string
+		completed  []int
+		numWorkers int
+		counts     []int
+		outliers   []bool
+	}{
+		{"even", []int{0, 1, 0, 1}, 2, []int{2, 2}, []bool{false, false}},
+		{"never completed", []int{0, 0, 2, 2}, 3, []int{2, 0, 2}, []bool{false, true, false}},
+		{"idle", []int{0, 0, 0, 0, 1, 1, 1, 1, 2}, 3, []int{4, 4, 1}, []bool{false, false, true}},
+		{"single", []int{0}, 1, []int{1}, []bool{false}},
+	}
+	for _, test := range tests {
+		b := newBreakdown(false)
+		for i := len(test.completed) - 1; i >= 0; i-- {
+			b.add(workerName(test.completed[i]), 10, true)
+		}
+		rows := summarizeWorkers(b, test.numWorkers)
+		if len(rows) != test.numWorkers {
+			t.Fatalf("%s: got %d rows, want %d", test.name, len(rows), test.numWorkers)
+		}
+		for w, row := range rows {
+			if row.Name != workerName(w) || row.NumRequests != test.counts[w] || row.Outlier != test.outliers[w] {
+				t.Errorf("%s: row %d = %s with %d requests, outlier %v", test.name, w, row.Name, row.NumRequests, row.Outlier)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// fan-out modes, either the clients go to every address or they are split between them
+const (
+	fanOutEach   = "each"
+	fanOutSpread = "spread"
+)
+
+// fanOutTargets resolves the host of the endpoint and returns one target per
+// address it resolves to, so that a bad node behind a round-robin DNS name
+// stands out in the breakdown of the targets, along with the host to present
+func fanOutTargets(endpoint string, ipVersion int,
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)) ([]Target, string, error) {
+
+	base, err := url.Parse(endpoint)
+	if err != nil || base.Hostname() == "" {
+		return nil, "", fmt.Errorf("invalid target url %q", endpoint)
+	}
+	if net.ParseIP(base.Hostname()) != nil {
+		return nil, "", fmt.Errorf("%s is an address already", base.Hostname())
+	}
+	addrs, err := lookupAddrs(lookup, base.Hostname(), ipVersion)
+	if err != nil {
+		return nil, "", err
+	}
+
+	targets := make([]Target, 0, len(addrs))
+	for _, addr := range addrs {
+		target := *base
+		target.Host = addr
+		if ip := net.ParseIP(addr); ip.To4() == nil {
+			target.Host = "[" + addr + "]"
+		}
+		if port := base.Port(); port != "" {
+			target.Host = net.JoinHostPort(addr, port)
+		}
+		targets = append(targets, Target{Name: addr, URL: target.String()})
+	}
+	return targets, base.Host, nil
+}
+
+// fanOutSchedule gives every address the clients and the requests of the
+// schedule in the each mode, the spread mode splits them as they are
+func fanOutSchedule(milestones []Milestone, mode string, addrs int) []Milestone {
+	if mode != fanOutEach {
+		return milestones
+	}
+	scaled := make([]Milestone, len(milestones))
+	for i, milestone := range milestones {
+		milestone.NumClients *= addrs
+		milestone.NumRequests *= addrs
+		scaled[i] = milestone
+	}
+	return scaled
+}
+
+// fanOutPools gives every address a pool of its own along with its share of
+// the requests, so that a slow address keeps its clients busy rather than
+// leaving its requests to the clients of the fast ones
+func fanOutPools(targets []Target, numRequests int) []*targetPool {
+	pools := make([]*targetPool, len(targets))
+	for i, target := range targets {
+		pools[i] = newTargetPool([]Target{target})
+		pools[i].left = int64(numRequests / len(targets))
+		if i < numRequests%len(targets) {
+			pools[i].left++
+		}
+	}
+	return pools
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanOutTargets(t *testing.T) {
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "api.local" {
+			return nil, errors.New("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP("10.0.0.2")}, {IP: net.ParseIP("fd00::1")}, {IP: net.ParseIP("10.0.0.1")}}, nil
+	}
+	cases := []struct {
+		endpoint  string
+		ipVersion int
+		want      []Target
+		host      string
+		fails     bool
+	}{
+		{"http://api.local:5000/predict", 0, []Target{
+			{Name: "10.0.0.1", URL: "http://10.0.0.1:5000/predict"},
+			{Name: "10.0.0.2", URL: "http://10.0.0.2:5000/predict"},
+			{Name: "fd00::1", URL: "http://[fd00::1]:5000/predict"},
+		}, "api.local:5000", false},
+		{"https://api.local/predict", 6, []Target{
+			{Name: "fd00::1", URL: "https://[fd00::1]/predict"},
+		}, "api.local", false},
+		{"http://10.0.0.1:5000/predict", 0, nil, "", true},
+		{"http://other.local/predict", 0, nil, "", true},
+	}
+	for _, c := range cases {
+		targets, host, err := fanOutTargets(c.endpoint, c.ipVersion, lookup)
+		if c.fails {
+			if err == nil {
+				t.Errorf("fanOutTargets(%q) should fail", c.endpoint)
+			}
+			continue
+		}
+		if err != nil || host != c.host || !reflect.DeepEqual(targets, c.want) {
+			t.Errorf("fanOutTargets(%q) = %v, %q, %v, want %v, %q", c.endpoint, targets, host, err, c.want, c.host)
+		}
+	}
+}
+
+func TestFanOutSchedule(t *testing.T) {
+	milestones := []Milestone{{NumRequests: 100, NumClients: 4}, {NumRequests: 200, NumClients: 8}}
+	each := fanOutSchedule(milestones, fanOutEach, 3)
+	if each[0].NumClients != 12 || each[0].NumRequests != 300 || each[1].NumClients != 24 || each[1].NumRequests != 600 {
+		t.Errorf("each mode scaled to %+v", each)
+	}
+	if milestones[0].NumClients != 4 {
+		t.Errorf("each mode changed the schedule it was given")
+	}
+	if spread := fanOutSchedule(milestones, fanOutSpread, 3); !reflect.DeepEqual(spread, milestones) {
+		t.Errorf("spread mode scaled to %+v", spread)
+	}
+}
+
+func TestFanOutPools(t *testing.T) {
+	// Every address sees the connections of its own clients only, the slow
+	// one does not hold back the clients of the fast one
+	var mu sync.Mutex
+	conns := make(map[string]map[string]bool)
+	serve := func(name string, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			if conns[name] == nil {
+				conns[name] = make(map[string]bool)
+			}
+			conns[name][r.RemoteAddr] = true
+			mu.Unlock()
+			time.Sleep(delay)
+		}))
+	}
+	fast := serve("fast", 0)
+	defer fast.Close()
+	slow := serve("slow", 5*time.Millisecond)
+	defer slow.Close()
+	targets := []Target{{Name: "fast", URL: fast.URL}, {Name: "slow", URL: slow.URL}}
+
+	cases := []struct {
+		mode       string
+		requests   int
+		clients    int
+		perAddress []int
+		conns      []int
+	}{
+		{fanOutEach, 20, 2, []int{20, 20}, []int{2, 2}},
+		{fanOutSpread, 41, 4, []int{21, 20}, []int{2, 2}},
+	}
+	for _, c := range cases {
+		conns = make(map[string]map[string]bool)
+		milestone := fanOutSchedule([]Milestone{{NumRequests: c.requests, NumClients: c.clients}}, c.mode, len(targets))[0]
+		task := &Task{Targets: targets, Corpus: []*Cannonball{{Method: "GET"}}, FanOut: true,
+			NumRequests: milestone.NumRequests, NumClients: milestone.NumClients}
+		opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true}), Decoders: 1,
+			PerTarget: true, Silent: true}
+		summary := runTask(0, task, opt, newControl(0))
+		opt.Transport.CloseIdleConnections()
+
+		got := make([]int, len(targets))
+		for _, target := range summary.Targets {
+			for i := range targets {
+				if target.Name == targets[i].Name {
+					got[i] = target.NumRequests
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, c.perAddress) {
+			t.Errorf("%s mode got %v requests per address, want %v", c.mode, got, c.perAddress)
+		}
+		for i, target := range targets {
+			if len(conns[target.Name]) > c.conns[i] {
+				t.Errorf("%s mode got %d connections to %s, want at most %d", c.mode, len(conns[target.Name]),
+					target.Name, c.conns[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// fuzzHugeString is the length of the strings of the huge string mutation
+const fuzzHugeString = 1 << 20
+
+const classFuzzAccepted = "fuzz accepted"
+
+var (
+	jsonString = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	jsonKey    = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*):`)
+)
+
+// fuzzMutation : A way of breaking the json body of a request, the ones
+// going after a string pick the longest one, which is the image of a payload
+type fuzzMutation struct {
+	name   string
+	mutate func(body []byte) []byte
+}
+
+var fuzzMutations = []fuzzMutation{
+	{"truncated base64", func(body []byte) []byte {
+		return replaceLongestString(body, func(s string) string {
+			// Half of it, never a whole number of base64 quanta
+			cut := len(s) / 2
+			if cut%4 == 0 {
+				cut++
+			}
+			if cut >= len(s) {
+				return s + "@"
+			}
+			return s[:cut]
+		})
+	}},
+	{"wrong fields", func(body []byte) []byte {
+		if !jsonKey.Match(body) {
+			return truncateJSON(body)
+		}
+		return jsonKey.ReplaceAll(body, []byte(`"x_$1"$2:`))
+	}},
+	{"huge string", func(body []byte) []byte {
+		return replaceLongestString(body, func(s string) string {
+			return strings.Repeat("A", fuzzHugeString)
+		})
+	}},
+	{"invalid utf-8", func(body []byte) []byte {
+		return replaceLongestString(body, func(s string) string {
+			return s[:len(s)/2] + "\xff\xfe\xc3\x28" + s[len(s)/2:]
+		})
+	}},
+	{"truncated json", truncateJSON},
+}
+
+func truncateJSON(body []byte) []byte {
+	return body[:len(body)/2]
+}
+
+// replaceLongestString swaps the contents of the longest string of the json,
+// the bodies without any are truncated instead
+func replaceLongestString(body []byte, replace func(s string) string) []byte {
+	var longest []int
+	for _, match := range jsonString.FindAllIndex(body, -1) {
+		if longest == nil || match[1]-match[0] > longest[1]-longest[0] {
+			longest = match
+		}
+	}
+	if longest == nil {
+		return truncateJSON(body)
+	}
+	mutated := make([]byte, 0, len(body))
+	mutated = append(mutated, body[:longest[0]+1]...)
+	mutated = append(mutated, replace(string(body[longest[0]+1:longest[1]-1]))...)
+	return append(mutated, body[longest[1]-1:]...)
+}
+
+// fuzzer : Sends a share of the requests with a broken body, the service is
+// expected to reject them with a 4xx rather than fail or hang
+type fuzzer struct {
+	fraction float64
+}
+
+// mutate breaks the body of a copy of the cannonball with a random mutation,
+// the requests without a body are sent as they are
+func (f *fuzzer) mutate(ball *Cannonball, rnd *rand.Rand) *Cannonball {
+	if len(ball.Body) == 0 || rnd.Float64() >= f.fraction {
+		return ball
+	}
+	mutation := fuzzMutations[rnd.Intn(len(fuzzMutations))]
+	mutated := *ball
+	mutated.Body, mutated.Fuzz = mutation.mutate(ball.Body), mutation.name
+	return &mutated
+}
+
+// judgeFuzz counts a 4xx to a fuzzed request as a success and anything
+// else it got as a misbehavior of the service
+func judgeFuzz(response *Response) {
+	switch {
+	case response.Status >= 400 && response.Status < 500:
+		response.Success, response.Class = true, ""
+	case response.Status != 0 && response.Status < 400:
+		response.Success, response.Class, response.raw = false, classFuzzAccepted, nil
+		response.Body = fmt.Sprintf("Request with a %s was accepted with %d", response.Fuzz, response.Status)
+	}
+}
+
+// FuzzMutation : What a mutation of the fuzzed requests got from the service
+type FuzzMutation struct {
+	Name         string `json:"name"`
+	NumRequests  int    `json:"num_requests"`
+	Rejected     int    `json:"rejected"`
+	Accepted     int    `json:"accepted"`
+	ServerErrors int    `json:"server_errors"`
+	Hangs        int    `json:"hangs"`
+	Other        int    `json:"other"`
+}
+
+// Fuzzing : The fuzzed requests of a task, every one not rejected with a 4xx is a misbehavior
+type Fuzzing struct {
+	NumRequests  int            `json:"num_requests"`
+	Misbehaviors int            `json:"misbehaviors"`
+	Mutations    []FuzzMutation `json:"mutations"`
+}
+
+// fuzzStats : Accumulates the fuzzed responses of a task by their mutations
+type fuzzStats struct {
+	mutations map[string]*FuzzMutation
+}
+
+func newFuzzStats() *fuzzStats {
+	return &fuzzStats{mutations: make(map[string]*FuzzMutation)}
+}
+
+func (s *fuzzStats) add(response *Response) {
+	if response.Fuzz == "" {
+		return
+	}
+	mutation, ok := s.mutations[response.Fuzz]
+	if !ok {
+		mutation = &FuzzMutation{Name: response.Fuzz}
+		s.mutations[response.Fuzz] = mutation
+	}
+	mutation.NumRequests++
+	switch {
+	case response.Success:
+		mutation.Rejected++
+	case response.Class == classFuzzAccepted:
+		mutation.Accepted++
+	case response.Status >= 500:
+		mutation.ServerErrors++
+	case response.Class == classTimeout || response.Class == classHeaderTimeout:
+		mutation.Hangs++
+	default:
+		mutation.Other++
+	}
+}
+
+// summarize is nil unless a request was fuzzed, the mutations keep their order
+func (s *fuzzStats) summarize() *Fuzzing {
+	if len(s.mutations) == 0 {
+		return nil
+	}
+	fuzzing := &Fuzzing{Mutations: make([]FuzzMutation, 0, len(s.mutations))}
+	for _, known := range fuzzMutations {
+		if mutation, ok := s.mutations[known.name]; ok {
+			fuzzing.NumRequests += mutation.NumRequests
+			fuzzing.Misbehaviors += mutation.NumRequests - mutation.Rejected
+			fuzzing.Mutations = append(fuzzing.Mutations, *mutation)
+		}
+	}
+	return fuzzing
+}
+
+func printFuzzing(w io.Writer, fuzzing *Fuzzing) {
+	fmt.Fprintf(w, "Fuzzing: %d of %d mutated requests misbehaved\n\n", fuzzing.Misbehaviors, fuzzing.NumRequests)
+	fmt.Fprintln(w, " Mutation           # reqs     4xx     2xx     5xx   hangs   other  ")
+	fmt.Fprintln(w, strings.Repeat("-", 69))
+	for _, m := range fuzzing.Mutations {
+		fmt.Fprintf(w, " %-16s%9d%8d%8d%8d%8d%8d\n", m.Name, m.NumRequests, m.Rejected, m.Accepted, m.ServerErrors,
+			m.Hangs, m.Other)
+	}
+}
+
+func markdownFuzzing(w io.Writer, fuzzing *Fuzzing) {
+	fmt.Fprintf(w, "Fuzzing: **%d** of %d mutated requests misbehaved\n\n", fuzzing.Misbehaviors, fuzzing.NumRequests)
+	fmt.Fprintln(w, "| Mutation | # reqs | 4xx | 2xx | 5xx | hangs | other |")
+	fmt.Fprintln(w, "|:---|---:|---:|---:|---:|---:|---:|")
+	for _, m := range fuzzing.Mutations {
+		fmt.Fprintf(w, "| %s | %d | %d | %d | %d | %d | %d |\n", m.Name, m.NumRequests, m.Rejected, m.Accepted,
+			m.ServerErrors, m.Hangs, m.Other)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFuzzMutations(t *testing.T) {
+	image := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 300))
+	body := []byte(`{"image": "` + image + `", "model": "v2"}`)
+	for _, mutation := range fuzzMutations {
+		mutated := mutation.mutate(body)
+		var doc map[string]interface{}
+		parsed := json.Unmarshal(mutated, &doc) == nil
+		switch mutation.name {
+		case "truncated base64":
+			_, err := base64.StdEncoding.DecodeString(doc["image"].(string))
+			if !parsed || err == nil || doc["model"] != "v2" {
+				t.Errorf("%s: got %s", mutation.name, mutated)
+			}
+		case "wrong fields":
+			if !parsed || doc["image"] != nil || doc["x_image"] != image || doc["x_model"] != "v2" {
+				t.Errorf("%s: got %s", mutation.name, mutated)
+			}
+		case "huge string":
+			if len(mutated) < fuzzHugeString || !strings.HasSuffix(string(mutated), `", "model": "v2"}`) {
+				t.Errorf("%s: got %d bytes", mutation.name, len(mutated))
+			}
+		case "invalid utf-8":
+			if utf8.Valid(mutated) || !bytes.HasPrefix(mutated, []byte(`{"image": "`)) {
+				t.Errorf("%s: got %q", mutation.name, mutated)
+			}
+		case "truncated json":
+			if parsed || len(mutated) != len(body)/2 {
+				t.Errorf("%s: got %s", mutation.name, mutated)
+			}
+		}
+		if bytes.Equal(mutated, body) {
+			t.Errorf("%s: the body is left as it is", mutation.name)
+		}
+	}
+
+	// The bodies without strings are cut short instead
+	for _, mutation := range fuzzMutations {
+		if got := mutation.mutate([]byte(`[1, 2, 3, 4]`)); string(got) != `[1, 2,` {
+			t.Errorf("%s of a list of numbers: got %s", mutation.name, got)
+		}
+	}
+	if got := fuzzMutations[0].mutate([]byte(`["", 1]`)); string(got) != `["@", 1]` {
+		t.Errorf("truncated base64 of an empty string: got %s", got)
+	}
+}
+
+func TestFuzzerMutate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	ball := &Cannonball{Method: "POST", Body: []byte(`{"image": "abcd"}`)}
+	fuzzed := 0
+	for i := 0; i < 1000; i++ {
+		if mutated := (&fuzzer{fraction: 0.2}).mutate(ball, rnd); mutated.Fuzz != "" {
+			fuzzed++
+		}
+	}
+	if fuzzed < 150 || fuzzed > 250 {
+		t.Errorf("fuzzed %d of 1000 requests, want about 200", fuzzed)
+	}
+	if string(ball.Body) != `{"image": "abcd"}` || ball.Fuzz != "" {
+		t.Errorf("the original cannonball got changed to %s", ball.Body)
+	}
+	if mutated := (&fuzzer{fraction: 1}).mutate(&Cannonball{Method: "GET"}, rnd); mutated.Fuzz != "" {
+		t.Errorf("fuzzed a request without a body with %s", mutated.Fuzz)
+	}
+}
+
+func TestFuzzing(t *testing.T) {
+	// The service rejects the broken images but fails on the huge ones and takes the unknown fields
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request struct {
+			Image string `json:"image"`
+		}
+		switch {
+		case len(body) > fuzzHugeString:
+			w.WriteHeader(http.StatusInternalServerError)
+		case json.Unmarshal(body, &request) != nil || !utf8.Valid(body):
+			w.WriteHeader(http.StatusBadRequest)
+		case request.Image == "":
+		default:
+			if _, err := base64.StdEncoding.DecodeString(request.Image); err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			}
+		}
+	}))
+	defer server.Close()
+
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true}), ValidateJSON: true}
+	ball := &Cannonball{Method: "POST", Body: []byte(`{"image": "` + base64.StdEncoding.EncodeToString([]byte("jpeg")) + `"}`)}
+	stats := newFuzzStats()
+	for _, mutation := range fuzzMutations {
+		fuzzed := *ball
+		fuzzed.Body, fuzzed.Fuzz = mutation.mutate(ball.Body), mutation.name
+		response := fire(server.URL, &fuzzed, nil, opt)
+		response.Fuzz = fuzzed.Fuzz
+		judgeFuzz(&response)
+		decode(&response, opt)
+		stats.add(&response)
+	}
+	stats.add(&Response{Success: true})
+
+	fuzzing := stats.summarize()
+	if fuzzing.NumRequests != len(fuzzMutations) || fuzzing.Misbehaviors != 2 {
+		t.Fatalf("got %d misbehaviors of %d requests, want 2 of %d", fuzzing.Misbehaviors, fuzzing.NumRequests,
+			len(fuzzMutations))
+	}
+	for _, mutation := range fuzzing.Mutations {
+		want := FuzzMutation{Name: mutation.Name, NumRequests: 1, Rejected: 1}
+		switch mutation.Name {
+		case "wrong fields":
+			want.Rejected, want.Accepted = 0, 1
+		case "huge string":
+			want.Rejected, want.ServerErrors = 0, 1
+		}
+		if mutation != want {
+			t.Errorf("got %+v, want %+v", mutation, want)
+		}
+	}
+
+	var text bytes.Buffer
+	printFuzzing(&text, fuzzing)
+	if !strings.Contains(text.String(), "2 of 5 mutated requests misbehaved") {
+		t.Errorf("got %q", text.String())
+	}
+}
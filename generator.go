@@ -0,0 +1,142 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// generatorSamplePeriod is how often the load generator looks at itself
+const generatorSamplePeriod = 500 * time.Millisecond
+
+// generatorBusyCPU is the share of the cores at which the load generator is
+// the likely bottleneck rather than the service
+const generatorBusyCPU = 0.9
+
+// GeneratorCPU : The processor time of the load generator as a share of the cores it may use
+type GeneratorCPU struct {
+	Mean  float64 `json:"mean"`
+	Peak  float64 `json:"peak"`
+	Cores int     `json:"cores"`
+}
+
+// Generator : How busy the load generator itself was during a task, the CPU
+// is left out on the platforms which do not tell the time of the process
+type Generator struct {
+	CPU           *GeneratorCPU `json:"cpu,omitempty"`
+	MaxGoroutines int           `json:"max_goroutines"`
+	AllocRate     float64       `json:"alloc_rate"` // in MB per second
+	MaxHeap       float64       `json:"max_heap"`   // in MB
+	NumGC         uint32        `json:"num_gc"`
+	Bottleneck    bool          `json:"bottleneck"`
+}
+
+// generatorMonitor : Samples the load generator in the background until finished
+type generatorMonitor struct {
+	stop   chan struct{}
+	done   chan struct{}
+	result Generator
+}
+
+func monitorGenerator(period time.Duration) *generatorMonitor {
+	m := &generatorMonitor{stop: make(chan struct{}), done: make(chan struct{})}
+	go m.run(period)
+	return m
+}
+
+func (m *generatorMonitor) run(period time.Duration) {
+	defer close(m.done)
+	cores := runtime.GOMAXPROCS(0)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	startAlloc, startGC := mem.TotalAlloc, mem.NumGC
+	start := time.Now()
+	startCPU, measured := processCPU()
+	last, lastCPU := start, startCPU
+	cpu := GeneratorCPU{Cores: cores}
+
+	sample := func(now time.Time) {
+		if goroutines := runtime.NumGoroutine(); goroutines > m.result.MaxGoroutines {
+			m.result.MaxGoroutines = goroutines
+		}
+		runtime.ReadMemStats(&mem)
+		if heap := float64(mem.HeapAlloc) / megabyte; heap > m.result.MaxHeap {
+			m.result.MaxHeap = heap
+		}
+		if !measured || !now.After(last) {
+			return
+		}
+		used, _ := processCPU()
+		if share := float64(used-lastCPU) / float64(now.Sub(last)) / float64(cores); share > cpu.Peak {
+			cpu.Peak = share
+		}
+		last, lastCPU = now, used
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			sample(now)
+		case <-m.stop:
+			now := time.Now()
+			sample(now)
+			elapsed := now.Sub(start)
+			if elapsed > 0 {
+				m.result.AllocRate = float64(mem.TotalAlloc-startAlloc) / megabyte / elapsed.Seconds()
+			}
+			m.result.NumGC = mem.NumGC - startGC
+			if measured && elapsed > 0 {
+				cpu.Mean = float64(lastCPU-startCPU) / float64(elapsed) / float64(cores)
+				m.result.CPU = &cpu
+				m.result.Bottleneck = cpu.Peak >= generatorBusyCPU
+			}
+			return
+		}
+	}
+}
+
+// finish takes the last sample and sums the task up
+func (m *generatorMonitor) finish() *Generator {
+	close(m.stop)
+	<-m.done
+	return &m.result
+}
+
+func describeGenerator(g *Generator) string {
+	description := ""
+	if g.CPU != nil {
+		cores := fmt.Sprintf("%d cores", g.CPU.Cores)
+		if g.CPU.Cores == 1 {
+			cores = "1 core"
+		}
+		description = fmt.Sprintf("cpu %.0f%% of %s, %.0f%% at the peak, ", 100*g.CPU.Mean, cores, 100*g.CPU.Peak)
+	}
+	description += fmt.Sprintf("%d goroutines at most, %.1f MB/s allocated, %.1f MB of heap at most, %d gc runs",
+		g.MaxGoroutines, g.AllocRate, g.MaxHeap, g.NumGC)
+	if g.Bottleneck {
+		description += ", the load generator itself was the bottleneck"
+	}
+	return description
+}
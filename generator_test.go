@@ -0,0 +1,68 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDescribeGenerator(t *testing.T) {
+	tests := []struct {
+		generator Generator
+		want      string
+	}{
+		{Generator{MaxGoroutines: 12, AllocRate: 3.25, MaxHeap: 8, NumGC: 2},
+			"12 goroutines at most, 3.2 MB/s allocated, 8.0 MB of heap at most, 2 gc runs"},
+		{Generator{CPU: &GeneratorCPU{Mean: 0.2, Peak: 0.35, Cores: 1}, MaxGoroutines: 12},
+			"cpu 20% of 1 core, 35% at the peak, 12 goroutines at most, 0.0 MB/s allocated, 0.0 MB of heap at most, 0 gc runs"},
+		{Generator{CPU: &GeneratorCPU{Mean: 0.85, Peak: 0.97, Cores: 8}, MaxGoroutines: 40, Bottleneck: true},
+			"cpu 85% of 8 cores, 97% at the peak, 40 goroutines at most, 0.0 MB/s allocated, 0.0 MB of heap at most, " +
+				"0 gc runs, the load generator itself was the bottleneck"},
+	}
+	for _, test := range tests {
+		if got := describeGenerator(&test.generator); got != test.want {
+			t.Errorf("describeGenerator(%+v) = %q, want %q", test.generator, got, test.want)
+		}
+	}
+}
+
+func TestMonitorGenerator(t *testing.T) {
+	monitor := monitorGenerator(10 * time.Millisecond)
+	// Keep a core busy for a while, allocating on the way
+	var buffers [][]byte
+	for deadline := time.Now().Add(50 * time.Millisecond); time.Now().Before(deadline); {
+		buffers = append(buffers, make([]byte, 1024))
+	}
+	generator := monitor.finish()
+
+	if generator.MaxGoroutines < 2 || generator.MaxHeap <= 0 || generator.AllocRate <= 0 {
+		t.Errorf("monitor saw %+v after allocating %d buffers", generator, len(buffers))
+	}
+	if _, measured := processCPU(); measured {
+		if generator.CPU == nil || generator.CPU.Cores != runtime.GOMAXPROCS(0) || generator.CPU.Peak <= 0 {
+			t.Errorf("monitor measured the cpu as %+v", generator.CPU)
+		}
+	} else if generator.CPU != nil {
+		t.Errorf("monitor made up the cpu as %+v", generator.CPU)
+	}
+}
@@ -3,6 +3,10 @@ module github.com/nizhib/cannonade
 go 1.13
 
 require (
-	github.com/montanaflynn/stats v0.5.0
+	github.com/gorilla/websocket v1.4.1
+	github.com/klauspost/compress v1.9.8
 	github.com/schollz/progressbar/v2 v2.14.2
+	github.com/yuin/gopher-lua v0.0.0-20191220021717-ab39c6098bdb
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
+	golang.org/x/sys v0.0.0-20191008105621-543471e840be
 )
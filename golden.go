@@ -0,0 +1,204 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// golden : The response every request is expected to get, either the exact
+// body or, for json, the fields of the golden document once the volatile
+// ones are ignored
+type golden struct {
+	body   []byte
+	doc    interface{} // nil unless the golden body is json
+	subset bool
+	ignore []*jsonPath
+}
+
+// newGolden parses the golden body, a json one is compared field by field
+func newGolden(body []byte, subset bool, ignore []*jsonPath) *golden {
+	g := &golden{body: body, subset: subset, ignore: ignore}
+	if doc, err := decodeJSON(body); err == nil {
+		g.doc = g.strip(doc)
+	}
+	return g
+}
+
+// parseIgnored compiles the comma separated paths of the volatile fields
+func parseIgnored(spec string) ([]*jsonPath, error) {
+	paths := make([]*jsonPath, 0)
+	if spec == "" {
+		return paths, nil
+	}
+	for _, expr := range strings.Split(spec, ",") {
+		path, err := parseJSONPath(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// loadGolden reads the golden response, or captures it from a reference call
+// when there is no file yet, the captured json is indented to be trimmed by hand
+func loadGolden(path string, subset bool, ignore []*jsonPath, capture func() ([]byte, error)) (*golden, bool, error) {
+	body, err := ioutil.ReadFile(path)
+	if err == nil {
+		return newGolden(body, subset, ignore), false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, err
+	}
+	if body, err = capture(); err != nil {
+		return nil, false, err
+	}
+	saved := body
+	var indented bytes.Buffer
+	if json.Indent(&indented, body, "", "  ") == nil {
+		indented.WriteString("\n")
+		saved = indented.Bytes()
+	}
+	if err := ioutil.WriteFile(path, saved, 0644); err != nil {
+		return nil, false, err
+	}
+	return newGolden(body, subset, ignore), true, nil
+}
+
+// check tells how the body departs from the golden one, if it does
+func (g *golden) check(body []byte) error {
+	if g.doc == nil {
+		if !bytes.Equal(body, g.body) {
+			return fmt.Errorf("body of %d bytes differs from the golden one of %d bytes", len(body), len(g.body))
+		}
+		return nil
+	}
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return fmt.Errorf("body is not json unlike the golden one")
+	}
+	if diff := diffJSON("$", g.doc, g.strip(doc), g.subset); diff != "" {
+		return fmt.Errorf("%s", diff)
+	}
+	return nil
+}
+
+// strip drops the volatile fields from the decoded document
+func (g *golden) strip(doc interface{}) interface{} {
+	for _, path := range g.ignore {
+		doc = path.remove(doc)
+	}
+	return doc
+}
+
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("trailing data after the json")
+	}
+	return doc, nil
+}
+
+// diffJSON finds the first path where the document departs from the golden
+// one, a subset allows the fields the golden document does not have
+func diffJSON(path string, want, got interface{}, subset bool) string {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		object, ok := got.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("%s is %s, want an object", path, encodeJSON(got))
+		}
+		for _, key := range sortedKeys(want) {
+			value, ok := object[key]
+			if !ok {
+				return fmt.Sprintf("%s.%s is missing", path, key)
+			}
+			if diff := diffJSON(path+"."+key, want[key], value, subset); diff != "" {
+				return diff
+			}
+		}
+		if !subset {
+			for _, key := range sortedKeys(object) {
+				if _, ok := want[key]; !ok {
+					return fmt.Sprintf("%s.%s is not in the golden response", path, key)
+				}
+			}
+		}
+		return ""
+	case []interface{}:
+		list, ok := got.([]interface{})
+		if !ok {
+			return fmt.Sprintf("%s is %s, want a list", path, encodeJSON(got))
+		}
+		if len(list) != len(want) {
+			return fmt.Sprintf("%s has %d items, want %d", path, len(list), len(want))
+		}
+		for i := range want {
+			if diff := diffJSON(fmt.Sprintf("%s[%d]", path, i), want[i], list[i], subset); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	case json.Number:
+		// 1 and 1.0 are the same number
+		if number, ok := got.(json.Number); ok {
+			x, errX := want.Float64()
+			y, errY := number.Float64()
+			if number == want || errX == nil && errY == nil && x == y {
+				return ""
+			}
+		}
+	default:
+		if got == want {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s is %s, want %s", path, encodeJSON(got), encodeJSON(want))
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoldenCheck(t *testing.T) {
+	ignore, err := parseIgnored("$.id, $.items[0].at")
+	if err != nil {
+		t.Fatalf("parseIgnored() failed: %s", err)
+	}
+	reference := []byte(`{"id": "a1", "label": "cat", "score": 0.5, "items": [{"at": 1, "n": 1}, {"n": 2}]}`)
+	tests := []struct {
+		subset bool
+		body   string
+		want   string
+	}{
+		{false, `{"id": "b2", "label": "cat", "score": 0.50, "items": [{"at": 9, "n": 1}, {"n": 2}]}`, ""},
+		{false, `{"id": "b2", "label": "dog", "score": 0.5, "items": [{"n": 1}, {"n": 2}]}`,
+			`$.label is "dog", want "cat"`},
+		{false, `{"label": "cat", "score": 0.5, "items": [{"n": 1}, {"n": 2}], "extra": 1}`,
+			"$.extra is not in the golden response"},
+		{true, `{"label": "cat", "score": 0.5, "items": [{"n": 1}, {"n": 2, "m": 3}], "extra": 1}`, ""},
+		{true, `{"label": "cat", "items": [{"n": 1}, {"n": 2}]}`, "$.score is missing"},
+		{true, `{"label": "cat", "score": 0.5, "items": [{"n": 1}]}`, "$.items has 1 items, want 2"},
+		{true, `{"label": "cat", "score": 0.5, "items": {"n": 1}}`, `$.items is {"n":1}, want a list`},
+		{true, `{"label": "cat", "score": "0.5", "items": [{"n": 1}, {"n": 2}]}`, `$.score is "0.5", want 0.5`},
+		{false, `not json`, "body is not json unlike the golden one"},
+	}
+	for _, test := range tests {
+		g := newGolden(reference, test.subset, ignore)
+		got := ""
+		if err := g.check([]byte(test.body)); err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("check(%s) with subset %v = %q, want %q", test.body, test.subset, got, test.want)
+		}
+	}
+
+	exact := newGolden([]byte("plain text"), false, nil)
+	if err := exact.check([]byte("plain text")); err != nil {
+		t.Errorf("check() of the same text failed: %s", err)
+	}
+	if err := exact.check([]byte("plain text!")); err == nil {
+		t.Errorf("check() of another text passed")
+	}
+}
+
+func TestLoadGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "golden.json")
+
+	calls := 0
+	capture := func() ([]byte, error) {
+		calls++
+		return []byte(`{"label":"cat"}`), nil
+	}
+	g, captured, err := loadGolden(path, false, nil, capture)
+	if err != nil || !captured || calls != 1 {
+		t.Fatalf("loadGolden() of a missing file = %v, %v after %d calls", captured, err, calls)
+	}
+	saved, _ := ioutil.ReadFile(path)
+	if string(saved) != "{\n  \"label\": \"cat\"\n}\n" {
+		t.Errorf("saved %q, want indented json", saved)
+	}
+	if err := g.check([]byte(`{"label": "cat"}`)); err != nil {
+		t.Errorf("check() of the captured response failed: %s", err)
+	}
+
+	if _, captured, err = loadGolden(path, false, nil, capture); err != nil || captured || calls != 1 {
+		t.Errorf("loadGolden() of a saved file = %v, %v after %d calls", captured, err, calls)
+	}
+
+	failing := func() ([]byte, error) { return nil, errors.New("refused") }
+	if _, _, err := loadGolden(filepath.Join(dir, "other.json"), false, nil, failing); err == nil {
+		t.Errorf("loadGolden() passed with a failed reference call")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.json")); !os.IsNotExist(err) {
+		t.Errorf("loadGolden() saved a file for a failed reference call")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Headers  []harHeader `json:"headers"`
+	PostData *struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	} `json:"postData"`
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request harRequest `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// skipHARHeader tells the headers which are set by the transport itself
+func skipHARHeader(name string) bool {
+	if strings.HasPrefix(name, ":") {
+		return true
+	}
+	for _, key := range append(hopHeaders, "Host") {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadHAR reads the requests exported from the browser dev tools, they keep
+// their own URLs unless rebased is set in which case only the path is kept
+func loadHAR(path string, rebased bool) ([]*Cannonball, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, "", err
+	}
+
+	origin := ""
+	corpus := make([]*Cannonball, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		request := entry.Request
+		u, err := url.Parse(request.URL)
+		if err != nil || u.Host == "" {
+			return nil, "", fmt.Errorf("invalid url %q", request.URL)
+		}
+		if origin == "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+
+		ball := &Cannonball{
+			Method: request.Method,
+			Path:   request.URL,
+			Header: make(http.Header),
+			Label:  request.Method + " " + u.Path,
+		}
+		if rebased {
+			ball.Path = u.RequestURI()
+		}
+		for _, header := range request.Headers {
+			if !skipHARHeader(header.Name) {
+				ball.Header.Add(header.Name, header.Value)
+			}
+		}
+		if request.PostData != nil {
+			ball.Body = []byte(request.PostData.Text)
+			if ball.Header.Get("Content-Type") == "" && request.PostData.MimeType != "" {
+				ball.Header.Set("Content-Type", request.PostData.MimeType)
+			}
+		}
+		corpus = append(corpus, ball)
+	}
+	if len(corpus) == 0 {
+		return nil, "", fmt.Errorf("no requests found in %s", path)
+	}
+
+	return corpus, origin, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testHAR = `{"log": {"entries": [
+	{"request": {"method": "GET", "url": "https://h.example/a?q=1", "headers": [
+		{"name": ":authority", "value": "h.example"},
+		{"name": "Host", "value": "h.example"},
+		{"name": "Connection", "value": "keep-alive"},
+		{"name": "X-Token", "value": "abc"}
+	]}},
+	{"request": {"method": "POST", "url": "https://h.example/b", "headers": [],
+		"postData": {"mimeType": "application/json", "text": "{\"a\": 1}"}}}
+]}}`
+
+// writeTestFile saves the content into a temporary directory removed by the cleanup
+func writeTestFile(t *testing.T, name string, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "cannonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadHAR(t *testing.T) {
+	path, cleanup := writeTestFile(t, "session.har", testHAR)
+	defer cleanup()
+
+	corpus, origin, err := loadHAR(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin != "https://h.example" {
+		t.Errorf("origin = %q, want https://h.example", origin)
+	}
+	if len(corpus) != 2 {
+		t.Fatalf("got %d requests, want 2", len(corpus))
+	}
+
+	get, post := corpus[0], corpus[1]
+	if get.Method != "GET" || get.Path != "https://h.example/a?q=1" || get.Label != "GET /a" {
+		t.Errorf("first request = %s %s %q", get.Method, get.Path, get.Label)
+	}
+	if len(get.Header) != 1 || get.Header.Get("X-Token") != "abc" {
+		t.Errorf("first request headers = %v, want only X-Token", get.Header)
+	}
+	if post.Method != "POST" || string(post.Body) != `{"a": 1}` {
+		t.Errorf("second request = %s %q", post.Method, post.Body)
+	}
+	if post.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("second request content type = %q", post.Header.Get("Content-Type"))
+	}
+
+	rebased, _, err := loadHAR(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebased[0].Path != "/a?q=1" || rebased[1].Path != "/b" {
+		t.Errorf("rebased paths = %q %q", rebased[0].Path, rebased[1].Path)
+	}
+}
+
+func TestLoadHARErrors(t *testing.T) {
+	for _, content := range []string{
+		`not json`,
+		`{"log": {"entries": []}}`,
+		`{"log": {"entries": [{"request": {"method": "GET", "url": "/relative"}}]}}`,
+	} {
+		path, cleanup := writeTestFile(t, "bad.har", content)
+		if _, _, err := loadHAR(path, false); err == nil {
+			t.Errorf("loadHAR(%q) succeeded, want an error", content)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// heatmapBounds are the upper bounds of the latency buckets in milliseconds,
+// roughly logarithmic, the last bucket takes everything slower
+var heatmapBounds = []Millis{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+// Heatmap : Counts of the requests by the time they ended and by their latency
+type Heatmap struct {
+	Interval float64      `json:"interval"`
+	Bounds   []Millis     `json:"bounds"`
+	Rows     []HeatmapRow `json:"rows"`
+}
+
+// HeatmapRow : The requests which ended within a single interval, a count per
+// latency bucket and one more for those over the last bound
+type HeatmapRow struct {
+	Elapsed float64 `json:"elapsed"`
+	Counts  []int   `json:"counts"`
+	Fails   int     `json:"fails"`
+}
+
+// heatmap : Accumulates the heatmap of a task, the failures are counted apart
+type heatmap struct {
+	start    time.Time
+	interval time.Duration
+	rows     []HeatmapRow
+}
+
+func newHeatmap(start time.Time, interval time.Duration) *heatmap {
+	return &heatmap{start: start, interval: interval}
+}
+
+func (h *heatmap) add(end time.Time, millis float64, success bool) {
+	index := int(end.Sub(h.start) / h.interval)
+	if index < 0 {
+		index = 0
+	}
+	for len(h.rows) <= index {
+		elapsed := time.Duration(len(h.rows)) * h.interval
+		h.rows = append(h.rows, HeatmapRow{Elapsed: elapsed.Seconds(), Counts: make([]int, len(heatmapBounds)+1)})
+	}
+
+	row := &h.rows[index]
+	if !success {
+		row.Fails++
+		return
+	}
+	bucket := sort.Search(len(heatmapBounds), func(i int) bool { return millis <= float64(heatmapBounds[i]) })
+	row.Counts[bucket]++
+}
+
+func (h *heatmap) summarize() *Heatmap {
+	return &Heatmap{Interval: h.interval.Seconds(), Bounds: heatmapBounds, Rows: h.rows}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHeatmap(t *testing.T) {
+	start := time.Now()
+	h := newHeatmap(start, time.Second)
+	h.add(start.Add(100*time.Millisecond), 0.5, true)
+	h.add(start.Add(900*time.Millisecond), 1, true)
+	h.add(start.Add(900*time.Millisecond), 7, true)
+	h.add(start.Add(2500*time.Millisecond), 30000, true)
+	h.add(start.Add(2600*time.Millisecond), 10, false)
+	// A response landing a hair before the start still goes to the first interval
+	h.add(start.Add(-time.Millisecond), 3, true)
+
+	counts := func(buckets map[int]int) []int {
+		row := make([]int, len(heatmapBounds)+1)
+		for bucket, count := range buckets {
+			row[bucket] = count
+		}
+		return row
+	}
+	want := &Heatmap{Interval: 1, Bounds: heatmapBounds, Rows: []HeatmapRow{
+		{Elapsed: 0, Counts: counts(map[int]int{0: 2, 2: 1, 3: 1})},
+		{Elapsed: 1, Counts: counts(nil)},
+		{Elapsed: 2, Counts: counts(map[int]int{len(heatmapBounds): 1}), Fails: 1},
+	}}
+	if got := h.summarize(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyFile is the store of the past runs within the history directory
+const historyFile = "history.jsonl"
+
+// HistoryEntry : The summary of a past run kept to follow the trends of the target
+type HistoryEntry struct {
+	Time     time.Time `json:"time"`
+	Endpoint string    `json:"endpoint"`
+	Args     []string  `json:"args,omitempty"`
+	Schedule string    `json:"schedule"`
+	Summary  Summary   `json:"summary"`
+}
+
+// newHistoryEntry sums the run up with its overall stats, or those of its only
+// or last task, leaving the windows and the breakdowns out
+func newHistoryEntry(report *Report, args []string, at time.Time) *HistoryEntry {
+	phases := make([]string, len(report.Tasks))
+	for i := range report.Tasks {
+		phases[i] = phaseName(&report.Tasks[i])
+	}
+	summary := report.Tasks[len(report.Tasks)-1]
+	if report.Overall != nil {
+		summary = *report.Overall
+	}
+	summary.Windows, summary.Heatmap = nil, nil
+	summary.Targets, summary.Backends, summary.Hosts, summary.Workers, summary.Requests = nil, nil, nil, nil, nil
+	return &HistoryEntry{Time: at, Endpoint: report.Endpoint, Args: args, Schedule: strings.Join(phases, ","),
+		Summary: summary}
+}
+
+// appendHistory adds the run to the store of the directory, creating both when missing
+func appendHistory(dir string, entry *HistoryEntry) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readHistory(dir string) ([]HistoryEntry, error) {
+	file, err := os.Open(filepath.Join(dir, historyFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var entry HistoryEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// historyOf picks the runs of the endpoint, which may be left out when all the
+// runs are of the same one
+func historyOf(entries []HistoryEntry, endpoint string) ([]HistoryEntry, error) {
+	endpoints := make(map[string]bool)
+	var picked []HistoryEntry
+	for _, entry := range entries {
+		endpoints[entry.Endpoint] = true
+		if entry.Endpoint == endpoint || endpoint == "" {
+			picked = append(picked, entry)
+		}
+	}
+	if endpoint == "" && len(endpoints) > 1 {
+		names := make([]string, 0, len(endpoints))
+		for name := range endpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("history has runs of several endpoints, pick one of %s", strings.Join(names, ", "))
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("history has no runs of %s", endpoint)
+	}
+	return picked, nil
+}
+
+// trendThresholds are the percentiles of the latest run, the ones to follow
+func trendThresholds(entries []HistoryEntry) []float64 {
+	latest := entries[len(entries)-1].Summary.Percentiles
+	thresholds := make([]float64, len(latest))
+	for i, percentile := range latest {
+		thresholds[i] = percentile.Threshold
+	}
+	return thresholds
+}
+
+func formatMillis(value Millis) string {
+	if math.IsNaN(float64(value)) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+func printTrend(w io.Writer, entries []HistoryEntry) {
+	thresholds := trendThresholds(entries)
+	width := len("Schedule")
+	for _, entry := range entries {
+		if len(entry.Schedule) > width {
+			width = len(entry.Schedule)
+		}
+	}
+
+	fmt.Fprintf(w, "Trend of %s over %d runs\n\n", entries[0].Endpoint, len(entries))
+	fmt.Fprintf(w, " %-16s  %-*s %9s", "Run", width, "Schedule", "req/s")
+	for _, threshold := range thresholds {
+		fmt.Fprintf(w, " %7s%%", formatThreshold(threshold))
+	}
+	fmt.Fprintf(w, " %8s  \n", "errors")
+	fmt.Fprintln(w, strings.Repeat("-", 16+width+23+9*len(thresholds)))
+	for _, entry := range entries {
+		summary := &entry.Summary
+		fmt.Fprintf(w, " %-16s  %-*s %9.2f", entry.Time.Local().Format("2006-01-02 15:04"), width, entry.Schedule,
+			summary.RPS)
+		for _, threshold := range thresholds {
+			fmt.Fprintf(w, " %8s", formatMillis(summaryPercentile(summary, threshold)))
+		}
+		fmt.Fprintf(w, " %7.1f%%\n", 100*errorRate(summary))
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// Chart dimensions of the html trend, in pixels
+const (
+	chartWidth   = 800
+	chartHeight  = 300
+	chartPadding = 40
+)
+
+// trendSeries : A percentile followed across the runs as a polyline of the chart
+type trendSeries struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// trendRow : A run as shown in the table of the html trend
+type trendRow struct {
+	Time     string
+	Schedule string
+	RPS      string
+	Values   []string
+	Errors   string
+}
+
+var trendColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+var trendPage = template.Must(template.New("trend").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Trend of {{.Endpoint}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { padding: 0.2em 0.8em; text-align: right; border-bottom: 1px solid #ddd; }
+th:first-child, td:first-child, th:nth-child(2), td:nth-child(2) { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Trend of {{.Endpoint}} over {{len .Rows}} runs</h1>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<rect x="{{.Padding}}" y="{{.Padding}}" width="{{.PlotWidth}}" height="{{.PlotHeight}}" fill="none" stroke="#ccc"/>
+<text x="{{.Padding}}" y="{{.Padding}}" dy="-0.5em" font-size="12">{{.Max}} ms</text>
+<text x="{{.Padding}}" y="{{.Bottom}}" dy="1.2em" font-size="12">0 ms</text>
+{{range $i, $s := .Series}}<polyline points="{{$s.Points}}" fill="none" stroke="{{$s.Color}}" stroke-width="2"/>
+<text x="{{$.Legend}}" y="{{$.Padding}}" dy="{{$i}}.2em" dx="0.5em" font-size="12" fill="{{$s.Color}}">{{$s.Name}}</text>
+{{end}}</svg>
+<table>
+<tr><th>Run</th><th>Schedule</th><th>req/s</th>{{range .Series}}<th>{{.Name}}, ms</th>{{end}}<th>errors</th></tr>
+{{range .Rows}}<tr><td>{{.Time}}</td><td>{{.Schedule}}</td><td>{{.RPS}}</td>{{range .Values}}<td>{{.}}</td>{{end}}<td>{{.Errors}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// renderTrend writes a page charting the percentiles of the runs, the runs go
+// left to right evenly spaced and the undefined latencies leave gaps out
+func renderTrend(w io.Writer, entries []HistoryEntry) error {
+	thresholds := trendThresholds(entries)
+	top := 0.0
+	for _, entry := range entries {
+		for _, threshold := range thresholds {
+			value := float64(summaryPercentile(&entry.Summary, threshold))
+			if !math.IsNaN(value) && value > top {
+				top = value
+			}
+		}
+	}
+	if top == 0 {
+		top = 1
+	}
+
+	plotWidth, plotHeight := chartWidth-3*chartPadding, chartHeight-2*chartPadding
+	x := func(i int) float64 {
+		if len(entries) == 1 {
+			return chartPadding + float64(plotWidth)/2
+		}
+		return chartPadding + float64(i*plotWidth)/float64(len(entries)-1)
+	}
+	y := func(value float64) float64 {
+		return chartPadding + float64(plotHeight)*(1-value/top)
+	}
+
+	series := make([]trendSeries, len(thresholds))
+	for t, threshold := range thresholds {
+		points := make([]string, 0, len(entries))
+		for i, entry := range entries {
+			value := float64(summaryPercentile(&entry.Summary, threshold))
+			if !math.IsNaN(value) {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", x(i), y(value)))
+			}
+		}
+		series[t] = trendSeries{Name: "p" + formatThreshold(threshold), Color: trendColors[t%len(trendColors)],
+			Points: strings.Join(points, " ")}
+	}
+	rows := make([]trendRow, len(entries))
+	for i, entry := range entries {
+		summary := &entry.Summary
+		row := trendRow{Time: entry.Time.Local().Format("2006-01-02 15:04"), Schedule: entry.Schedule,
+			RPS: fmt.Sprintf("%.2f", summary.RPS), Errors: fmt.Sprintf("%.1f%%", 100*errorRate(summary))}
+		for _, threshold := range thresholds {
+			row.Values = append(row.Values, formatMillis(summaryPercentile(summary, threshold)))
+		}
+		rows[i] = row
+	}
+
+	return trendPage.Execute(w, map[string]interface{}{
+		"Endpoint":   entries[0].Endpoint,
+		"Width":      chartWidth,
+		"Height":     chartHeight,
+		"Padding":    chartPadding,
+		"PlotWidth":  plotWidth,
+		"PlotHeight": plotHeight,
+		"Bottom":     chartPadding + plotHeight,
+		"Legend":     chartPadding + plotWidth,
+		"Max":        fmt.Sprintf("%.0f", top),
+		"Series":     series,
+		"Rows":       rows,
+	})
+}
+
+func trendCommand(args []string) int {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	last := fs.Int("last", 0, "show only this many latest runs")
+	htmlPath := fs.String("html", "", "path of the html page to chart the trend to instead of printing it")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade trend [options...] <history dir> [url]\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() == 0 || fs.NArg() > 2 {
+		fmt.Println("Provide a history directory to show the trend of!")
+		return 1
+	}
+
+	entries, err := readHistory(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed reading the history: %s\n", err)
+		return 1
+	}
+	entries, err = historyOf(entries, fs.Arg(1))
+	if err != nil {
+		fmt.Printf("Failed picking the runs: %s\n", err)
+		return 1
+	}
+	if *last > 0 && len(entries) > *last {
+		entries = entries[len(entries)-*last:]
+	}
+
+	if *htmlPath == "" {
+		printTrend(os.Stdout, entries)
+		return 0
+	}
+	file, err := os.Create(*htmlPath)
+	if err != nil {
+		fmt.Printf("Failed creating the page: %s\n", err)
+		return 1
+	}
+	defer file.Close()
+	if err := renderTrend(file, entries); err != nil {
+		fmt.Printf("Failed rendering the trend: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cannonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	first := summaryOf(100, 10, 20)
+	first.Windows = []Window{{NumRequests: 100}}
+	overall := summaryOf(150, 11, 25)
+	reports := []Report{
+		{Endpoint: "http://api/a", Tasks: []Summary{first}},
+		{Endpoint: "http://api/a", Tasks: []Summary{first, summaryOf(200, 12, 30)}, Overall: &overall},
+		{Endpoint: "http://api/b", Tasks: []Summary{first}},
+	}
+	for i := range reports {
+		if err := appendHistory(dir, newHistoryEntry(&reports[i], nil, at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := readHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("read %d runs back, want 3", len(entries))
+	}
+	if entries[0].Summary.Windows != nil || entries[0].Schedule != "100@4" {
+		t.Errorf("first run kept as %+v", entries[0])
+	}
+	if entries[1].Summary.RPS != 150 || entries[1].Schedule != "100@4,100@4" {
+		t.Errorf("schedule run kept as %+v, want its overall stats", entries[1])
+	}
+	if !entries[2].Time.Equal(at) {
+		t.Errorf("run time read back as %s, want %s", entries[2].Time, at)
+	}
+
+	if _, err := historyOf(entries, ""); err == nil {
+		t.Error("runs of several endpoints are picked without naming one")
+	}
+	if _, err := historyOf(entries, "http://api/c"); err == nil {
+		t.Error("runs of an unknown endpoint are picked")
+	}
+	if picked, err := historyOf(entries, "http://api/a"); err != nil || len(picked) != 2 {
+		t.Errorf("picked %d runs of the endpoint (%v), want 2", len(picked), err)
+	}
+}
+
+func TestPrintTrend(t *testing.T) {
+	at := time.Date(2020, 5, 1, 12, 0, 0, 0, time.Local)
+	entries := []HistoryEntry{
+		{Time: at, Endpoint: "http://api", Schedule: "100@4", Summary: summaryOf(100, 10, 20)},
+		{Time: at.Add(time.Hour), Endpoint: "http://api", Schedule: "100@4", Summary: summaryOf(90, 12, 24)},
+	}
+	var out bytes.Buffer
+	printTrend(&out, entries)
+	for _, want := range []string{"Trend of http://api over 2 runs\n", "      50%      99%   errors",
+		" 2020-05-01 13:00  100@4        90.00    12.00    24.00     0.0%\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("trend printed %q, missing %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	if err := renderTrend(&out, entries); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<polyline points=") || !strings.Contains(out.String(), "<td>24.00</td>") {
+		t.Errorf("trend page misses the chart or the table: %s", out.String())
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+// identityTemplate : What every virtual client keeps to itself across its
+// requests, a cookie jar and the sticky headers expanded once per client
+type identityTemplate struct {
+	Cookies bool
+	Header  http.Header
+}
+
+// check makes sure the sticky headers only refer to the known values
+func (t *identityTemplate) check(known map[string]bool) error {
+	for _, values := range t.Header {
+		for _, value := range values {
+			if err := checkTemplate(value, known); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *identityTemplate) String() string {
+	var parts []string
+	if t.Cookies {
+		parts = append(parts, "own cookie jar")
+	}
+	if len(t.Header) > 0 {
+		parts = append(parts, "sticky "+strings.Join(headerFlag(t.Header).lines(), ", "))
+	}
+	return strings.Join(parts, ", ") + " per client"
+}
+
+// clientIdentity : The cookies and the headers of a single virtual client
+type clientIdentity struct {
+	jar    http.CookieJar
+	header http.Header
+}
+
+// newClient expands the sticky headers with the next row of the data, so the
+// clients take the users of the data one each
+func (t *identityTemplate) newClient(data *dataFeed, rnd *rand.Rand) *clientIdentity {
+	identity := &clientIdentity{header: make(http.Header)}
+	if t.Cookies {
+		// Without a public suffix list the jar still keeps the cookies per host
+		jar, err := cookiejar.New(nil)
+		panicIf(err)
+		identity.jar = jar
+	}
+	vars := data.row(rnd)
+	for key, values := range t.Header {
+		for _, value := range values {
+			// The headers are checked up front, so every value is always there
+			expanded, err := expand(value, vars, rnd)
+			panicIf(err)
+			identity.header.Add(key, expanded)
+		}
+	}
+	return identity
+}
+
+// options hands the client a copy of the options sending with its cookie jar
+func (c *clientIdentity) options(opt *Options) *Options {
+	own := *opt
+	own.Jar = c.jar
+	return &own
+}
+
+// headers adds the sticky headers to the extra ones of a request
+func (c *clientIdentity) headers(header http.Header) http.Header {
+	if c == nil || len(c.header) == 0 {
+		return header
+	}
+	merged := c.header.Clone()
+	for key, values := range header {
+		merged[key] = values
+	}
+	return merged
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestIdentityTemplate(t *testing.T) {
+	template := &identityTemplate{Cookies: true, Header: http.Header{"X-Session-Id": {"{{uuid}}"}, "X-User": {"{{user}}"}}}
+	if err := template.check(map[string]bool{"user": true}); err != nil {
+		t.Errorf("got %v for the known values", err)
+	}
+	if err := template.check(nil); err == nil {
+		t.Error("got no error for a value missing from the data")
+	}
+	if got := template.String(); got != "own cookie jar, sticky X-Session-Id: {{uuid}}, X-User: {{user}} per client" {
+		t.Errorf("got %q", got)
+	}
+
+	feed := &dataFeed{columns: []string{"user"}, rows: []map[string]string{{"user": "alice"}, {"user": "bob"}}}
+	rnd := rand.New(rand.NewSource(1))
+	first, second := template.newClient(feed, rnd), template.newClient(feed, rnd)
+	if first.header.Get("X-User") != "alice" || second.header.Get("X-User") != "bob" {
+		t.Errorf("got users %q and %q, want one row each", first.header.Get("X-User"), second.header.Get("X-User"))
+	}
+	if first.header.Get("X-Session-Id") == second.header.Get("X-Session-Id") {
+		t.Errorf("both clients got the session %s", first.header.Get("X-Session-Id"))
+	}
+	if first.jar == nil {
+		t.Error("got no cookie jar")
+	}
+	if (&identityTemplate{Header: template.Header}).newClient(feed, rnd).jar != nil {
+		t.Error("got a cookie jar without the cookies")
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	// The server hands out a session to every request coming without one
+	var mu sync.Mutex
+	sessions := 0
+	seen := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			sessions++
+			cookie = &http.Cookie{Name: "session", Value: fmt.Sprint(sessions)}
+			http.SetCookie(w, cookie)
+		}
+		user := r.Header.Get("X-User")
+		seen[user] = append(seen[user], cookie.Value+" "+r.Header.Get("Traceparent"))
+	}))
+	defer server.Close()
+
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true})}
+	template := &identityTemplate{Cookies: true, Header: http.Header{"X-User": {"user-{{seq}}"}}}
+	rnd := rand.New(rand.NewSource(1))
+	clients := []*clientIdentity{template.newClient(nil, rnd), template.newClient(nil, rnd)}
+	for i := 0; i < 3; i++ {
+		for _, client := range clients {
+			header := client.headers(http.Header{"Traceparent": {"00-1"}})
+			response := fire(server.URL, &Cannonball{Method: "GET"}, header, client.options(opt))
+			if !response.Success {
+				t.Fatalf("got %d %q", response.Status, response.Body)
+			}
+		}
+	}
+	if len(seen) != 2 || sessions != 2 {
+		t.Fatalf("got %d users in %d sessions, want 2 of each", len(seen), sessions)
+	}
+	for user, requests := range seen {
+		for _, request := range requests {
+			if request != requests[0] || request[len(request)-4:] != "00-1" {
+				t.Errorf("%s: got the requests %v, want all of them in the first session", user, requests)
+				break
+			}
+		}
+	}
+	if opt.Jar != nil {
+		t.Error("the cookie jar leaked into the shared options")
+	}
+
+	// Without the cookies every request starts a session of its own
+	client := (&identityTemplate{Header: template.Header}).newClient(nil, rnd)
+	for i := 0; i < 2; i++ {
+		fire(server.URL, &Cannonball{Method: "GET"}, client.headers(nil), client.options(opt))
+	}
+	if sessions != 4 {
+		t.Errorf("got %d sessions, want a new one for each of the requests without cookies", sessions)
+	}
+	if (*clientIdentity)(nil).headers(nil) != nil {
+		t.Error("got headers without an identity")
+	}
+}
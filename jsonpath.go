@@ -0,0 +1,153 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath : A compiled subset of JSONPath, the keys and the indices from
+// the root like $.data.items[0].id or $['job id']
+type jsonPath struct {
+	expr  string
+	steps []interface{} // string keys and int indices
+}
+
+// parseJSONPath compiles the expression, only plain member and index access is supported
+func parseJSONPath(expr string) (*jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("path %q should start at the root $", expr)
+	}
+	path := &jsonPath{expr: expr}
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("path %q has an empty key", expr)
+			}
+			path.steps = append(path.steps, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unclosed bracket", expr)
+			}
+			inside := rest[1:end]
+			if len(inside) >= 2 && (inside[0] == '\'' || inside[0] == '"') && inside[len(inside)-1] == inside[0] {
+				path.steps = append(path.steps, inside[1:len(inside)-1])
+			} else {
+				index, err := strconv.Atoi(inside)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("path %q has an invalid index [%s]", expr, inside)
+				}
+				path.steps = append(path.steps, index)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q has an unexpected %q", expr, rest[0])
+		}
+	}
+	return path, nil
+}
+
+// find walks the decoded document down the path
+func (p *jsonPath) find(doc interface{}) (interface{}, bool) {
+	for _, step := range p.steps {
+		switch step := step.(type) {
+		case string:
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = object[step]; !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := doc.([]interface{})
+			if !ok || step >= len(list) {
+				return nil, false
+			}
+			doc = list[step]
+		}
+	}
+	return doc, true
+}
+
+// remove drops the value at the path from the decoded document, an item
+// of a list turns null so that the rest keep their indices
+func (p *jsonPath) remove(doc interface{}) interface{} {
+	if len(p.steps) == 0 {
+		return nil
+	}
+	parent := &jsonPath{expr: p.expr, steps: p.steps[:len(p.steps)-1]}
+	container, ok := parent.find(doc)
+	if !ok {
+		return doc
+	}
+	switch step := p.steps[len(p.steps)-1].(type) {
+	case string:
+		if object, ok := container.(map[string]interface{}); ok {
+			delete(object, step)
+		}
+	case int:
+		if list, ok := container.([]interface{}); ok && step < len(list) {
+			list[step] = nil
+		}
+	}
+	return doc
+}
+
+// extract finds the value in the json body, the strings come out as they
+// are and everything else as json
+func (p *jsonPath) extract(body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("response is not json: %s", err)
+	}
+	value, ok := p.find(doc)
+	if !ok {
+		return "", fmt.Errorf("no %s in the response", p.expr)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func (p *jsonPath) String() string {
+	return p.expr
+}
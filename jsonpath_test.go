@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import "testing"
+
+func TestJSONPath(t *testing.T) {
+	body := []byte(`{"id": "job-1", "count": 12345678901234, "ok": true, "job id": "spaced",
+		"items": [{"name": "a"}, {"name": "b", "tags": ["x", "y"]}], "meta": {"size": 3}}`)
+	tests := []struct {
+		expr  string
+		want  string
+		fails bool
+	}{
+		{"$.id", "job-1", false},
+		{"$.count", "12345678901234", false},
+		{"$.ok", "true", false},
+		{"$['job id']", "spaced", false},
+		{"$.items[1].name", "b", false},
+		{"$.items[1].tags[0]", "x", false},
+		{`$["meta"].size`, "3", false},
+		{"$.meta", `{"size":3}`, false},
+		{"$.items[2]", "", true},
+		{"$.missing", "", true},
+		{"$.id.deeper", "", true},
+	}
+	for _, test := range tests {
+		path, err := parseJSONPath(test.expr)
+		if err != nil {
+			t.Errorf("%s: %s", test.expr, err)
+			continue
+		}
+		got, err := path.extract(body)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", test.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %q (%v), want %q", test.expr, got, err, test.want)
+		}
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, expr := range []string{"id", "$.", "$..id", "$[", "$[-1]", "$[x]", "$id"} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("%s: got no error", expr)
+		}
+	}
+	path, _ := parseJSONPath("$.id")
+	if _, err := path.extract([]byte("not json")); err == nil {
+		t.Errorf("got no error for a body that is not json")
+	}
+}
+
+func TestJSONPathRemove(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$.id", `{"items":[1,2],"meta":{"size":3}}`},
+		{"$.meta.size", `{"id":"a","items":[1,2],"meta":{}}`},
+		{"$.items[0]", `{"id":"a","items":[null,2],"meta":{"size":3}}`},
+		{"$.missing.size", `{"id":"a","items":[1,2],"meta":{"size":3}}`},
+		{"$", `null`},
+	}
+	for _, test := range tests {
+		path, err := parseJSONPath(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %s", test.expr, err)
+		}
+		doc, _ := decodeJSON([]byte(`{"id": "a", "items": [1, 2], "meta": {"size": 3}}`))
+		if got := encodeJSON(path.remove(doc)); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const k8sProxyAPI = "http://127.0.0.1:8001"
+const k8sAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+const k8sTimeout = 10 * time.Second
+
+type k8sTargetRef struct {
+	Name string `json:"name"`
+}
+
+type k8sAddress struct {
+	IP        string        `json:"ip"`
+	TargetRef *k8sTargetRef `json:"targetRef"`
+}
+
+type k8sPort struct {
+	Name       string      `json:"name"`
+	Port       int         `json:"port"`
+	TargetPort interface{} `json:"targetPort"`
+}
+
+type k8sService struct {
+	Spec struct {
+		Ports []k8sPort `json:"ports"`
+	} `json:"spec"`
+}
+
+type k8sEndpoints struct {
+	Subsets []struct {
+		Addresses []k8sAddress `json:"addresses"`
+		Ports     []k8sPort    `json:"ports"`
+	} `json:"subsets"`
+}
+
+// k8sClient : A minimal Kubernetes API client, either in-cluster or through kubectl proxy
+type k8sClient struct {
+	api    string
+	token  string
+	client http.Client
+}
+
+func newK8sClient(api string) (*k8sClient, error) {
+	k8s := &k8sClient{api: api, client: http.Client{Timeout: k8sTimeout}}
+	if api != "" {
+		return k8s, nil
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		k8s.api = k8sProxyAPI
+		return k8s, nil
+	}
+
+	token, err := ioutil.ReadFile(k8sAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(k8sAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	k8s.api = "https://" + net.JoinHostPort(host, port)
+	k8s.token = strings.TrimSpace(string(token))
+	k8s.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return k8s, nil
+}
+
+func (k8s *k8sClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", k8s.api+path, nil)
+	if err != nil {
+		return err
+	}
+	if k8s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k8s.token)
+	}
+
+	res, err := k8s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// parseServiceSpec splits ns/name:port into its parts, the port is optional
+func parseServiceSpec(spec string) (string, string, string, error) {
+	slash := strings.Index(spec, "/")
+	if slash <= 0 || slash == len(spec)-1 {
+		return "", "", "", fmt.Errorf("service %q is not in ns/name:port form", spec)
+	}
+	namespace, name, port := spec[:slash], spec[slash+1:], ""
+	if colon := strings.LastIndex(name, ":"); colon >= 0 {
+		name, port = name[:colon], name[colon+1:]
+	}
+	return namespace, name, port, nil
+}
+
+// resolveService finds the pods behind a Kubernetes service and
+// returns the endpoint rewritten to target each of them directly
+func resolveService(api string, spec string, endpoint string) ([]Target, error) {
+	namespace, name, port, err := parseServiceSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	k8s, err := newK8sClient(api)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s", url.PathEscape(namespace))
+
+	var service k8sService
+	if err := k8s.get(path+"/services/"+url.PathEscape(name), &service); err != nil {
+		return nil, err
+	}
+	var servicePort *k8sPort
+	for i, p := range service.Spec.Ports {
+		if port == "" || port == p.Name || port == strconv.Itoa(p.Port) {
+			servicePort = &service.Spec.Ports[i]
+			break
+		}
+	}
+	if servicePort == nil {
+		return nil, fmt.Errorf("service %s/%s has no port %q", namespace, name, port)
+	}
+
+	var endpoints k8sEndpoints
+	if err := k8s.get(path+"/endpoints/"+url.PathEscape(name), &endpoints); err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, 0)
+	for _, subset := range endpoints.Subsets {
+		podPort := 0
+		for _, p := range subset.Ports {
+			if p.Name == servicePort.Name || len(subset.Ports) == 1 {
+				podPort = p.Port
+				break
+			}
+		}
+		if podPort == 0 {
+			continue
+		}
+		for _, address := range subset.Addresses {
+			target := *base
+			target.Host = net.JoinHostPort(address.IP, strconv.Itoa(podPort))
+			label := address.IP
+			if address.TargetRef != nil && address.TargetRef.Name != "" {
+				label = address.TargetRef.Name
+			}
+			targets = append(targets, Target{Name: label, URL: target.String()})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("service %s/%s has no ready endpoints", namespace, name)
+	}
+
+	return targets, nil
+}
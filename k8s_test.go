@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseServiceSpec(t *testing.T) {
+	tests := []struct {
+		spec                  string
+		namespace, name, port string
+	}{
+		{"default/api", "default", "api", ""},
+		{"ml/api:8000", "ml", "api", "8000"},
+		{"ml/api:http", "ml", "api", "http"},
+	}
+	for _, test := range tests {
+		namespace, name, port, err := parseServiceSpec(test.spec)
+		if err != nil {
+			t.Errorf("parseServiceSpec(%q) failed: %s", test.spec, err)
+			continue
+		}
+		if namespace != test.namespace || name != test.name || port != test.port {
+			t.Errorf("parseServiceSpec(%q) = %q %q %q, want %q %q %q", test.spec,
+				namespace, name, port, test.namespace, test.name, test.port)
+		}
+	}
+}
+
+func TestParseServiceSpecErrors(t *testing.T) {
+	for _, spec := range []string{"", "api", "/api", "default/"} {
+		if _, _, _, err := parseServiceSpec(spec); err == nil {
+			t.Errorf("parseServiceSpec(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package latency
+
+import (
+	"math"
+	"math/bits"
+)
+
+// subBuckets is how many buckets every power of two of microseconds is cut
+// into, the values are exact below twice of it and within 0.1% above
+const subBuckets = 1024
+
+// subBits is the log2 of subBuckets
+const subBits = 10
+
+// histogram : Counts of the latencies in log-linear buckets of microseconds,
+// taking the same memory whatever the number of the requests. The sum and the
+// extremes are kept exactly
+type histogram struct {
+	counts []uint64
+	total  int
+	sum    int64
+	min    float64
+	max    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// bucket is the index of the bucket of the microseconds
+func bucket(micros int64) int {
+	if micros < 2*subBuckets {
+		return int(micros)
+	}
+	shift := bits.Len64(uint64(micros)) - subBits - 1
+	return subBuckets*(shift+1) + int(micros>>uint(shift)) - subBuckets
+}
+
+// bucketMiddle is the microseconds in the middle of the bucket
+func bucketMiddle(index int) float64 {
+	if index < 2*subBuckets {
+		return float64(index)
+	}
+	shift := index/subBuckets - 1
+	lower := int64(index%subBuckets+subBuckets) << uint(shift)
+	return float64(lower) + float64(int64(1)<<uint(shift)-1)/2
+}
+
+func (h *histogram) add(millis float64) {
+	micros := int64(math.Round(millis * steps))
+	if micros < 0 {
+		micros = 0
+	}
+	index := bucket(micros)
+	if index >= len(h.counts) {
+		grown := make([]uint64, index+1, index+1+index/4)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[index]++
+	h.total++
+	h.sum += micros
+	h.min = math.Min(h.min, millis)
+	h.max = math.Max(h.max, millis)
+}
+
+// merge adds the counts of the other histogram
+func (h *histogram) merge(other *histogram) {
+	if other == nil {
+		return
+	}
+	if len(other.counts) > len(h.counts) {
+		grown := make([]uint64, len(other.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.min = math.Min(h.min, other.min)
+	h.max = math.Max(h.max, other.max)
+}
+
+// at is the value of the given rank in the sorted order, within the extremes
+func (h *histogram) at(rank int) float64 {
+	seen := uint64(0)
+	for index, count := range h.counts {
+		seen += count
+		if seen > uint64(rank) {
+			value := bucketMiddle(index) / steps
+			return math.Max(h.min, math.Min(h.max, value))
+		}
+	}
+	return h.max
+}
+
+// percentile interpolates between the two closest ranks just like Percentile
+func (h *histogram) percentile(threshold float64) float64 {
+	if h.total == 0 || threshold < 0 || threshold > 100 {
+		return math.NaN()
+	}
+	rank := threshold / 100 * float64(h.total-1)
+	lower := int(math.Floor(rank))
+	if lower >= h.total-1 {
+		return h.max
+	}
+	below, above := h.at(lower), h.at(lower+1)
+	return below + (above-below)*(rank-float64(lower))
+}
+
+func (h *histogram) mean() float64 {
+	if h.total == 0 {
+		return math.NaN()
+	}
+	return float64(h.sum) / float64(h.total) / steps
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package latency
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBucket(t *testing.T) {
+	for _, micros := range []int64{0, 1, 2047, 2048, 2049, 4095, 4096, 123456, 3600e6} {
+		middle := bucketMiddle(bucket(micros))
+		if math.Abs(middle-float64(micros)) > float64(micros)/subBuckets {
+			t.Errorf("bucket of %d us has its middle at %g", micros, middle)
+		}
+	}
+	// The buckets follow each other without gaps
+	for micros := int64(1); micros < 1<<16; micros++ {
+		if step := bucket(micros) - bucket(micros-1); step != 0 && step != 1 {
+			t.Fatalf("bucket(%d) - bucket(%d) = %d", micros, micros-1, step)
+		}
+	}
+}
+
+func TestFoldedStats(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	folded := NewLimited(100)
+	exact := NewLimited(0)
+	for i := 0; i < 20000; i++ {
+		millis, success := math.Exp(rnd.NormFloat64())*50, i%20 != 0
+		folded.Add(millis, success)
+		exact.Add(millis, success)
+	}
+	if !folded.Folded() || exact.Folded() {
+		t.Fatalf("folded %v and %v, want only the first accumulator folded", folded.Folded(), exact.Folded())
+	}
+	if folded.Count() != 20000 {
+		t.Errorf("folded count = %d, want 20000", folded.Count())
+	}
+
+	thresholds := []float64{50, 90, 99, 99.9}
+	for _, mode := range []struct{ successes, failures bool }{{true, false}, {true, true}, {false, true}} {
+		got := folded.stats(mode.successes, mode.failures, thresholds)
+		want := exact.stats(mode.successes, mode.failures, thresholds)
+		if got.Count != want.Count || got.Successes != want.Successes || got.Fails != want.Fails {
+			t.Errorf("folded counts = %d/%d/%d, want %d/%d/%d", got.Count, got.Successes, got.Fails,
+				want.Count, want.Successes, want.Fails)
+		}
+		if got.Min != want.Min || got.Max != want.Max || math.Abs(got.Mean-want.Mean) > 0.001 {
+			t.Errorf("folded mean %g, min %g, max %g, want %g, %g, %g", got.Mean, got.Min, got.Max,
+				want.Mean, want.Min, want.Max)
+		}
+		for i, threshold := range thresholds {
+			if math.Abs(got.Percentiles[i]-want.Percentiles[i]) > want.Percentiles[i]/subBuckets+0.001 {
+				t.Errorf("folded %g%% = %g, want %g within 0.1%%", threshold, got.Percentiles[i], want.Percentiles[i])
+			}
+		}
+	}
+}
+
+func TestFoldedStatsExactBelow(t *testing.T) {
+	// Below two milliseconds every microsecond has a bucket of its own
+	acc := NewLimited(2)
+	for _, millis := range []float64{0.25, 0.5, 0.75, 1} {
+		acc.Add(millis, true)
+	}
+	stats := acc.Stats(50, 75)
+	if stats.Median != 0.625 || stats.Percentiles[1] != 0.813 || stats.Mean != 0.625 {
+		t.Errorf("folded median %g, 75%% %g, mean %g, want 0.625, 0.813, 0.625", stats.Median,
+			stats.Percentiles[1], stats.Mean)
+	}
+}
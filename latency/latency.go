@@ -0,0 +1,233 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+// Package latency accumulates request latencies and summarizes them. The
+// summaries only depend on the set of values, not on the order they came in.
+// Past a number of requests the latencies are folded into histograms, so that
+// long runs take the same memory however many requests they make.
+package latency
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// steps is the number of rounding steps per millisecond, to the microsecond
+const steps = 1000
+
+// DefaultMaxSamples is how many latencies the accumulators keep as they are
+const DefaultMaxSamples = 1 << 20
+
+// Stats : Summary of the accumulated latencies in milliseconds, the values
+// are NaN when there is no request to take them from
+type Stats struct {
+	Count       int
+	Successes   int
+	Fails       int
+	Mean        float64
+	Min         float64
+	Max         float64
+	Median      float64
+	Percentiles []float64
+}
+
+// Accumulator : Latencies of the requests, safe for concurrent use. Once
+// there are more than the max samples of them, they go into histograms
+type Accumulator struct {
+	mu         sync.Mutex
+	values     []float64
+	failed     []float64
+	limit      int
+	histogram  *histogram
+	histFailed *histogram
+}
+
+// New creates an empty accumulator keeping the default number of samples
+func New() *Accumulator {
+	return NewLimited(DefaultMaxSamples)
+}
+
+// NewLimited creates an empty accumulator keeping that many latencies as they
+// are before folding them into histograms, 0 keeps all of them
+func NewLimited(maxSamples int) *Accumulator {
+	return &Accumulator{values: make([]float64, 0), limit: maxSamples}
+}
+
+// Add records a request, the failed ones are kept apart from the successful
+func (a *Accumulator) Add(millis float64, success bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.histogram == nil && a.limit > 0 && len(a.values)+len(a.failed) >= a.limit {
+		a.fold()
+	}
+	switch {
+	case a.histogram != nil && success:
+		a.histogram.add(millis)
+	case a.histogram != nil:
+		a.histFailed.add(millis)
+	case success:
+		a.values = append(a.values, millis)
+	default:
+		a.failed = append(a.failed, millis)
+	}
+}
+
+// fold moves the latencies kept so far into the histograms
+func (a *Accumulator) fold() {
+	a.histogram, a.histFailed = newHistogram(), newHistogram()
+	for _, value := range a.values {
+		a.histogram.add(value)
+	}
+	for _, value := range a.failed {
+		a.histFailed.add(value)
+	}
+	a.values, a.failed = nil, nil
+}
+
+// Folded tells whether the latencies went into histograms, their percentiles
+// are then estimated to within 0.1%
+func (a *Accumulator) Folded() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.histogram != nil
+}
+
+// Count is the number of the requests recorded so far
+func (a *Accumulator) Count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.histogram != nil {
+		return a.histogram.total + a.histFailed.total
+	}
+	return len(a.values) + len(a.failed)
+}
+
+// Stats summarizes the latencies of the successful requests with the given percentiles
+func (a *Accumulator) Stats(thresholds ...float64) Stats {
+	return a.stats(true, false, thresholds)
+}
+
+// StatsWithFailures summarizes the latencies of all the requests, the failed ones included
+func (a *Accumulator) StatsWithFailures(thresholds ...float64) Stats {
+	return a.stats(true, true, thresholds)
+}
+
+// FailedStats summarizes the latencies of the failed requests alone, the time
+// it took them to fail
+func (a *Accumulator) FailedStats(thresholds ...float64) Stats {
+	return a.stats(false, true, thresholds)
+}
+
+func (a *Accumulator) stats(successes bool, failures bool, thresholds []float64) Stats {
+	a.mu.Lock()
+	if a.histogram != nil {
+		defer a.mu.Unlock()
+		return a.histogramStats(successes, failures, thresholds)
+	}
+	sorted := make([]float64, 0, len(a.values)+len(a.failed))
+	if successes {
+		sorted = append(sorted, a.values...)
+	}
+	if failures {
+		sorted = append(sorted, a.failed...)
+	}
+	numSuccesses, fails := len(a.values), len(a.failed)
+	a.mu.Unlock()
+	sort.Float64s(sorted)
+
+	s := Stats{
+		Count:       numSuccesses + fails,
+		Successes:   numSuccesses,
+		Fails:       fails,
+		Mean:        math.NaN(),
+		Min:         math.NaN(),
+		Max:         math.NaN(),
+		Median:      math.NaN(),
+		Percentiles: make([]float64, len(thresholds)),
+	}
+	for i, threshold := range thresholds {
+		s.Percentiles[i] = Round(Percentile(sorted, threshold))
+	}
+	if len(sorted) == 0 {
+		return s
+	}
+
+	// Summing in the sorted order keeps the mean independent of the arrival order
+	sum := 0.0
+	for _, value := range sorted {
+		sum += value
+	}
+	s.Mean = Round(sum / float64(len(sorted)))
+	s.Min = Round(sorted[0])
+	s.Max = Round(sorted[len(sorted)-1])
+	s.Median = Round(Percentile(sorted, 50))
+	return s
+}
+
+func (a *Accumulator) histogramStats(successes bool, failures bool, thresholds []float64) Stats {
+	merged := newHistogram()
+	if successes {
+		merged.merge(a.histogram)
+	}
+	if failures {
+		merged.merge(a.histFailed)
+	}
+	s := Stats{
+		Count:       a.histogram.total + a.histFailed.total,
+		Successes:   a.histogram.total,
+		Fails:       a.histFailed.total,
+		Mean:        Round(merged.mean()),
+		Min:         math.NaN(),
+		Max:         math.NaN(),
+		Median:      Round(merged.percentile(50)),
+		Percentiles: make([]float64, len(thresholds)),
+	}
+	for i, threshold := range thresholds {
+		s.Percentiles[i] = Round(merged.percentile(threshold))
+	}
+	if merged.total > 0 {
+		s.Min, s.Max = Round(merged.min), Round(merged.max)
+	}
+	return s
+}
+
+// Percentile interpolates linearly between the two closest ranks of the sorted
+// values, so that the median of an even count is the mean of the middle two
+func Percentile(sorted []float64, threshold float64) float64 {
+	n := len(sorted)
+	if n == 0 || threshold < 0 || threshold > 100 {
+		return math.NaN()
+	}
+	rank := threshold / 100 * float64(n-1)
+	lower := int(math.Floor(rank))
+	if lower >= n-1 {
+		return sorted[n-1]
+	}
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(rank-float64(lower))
+}
+
+// Round rounds the milliseconds half away from zero to the microsecond
+func Round(value float64) float64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+	return math.Round(value*steps) / steps
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package latency
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	uniform := make([]float64, 100)
+	for i := range uniform {
+		uniform[i] = float64(i + 1)
+	}
+	tests := []struct {
+		sorted    []float64
+		threshold float64
+		want      float64
+	}{
+		{uniform, 50, 50.5},
+		{uniform, 90, 90.1},
+		{uniform, 99, 99.01},
+		{uniform, 99.9, 99.901},
+		{uniform, 100, 100},
+		{uniform, 0, 1},
+		{[]float64{1, 2, 3}, 50, 2},
+		{[]float64{1, 3}, 50, 2},
+		{[]float64{1, 3}, 75, 2.5},
+		{[]float64{7}, 95, 7},
+		{[]float64{}, 50, math.NaN()},
+		{uniform, 101, math.NaN()},
+	}
+	for _, test := range tests {
+		got := Round(Percentile(test.sorted, test.threshold))
+		if got != test.want && !(math.IsNaN(got) && math.IsNaN(test.want)) {
+			t.Errorf("Percentile(%d values, %g) = %g, want %g", len(test.sorted), test.threshold, got, test.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  float64
+	}{
+		{1.0004, 1},
+		{1.0005, 1.001},
+		{-1.0005, -1.001},
+		{12.3456789, 12.346},
+		{math.Inf(1), math.Inf(1)},
+	}
+	for _, test := range tests {
+		if got := Round(test.value); got != test.want {
+			t.Errorf("Round(%g) = %g, want %g", test.value, got, test.want)
+		}
+	}
+	if !math.IsNaN(Round(math.NaN())) {
+		t.Errorf("Round(NaN) is not NaN")
+	}
+}
+
+func TestStats(t *testing.T) {
+	acc := New()
+	for _, millis := range []float64{10, 20, 30, 40} {
+		acc.Add(millis, true)
+	}
+	acc.Add(5000, false)
+	acc.Add(5000, false)
+
+	stats := acc.Stats(50, 100)
+	if stats.Count != 6 || stats.Successes != 4 || stats.Fails != 2 {
+		t.Errorf("counts = %d/%d/%d, want 6/4/2", stats.Count, stats.Successes, stats.Fails)
+	}
+	// The failures neither count towards the latencies nor dilute the mean
+	if stats.Mean != 25 || stats.Min != 10 || stats.Max != 40 || stats.Median != 25 {
+		t.Errorf("got mean %g, min %g, max %g, median %g", stats.Mean, stats.Min, stats.Max, stats.Median)
+	}
+	if stats.Percentiles[0] != 25 || stats.Percentiles[1] != 40 {
+		t.Errorf("got percentiles %v", stats.Percentiles)
+	}
+
+	// Unless they are asked for, then the latencies of all the requests count
+	stats = acc.StatsWithFailures(50, 100)
+	if stats.Count != 6 || stats.Successes != 4 || stats.Fails != 2 {
+		t.Errorf("counts = %d/%d/%d, want 6/4/2", stats.Count, stats.Successes, stats.Fails)
+	}
+	if stats.Mean != 1683.333 || stats.Min != 10 || stats.Max != 5000 || stats.Median != 35 {
+		t.Errorf("got mean %g, min %g, max %g, median %g", stats.Mean, stats.Min, stats.Max, stats.Median)
+	}
+	if stats.Percentiles[0] != 35 || stats.Percentiles[1] != 5000 {
+		t.Errorf("got percentiles %v", stats.Percentiles)
+	}
+
+	// Or alone, as the time it took the requests to fail
+	stats = acc.FailedStats(50)
+	if stats.Count != 6 || stats.Fails != 2 || stats.Mean != 5000 || stats.Min != 5000 || stats.Percentiles[0] != 5000 {
+		t.Errorf("got %d/%d requests, mean %g, min %g, percentiles %v", stats.Count, stats.Fails, stats.Mean,
+			stats.Min, stats.Percentiles)
+	}
+
+	empty := New().Stats(95)
+	if empty.Count != 0 || !math.IsNaN(empty.Mean) || !math.IsNaN(empty.Percentiles[0]) {
+		t.Errorf("empty stats = %+v", empty)
+	}
+}
+
+func TestStatsOrderIndependent(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = rnd.ExpFloat64() * 20
+	}
+
+	forward, backward := New(), New()
+	for i := range values {
+		forward.Add(values[i], true)
+		backward.Add(values[len(values)-1-i], true)
+	}
+	a, b := forward.Stats(90, 99), backward.Stats(90, 99)
+	if a.Mean != b.Mean || a.Median != b.Median || a.Percentiles[0] != b.Percentiles[0] || a.Percentiles[1] != b.Percentiles[1] {
+		t.Errorf("stats depend on the order: %+v vs %+v", a, b)
+	}
+	// The mean of an exponential distribution is close to its scale
+	if a.Mean < 18 || a.Mean > 22 {
+		t.Errorf("got mean %g, want about 20", a.Mean)
+	}
+}
+
+func TestAccumulatorConcurrent(t *testing.T) {
+	acc := New()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				acc.Add(float64(i), i%10 != 0)
+				if i%100 == 0 {
+					acc.Stats(95)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := acc.Stats()
+	if stats.Count != 8000 || stats.Fails != 800 {
+		t.Errorf("got %d requests and %d fails, want 8000 and 800", stats.Count, stats.Fails)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const limiterBurst = 1.0
+
+// Arrival processes of the requests under a rate
+const (
+	arrivalUniform = "uniform"
+	arrivalPoisson = "poisson"
+)
+
+// Limiter : A token bucket shared by all the clients to cap the outbound rate
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	tokens  float64
+	last    time.Time
+	planned time.Time
+	poisson *rand.Rand
+}
+
+func newLimiter(rate float64) *Limiter {
+	return &Limiter{
+		rate:   rate,
+		tokens: limiterBurst,
+		last:   time.Now(),
+	}
+}
+
+// Rate is the current limit, zero means no limit
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate changes the limit on the fly, a zero rate lifts it
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	l.tokens = math.Min(l.tokens, limiterBurst)
+	l.last = time.Now()
+	l.planned = time.Time{}
+}
+
+// SpreadPoisson makes the gaps between the requests exponential around the
+// rate, as if they came from many independent clients, by having each
+// request cost a random number of tokens instead of exactly one
+func (l *Limiter) SpreadPoisson(rnd *rand.Rand) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.poisson = rnd
+}
+
+// Wait blocks until a token is available, a zero rate means no limit. It
+// gives up as soon as cancel is closed and tells whether the token was got
+// along with the moment the request was intended for, zero when there is no
+// limit to keep. The intended moments
+// keep the exact pace of the rate, so they fall behind whenever the clients
+// do not keep up with it.
+func (l *Limiter) Wait(cancel <-chan struct{}) (time.Time, bool) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return time.Time{}, true
+	}
+
+	l.tokens = math.Min(limiterBurst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	cost := 1.0
+	if l.poisson != nil {
+		cost = l.poisson.ExpFloat64()
+	}
+	l.tokens -= cost
+	if l.planned.IsZero() {
+		l.planned = now
+	}
+	intended := l.planned
+	l.planned = l.planned.Add(time.Duration(cost / l.rate * float64(time.Second)))
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return intended, true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return intended, true
+	case <-cancel:
+		return intended, false
+	}
+}
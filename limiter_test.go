@@ -0,0 +1,130 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	limiter := newLimiter(0)
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		if _, ok := limiter.Wait(nil); !ok {
+			t.Fatal("unlimited wait was cancelled")
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited waits took %s", elapsed)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	limiter := newLimiter(100)
+	start := time.Now()
+	for i := 0; i < 21; i++ {
+		limiter.Wait(nil)
+	}
+	// The first token is there from the start, the other 20 take 10ms each
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("21 waits at 100 rps took %s, want about 200ms", elapsed)
+	}
+}
+
+func TestLimiterSetRate(t *testing.T) {
+	limiter := newLimiter(1)
+	limiter.Wait(nil)
+	limiter.SetRate(0)
+	if limiter.Rate() != 0 {
+		t.Errorf("rate = %g, want 0", limiter.Rate())
+	}
+	start := time.Now()
+	limiter.Wait(nil)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("wait after lifting the limit took %s", elapsed)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	limiter := newLimiter(0.1)
+	limiter.Wait(nil)
+
+	cancel := make(chan struct{})
+	time.AfterFunc(20*time.Millisecond, func() { close(cancel) })
+	start := time.Now()
+	if _, ok := limiter.Wait(cancel); ok {
+		t.Error("wait got a token, want it cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled wait took %s", elapsed)
+	}
+}
+
+func TestLimiterIntended(t *testing.T) {
+	limiter := newLimiter(100)
+	first, _ := limiter.Wait(nil)
+	for i := 1; i <= 5; i++ {
+		intended, _ := limiter.Wait(nil)
+		if want := first.Add(time.Duration(i) * 10 * time.Millisecond); !intended.Equal(want) {
+			t.Errorf("request %d intended at %s, want %s", i, intended.Sub(first), want.Sub(first))
+		}
+	}
+
+	// A client late by 50ms finds its request intended for the past
+	time.Sleep(50 * time.Millisecond)
+	intended, _ := limiter.Wait(nil)
+	if lag := time.Since(intended); lag < 40*time.Millisecond {
+		t.Errorf("late request lags by %s, want about 50ms", lag)
+	}
+}
+
+func TestLimiterPoisson(t *testing.T) {
+	limiter := newLimiter(1000)
+	limiter.SpreadPoisson(rand.New(rand.NewSource(1)))
+	start := time.Now()
+	previous, _ := limiter.Wait(nil)
+	var gaps []float64
+	for i := 0; i < 500; i++ {
+		intended, _ := limiter.Wait(nil)
+		gaps = append(gaps, intended.Sub(previous).Seconds()*1000)
+		previous = intended
+	}
+	// Exponential gaps keep the mean of the rate and spread as much as it
+	mean, variance := 0.0, 0.0
+	for _, gap := range gaps {
+		mean += gap / float64(len(gaps))
+	}
+	for _, gap := range gaps {
+		variance += (gap - mean) * (gap - mean) / float64(len(gaps))
+	}
+	if mean < 0.85 || mean > 1.15 {
+		t.Errorf("mean gap %.3f ms, want about 1 ms", mean)
+	}
+	if deviation := math.Sqrt(variance); deviation < 0.7*mean || deviation > 1.3*mean {
+		t.Errorf("gaps deviate by %.3f ms around %.3f ms, want about as much as the mean", deviation, mean)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("500 waits at 1000 rps took %s, want about 500ms", elapsed)
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMetricsFile = "metrics.log"
+const defaultMetricsInterval = 10 * time.Second
+const metricsQueue = 16384
+
+// sinkTimeout bounds every push of the metrics
+const sinkTimeout = 5 * time.Second
+
+// SinkOptions : How often the batches are pushed and when the files are rotated
+type SinkOptions struct {
+	Interval time.Duration
+	MaxSize  int64
+	MaxAge   time.Duration
+}
+
+// MetricSink : Destination of the outcome of every request as it completes,
+// safe for concurrent use
+type MetricSink interface {
+	Record(latency time.Duration, success bool)
+	Close() error
+}
+
+// openMetricSink opens the sink of the spec: file[:path], graphite:host:port
+// or cloudwatch:namespace, the last two push the requests of every interval
+// at once, under the name of the task when it has one. The requests are handed
+// over to the sink by a goroutine of its own, off the path of the clients
+func openMetricSink(spec string, name string, so SinkOptions) (MetricSink, error) {
+	sink, err := openSink(spec, name, so)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncSink(sink, metricsQueue), nil
+}
+
+func openSink(spec string, name string, so SinkOptions) (MetricSink, error) {
+	kind, target := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, target = spec[:i], spec[i+1:]
+	}
+	switch kind {
+	case "file":
+		if target == "" {
+			target = defaultMetricsFile
+		}
+		return openFileSink(target, so.MaxSize, so.MaxAge)
+	case "graphite":
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return nil, fmt.Errorf("graphite sink %q should be graphite:host:port", spec)
+		}
+		prefix := statsdPrefix
+		if name != "" {
+			prefix += "." + graphiteName(name)
+		}
+		graphite := &graphiteSink{address: target, prefix: prefix, timeout: sinkTimeout}
+		if err := graphite.connect(); err != nil {
+			return nil, err
+		}
+		return newBatchSink(so.Interval, graphite.push), nil
+	case "cloudwatch":
+		if target == "" {
+			return nil, fmt.Errorf("cloudwatch sink %q should be cloudwatch:namespace", spec)
+		}
+		id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("cloudwatch sink needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		region := awsRegion()
+		endpoint := fmt.Sprintf("https://monitoring.%s.amazonaws.com/", region)
+		if custom := os.Getenv("AWS_ENDPOINT_URL"); custom != "" {
+			endpoint = strings.TrimSuffix(custom, "/") + "/"
+		}
+		cloudwatch := &cloudwatchSink{endpoint: endpoint, namespace: target, task: name, region: region,
+			id: id, secret: secret, token: os.Getenv("AWS_SESSION_TOKEN")}
+		return newBatchSink(so.Interval, cloudwatch.push), nil
+	}
+	return nil, fmt.Errorf("unknown metrics sink %q (file, graphite, cloudwatch)", kind)
+}
+
+// The units of a size in bytes, the longest suffixes go first
+var byteUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parseByteSize reads a size like 100MB or 512kb into bytes, a bare number
+// is in bytes
+func parseByteSize(spec string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(spec))
+	scale := 1.0
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, scale = strings.TrimSuffix(value, unit.suffix), unit.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("size %q should be a positive number of b, kb, mb or gb", spec)
+	}
+	return int64(size * scale), nil
+}
+
+// metricRecord : The outcome of a request on its way to a sink
+type metricRecord struct {
+	latency time.Duration
+	success bool
+}
+
+// asyncSink : Queues the requests for a sink fed by a single goroutine, so
+// that neither its locks nor its writes ever hold up the clients
+type asyncSink struct {
+	sink    MetricSink
+	records chan metricRecord
+	done    chan struct{}
+	dropped int64
+}
+
+func newAsyncSink(sink MetricSink, queue int) *asyncSink {
+	s := &asyncSink{sink: sink, records: make(chan metricRecord, queue), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *asyncSink) Record(latency time.Duration, success bool) {
+	select {
+	case s.records <- metricRecord{latency, success}:
+	default:
+		// Never let a slow sink throttle the requests, the drops are told about
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+func (s *asyncSink) run() {
+	defer close(s.done)
+	for record := range s.records {
+		s.sink.Record(record.latency, record.success)
+	}
+}
+
+// Close hands over the queued requests and closes the sink
+func (s *asyncSink) Close() error {
+	close(s.records)
+	<-s.done
+	if dropped := atomic.LoadInt64(&s.dropped); dropped > 0 {
+		fmt.Fprintf(os.Stderr, "Dropped %d latencies the metrics sink could not keep up with\n", dropped)
+	}
+	return s.sink.Close()
+}
+
+// fileSink : Appends the latency of every request in milliseconds to a file,
+// a line each, moving the file aside as path.1, path.2 and so on once it grows
+// past the max size or lives past the max age
+type fileSink struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	f       *os.File
+	written int64
+	opened  time.Time
+	next    int
+	dropped int
+	err     error
+}
+
+func openFileSink(path string, maxSize int64, maxAge time.Duration) (*fileSink, error) {
+	s := &fileSink{path: path, maxSize: maxSize, maxAge: maxAge, next: nextRotation(path)}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// nextRotation is the number after those of the files already rotated
+func nextRotation(path string) int {
+	next := 1
+	matches, _ := filepath.Glob(path + ".*")
+	for _, match := range matches {
+		if n, err := strconv.Atoi(strings.TrimPrefix(match, path+".")); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return next
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.written, s.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+// rotate moves the full file aside and starts a new one, the lines are
+// dropped when even the new one cannot be opened
+func (s *fileSink) rotate() {
+	s.f.Close()
+	s.f = nil
+	if err := os.Rename(s.path, fmt.Sprintf("%s.%d", s.path, s.next)); err != nil {
+		s.err = err
+	} else {
+		s.next++
+	}
+	if err := s.open(); err != nil {
+		s.err = err
+	}
+}
+
+func (s *fileSink) Record(latency time.Duration, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		s.dropped++
+		return
+	}
+	n, _ := fmt.Fprintf(s.f, "%3.3f\n", float64(latency)/float64(time.Millisecond))
+	s.written += int64(n)
+	if (s.maxSize > 0 && s.written >= s.maxSize) || (s.maxAge > 0 && time.Since(s.opened) >= s.maxAge) {
+		s.rotate()
+	}
+}
+
+// Close releases the file and tells whether a rotation failed
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f != nil {
+		if err := s.f.Close(); err != nil && s.err == nil {
+			s.err = err
+		}
+		s.f = nil
+	}
+	if s.dropped > 0 {
+		return fmt.Errorf("dropped %d latencies after failing to rotate %s: %s", s.dropped, s.path, s.err)
+	}
+	if s.err != nil {
+		return fmt.Errorf("failed rotating %s: %s", s.path, s.err)
+	}
+	return nil
+}
+
+// metricBatch : The requests of an interval, the latencies are those of the
+// successful ones
+type metricBatch struct {
+	at       time.Time
+	requests int
+	errors   int
+	count    int
+	sum      time.Duration
+	min      time.Duration
+	max      time.Duration
+}
+
+func (b *metricBatch) add(latency time.Duration, success bool) {
+	b.requests++
+	if !success {
+		b.errors++
+		return
+	}
+	if b.count == 0 || latency < b.min {
+		b.min = latency
+	}
+	if latency > b.max {
+		b.max = latency
+	}
+	b.count++
+	b.sum += latency
+}
+
+// batchSink : Gathers the requests into a batch pushed every interval, the
+// pushes which fail are counted and told about once the sink is closed
+type batchSink struct {
+	mu     sync.Mutex
+	batch  metricBatch
+	push   func(batch *metricBatch) error
+	failed int
+	err    error
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newBatchSink(interval time.Duration, push func(batch *metricBatch) error) *batchSink {
+	s := &batchSink{push: push, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.run(interval)
+	return s
+}
+
+func (s *batchSink) Record(latency time.Duration, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch.add(latency, success)
+}
+
+func (s *batchSink) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+func (s *batchSink) flush() {
+	s.mu.Lock()
+	batch := s.batch
+	s.batch = metricBatch{}
+	s.mu.Unlock()
+	if batch.requests == 0 {
+		return
+	}
+	batch.at = time.Now()
+	if err := s.push(&batch); err != nil {
+		s.failed++
+		s.err = err
+	}
+}
+
+// Close pushes the last batch and tells whether any of the pushes failed
+func (s *batchSink) Close() error {
+	close(s.stop)
+	<-s.done
+	if s.failed > 0 {
+		return fmt.Errorf("%d pushes of the metrics failed, the last one with %s", s.failed, s.err)
+	}
+	return nil
+}
+
+// graphiteSink : Pushes the batches over the plaintext protocol of Graphite,
+// connecting again after a failure, every write is bounded by the timeout so
+// that a stalled collector never holds up the end of the run
+type graphiteSink struct {
+	address string
+	prefix  string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+// graphiteName keeps the name of a task in a single node of the metric path
+func graphiteName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == ' ' || r == '/' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func (g *graphiteSink) connect() error {
+	conn, err := net.DialTimeout("tcp", g.address, g.timeout)
+	if err != nil {
+		return err
+	}
+	g.conn = conn
+	return nil
+}
+
+func (g *graphiteSink) push(batch *metricBatch) error {
+	if g.conn == nil {
+		if err := g.connect(); err != nil {
+			return err
+		}
+	}
+	err := g.conn.SetWriteDeadline(time.Now().Add(g.timeout))
+	if err == nil {
+		_, err = io.WriteString(g.conn, graphiteLines(g.prefix, batch))
+	}
+	if err != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+	return err
+}
+
+// graphiteLines are the path, the value and the unix time of every metric
+func graphiteLines(prefix string, batch *metricBatch) string {
+	var lines strings.Builder
+	at := batch.at.Unix()
+	metric := func(name string, value string) {
+		fmt.Fprintf(&lines, "%s.%s %s %d\n", prefix, name, value, at)
+	}
+	metric("requests", strconv.Itoa(batch.requests))
+	metric("errors", strconv.Itoa(batch.errors))
+	if batch.count > 0 {
+		millis := func(d time.Duration) string {
+			return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+		}
+		metric("latency.mean", millis(batch.sum/time.Duration(batch.count)))
+		metric("latency.min", millis(batch.min))
+		metric("latency.max", millis(batch.max))
+	}
+	return lines.String()
+}
+
+// cloudwatchSink : Pushes the batches with PutMetricData, the latencies as
+// statistic sets so that CloudWatch aggregates them on its own
+type cloudwatchSink struct {
+	endpoint  string
+	namespace string
+	task      string
+	region    string
+	id        string
+	secret    string
+	token     string
+}
+
+// cloudwatchQuery is the form of the PutMetricData call of the batch
+func cloudwatchQuery(namespace string, task string, batch *metricBatch) url.Values {
+	query := url.Values{"Action": {"PutMetricData"}, "Version": {"2010-08-01"}, "Namespace": {namespace}}
+	member := 0
+	metric := func(name string, unit string, values map[string]string) {
+		member++
+		prefix := fmt.Sprintf("MetricData.member.%d.", member)
+		query.Set(prefix+"MetricName", name)
+		query.Set(prefix+"Unit", unit)
+		query.Set(prefix+"Timestamp", batch.at.UTC().Format(time.RFC3339))
+		if task != "" {
+			query.Set(prefix+"Dimensions.member.1.Name", "Task")
+			query.Set(prefix+"Dimensions.member.1.Value", task)
+		}
+		for key, value := range values {
+			query.Set(prefix+key, value)
+		}
+	}
+	metric("Requests", "Count", map[string]string{"Value": strconv.Itoa(batch.requests)})
+	metric("Errors", "Count", map[string]string{"Value": strconv.Itoa(batch.errors)})
+	if batch.count > 0 {
+		millis := func(d time.Duration) string {
+			return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+		}
+		metric("Latency", "Milliseconds", map[string]string{
+			"StatisticValues.SampleCount": strconv.Itoa(batch.count),
+			"StatisticValues.Sum":         millis(batch.sum),
+			"StatisticValues.Minimum":     millis(batch.min),
+			"StatisticValues.Maximum":     millis(batch.max),
+		})
+	}
+	return query
+}
+
+func (c *cloudwatchSink) push(batch *metricBatch) error {
+	body := []byte(canonicalQuery(cloudwatchQuery(c.namespace, c.task, batch)))
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	hash := sha256.Sum256(body)
+	signAWS(req, "monitoring", hex.EncodeToString(hash[:]), c.id, c.secret, c.token, c.region, time.Now())
+
+	client := http.Client{Timeout: sinkTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, dryRunPreview))
+		return fmt.Errorf("PutMetricData: %s %s", res.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
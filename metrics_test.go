@@ -0,0 +1,349 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenMetricSinkErrors(t *testing.T) {
+	defer setEnv(map[string]string{"AWS_ACCESS_KEY_ID": "", "AWS_SECRET_ACCESS_KEY": ""})()
+	for _, spec := range []string{"statsd:localhost:8125", "graphite:localhost", "cloudwatch:", "cloudwatch:Cannonade"} {
+		if sink, err := openMetricSink(spec, "", SinkOptions{Interval: time.Second}); err == nil {
+			sink.Close()
+			t.Errorf("openMetricSink(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "latencies.log")
+
+	sink, err := openMetricSink("file:"+path, "", SinkOptions{Interval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(12345*time.Microsecond, true)
+	sink.Record(2*time.Millisecond, false)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if want := "12.345\n2.000\n"; string(data) != want {
+		t.Errorf("file sink wrote %q, want %q", data, want)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		spec string
+		want int64
+	}{
+		{"512", 512},
+		{"100b", 100},
+		{"64kb", 64 << 10},
+		{"100MB", 100 << 20},
+		{"1.5gb", 3 << 29},
+	}
+	for _, test := range tests {
+		if got, err := parseByteSize(test.spec); err != nil || got != test.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", test.spec, got, err, test.want)
+		}
+	}
+	for _, spec := range []string{"", "mb", "-1kb", "10tb"} {
+		if _, err := parseByteSize(spec); err == nil {
+			t.Errorf("parseByteSize(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+	ioutil.WriteFile(path+".3", []byte("1.000\n"), 0644)
+
+	// Every line is 6 bytes, so every file takes two of them
+	sink, err := openMetricSink("file:"+path, "", SinkOptions{MaxSize: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		sink.Record(time.Duration(i)*time.Millisecond, true)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		path + ".3": "1.000\n",
+		path + ".4": "1.000\n2.000\n",
+		path + ".5": "3.000\n4.000\n",
+		path:        "5.000\n",
+	}
+	for file, lines := range want {
+		if data, _ := ioutil.ReadFile(file); string(data) != lines {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), data, lines)
+		}
+	}
+}
+
+func TestFileSinkAgeRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+
+	sink, err := openMetricSink("file:"+path, "", SinkOptions{MaxAge: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(time.Millisecond, true)
+	sink.Record(time.Millisecond, true)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{path + ".1", path + ".2"} {
+		if data, _ := ioutil.ReadFile(file); string(data) != "1.000\n" {
+			t.Errorf("%s = %q, want a line of its own", filepath.Base(file), data)
+		}
+	}
+}
+
+// blockedSink : A sink stuck in its first record until released
+type blockedSink struct {
+	entered  chan struct{}
+	release  chan struct{}
+	recorded int
+	closed   bool
+}
+
+func (s *blockedSink) Record(latency time.Duration, success bool) {
+	if s.recorded == 0 {
+		close(s.entered)
+		<-s.release
+	}
+	s.recorded++
+}
+
+func (s *blockedSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestAsyncSink(t *testing.T) {
+	inner := &blockedSink{entered: make(chan struct{}), release: make(chan struct{})}
+	sink := newAsyncSink(inner, 2)
+	sink.Record(time.Millisecond, true)
+	<-inner.entered
+
+	// The sink is busy with the first one, two more fit into the queue
+	for i := 0; i < 4; i++ {
+		sink.Record(time.Millisecond, true)
+	}
+	close(inner.release)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if inner.recorded != 3 || sink.dropped != 2 || !inner.closed {
+		t.Errorf("async sink recorded %d, dropped %d, closed %v, want 3, 2, true", inner.recorded, sink.dropped, inner.closed)
+	}
+}
+
+func TestMetricBatch(t *testing.T) {
+	var batch metricBatch
+	for _, latency := range []time.Duration{30, 10, 20} {
+		batch.add(latency*time.Millisecond, true)
+	}
+	batch.add(time.Second, false)
+	if batch.requests != 4 || batch.errors != 1 || batch.count != 3 {
+		t.Fatalf("batch counted %d requests, %d errors, %d latencies, want 4, 1, 3", batch.requests, batch.errors, batch.count)
+	}
+	if batch.min != 10*time.Millisecond || batch.max != 30*time.Millisecond || batch.sum != 60*time.Millisecond {
+		t.Errorf("batch latencies are min %s, max %s, sum %s, want 10ms, 30ms, 60ms", batch.min, batch.max, batch.sum)
+	}
+}
+
+func TestGraphiteSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	lines := make(chan string, 16)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	sink, err := openMetricSink("graphite:"+listener.Addr().String(), "canary v2", SinkOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(10*time.Millisecond, true)
+	sink.Record(30*time.Millisecond, true)
+	sink.Record(time.Second, false)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"cannonade.canary_v2.requests":     "3",
+		"cannonade.canary_v2.errors":       "1",
+		"cannonade.canary_v2.latency.mean": "20.000",
+		"cannonade.canary_v2.latency.min":  "10.000",
+		"cannonade.canary_v2.latency.max":  "30.000",
+	}
+	got := make(map[string]string)
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("graphite got %v, want %v", got, want)
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				t.Fatalf("graphite line %q should be path, value and time", line)
+			}
+			got[fields[0]] = fields[1]
+		case <-timeout:
+			t.Fatalf("graphite got %v before the timeout, want %v", got, want)
+		}
+	}
+	for path, value := range want {
+		if got[path] != value {
+			t.Errorf("graphite %s = %q, want %q", path, got[path], value)
+		}
+	}
+}
+
+func TestGraphiteSinkStalled(t *testing.T) {
+	// Nobody reads the other end of the pipe, like a collector stuck for good
+	client, server := net.Pipe()
+	defer server.Close()
+	graphite := &graphiteSink{address: "127.0.0.1:0", prefix: "cannonade", timeout: 50 * time.Millisecond, conn: client}
+
+	start := time.Now()
+	if err := graphite.push(&metricBatch{at: start, requests: 1}); err == nil {
+		t.Fatal("got no error from a stalled collector")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the push took %s against a stalled collector", elapsed)
+	}
+	if graphite.conn != nil {
+		t.Error("kept the connection of the failed push")
+	}
+}
+
+func TestCloudwatchSink(t *testing.T) {
+	forms := make(chan url.Values, 1)
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		r.ParseForm()
+		forms <- r.PostForm
+	}))
+	defer server.Close()
+	defer setEnv(map[string]string{
+		"AWS_ACCESS_KEY_ID": "AKIDEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_REGION": "eu-west-1", "AWS_ENDPOINT_URL": server.URL,
+	})()
+
+	sink, err := openMetricSink("cloudwatch:Cannonade/Staging", "canary", SinkOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(10*time.Millisecond, true)
+	sink.Record(time.Second, false)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	form := <-forms
+	want := map[string]string{
+		"Action":                         "PutMetricData",
+		"Namespace":                      "Cannonade/Staging",
+		"MetricData.member.1.MetricName": "Requests",
+		"MetricData.member.1.Value":      "2",
+		"MetricData.member.1.Dimensions.member.1.Value":   "canary",
+		"MetricData.member.2.MetricName":                  "Errors",
+		"MetricData.member.2.Value":                       "1",
+		"MetricData.member.3.MetricName":                  "Latency",
+		"MetricData.member.3.Unit":                        "Milliseconds",
+		"MetricData.member.3.StatisticValues.SampleCount": "1",
+		"MetricData.member.3.StatisticValues.Sum":         "10.000",
+	}
+	for key, value := range want {
+		if got := form.Get(key); got != value {
+			t.Errorf("PutMetricData %s = %q, want %q", key, got, value)
+		}
+	}
+	if !strings.Contains(authorization, "/eu-west-1/monitoring/aws4_request") {
+		t.Errorf("Authorization = %q, want it signed for monitoring in eu-west-1", authorization)
+	}
+}
+
+func TestCloudwatchSinkFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "InvalidClientTokenId", http.StatusForbidden)
+	}))
+	defer server.Close()
+	defer setEnv(map[string]string{
+		"AWS_ACCESS_KEY_ID": "AKIDEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_ENDPOINT_URL": server.URL,
+	})()
+
+	sink, err := openMetricSink("cloudwatch:Cannonade", "", SinkOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(time.Millisecond, true)
+	if err := sink.Close(); err == nil || !strings.Contains(err.Error(), "InvalidClientTokenId") {
+		t.Errorf("Close() = %v, want the error of the push", err)
+	}
+}
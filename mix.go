@@ -0,0 +1,148 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// MixRequest : A named kind of request of the mix with its share of the
+// traffic, it sends the image payload at its own scale unless it has a body
+// or is a GET or a HEAD. The path, the header values and the body are templates
+type MixRequest struct {
+	Name   string            `json:"name"`
+	Weight float64           `json:"weight"`
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Header map[string]string `json:"header"`
+	Body   string            `json:"body"`
+	Scale  float64           `json:"scale"`
+	Batch  int               `json:"batch"`
+
+	template *requestTemplate
+}
+
+// payload tells whether the request sends the image
+func (r *MixRequest) payload() bool {
+	return r.Body == "" && r.Method != "GET" && r.Method != "HEAD"
+}
+
+// Mix : Kinds of requests shuffled together according to their weights
+type Mix struct {
+	Requests []*MixRequest `json:"requests"`
+
+	total float64
+}
+
+// loadMix reads a json file of the requests of the mix and checks them, the
+// columns of the data feed are the values their templates may refer to
+func loadMix(path string, columns []string) (*Mix, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mix Mix
+	if err := json.Unmarshal(data, &mix); err != nil {
+		return nil, err
+	}
+	if err := mix.compile(columns); err != nil {
+		return nil, err
+	}
+	return &mix, nil
+}
+
+// compile checks the weights and the templates of the requests
+func (m *Mix) compile(columns []string) error {
+	if len(m.Requests) == 0 {
+		return fmt.Errorf("mix has no requests")
+	}
+	known := make(map[string]bool)
+	for _, column := range columns {
+		known[column] = true
+	}
+	names := make(map[string]bool)
+	for i, request := range m.Requests {
+		if request.Name == "" {
+			return fmt.Errorf("request #%d has no name", i+1)
+		}
+		if names[request.Name] {
+			return fmt.Errorf("request %s is there twice", request.Name)
+		}
+		names[request.Name] = true
+		if request.Weight <= 0 {
+			return fmt.Errorf("%s: weight should be positive", request.Name)
+		}
+		if request.Scale < 0 || request.Batch < 0 {
+			return fmt.Errorf("%s: scale and batch should be positive", request.Name)
+		}
+		request.Method = strings.ToUpper(request.Method)
+		if request.Method == "" {
+			request.Method = "POST"
+		}
+		request.template = &requestTemplate{Path: request.Path, Body: request.Body, Header: make(http.Header)}
+		for key, value := range request.Header {
+			request.template.Header.Set(key, value)
+		}
+		if err := request.template.check(known); err != nil {
+			return fmt.Errorf("%s: %s", request.Name, err)
+		}
+		m.total += request.Weight
+	}
+	return nil
+}
+
+// pick draws a request by the weights
+func (m *Mix) pick(rnd *rand.Rand) *MixRequest {
+	x := rnd.Float64() * m.total
+	for _, request := range m.Requests {
+		if x < request.Weight {
+			return request
+		}
+		x -= request.Weight
+	}
+	return m.Requests[len(m.Requests)-1]
+}
+
+// shoot makes the request out of the payload shot for it, expanding its
+// templates with the row of the data feed
+func (r *MixRequest) shoot(shot *Cannonball, vars map[string]string, rnd *rand.Rand) *Cannonball {
+	ball := &Cannonball{Method: r.Method, Label: r.Name}
+	if shot != nil {
+		ball.Body, ball.Header, ball.RawSize = shot.Body, shot.Header, shot.RawSize
+	} else if r.Body != "" {
+		// The bodies go as the json of the payload would, unless the header says otherwise
+		ball.Header = http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+	}
+	return r.template.apply(ball, vars, rnd)
+}
+
+func (m *Mix) String() string {
+	parts := make([]string, len(m.Requests))
+	for i, request := range m.Requests {
+		parts[i] = fmt.Sprintf("%.0f%% %s", 100*request.Weight/m.total, request.Name)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestMixCompile(t *testing.T) {
+	tests := []struct {
+		mix   string
+		fails string
+	}{
+		{`{"requests": [{"name": "small", "weight": 70, "scale": 0.5}, {"name": "bad", "weight": 5, "body": "{{id}}"}]}`, ""},
+		{`{"requests": []}`, "no requests"},
+		{`{"requests": [{"weight": 1}]}`, "no name"},
+		{`{"requests": [{"name": "a", "weight": 1}, {"name": "a", "weight": 2}]}`, "twice"},
+		{`{"requests": [{"name": "a"}]}`, "weight"},
+		{`{"requests": [{"name": "a", "weight": 1, "scale": -1}]}`, "scale"},
+		{`{"requests": [{"name": "a", "weight": 1, "path": "/{{user}}"}]}`, "no value for {{user}}"},
+	}
+	for _, test := range tests {
+		var mix Mix
+		if err := json.Unmarshal([]byte(test.mix), &mix); err != nil {
+			t.Fatal(err)
+		}
+		err := mix.compile([]string{"id"})
+		if test.fails == "" && err != nil || test.fails != "" && (err == nil || !strings.Contains(err.Error(), test.fails)) {
+			t.Errorf("%s: got error %v, want %q", test.mix, err, test.fails)
+		}
+	}
+}
+
+func TestMixPick(t *testing.T) {
+	mix := &Mix{Requests: []*MixRequest{{Name: "small", Weight: 70}, {Name: "large", Weight: 25},
+		{Name: "malformed", Weight: 5}}}
+	if err := mix.compile(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := mix.String(); got != "70% small, 25% large, 5% malformed" {
+		t.Errorf("got %q", got)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[mix.pick(rnd).Name]++
+	}
+	for _, request := range mix.Requests {
+		if share := float64(counts[request.Name]) / 100; share < request.Weight-2 || share > request.Weight+2 {
+			t.Errorf("%s: got %.1f%% of the requests, want %g%%", request.Name, share, request.Weight)
+		}
+	}
+}
+
+func TestProduceMix(t *testing.T) {
+	mix := &Mix{Requests: []*MixRequest{
+		{Name: "small", Weight: 1, Scale: 0.25},
+		{Name: "large", Weight: 1, Batch: 2},
+		{Name: "malformed", Weight: 1, Body: `{"image": "{{id}}"}`, Header: map[string]string{"X-Case": "{{id}}"}},
+		{Name: "health", Weight: 1, Method: "GET", Path: "/health"},
+	}}
+	if err := mix.compile([]string{"id"}); err != nil {
+		t.Fatal(err)
+	}
+	feed := &dataFeed{columns: []string{"id"}, rows: []map[string]string{{"id": "x"}}}
+	task := &Task{Image: image.NewRGBA(image.Rect(0, 0, 64, 64)), Scale: 1, Batch: 1, NumRequests: 200,
+		Encoding: Encoding{Format: formatJPEG, Quality: defaultQuality}}
+	sizes := make(map[string]int)
+	for _, ball := range collectPayloads(task, &Options{Mix: mix, Data: feed}) {
+		sizes[ball.Label] = len(ball.Body)
+		switch ball.Label {
+		case "malformed":
+			if string(ball.Body) != `{"image": "x"}` || ball.Header.Get("X-Case") != "x" || ball.Method != "POST" {
+				t.Errorf("malformed: got %s %q with %v", ball.Method, ball.Body, ball.Header)
+			}
+		case "health":
+			if ball.Method != "GET" || ball.Path != "/health" || len(ball.Body) > 0 {
+				t.Errorf("health: got %s %s with %q", ball.Method, ball.Path, ball.Body)
+			}
+		case "large":
+			if !strings.Contains(string(ball.Body), `"images"`) {
+				t.Errorf("large: got no batch of images")
+			}
+		}
+	}
+	if len(sizes) != 4 {
+		t.Errorf("got the requests %v, want all four", sizes)
+	}
+	if sizes["small"] >= sizes["large"] {
+		t.Errorf("got a small payload of %d bytes, a large one of %d", sizes["small"], sizes["large"])
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMockListen = "127.0.0.1:5000"
+
+// mockTarget : A stand-in for a model service answering the image payloads,
+// after a random latency and with a share of them failing
+type mockTarget struct {
+	latency   time.Duration
+	jitter    time.Duration
+	errorRate float64
+	status    int
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// parseMockLatency reads a latency with an optional jitter around it, like
+// 50ms±20ms or 50ms+-20ms
+func parseMockLatency(spec string) (time.Duration, time.Duration, error) {
+	parts := strings.SplitN(strings.Replace(spec, "+-", "±", 1), "±", 2)
+	latency, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+	if err != nil || latency < 0 {
+		return 0, 0, fmt.Errorf("latency %q should be a duration like 50ms or 50ms±20ms", spec)
+	}
+	var jitter time.Duration
+	if len(parts) == 2 {
+		jitter, err = time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || jitter < 0 {
+			return 0, 0, fmt.Errorf("jitter of %q should be a duration", spec)
+		}
+	}
+	return latency, jitter, nil
+}
+
+// parseShare reads a share either as a percentage or as a fraction
+func parseShare(spec string) (float64, error) {
+	value := strings.TrimSpace(spec)
+	scale := 1.0
+	if strings.HasSuffix(value, "%") {
+		value, scale = strings.TrimSuffix(value, "%"), 100
+	}
+	share, err := strconv.ParseFloat(value, 64)
+	if err != nil || share < 0 || share/scale > 1 {
+		return 0, fmt.Errorf("share %q should be between 0 and 1, or 0%% and 100%%", spec)
+	}
+	return share / scale, nil
+}
+
+// draw picks the latency of a request and whether it fails
+func (m *mockTarget) draw() (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latency := m.latency
+	if m.jitter > 0 {
+		latency += time.Duration(m.rnd.Int63n(2*int64(m.jitter)+1)) - m.jitter
+	}
+	if latency < 0 {
+		latency = 0
+	}
+	return latency, m.rnd.Float64() < m.errorRate
+}
+
+// checkPayload counts the images of the body, which has to be the json of a
+// Request with every image in base64, an empty body carries none
+func checkPayload(body []byte) (int, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return 0, nil
+	}
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, err
+	}
+	images := req.Images
+	if req.Image != "" {
+		images = append(images, req.Image)
+	}
+	if len(images) == 0 {
+		return 0, fmt.Errorf("no image or images")
+	}
+	for i, encoded := range images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return 0, fmt.Errorf("image %d: %s", i+1, err)
+		}
+		if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return 0, fmt.Errorf("image %d: %s", i+1, err)
+		}
+	}
+	return len(images), nil
+}
+
+// handler answers GET /health right away and any other request as a model
+// would, a broken payload gets a 400
+func (m *mockTarget) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body bytes.Buffer
+		if _, err := body.ReadFrom(r.Body); err != nil {
+			return
+		}
+		images, err := checkPayload(body.Bytes())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			panicIf(json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}))
+			return
+		}
+
+		latency, failed := m.draw()
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+		if failed {
+			w.WriteHeader(m.status)
+			panicIf(json.NewEncoder(w).Encode(map[string]string{"error": "mock failure"}))
+			return
+		}
+		panicIf(json.NewEncoder(w).Encode(map[string]interface{}{"label": "mock", "score": 0.99, "images": images}))
+	})
+	return mux
+}
+
+func serveMockCommand(args []string) int {
+	fs := flag.NewFlagSet("serve-mock", flag.ExitOnError)
+	listen := fs.String("listen", defaultMockListen, "address to serve the mock target on")
+	latency := fs.String("latency", "0s", "latency of every response with an optional jitter around it (50ms±20ms)")
+	errorRate := fs.String("error-rate", "0", "share of the requests failing with the error status (2%)")
+	status := fs.Int("error-status", http.StatusInternalServerError, "status of the failed requests")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade serve-mock [options...]\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+
+	mock := &mockTarget{status: *status, rnd: newRandomness(time.Now().UnixNano()).stream(streamMock)}
+	var err error
+	mock.latency, mock.jitter, err = parseMockLatency(*latency)
+	if err != nil {
+		fmt.Printf("Failed parsing the latency: %s\n", err)
+		return 1
+	}
+	mock.errorRate, err = parseShare(*errorRate)
+	if err != nil {
+		fmt.Printf("Failed parsing the error rate: %s\n", err)
+		return 1
+	}
+	if *status < 100 || *status > 599 {
+		fmt.Printf("Invalid error status %d\n", *status)
+		return 1
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Printf("Failed starting the mock target: %s\n", err)
+		return 1
+	}
+	defer listener.Close()
+	fmt.Fprintf(os.Stderr, "Mock target is listening on http://%s\n", listener.Addr())
+	if err := http.Serve(listener, mock.handler()); err != nil {
+		fmt.Printf("Failed serving the mock target: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMockLatency(t *testing.T) {
+	tests := []struct {
+		spec            string
+		latency, jitter time.Duration
+		ok              bool
+	}{
+		{"50ms", 50 * time.Millisecond, 0, true},
+		{"50ms±20ms", 50 * time.Millisecond, 20 * time.Millisecond, true},
+		{"1s +- 100ms", time.Second, 100 * time.Millisecond, true},
+		{"0s", 0, 0, true},
+		{"fast", 0, 0, false},
+		{"-5ms", 0, 0, false},
+		{"50ms±often", 0, 0, false},
+	}
+	for _, test := range tests {
+		latency, jitter, err := parseMockLatency(test.spec)
+		if (err == nil) != test.ok || latency != test.latency || jitter != test.jitter {
+			t.Errorf("%q: got %v±%v, %v", test.spec, latency, jitter, err)
+		}
+	}
+}
+
+func TestParseShare(t *testing.T) {
+	tests := []struct {
+		spec  string
+		share float64
+		ok    bool
+	}{
+		{"2%", 0.02, true},
+		{"0.5", 0.5, true},
+		{"100%", 1, true},
+		{"0", 0, true},
+		{"150%", 0, false},
+		{"2", 0, false},
+		{"-1%", 0, false},
+		{"some", 0, false},
+	}
+	for _, test := range tests {
+		if share, err := parseShare(test.spec); (err == nil) != test.ok || share != test.share {
+			t.Errorf("%q: got %v, %v", test.spec, share, err)
+		}
+	}
+}
+
+func TestMockHandler(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	payload := makeCannonball(img, nil, 2, Encoding{Format: formatPNG}).Body
+	tests := []struct {
+		errorRate float64
+		method    string
+		path      string
+		body      string
+		status    int
+		want      string
+	}{
+		{0, "POST", "/predict", string(payload), http.StatusOK, `"images":2`},
+		{0, "GET", "/predict", "", http.StatusOK, `"images":0`},
+		{0, "POST", "/predict", `{"image": "bm90IGFuIGltYWdl"}`, http.StatusBadRequest, "image 1"},
+		{0, "POST", "/predict", `{"image": "%%%"}`, http.StatusBadRequest, "image 1"},
+		{0, "POST", "/predict", `{"text": "hi"}`, http.StatusBadRequest, "no image"},
+		{0, "POST", "/predict", `{"image": `, http.StatusBadRequest, "error"},
+		{1, "POST", "/predict", string(payload), http.StatusServiceUnavailable, "mock failure"},
+		{1, "GET", "/health", "", http.StatusOK, "ok"},
+	}
+	for _, test := range tests {
+		mock := &mockTarget{errorRate: test.errorRate, status: http.StatusServiceUnavailable, rnd: rand.New(rand.NewSource(1))}
+		w := httptest.NewRecorder()
+		mock.handler().ServeHTTP(w, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s %s %.20q: got %d %q, want %d with %q", test.method, test.path, test.body,
+				w.Code, w.Body.String(), test.status, test.want)
+		}
+	}
+}
+
+func TestMockLatency(t *testing.T) {
+	mock := &mockTarget{latency: 20 * time.Millisecond, jitter: 10 * time.Millisecond, rnd: rand.New(rand.NewSource(1))}
+	for i := 0; i < 100; i++ {
+		latency, failed := mock.draw()
+		if latency < 10*time.Millisecond || latency > 30*time.Millisecond || failed {
+			t.Fatalf("got %v, failed %v", latency, failed)
+		}
+	}
+}
+
+// TestAttackMock runs whole schedules against the mock target end to end
+func TestAttackMock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		errorRate float64
+		args      []string
+		requests  []int
+		failure   string
+	}{
+		{0, []string{"-num-requests", "30", "-num-clients", "3"}, []int{30}, ""},
+		{0, []string{"-schedule", "10@1,20@2", "-noisy"}, []int{10, 20}, ""},
+		{1, []string{"-num-requests", "10", "-num-clients", "2"}, []int{10}, "http 502"},
+	}
+	for i, test := range tests {
+		mock := &mockTarget{latency: time.Millisecond, errorRate: test.errorRate, status: http.StatusBadGateway,
+			rnd: rand.New(rand.NewSource(1))}
+		server := httptest.NewServer(mock.handler())
+		path := filepath.Join(dir, "report.json")
+		fs, flags := newAttackFlagSet("attack")
+		args := append([]string{"-synthetic", "32x32", "-silent", "-format", "json", "-report", path}, test.args...)
+		if err := fs.Parse(append(args, server.URL+"/predict")); err != nil {
+			t.Fatal(err)
+		}
+		flags.attack(fs.Args(), nil)
+		server.Close()
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report Report
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(&report); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if len(report.Tasks) != len(test.requests) {
+			t.Fatalf("#%d: got %d tasks, want %d", i, len(report.Tasks), len(test.requests))
+		}
+		for j, task := range report.Tasks {
+			fails := 0
+			if test.failure != "" {
+				fails = test.requests[j]
+			}
+			if task.NumRequests != test.requests[j] || task.NumFails != fails {
+				t.Errorf("#%d: task %d got %d requests with %d fails, want %d with %d", i, j+1,
+					task.NumRequests, task.NumFails, test.requests[j], fails)
+			}
+			if test.failure != "" && (len(task.Failures) != 1 || task.Failures[0].Class != test.failure) {
+				t.Errorf("#%d: task %d got the failures %+v, want %s", i, j+1, task.Failures, test.failure)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultParallelInterval is the period of the interleaved live view of the
+// parallel tasks which do not set one of their own
+const defaultParallelInterval = 5 * time.Second
+
+// ParallelTask : One of the runs of a parallel file, the options and the
+// endpoint of the attack command line it stands for
+type ParallelTask struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// ParallelConfig : The runs started at once against the endpoints sharing a backend
+type ParallelConfig struct {
+	Tasks []ParallelTask `json:"tasks"`
+}
+
+func loadParallel(path string) (*ParallelConfig, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	var config ParallelConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Tasks) == 0 {
+		return nil, fmt.Errorf("no tasks in %s", path)
+	}
+	names := make(map[string]bool)
+	for i := range config.Tasks {
+		task := &config.Tasks[i]
+		if task.Name == "" {
+			task.Name = fmt.Sprintf("task-%d", i+1)
+		}
+		if names[task.Name] {
+			return nil, fmt.Errorf("task %s comes twice", task.Name)
+		}
+		names[task.Name] = true
+		if len(task.Args) == 0 {
+			return nil, fmt.Errorf("task %s has no args", task.Name)
+		}
+	}
+	return &config, nil
+}
+
+// parallelFlags parses the command line of the task, the options given to the
+// parallel command apply to it unless it sets them itself
+func parallelFlags(task ParallelTask, common *flag.FlagSet) (*attackFlags, error) {
+	fs, flags := newAttackFlagSet("attack")
+	fs.Init("attack", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(task.Args); err != nil {
+		return nil, err
+	}
+	var err error
+	common.Visit(func(fl *flag.Flag) {
+		if err != nil || flags.isSet(fl.Name) {
+			return
+		}
+		if repeated, ok := fl.Value.(interface{ lines() []string }); ok {
+			for _, line := range repeated.lines() {
+				if err = fs.Set(fl.Name, line); err != nil {
+					return
+				}
+			}
+			return
+		}
+		err = fs.Set(fl.Name, fl.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !flags.isSet("interval") {
+		panicIf(fs.Set("interval", defaultParallelInterval.String()))
+	}
+	flags.name = task.Name
+	return flags, nil
+}
+
+func parallelCommand(args []string) int {
+	fs, _ := newAttackFlagSet("parallel")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade parallel [options...] <tasks.json>\n\n"+
+			"The options apply to every task which does not set them itself.\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() == 0 {
+		fmt.Println("Provide a file of the tasks to run in parallel!")
+		return 1
+	}
+	config, err := loadParallel(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed loading the tasks: %s\n", err)
+		return 1
+	}
+
+	runs := make([]*attackFlags, len(config.Tasks))
+	reports := make([]bytes.Buffer, len(config.Tasks))
+	planning := false
+	for i, task := range config.Tasks {
+		flags, err := parallelFlags(task, fs)
+		if err != nil {
+			fmt.Printf("Failed parsing the options of %s: %s\n", task.Name, err)
+			return 1
+		}
+		if *flags.progress || *flags.interactive {
+			fmt.Println("Cannot show the progress bars or read control commands of parallel tasks")
+			return 1
+		}
+		flags.output = &reports[i]
+		runs[i] = flags
+		planning = planning || *flags.explain || *flags.dryRun
+	}
+
+	// The plans come one after another, the attacks all start at once and
+	// interleave their live views, tagged with the names of the tasks
+	codes := make([]int, len(runs))
+	if planning {
+		for i, flags := range runs {
+			fmt.Printf("%s:\n", flags.name)
+			codes[i] = flags.attack(flags.fs.Args(), nil)
+			fmt.Println()
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i, flags := range runs {
+			wg.Add(1)
+			go func(i int, flags *attackFlags) {
+				defer wg.Done()
+				codes[i] = flags.attack(flags.fs.Args(), nil)
+			}(i, flags)
+		}
+		wg.Wait()
+	}
+
+	code := 0
+	for i, flags := range runs {
+		if reports[i].Len() > 0 {
+			if *flags.format != "json" {
+				fmt.Printf("\n=== %s ===\n", flags.name)
+			}
+			_, err := reports[i].WriteTo(os.Stdout)
+			panicIf(err)
+		} else if codes[i] != 0 && !planning {
+			fmt.Printf("\n=== %s ===\nFailed before the first request, see the errors above\n", flags.name)
+		}
+		if codes[i] != 0 {
+			code = codes[i]
+		}
+	}
+	return code
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		config string
+		names  []string
+		err    string
+	}{
+		{config: `{"tasks": [{"name": "predict", "args": ["http://a/predict"]}, {"args": ["http://a/health"]}]}`,
+			names: []string{"predict", "task-2"}},
+		{config: `{"tasks": []}`, err: "no tasks"},
+		{config: `{"tasks": [{"name": "a", "args": ["http://a"]}, {"name": "a", "args": ["http://b"]}]}`, err: "task a comes twice"},
+		{config: `{"tasks": [{"name": "a"}]}`, err: "task a has no args"},
+		{config: `{"tasks": "all"}`, err: "cannot unmarshal"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "tasks.json")
+		if err := ioutil.WriteFile(path, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := loadParallel(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got %v, want %q", test.config, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.config, err)
+		}
+		var names []string
+		for _, task := range config.Tasks {
+			names = append(names, task.Name)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: got %v, want %v", test.config, names, test.names)
+		}
+	}
+}
+
+func TestParallelFlags(t *testing.T) {
+	common, _ := newAttackFlagSet("parallel")
+	if err := common.Parse([]string{"-num-clients", "16", "-header", "X-Run: 7", "-header", "X-Env: ci", "-interval", "2s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, err := parallelFlags(ParallelTask{Name: "health", Args: []string{"-num-clients", "2", "http://a/health"}}, common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *flags.numClients != 2 || *flags.interval != 2*time.Second || flags.name != "health" {
+		t.Errorf("got %d clients every %v, want the own 2 clients every 2s of the command", *flags.numClients, *flags.interval)
+	}
+	if got := flags.header.lines(); !reflect.DeepEqual(got, []string{"X-Env: ci", "X-Run: 7"}) {
+		t.Errorf("got the headers %v", got)
+	}
+	if !reflect.DeepEqual(flags.fs.Args(), []string{"http://a/health"}) {
+		t.Errorf("got the args %v", flags.fs.Args())
+	}
+
+	// The live view is on even when neither sets an interval
+	bare, _ := newAttackFlagSet("parallel")
+	flags, err = parallelFlags(ParallelTask{Name: "predict", Args: []string{"http://a/predict"}}, bare)
+	if err != nil || *flags.interval != defaultParallelInterval || *flags.numClients != defaultNumClients {
+		t.Errorf("got %v every %v with %d clients", err, *flags.interval, *flags.numClients)
+	}
+
+	if _, err := parallelFlags(ParallelTask{Name: "broken", Args: []string{"-num-clients", "many"}}, bare); err == nil {
+		t.Error("got no error for a broken option")
+	}
+}
+
+func TestParallelCommand(t *testing.T) {
+	// Both tasks hit the same backend at the same time
+	var inFlight, overlapped int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&inFlight, 1) > 1 {
+			atomic.StoreInt64(&overlapped, 1)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt64(&inFlight, -1)
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tasks := ParallelConfig{Tasks: []ParallelTask{
+		{Name: "predict", Args: []string{"-synthetic", "32x32", "-num-requests", "40", "-num-clients", "1",
+			"-report", filepath.Join(dir, "predict.json"), server.URL + "/predict"}},
+		{Name: "health", Args: []string{"-curl", "curl " + server.URL + "/health", "-num-requests", "30", "-num-clients", "1",
+			"-report", filepath.Join(dir, "health.json")}},
+	}}
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tasks.json")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := parallelCommand([]string{"-silent", "-format", "json", path}); code != 0 {
+		t.Fatalf("got the exit code %d", code)
+	}
+	if atomic.LoadInt64(&overlapped) == 0 {
+		t.Error("the tasks never ran at the same time")
+	}
+	for name, want := range map[string]int{"predict": 40, "health": 30} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(report.Tasks) != 1 || report.Tasks[0].NumRequests != want || report.Tasks[0].NumFails != 0 {
+			t.Errorf("%s: got %+v, want %d requests", name, report.Tasks, want)
+		}
+	}
+}
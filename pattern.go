@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// patternStep is how often the rate follows the pattern
+const patternStep = 100 * time.Millisecond
+
+// pattern : A request rate changing over time along a built-in shape,
+// repeating every period
+type pattern struct {
+	kind   string
+	low    float64
+	high   float64
+	by     float64
+	every  time.Duration
+	length time.Duration
+}
+
+// The parameters of every shape, the first two are the rates it moves between
+var patternParams = map[string][]string{
+	"spike":    {"base", "peak", "every", "for"},
+	"sawtooth": {"min", "max", "every"},
+	"sine":     {"min", "max", "every"},
+	"step":     {"from", "to", "by", "every"},
+}
+
+// parsePattern reads a shape:name=value,... spec, the rates are given in
+// requests per second with an optional rps suffix
+func parsePattern(spec string) (*pattern, error) {
+	pair := strings.SplitN(spec, ":", 2)
+	params, ok := patternParams[pair[0]]
+	if !ok {
+		kinds := make([]string, 0, len(patternParams))
+		for kind := range patternParams {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("unknown pattern %q (%s)", pair[0], strings.Join(kinds, ", "))
+	}
+	values := make(map[string]string)
+	if len(pair) == 2 {
+		for _, field := range strings.Split(pair[1], ",") {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("parameter %q should be name=value", field)
+			}
+			values[kv[0]] = kv[1]
+		}
+	}
+	for name := range values {
+		known := false
+		for _, param := range params {
+			known = known || name == param
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown parameter %q of %s (%s)", name, pair[0], strings.Join(params, ", "))
+		}
+	}
+	for _, param := range params {
+		if values[param] == "" {
+			return nil, fmt.Errorf("%s needs %s", pair[0], strings.Join(params, ", "))
+		}
+	}
+
+	p := &pattern{kind: pair[0]}
+	var err error
+	rate := func(name string) float64 {
+		value, e := strconv.ParseFloat(strings.TrimSuffix(values[name], "rps"), 64)
+		if e == nil && value <= 0 {
+			e = fmt.Errorf("should be positive")
+		}
+		if e != nil && err == nil {
+			err = fmt.Errorf("invalid rate %s=%s: %s", name, values[name], e)
+		}
+		return value
+	}
+	duration := func(name string) time.Duration {
+		value, e := time.ParseDuration(values[name])
+		if e == nil && value <= 0 {
+			e = fmt.Errorf("should be positive")
+		}
+		if e != nil && err == nil {
+			err = fmt.Errorf("invalid duration %s=%s: %s", name, values[name], e)
+		}
+		return value
+	}
+	p.low, p.high = rate(params[0]), rate(params[1])
+	p.every = duration("every")
+	switch p.kind {
+	case "spike":
+		p.length = duration("for")
+		if err == nil && p.length >= p.every {
+			err = fmt.Errorf("spike for %v should be shorter than every %v", p.length, p.every)
+		}
+	case "step":
+		p.by = rate("by")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// rate is the requests per second the pattern holds at the moment of the run
+func (p *pattern) rate(elapsed time.Duration) float64 {
+	phase := float64(elapsed%p.every) / float64(p.every)
+	switch p.kind {
+	case "spike":
+		// The spike closes every period, so that the run starts steady
+		if elapsed%p.every >= p.every-p.length {
+			return p.high
+		}
+		return p.low
+	case "sawtooth":
+		return p.low + (p.high-p.low)*phase
+	case "sine":
+		return p.low + (p.high-p.low)*(1-math.Cos(2*math.Pi*phase))/2
+	default:
+		// Steps go from one rate towards the other and stay there
+		steps := float64(elapsed / p.every)
+		if p.high < p.low {
+			return math.Max(p.high, p.low-steps*p.by)
+		}
+		return math.Min(p.high, p.low+steps*p.by)
+	}
+}
+
+// drive keeps the limiter at the rate of the pattern until done is closed
+func (p *pattern) drive(limiter *Limiter, start time.Time, done <-chan struct{}) {
+	ticker := time.NewTicker(patternStep)
+	defer ticker.Stop()
+	current := limiter.Rate()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			// Resetting the limiter drops its pace, so it is only set on a change
+			if rate := p.rate(now.Sub(start)); rate != current {
+				limiter.SetRate(rate)
+				current = rate
+			}
+		}
+	}
+}
+
+func (p *pattern) String() string {
+	switch p.kind {
+	case "spike":
+		return fmt.Sprintf("spike from %g to %g req/s for %v every %v", p.low, p.high, p.length, p.every)
+	case "step":
+		return fmt.Sprintf("step from %g to %g req/s by %g every %v", p.low, p.high, p.by, p.every)
+	default:
+		return fmt.Sprintf("%s between %g and %g req/s every %v", p.kind, p.low, p.high, p.every)
+	}
+}
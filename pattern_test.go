@@ -0,0 +1,108 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  string
+		fails bool
+	}{
+		{"spike:base=10rps,peak=500rps,every=60s,for=5s", "spike from 10 to 500 req/s for 5s every 1m0s", false},
+		{"sawtooth:min=10,max=100,every=30s", "sawtooth between 10 and 100 req/s every 30s", false},
+		{"sine:max=100,min=10,every=1m", "sine between 10 and 100 req/s every 1m0s", false},
+		{"step:from=10,to=100,by=20,every=10s", "step from 10 to 100 req/s by 20 every 10s", false},
+		{"wave:min=1", "", true},
+		{"sine:min=10,max=100", "", true},
+		{"sine:min=10,max=100,every=1m,for=5s", "", true},
+		{"sine:min=10,max=100,every", "", true},
+		{"spike:base=10,peak=0,every=60s,for=5s", "", true},
+		{"spike:base=10,peak=50,every=5s,for=5s", "", true},
+		{"step:from=10,to=100,by=10,every=soon", "", true},
+	}
+	for _, test := range tests {
+		p, err := parsePattern(test.spec)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got no error", test.spec)
+			}
+			continue
+		}
+		if err != nil || p.String() != test.want {
+			t.Errorf("%s: got %v (%v)", test.spec, p, err)
+		}
+	}
+}
+
+func TestPatternRate(t *testing.T) {
+	tests := []struct {
+		spec    string
+		elapsed time.Duration
+		want    float64
+	}{
+		{"spike:base=10,peak=500,every=60s,for=5s", 0, 10},
+		{"spike:base=10,peak=500,every=60s,for=5s", 54 * time.Second, 10},
+		{"spike:base=10,peak=500,every=60s,for=5s", 57 * time.Second, 500},
+		{"spike:base=10,peak=500,every=60s,for=5s", 61 * time.Second, 10},
+		{"sawtooth:min=10,max=110,every=10s", 5 * time.Second, 60},
+		{"sawtooth:min=10,max=110,every=10s", 10 * time.Second, 10},
+		{"sine:min=10,max=110,every=10s", 0, 10},
+		{"sine:min=10,max=110,every=10s", 5 * time.Second, 110},
+		{"sine:min=10,max=110,every=10s", 2500 * time.Millisecond, 60},
+		{"step:from=10,to=50,by=15,every=10s", 9 * time.Second, 10},
+		{"step:from=10,to=50,by=15,every=10s", 20 * time.Second, 40},
+		{"step:from=10,to=50,by=15,every=10s", time.Minute, 50},
+		{"step:from=50,to=10,by=15,every=10s", 10 * time.Second, 35},
+		{"step:from=50,to=10,by=15,every=10s", time.Minute, 10},
+	}
+	for _, test := range tests {
+		p, err := parsePattern(test.spec)
+		if err != nil {
+			t.Fatalf("%s: %s", test.spec, err)
+		}
+		if got := p.rate(test.elapsed); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s at %v: got %g, want %g", test.spec, test.elapsed, got, test.want)
+		}
+	}
+}
+
+func TestPatternDrive(t *testing.T) {
+	p, _ := parsePattern("spike:base=10,peak=500,every=400ms,for=200ms")
+	limiter := newLimiter(p.rate(0))
+	done := make(chan struct{})
+	go p.drive(limiter, time.Now(), done)
+	defer close(done)
+
+	time.Sleep(300 * time.Millisecond)
+	if rate := limiter.Rate(); rate != 500 {
+		t.Errorf("got rate %g in the spike, want 500", rate)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if rate := limiter.Rate(); rate != 10 {
+		t.Errorf("got rate %g after the spike, want 10", rate)
+	}
+}
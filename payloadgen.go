@@ -0,0 +1,188 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+	"time"
+)
+
+// generatorExitWait is how long a generator command gets to exit once its input is closed
+const generatorExitWait = 2 * time.Second
+
+// payloadGenerator : An outside source of the requests for the payloads
+// cannonade cannot make on its own, it is called from a single goroutine
+type payloadGenerator interface {
+	Generate() (*Cannonball, error)
+	Close() error
+	String() string
+}
+
+// generatedRequest : A request as a generator command writes it, the body is
+// either text or base64 for the binary payloads
+type generatedRequest struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	BodyBase64 []byte      `json:"body_base64"`
+}
+
+func (r *generatedRequest) cannonball() *Cannonball {
+	ball := &Cannonball{Method: r.Method, Path: r.Path, Header: r.Header, Body: []byte(r.Body)}
+	if r.BodyBase64 != nil {
+		ball.Body = r.BodyBase64
+	}
+	if ball.Method == "" {
+		ball.Method = http.MethodPost
+	}
+	return ball
+}
+
+// pluginGenerator : A Go plugin exporting func Generate(seq int) (*http.Request, error)
+// with seq counting the requests of the run from 1, only the method, the path,
+// the headers and the body of the request are used
+type pluginGenerator struct {
+	path     string
+	generate func(int) (*http.Request, error)
+	seq      int
+}
+
+func openPluginGenerator(path string) (*pluginGenerator, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup("Generate")
+	if err != nil {
+		return nil, err
+	}
+	generate, ok := symbol.(func(int) (*http.Request, error))
+	if !ok {
+		return nil, fmt.Errorf("%s exports Generate as %T, want func(int) (*http.Request, error)", path, symbol)
+	}
+	return &pluginGenerator{path: path, generate: generate}, nil
+}
+
+func (g *pluginGenerator) Generate() (*Cannonball, error) {
+	g.seq++
+	req, err := g.generate(g.seq)
+	if err != nil {
+		return nil, err
+	}
+	ball := &Cannonball{Method: req.Method, Header: req.Header}
+	if ball.Method == "" {
+		ball.Method = http.MethodPost
+	}
+	if req.URL != nil && req.URL.Path != "" {
+		ball.Path = req.URL.RequestURI()
+	}
+	if req.Body != nil {
+		defer req.Body.Close()
+		if ball.Body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	return ball, nil
+}
+
+func (g *pluginGenerator) Close() error {
+	return nil
+}
+
+func (g *pluginGenerator) String() string {
+	return g.path
+}
+
+// commandGenerator : A subprocess reading {"seq": N} lines on its stdin and
+// answering each of them with a line of a request as json on its stdout
+type commandGenerator struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	seq     int
+}
+
+func startCommandGenerator(command string) (*commandGenerator, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty generator command")
+	}
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandGenerator{command: command, cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+func (g *commandGenerator) Generate() (*Cannonball, error) {
+	g.seq++
+	if _, err := fmt.Fprintf(g.stdin, "{\"seq\": %d}\n", g.seq); err != nil {
+		return nil, fmt.Errorf("generator is gone: %s", err)
+	}
+	line, err := g.stdout.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, fmt.Errorf("generator is gone: %s", err)
+	}
+	var request generatedRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return nil, fmt.Errorf("bad request from the generator: %s", err)
+	}
+	return request.cannonball(), nil
+}
+
+// Close ends the input of the command and kills it unless it exits soon after
+func (g *commandGenerator) Close() error {
+	g.stdin.Close()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- g.cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(generatorExitWait):
+		return g.cmd.Process.Kill()
+	}
+}
+
+func (g *commandGenerator) String() string {
+	return g.command
+}
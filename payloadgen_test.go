@@ -0,0 +1,113 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestGeneratorCommand is not a test, it plays the generator command of TestCommandGenerator
+func TestGeneratorCommand(t *testing.T) {
+	if os.Getenv("CANNONADE_TEST_GENERATOR") != "1" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var next struct{ Seq int }
+		if json.Unmarshal(scanner.Bytes(), &next) != nil || next.Seq > 2 {
+			break
+		}
+		if next.Seq == 1 {
+			fmt.Printf("{\"path\": \"/items/1\", \"header\": {\"X-Seq\": [\"1\"]}, \"body\": \"{\\\"id\\\": 1}\"}\n")
+		} else {
+			fmt.Printf("{\"method\": \"PUT\", \"body_base64\": \"/9g=\"}\n")
+		}
+	}
+	os.Exit(0)
+}
+
+func TestCommandGenerator(t *testing.T) {
+	os.Setenv("CANNONADE_TEST_GENERATOR", "1")
+	generator, err := startCommandGenerator(os.Args[0] + " -test.run=TestGeneratorCommand")
+	os.Unsetenv("CANNONADE_TEST_GENERATOR")
+	if err != nil {
+		t.Fatalf("startCommandGenerator() failed: %s", err)
+	}
+	defer generator.Close()
+
+	want := []*Cannonball{
+		{Method: "POST", Path: "/items/1", Header: map[string][]string{"X-Seq": {"1"}}, Body: []byte(`{"id": 1}`)},
+		{Method: "PUT", Body: []byte{0xff, 0xd8}},
+	}
+	for i, ball := range want {
+		got, err := generator.Generate()
+		if err != nil || !reflect.DeepEqual(got, ball) {
+			t.Errorf("request %d = %+v (%v), want %+v", i+1, got, err, ball)
+		}
+	}
+	// The command gives up on the third request
+	if ball, err := generator.Generate(); err == nil {
+		t.Errorf("request 3 = %+v, want an error", ball)
+	}
+
+	if _, err := startCommandGenerator(" "); err == nil {
+		t.Errorf("startCommandGenerator() of an empty command passed")
+	}
+}
+
+// failingGenerator : Produces the given number of requests and fails the rest
+type failingGenerator struct {
+	left int
+}
+
+func (g *failingGenerator) Generate() (*Cannonball, error) {
+	if g.left == 0 {
+		return nil, errors.New("out of payloads")
+	}
+	g.left--
+	return &Cannonball{Method: "POST", Body: []byte("{}")}, nil
+}
+
+func (g *failingGenerator) Close() error   { return nil }
+func (g *failingGenerator) String() string { return "failing" }
+
+func TestProduceGenerated(t *testing.T) {
+	task := &Task{Generator: &failingGenerator{left: 2}, NumRequests: 3}
+	quit := make(chan struct{})
+	defer close(quit)
+
+	var balls []*Cannonball
+	for ball := range producePayloads(task, &Options{}, 1, quit) {
+		balls = append(balls, ball)
+	}
+	if len(balls) != 3 {
+		t.Fatalf("produced %d payloads, want 3", len(balls))
+	}
+	if balls[0].err != nil || string(balls[1].Body) != "{}" || balls[2].err == nil {
+		t.Errorf("produced %+v, want two requests and a failure", balls)
+	}
+}
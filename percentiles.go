@@ -0,0 +1,89 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// defaultPercentiles are the percentiles shown in every summary unless asked otherwise
+const defaultPercentiles = "50,80,90,95,99,100"
+
+// percentileSet : The percentiles to summarize the latencies with and the requests they cover
+type percentileSet struct {
+	thresholds []float64
+	failures   bool
+	exact      bool
+}
+
+// parsePercentiles reads a comma-separated list of percentiles, sorted and without repeats
+func parsePercentiles(value string, failures bool) (percentileSet, error) {
+	set := percentileSet{failures: failures}
+	seen := make(map[float64]bool)
+	for _, field := range strings.Split(value, ",") {
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || threshold < 0 || threshold > 100 {
+			return set, fmt.Errorf("invalid percentile %q, expected a number from 0 to 100", field)
+		}
+		if !seen[threshold] {
+			seen[threshold] = true
+			set.thresholds = append(set.thresholds, threshold)
+		}
+	}
+	sort.Float64s(set.thresholds)
+	return set, nil
+}
+
+// has tells whether the threshold is among the percentiles
+func (s percentileSet) has(threshold float64) bool {
+	for _, t := range s.thresholds {
+		if t == threshold {
+			return true
+		}
+	}
+	return false
+}
+
+func (s percentileSet) stats(latencies *latency.Accumulator) latency.Stats {
+	if s.failures {
+		return latencies.StatsWithFailures(s.thresholds...)
+	}
+	return latencies.Stats(s.thresholds...)
+}
+
+// formatThreshold prints the percentile without the trailing zeros, e.g. 99.9
+func formatThreshold(threshold float64) string {
+	return strconv.FormatFloat(threshold, 'f', -1, 64)
+}
+
+// newAccumulator keeps every latency for exact percentiles, or only the first
+// million before folding them into histograms
+func newAccumulator(exact bool) *latency.Accumulator {
+	if exact {
+		return latency.NewLimited(0)
+	}
+	return latency.New()
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+func TestParsePercentiles(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []float64
+		err   bool
+	}{
+		{defaultPercentiles, []float64{50, 80, 90, 95, 99, 100}, false},
+		{"99.99, 50,99.9,99,90", []float64{50, 90, 99, 99.9, 99.99}, false},
+		{"95,95", []float64{95}, false},
+		{"0", []float64{0}, false},
+		{"101", nil, true},
+		{"-1", nil, true},
+		{"p99", nil, true},
+		{"50,", nil, true},
+	}
+	for _, test := range tests {
+		set, err := parsePercentiles(test.value, false)
+		if (err != nil) != test.err {
+			t.Errorf("parsePercentiles(%q) error = %v", test.value, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(set.thresholds, test.want) {
+			t.Errorf("parsePercentiles(%q) = %v, want %v", test.value, set.thresholds, test.want)
+		}
+	}
+}
+
+func TestPercentileSetFailures(t *testing.T) {
+	acc := latency.New()
+	for _, millis := range []float64{10, 20, 30} {
+		acc.Add(millis, true)
+	}
+	acc.Add(1000, false)
+
+	successes := summarize(acc, 1, percentileSet{thresholds: []float64{100}})
+	everything := summarize(acc, 1, percentileSet{thresholds: []float64{100}, failures: true})
+	if successes.Max != 30 || successes.Percentiles[0].Value != 30 {
+		t.Errorf("got max %g and p100 %g without the failures", successes.Max, successes.Percentiles[0].Value)
+	}
+	if everything.Max != 1000 || everything.Percentiles[0].Value != 1000 || everything.NumFails != 1 {
+		t.Errorf("got max %g, p100 %g and %d fails with the failures",
+			everything.Max, everything.Percentiles[0].Value, everything.NumFails)
+	}
+	if got := formatThreshold(99.9); got != "99.9" {
+		t.Errorf("formatThreshold(99.9) = %q", got)
+	}
+}
+
+func TestExactPercentiles(t *testing.T) {
+	// Two runs side by side keep to their own setting
+	exact := newCollector(false, false, false, percentileSet{thresholds: []float64{50}, exact: true})
+	estimated := newCollector(false, false, false, percentileSet{thresholds: []float64{50}})
+	for i := 0; i <= latency.DefaultMaxSamples; i++ {
+		exact.latencies.Add(1, true)
+		estimated.latencies.Add(1, true)
+	}
+	if exact.latencies.Folded() || !estimated.latencies.Folded() {
+		t.Errorf("got folded %v and %v, want only the run without exact percentiles folded",
+			exact.latencies.Folded(), estimated.latencies.Folded())
+	}
+}
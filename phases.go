@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+func phaseName(summary *Summary) string {
+	return fmt.Sprintf("%d@%d", summary.NumRequests, summary.NumClients)
+}
+
+// combinePhases sums the phases of a schedule up as if they were a single task,
+// the latencies are those of all their requests
+func combinePhases(latencies *latency.Accumulator, tasks []Summary, set percentileSet) *Summary {
+	seconds := 0.0
+	for i := range tasks {
+		seconds += tasks[i].Seconds
+	}
+	overall := summarize(latencies, seconds, set)
+	for i := range tasks {
+		task := &tasks[i]
+		if task.NumClients > overall.NumClients {
+			overall.NumClients = task.NumClients
+		}
+		overall.BytesSent += task.BytesSent
+		overall.BytesReceived += task.BytesReceived
+		overall.NumOversized += task.NumOversized
+	}
+	if overall.NumRequests > 0 {
+		overall.AvgResponseBytes = float64(overall.BytesReceived) / float64(overall.NumRequests)
+	}
+	if seconds > 0 {
+		overall.Throughput = float64(overall.BytesReceived) / seconds / megabyte
+	}
+	return &overall
+}
+
+// printPhases compares the tasks of a schedule side by side, followed by
+// all of them combined
+func printPhases(w io.Writer, tasks []Summary, overall *Summary) {
+	width := len("Overall")
+	for i := range tasks {
+		if name := phaseName(&tasks[i]); len(name) > width {
+			width = len(name)
+		}
+	}
+
+	row := func(index string, name string, task *Summary) {
+		fmt.Fprintf(w, " %5s %-*s%9.2f%9.2f%8.0f%8.0f%8.0f%8.0f%10d%7.1f%%", index, width, name,
+			task.RPS, task.SuccessRPS, task.Avg, summaryPercentile(task, 50), summaryPercentile(task, 95),
+			summaryPercentile(task, 99), task.NumFails, 100*errorRate(task))
+		if task.Payload != "" {
+			fmt.Fprintf(w, "  %s", task.Payload)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprintf(w, "     # %-*s    req/s     ok/s     Avg     50%%     95%%     99%%   # fails  errors  Payload\n",
+		width, "Phase")
+	rule := strings.Repeat("-", width+84)
+	fmt.Fprintln(w, rule)
+	for i := range tasks {
+		row(strconv.Itoa(i+1), phaseName(&tasks[i]), &tasks[i])
+	}
+	if overall != nil {
+		fmt.Fprintln(w, rule)
+		row("", "Overall", overall)
+	}
+}
+
+func markdownPhases(w io.Writer, tasks []Summary, overall *Summary) {
+	row := func(index string, name string, task *Summary) {
+		fmt.Fprintf(w, "| %s | %s | %.2f | %.2f | %.0f | %.0f | %.0f | %.0f | %d | %.1f%% | %s |\n", index, name,
+			task.RPS, task.SuccessRPS, task.Avg, summaryPercentile(task, 50), summaryPercentile(task, 95),
+			summaryPercentile(task, 99), task.NumFails, 100*errorRate(task), task.Payload)
+	}
+
+	fmt.Fprintln(w, "| # | Phase | req/s | ok/s | Avg | 50% | 95% | 99% | # fails | errors | Payload |")
+	fmt.Fprintln(w, "|--:|:------|------:|-----:|----:|----:|----:|----:|--------:|-------:|:--------|")
+	for i := range tasks {
+		row(strconv.Itoa(i+1), phaseName(&tasks[i]), &tasks[i])
+	}
+	if overall != nil {
+		row("", "**Overall**", overall)
+	}
+}
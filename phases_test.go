@@ -0,0 +1,73 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+func TestPrintPhases(t *testing.T) {
+	tasks := []Summary{
+		{NumRequests: 500, NumClients: 8, RPS: 120.5, SuccessRPS: 119, Avg: 45, NumFails: 3,
+			Percentiles: []Percentile{{Threshold: 50, Value: 40}, {Threshold: 95, Value: 80}, {Threshold: 99, Value: 95}}},
+		{NumRequests: 1000, NumClients: 16, Payload: "noise=0.5", RPS: 200, SuccessRPS: 150, Avg: 90, NumFails: 250,
+			Percentiles: []Percentile{{Threshold: 50, Value: 70}, {Threshold: 95, Value: 300}, {Threshold: 99, Value: 450}}},
+	}
+	overall := &Summary{NumRequests: 1500, NumClients: 16, RPS: 170, SuccessRPS: 140, Avg: 75, NumFails: 253,
+		Percentiles: []Percentile{{Threshold: 50, Value: 60}, {Threshold: 95, Value: 250}, {Threshold: 99, Value: 400}}}
+	want := "     # Phase      req/s     ok/s     Avg     50%     95%     99%   # fails  errors  Payload\n" +
+		"-------------------------------------------------------------------------------------------\n" +
+		"     1 500@8     120.50   119.00      45      40      80      95         3    0.6%\n" +
+		"     2 1000@16   200.00   150.00      90      70     300     450       250   25.0%  noise=0.5\n" +
+		"-------------------------------------------------------------------------------------------\n" +
+		"       Overall   170.00   140.00      75      60     250     400       253   16.9%\n"
+	buf := new(bytes.Buffer)
+	printPhases(buf, tasks, overall)
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCombinePhases(t *testing.T) {
+	latencies := latency.New()
+	for _, millis := range []float64{10, 20, 30, 40} {
+		latencies.Add(millis, true)
+	}
+	latencies.Add(100, false)
+	tasks := []Summary{
+		{NumRequests: 2, NumClients: 2, Seconds: 1, BytesReceived: 1000, BytesSent: 10},
+		{NumRequests: 3, NumClients: 4, NumFails: 1, Seconds: 1.5, BytesReceived: 1500, BytesSent: 20},
+	}
+
+	overall := combinePhases(latencies, tasks, percentileSet{thresholds: []float64{95}})
+	if overall.NumRequests != 5 || overall.NumFails != 1 || overall.NumClients != 4 || overall.Seconds != 2.5 {
+		t.Errorf("got %+v", overall)
+	}
+	if overall.RPS != 2 || overall.SuccessRPS != 1.6 || overall.Avg != 25 || overall.Max != 40 {
+		t.Errorf("got rates %g, %g and latencies %g, %g", overall.RPS, overall.SuccessRPS, overall.Avg, overall.Max)
+	}
+	if overall.BytesReceived != 2500 || overall.BytesSent != 30 || overall.AvgResponseBytes != 500 {
+		t.Errorf("got traffic %d, %d, %g", overall.BytesReceived, overall.BytesSent, overall.AvgResponseBytes)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultPollInterval = 500 * time.Millisecond
+const defaultPollTimeout = time.Minute
+
+// pollCondition : The value a poll response holds once the job is done
+type pollCondition struct {
+	path  *jsonPath
+	value string
+}
+
+// parsePollCondition reads a $.path=value condition
+func parsePollCondition(spec string) (*pollCondition, error) {
+	pair := strings.SplitN(spec, "=", 2)
+	if len(pair) != 2 {
+		return nil, fmt.Errorf("condition %q should be $.path=value", spec)
+	}
+	path, err := parseJSONPath(pair[0])
+	if err != nil {
+		return nil, err
+	}
+	return &pollCondition{path: path, value: pair[1]}, nil
+}
+
+func (c *pollCondition) String() string {
+	return c.path.String() + "=" + c.value
+}
+
+// Poller : Follows a submitted job to its end, the job url comes from the
+// submit response and the job is done once a poll meets the condition, or
+// simply gets a 200 response without one
+type Poller struct {
+	URL      *jsonPath
+	Until    *pollCondition
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// follow polls the job of a submit response, the result is the last poll
+// carrying the traffic of the whole job, a submit that failed is returned as is
+func (p *Poller) follow(endpoint string, submitted Response, header http.Header, opt *Options, stop <-chan struct{}) Response {
+	if submitted.Status < 200 || submitted.Status >= 300 || submitted.raw == nil {
+		return submitted
+	}
+	if submitted.encoding != "" {
+		decompress(&submitted, opt)
+		if submitted.raw == nil {
+			return submitted
+		}
+	}
+	job, err := p.URL.extract(submitted.raw)
+	if err != nil {
+		submitted.Success, submitted.Class, submitted.raw = false, classExtract, nil
+		submitted.Body = fmt.Sprintf("Failed extracting the job url: %s", err)
+		return submitted
+	}
+
+	ball := &Cannonball{Method: "GET", Path: job}
+	sent, received := submitted.Sent, submitted.Bytes
+	deadline := time.Now().Add(p.Timeout)
+	timer := time.NewTimer(p.Interval)
+	defer timer.Stop()
+	for polls := 1; ; polls++ {
+		select {
+		case <-stop:
+			return Response{Body: fmt.Sprintf("Stopped while polling %s", job), Class: classPoll,
+				Sent: sent, Bytes: received, Polls: polls - 1}
+		case <-timer.C:
+		}
+		response := fire(endpoint, ball, header, opt)
+		sent, received = sent+response.Sent, received+response.Bytes
+		response.Sent, response.Bytes, response.Polls = sent, received, polls
+		if response.Status != http.StatusAccepted && !response.Success {
+			return response
+		}
+		if response.Success && p.done(&response, opt) {
+			return response
+		}
+		if time.Now().Add(p.Interval).After(deadline) {
+			return Response{Body: fmt.Sprintf("Job %s is not done after %v", job, p.Timeout), Status: response.Status,
+				Class: classPoll, Sent: sent, Bytes: received, Polls: polls}
+		}
+		timer.Reset(p.Interval)
+	}
+}
+
+// done checks the poll response against the condition
+func (p *Poller) done(response *Response, opt *Options) bool {
+	if p.Until == nil {
+		return true
+	}
+	if response.raw != nil && response.encoding != "" {
+		decompress(response, opt)
+	}
+	value, err := p.Until.path.extract(response.raw)
+	return err == nil && value == p.Until.value
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePollCondition(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  string
+		fails bool
+	}{
+		{"$.status=done", "$.status=done", false},
+		{"$.job.state=a=b", "$.job.state=a=b", false},
+		{"$.status", "", true},
+		{"status=done", "", true},
+	}
+	for _, test := range tests {
+		condition, err := parsePollCondition(test.spec)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got no error", test.spec)
+			}
+			continue
+		}
+		if err != nil || condition.String() != test.want {
+			t.Errorf("%s: got %v (%v)", test.spec, condition, err)
+		}
+	}
+}
+
+func TestPollerFollow(t *testing.T) {
+	var mutex sync.Mutex
+	polls := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			job := r.URL.Query().Get("job")
+			if job == "" {
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprint(w, `{"queued": true}`)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, `{"result_url": "/jobs/%s"}`, job)
+			return
+		}
+		mutex.Lock()
+		polls[r.URL.Path]++
+		n := polls[r.URL.Path]
+		mutex.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "broken"):
+			w.WriteHeader(http.StatusInternalServerError)
+		case n == 1:
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"status": "queued"}`)
+		case n == 2 || strings.HasSuffix(r.URL.Path, "stuck"):
+			fmt.Fprint(w, `{"status": "running"}`)
+		default:
+			fmt.Fprint(w, `{"status": "done"}`)
+		}
+	}))
+	defer server.Close()
+
+	done, _ := parsePollCondition("$.status=done")
+	url, _ := parseJSONPath("$.result_url")
+	tests := []struct {
+		job     string
+		until   *pollCondition
+		success bool
+		class   string
+		polls   int
+	}{
+		{"a", done, true, "", 3},
+		{"b", nil, true, "", 2},
+		{"stuck", done, false, classPoll, 2},
+		{"broken", done, false, statusClass(http.StatusInternalServerError), 1},
+		{"", done, false, classExtract, 0},
+	}
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true})}
+	for _, test := range tests {
+		poller := &Poller{URL: url, Until: test.until, Interval: 10 * time.Millisecond, Timeout: 45 * time.Millisecond}
+		submit := &Cannonball{Method: "POST", Path: "/submit?job=" + test.job, Body: []byte("{}")}
+		response := poller.follow(server.URL, fire(server.URL, submit, nil, opt), nil, opt, nil)
+		// The stuck jobs are polled as many times as the timeout lets, at least twice
+		polled := response.Polls == test.polls || test.class == classPoll && response.Polls >= test.polls
+		if response.Success != test.success || response.Class != test.class || !polled {
+			t.Errorf("%s: got success %v, class %q after %d polls (%s)", test.job, response.Success,
+				response.Class, response.Polls, response.Body)
+		}
+		if test.polls > 0 && response.Sent <= len(submit.Body) {
+			t.Errorf("%s: got %d bytes sent over the whole job", test.job, response.Sent)
+		}
+	}
+
+	failed := Response{Status: http.StatusServiceUnavailable, Class: statusClass(http.StatusServiceUnavailable), raw: []byte("{}")}
+	poller := &Poller{URL: url, Interval: time.Millisecond, Timeout: time.Second}
+	if response := poller.follow(server.URL, failed, nil, opt, nil); response.Polls != 0 || response.Class != failed.Class {
+		t.Errorf("got a failed submit polled")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStartPprof(t *testing.T) {
+	listener, err := startPprof("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startPprof() failed: %s", err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/debug/pprof/", "goroutine"},
+		{"/debug/pprof/goroutine?debug=1", "startPprof"},
+		{"/debug/pprof/cmdline", ""},
+	}
+	for _, test := range tests {
+		response, err := http.Get("http://" + listener.Addr().String() + test.path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %s", test.path, err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK || !strings.Contains(string(body), test.want) {
+			t.Errorf("GET %s = %d %q, want 200 with %q", test.path, response.StatusCode, body, test.want)
+		}
+	}
+
+	if response, err := http.Get("http://" + listener.Addr().String() + "/metrics"); err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusNotFound {
+			t.Errorf("GET /metrics = %d, want 404 outside of /debug/pprof/", response.StatusCode)
+		}
+	}
+}
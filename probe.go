@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+func probeCommand(args []string) int {
+	fs, flags := newAttackFlagSet("probe")
+	panicIf(fs.Parse(args))
+	flags.probe = true
+	return flags.attack(fs.Args(), nil)
+}
+
+// probe fires the first request of the task once and prints everything about
+// it, to check the endpoint answers as expected before attacking it
+func probe(w io.Writer, task *Task, opt *Options) int {
+	ball := firstCannonball(task, opt)
+	endpoint := task.Targets[0].URL
+	if err := printRequest(w, "> ", endpoint, ball, opt); err != nil {
+		fmt.Fprintf(w, "Failed preparing the request: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(w, ">\n> %s of payload\n\n", formatBytes(float64(len(ball.Body))))
+
+	// The details of the response carry its headers
+	shot := *opt
+	shot.Slowest = 1
+	response := fireOnce(endpoint, ball, &shot)
+
+	if response.Status != 0 {
+		fmt.Fprintf(w, "< %d %s\n", response.Status, http.StatusText(response.Status))
+		if response.Detail != nil {
+			printHeader(w, "< ", response.Detail.ResponseHeader)
+		}
+		fmt.Fprint(w, "<\n\n")
+	}
+	printTiming(w, &response)
+	fmt.Fprintf(w, "\n%s\n", response.Body)
+	if !response.Success {
+		return 1
+	}
+	return 0
+}
+
+// fireOnce sends a single request over the protocol of the run and decodes the response
+func fireOnce(endpoint string, ball *Cannonball, opt *Options) Response {
+	start := time.Now()
+	var response Response
+	if opt.Protocol == protocolWS {
+		sockets := newWSClient(opt)
+		response = sockets.fire(endpoint, ball, nil, opt)
+		sockets.close()
+	} else {
+		response = fire(endpoint, ball, nil, opt)
+	}
+	response.Latency = time.Since(start)
+	decode(&response, opt)
+	return response
+}
+
+// printTiming writes the phases of the request latency
+func printTiming(w io.Writer, response *Response) {
+	timing := response.Timing
+	fmt.Fprintf(w, "Timing: dns %.1f ms, connect %.1f ms, tls %.1f ms, send %.1f ms, wait %.1f ms, receive %.1f ms\n",
+		millis(timing.DNS), millis(timing.Connect), millis(timing.TLS), millis(timing.Send), millis(timing.Wait),
+		millis(timing.Receive))
+	fmt.Fprintf(w, "Total:  %.1f ms", millis(response.Latency))
+	if timing.Reused {
+		fmt.Fprint(w, " over a reused connection")
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "pod-1")
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		code   int
+		status string
+	}{
+		{"/items", 0, "< 200 OK\n"},
+		{"/broken", 1, "< 500 Internal Server Error\n"},
+	}
+	for _, test := range tests {
+		task := &Task{
+			Targets: []Target{{Name: "api", URL: server.URL}},
+			Corpus:  []*Cannonball{{Method: "POST", Path: test.path, Body: []byte(`{"id":7}`)}},
+		}
+		opt := &Options{Timeout: 1, Transport: &http.Transport{}}
+		var out bytes.Buffer
+		if code := probe(&out, task, opt); code != test.code {
+			t.Errorf("probe of %s exited with %d, want %d", test.path, code, test.code)
+		}
+		printed := out.String()
+		for _, want := range []string{"> POST " + server.URL + test.path + "\n", "> 8 B of payload\n", test.status,
+			"< X-Served-By: pod-1\n", "Timing: dns ", "\n{\"ok\":true}\n"} {
+			if !strings.Contains(printed, want) {
+				t.Errorf("probe of %s printed %q, missing %q", test.path, printed, want)
+			}
+		}
+	}
+}
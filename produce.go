@@ -0,0 +1,250 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"image"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// produceNoisy encodes count distinct noisy cannonballs spreading the work
+// across the given number of goroutines
+func produceNoisy(img image.Image, batch int, encoding Encoding, count int, workers int, random *randomness) []*Cannonball {
+	balls := make([]*Cannonball, count)
+	if workers < 1 {
+		workers = 1
+	}
+
+	next := make(chan int, count)
+	for i := range balls {
+		next <- i
+	}
+	close(next)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(rnd *rand.Rand) {
+			defer wg.Done()
+			for i := range next {
+				balls[i] = makeCannonball(img, rnd, batch, encoding)
+			}
+		}(random.stream(streamProducers + int64(w)))
+	}
+	wg.Wait()
+
+	return balls
+}
+
+// pipelineSlack is the number of cannonballs produced ahead of the clients
+const pipelineSlack = 4
+
+// producePayloads feeds the cannonballs of every request of the task on
+// demand, so that only a few of them are held in memory at once. The clean
+// and the precomputed payloads are shared by all the requests using them.
+// The channel is closed once the task has all its requests or quit is closed.
+func producePayloads(task *Task, opt *Options, queue int, quit <-chan struct{}) <-chan *Cannonball {
+	pipeline := make(chan *Cannonball, queue+pipelineSlack)
+	emit := func(ball *Cannonball) bool {
+		// Check quit first, select picks at random when the clients still read
+		select {
+		case <-quit:
+			return false
+		default:
+		}
+		select {
+		case pipeline <- ball:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+
+	if task.Corpus != nil {
+		go func() {
+			defer close(pipeline)
+			start := time.Now()
+			span := task.Corpus[len(task.Corpus)-1].At
+			for r := 0; r < task.NumRequests; r++ {
+				ball := task.Corpus[r%len(task.Corpus)]
+				if task.Speed > 0 {
+					// Every pass over the log starts as the previous one ends
+					at := time.Duration(float64(span*time.Duration(r/len(task.Corpus))+ball.At) / task.Speed)
+					if wait := time.Until(start.Add(at)); wait > 0 {
+						timer := time.NewTimer(wait)
+						select {
+						case <-timer.C:
+						case <-quit:
+							timer.Stop()
+							return
+						}
+					}
+				}
+				if !emit(ball) {
+					return
+				}
+			}
+		}()
+		return pipeline
+	}
+
+	compress := func(ball *Cannonball) *Cannonball {
+		if opt.Compress != nil {
+			start := time.Now()
+			compressed := opt.Compress.compress(ball)
+			task.costs.compressedIn(time.Since(start))
+			if compressed != ball && ball.lease != nil {
+				// The original body is done with as soon as it is compressed
+				ball.lease.recycle()
+				compressed.lease = nil
+			}
+			return compressed
+		}
+		return ball
+	}
+
+	// The generators are not expected to be safe for concurrent use
+	if task.Generator != nil {
+		go func() {
+			defer close(pipeline)
+			for r := 0; r < task.NumRequests; r++ {
+				ball, err := task.Generator.Generate()
+				if err != nil {
+					ball = &Cannonball{err: err}
+				} else {
+					ball = compress(ball)
+				}
+				if !emit(ball) {
+					return
+				}
+			}
+		}()
+		return pipeline
+	}
+	if opt.Mix != nil {
+		return produceMix(task, opt, emit, compress, pipeline)
+	}
+	img := scaleImage(task.Image, task.Scale)
+	clean := compress(task.costs.made(makeCannonball(img, nil, task.Batch, task.Encoding)))
+	var pool []*Cannonball
+	if opt.Precompute > 0 && task.Noise > 0 {
+		count := opt.Precompute
+		if count > task.NumRequests {
+			count = task.NumRequests
+		}
+		pool = produceNoisy(img, task.Batch, task.Encoding, count, opt.Producers, opt.Random)
+		for i := range pool {
+			pool[i] = compress(task.costs.made(pool[i]))
+		}
+	}
+
+	workers := opt.Producers
+	if workers < 1 || pool != nil || task.Noise == 0 {
+		workers = 1
+	}
+	var bodies *bodyPool
+	if pool == nil && task.Noise > 0 && recycles(opt) {
+		// Every body is either queued, in flight or being made
+		bodies = newBodyPool(2*queue + pipelineSlack + workers)
+	}
+	var next, noisy int64 = -1, -1
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(rnd *rand.Rand) {
+			defer wg.Done()
+			for atomic.AddInt64(&next, 1) < int64(task.NumRequests) {
+				ball := clean
+				if task.Noise >= 1 || rnd.Float64() < task.Noise {
+					if pool != nil {
+						ball = pool[atomic.AddInt64(&noisy, 1)%int64(len(pool))]
+					} else {
+						ball = compress(task.costs.made(bodies.make(img, rnd, task.Batch, task.Encoding)))
+					}
+				}
+				if !emit(ball) {
+					return
+				}
+			}
+		}(opt.Random.stream(streamProducers + int64(w)))
+	}
+	go func() {
+		wg.Wait()
+		close(pipeline)
+	}()
+	return pipeline
+}
+
+// produceMix shoots the requests of the mix in the shares of their weights,
+// each payload request gets the image at its own scale and batch
+func produceMix(task *Task, opt *Options, emit func(*Cannonball) bool, compress func(*Cannonball) *Cannonball,
+	pipeline chan *Cannonball) <-chan *Cannonball {
+
+	images := make(map[*MixRequest]image.Image)
+	batches := make(map[*MixRequest]int)
+	cleans := make(map[*MixRequest]*Cannonball)
+	for _, request := range opt.Mix.Requests {
+		if !request.payload() {
+			continue
+		}
+		scale, batch := task.Scale, task.Batch
+		if request.Scale > 0 {
+			scale *= request.Scale
+		}
+		if request.Batch > 0 {
+			batch = request.Batch
+		}
+		images[request] = scaleImage(task.Image, scale)
+		batches[request] = batch
+		cleans[request] = task.costs.made(makeCannonball(images[request], nil, batch, task.Encoding))
+	}
+
+	workers := opt.Producers
+	if workers < 1 || task.Noise == 0 {
+		workers = 1
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(rnd *rand.Rand) {
+			defer wg.Done()
+			for atomic.AddInt64(&next, 1) < int64(task.NumRequests) {
+				request := opt.Mix.pick(rnd)
+				shot := cleans[request]
+				if shot != nil && (task.Noise >= 1 || task.Noise > 0 && rnd.Float64() < task.Noise) {
+					shot = task.costs.made(makeCannonball(images[request], rnd, batches[request], task.Encoding))
+				}
+				if !emit(compress(request.shoot(shot, opt.Data.row(rnd), rnd))) {
+					return
+				}
+			}
+		}(opt.Random.stream(streamProducers + int64(w)))
+	}
+	go func() {
+		wg.Wait()
+		close(pipeline)
+	}()
+	return pipeline
+}
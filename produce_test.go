@@ -0,0 +1,123 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"time"
+)
+
+func distinctBodies(plan []*Cannonball) int {
+	seen := make([][]byte, 0)
+	for _, ball := range plan {
+		known := false
+		for _, body := range seen {
+			if bytes.Equal(body, ball.Body) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			seen = append(seen, ball.Body)
+		}
+	}
+	return len(seen)
+}
+
+func collectPayloads(task *Task, opt *Options) []*Cannonball {
+	plan := make([]*Cannonball, 0)
+	for ball := range producePayloads(task, opt, 1, make(chan struct{})) {
+		plan = append(plan, ball)
+	}
+	return plan
+}
+
+func TestProducePayloads(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	tests := []struct {
+		noise      float64
+		precompute int
+		distinct   int
+	}{
+		{0, 0, 1},
+		{1, 0, 10},
+		{1, 3, 3},
+		{1, 50, 10},
+	}
+	for _, test := range tests {
+		task := &Task{Image: img, Noise: test.noise, Scale: 1, Batch: 1, NumRequests: 10}
+		plan := collectPayloads(task, &Options{Precompute: test.precompute, Producers: 2})
+		if len(plan) != 10 {
+			t.Fatalf("planned %d requests, want 10", len(plan))
+		}
+		if got := distinctBodies(plan); got != test.distinct {
+			t.Errorf("noise %g with precompute %d: %d distinct payloads, want %d",
+				test.noise, test.precompute, got, test.distinct)
+		}
+	}
+}
+
+func TestProducePayloadsCorpus(t *testing.T) {
+	corpus := []*Cannonball{{Label: "a"}, {Label: "b"}}
+	plan := collectPayloads(&Task{Corpus: corpus, NumRequests: 5}, &Options{})
+	labels := ""
+	for _, ball := range plan {
+		labels += ball.Label
+	}
+	if labels != "ababa" {
+		t.Errorf("planned %q, want the corpus cycled", labels)
+	}
+}
+
+func TestProducePayloadsTimed(t *testing.T) {
+	corpus := []*Cannonball{{Label: "a"}, {Label: "b", At: 40 * time.Millisecond}, {Label: "c", At: 100 * time.Millisecond}}
+	quit := make(chan struct{})
+	defer close(quit)
+	start := time.Now()
+	pipeline := producePayloads(&Task{Corpus: corpus, Speed: 2, NumRequests: 5}, &Options{}, 10, quit)
+	// At twice the speed the second pass starts 50ms in
+	wants := []time.Duration{0, 20, 50, 50, 70}
+	for i, want := range wants {
+		<-pipeline
+		want *= time.Millisecond
+		if at := time.Since(start); at < want || at > want+40*time.Millisecond {
+			t.Errorf("request %d came at %v, want %v", i, at, want)
+		}
+	}
+}
+
+func TestProducePayloadsQuit(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	quit := make(chan struct{})
+	pipeline := producePayloads(&Task{Image: img, Noise: 1, Scale: 1, Batch: 1, NumRequests: 1000},
+		&Options{Producers: 4}, 1, quit)
+	<-pipeline
+	close(quit)
+	count := 0
+	for range pipeline {
+		count++
+	}
+	if count > 1+pipelineSlack+4 {
+		t.Errorf("got %d cannonballs after quitting, want just the buffered ones", count)
+	}
+}
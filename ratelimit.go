@@ -0,0 +1,159 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// rateLimitRetries is how many times a throttled request is tried again
+	// before its 429 counts as a failure
+	rateLimitRetries = 10
+	// The backoff of the 429 responses without a Retry-After doubles from the
+	// first one up to the longest one
+	firstBackoff   = 500 * time.Millisecond
+	longestBackoff = 30 * time.Second
+)
+
+// parseRetryAfter reads the delay of a Retry-After header, either seconds or
+// an http date, a missing or a broken one is negative
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if date.Before(now) {
+			return 0
+		}
+		return date.Sub(now)
+	}
+	return -1
+}
+
+// throttleBackoff is how long to wait after the nth throttle of a request in
+// a row, for as long as the target asks or doubling when it does not say
+func throttleBackoff(retryAfter time.Duration, throttles int) time.Duration {
+	if retryAfter >= 0 {
+		return retryAfter
+	}
+	backoff := firstBackoff
+	for i := 1; i < throttles && backoff < longestBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > longestBackoff {
+		backoff = longestBackoff
+	}
+	return backoff
+}
+
+// retryThrottled backs the client off after every 429 and fires the request
+// again, returning the last response along with the start of its attempt
+func retryThrottled(response Response, start time.Time, fire func() Response, stop <-chan struct{}) (Response, time.Time) {
+	throttles, backoff := 0, time.Duration(0)
+	for response.Status == http.StatusTooManyRequests && throttles < rateLimitRetries {
+		throttles++
+		wait := throttleBackoff(response.retryAfter, throttles)
+		backoff += wait
+		// A stopped run gives up even when the target asks for no wait at all
+		stopped := false
+		select {
+		case <-stop:
+			stopped = true
+		default:
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				stopped = true
+			}
+		}
+		if stopped {
+			break
+		}
+		start = time.Now()
+		response = fire()
+	}
+	response.Throttles, response.Backoff = throttles, backoff
+	return response, start
+}
+
+// RateLimit : How much of the load the rate limiter of the target let through,
+// counting the throttles the clients backed off from instead of the failures
+type RateLimit struct {
+	Throttled  int     `json:"throttled"`
+	Throttles  int     `json:"throttles"`
+	Backoff    float64 `json:"backoff_seconds"`
+	Rejected   int     `json:"rejected"`
+	OfferedRPS float64 `json:"offered_rps"`
+	AllowedRPS float64 `json:"allowed_rps"`
+}
+
+// rateLimitStats : Accumulates the throttles of the requests of a task
+type rateLimitStats struct {
+	requests  int
+	throttled int
+	throttles int
+	backoff   time.Duration
+	rejected  int
+}
+
+func (s *rateLimitStats) add(response *Response) {
+	s.requests++
+	if response.Throttles > 0 {
+		s.throttled++
+		s.throttles += response.Throttles
+		s.backoff += response.Backoff
+	}
+	if response.Status == http.StatusTooManyRequests {
+		s.rejected++
+	}
+}
+
+// summarize is nil unless a request got throttled, the allowed rate counts
+// the requests which got through and the offered one every attempt
+func (s *rateLimitStats) summarize(totalSeconds float64) *RateLimit {
+	if s.throttled == 0 {
+		return nil
+	}
+	limit := &RateLimit{Throttled: s.throttled, Throttles: s.throttles, Backoff: s.backoff.Seconds(), Rejected: s.rejected}
+	if totalSeconds > 0 {
+		limit.OfferedRPS = float64(s.requests+s.throttles) / totalSeconds
+		limit.AllowedRPS = float64(s.requests-s.rejected) / totalSeconds
+	}
+	return limit
+}
+
+func describeRateLimit(limit *RateLimit, numRequests int) string {
+	description := fmt.Sprintf("%d of %d requests throttled %d times, backed off %.1fs in total, "+
+		"%.2f req/s allowed of %.2f req/s tried", limit.Throttled, numRequests, limit.Throttles, limit.Backoff,
+		limit.AllowedRPS, limit.OfferedRPS)
+	if limit.Rejected > 0 {
+		description += fmt.Sprintf(", %d still throttled after %d retries", limit.Rejected, rateLimitRetries)
+	}
+	return description
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		wait  time.Duration
+	}{
+		{value: "3", wait: 3 * time.Second},
+		{value: " 0 ", wait: 0},
+		{value: "Sun, 01 Mar 2020 12:00:10 GMT", wait: 10 * time.Second},
+		{value: "Sun, 01 Mar 2020 11:59:00 GMT", wait: 0},
+		{value: "", wait: -1},
+		{value: "-5", wait: -1},
+		{value: "soon", wait: -1},
+	}
+	for _, test := range tests {
+		if wait := parseRetryAfter(test.value, now); wait != test.wait {
+			t.Errorf("%q: got %v, want %v", test.value, wait, test.wait)
+		}
+	}
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		throttles  int
+		backoff    time.Duration
+	}{
+		{retryAfter: 2 * time.Second, throttles: 5, backoff: 2 * time.Second},
+		{retryAfter: 0, throttles: 1, backoff: 0},
+		{retryAfter: -1, throttles: 1, backoff: 500 * time.Millisecond},
+		{retryAfter: -1, throttles: 3, backoff: 2 * time.Second},
+		{retryAfter: -1, throttles: 10, backoff: 30 * time.Second},
+	}
+	for _, test := range tests {
+		if backoff := throttleBackoff(test.retryAfter, test.throttles); backoff != test.backoff {
+			t.Errorf("%v after %d throttles: got %v, want %v", test.retryAfter, test.throttles, backoff, test.backoff)
+		}
+	}
+}
+
+func TestRetryThrottled(t *testing.T) {
+	// The limiter lets a request through once the ones before it used up the throttles
+	var requests, throttles int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= atomic.LoadInt64(&throttles) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true})}
+	shoot := func() Response {
+		return fire(server.URL, &Cannonball{Method: "GET"}, nil, opt)
+	}
+	tests := []struct {
+		name      string
+		throttles int64
+		stopped   bool
+		status    int
+		retried   int
+	}{
+		{name: "allowed", throttles: 0, status: 200},
+		{name: "throttled", throttles: 3, status: 200, retried: 3},
+		{name: "exhausted", throttles: 100, status: 429, retried: rateLimitRetries},
+		{name: "stopped", throttles: 100, stopped: true, status: 429, retried: 1},
+	}
+	for _, test := range tests {
+		atomic.StoreInt64(&requests, 0)
+		atomic.StoreInt64(&throttles, test.throttles)
+		stop := make(chan struct{})
+		if test.stopped {
+			close(stop)
+		}
+		first := time.Now()
+		response, start := retryThrottled(shoot(), first, shoot, stop)
+		if response.Status != test.status || response.Throttles != test.retried || response.Backoff != 0 {
+			t.Errorf("%s: got %d after %d throttles backing off %v, want %d after %d", test.name, response.Status,
+				response.Throttles, response.Backoff, test.status, test.retried)
+		}
+		if retried := test.retried > 0 && !test.stopped; retried != start.After(first) {
+			t.Errorf("%s: got the start of the attempt at %v, first at %v", test.name, start, first)
+		}
+	}
+
+	// A 429 without Retry-After waits out the first backoff
+	start := time.Now()
+	response, _ := retryThrottled(Response{Status: 429, retryAfter: -1}, start, func() Response {
+		return Response{Status: 200, Success: true}
+	}, nil)
+	if elapsed := time.Since(start); !response.Success || response.Backoff != firstBackoff || elapsed < firstBackoff {
+		t.Errorf("got %d backing off %v in %v", response.Status, response.Backoff, elapsed)
+	}
+}
+
+func TestRateLimitStats(t *testing.T) {
+	stats := &rateLimitStats{}
+	stats.add(&Response{Status: 200, Success: true})
+	if stats.summarize(1) != nil {
+		t.Error("got a rate limit without any throttles")
+	}
+	stats.add(&Response{Status: 200, Success: true, Throttles: 2, Backoff: 2 * time.Second})
+	stats.add(&Response{Status: 200, Success: true, Throttles: 1, Backoff: time.Second})
+	stats.add(&Response{Status: 429, Throttles: 10, Backoff: 5 * time.Second})
+
+	limit := stats.summarize(2)
+	want := RateLimit{Throttled: 3, Throttles: 13, Backoff: 8, Rejected: 1, OfferedRPS: 8.5, AllowedRPS: 1.5}
+	if *limit != want {
+		t.Fatalf("got %+v, want %+v", *limit, want)
+	}
+	description := "3 of 4 requests throttled 13 times, backed off 8.0s in total, 1.50 req/s allowed of 8.50 req/s tried, " +
+		"1 still throttled after 10 retries"
+	if got := describeRateLimit(limit, 4); got != description {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultReadyTimeout = 2 * time.Minute
+const readyInterval = time.Second
+
+// waitReady polls the health path of every target until it answers with a
+// success, so that a run started right after a deploy does not record the
+// startup errors of the service instead of its performance
+func waitReady(w io.Writer, targets []Target, path string, timeout time.Duration, interval time.Duration, opt *Options) error {
+	deadline := time.Now().Add(timeout)
+	ball := &Cannonball{Method: "GET", Path: path}
+	for _, target := range targets {
+		// The health of a websocket service is checked over plain http
+		endpoint := target.URL
+		if strings.HasPrefix(endpoint, "ws") {
+			endpoint = "http" + strings.TrimPrefix(endpoint, "ws")
+		}
+		start := time.Now()
+		for polls := 1; ; polls++ {
+			response := fire(endpoint, ball, nil, opt)
+			if response.Status >= 200 && response.Status < 300 {
+				if w != nil {
+					fmt.Fprintf(w, "%s is ready after %v\n", target.Name, time.Since(start).Round(time.Millisecond))
+				}
+				break
+			}
+			if time.Now().Add(interval).After(deadline) {
+				last := response.Body
+				if response.Status != 0 {
+					last = fmt.Sprintf("%d %s", response.Status, http.StatusText(response.Status))
+				}
+				return fmt.Errorf("%s is not ready after %v, the last poll got: %s", target.Name, timeout, last)
+			}
+			if polls == 1 && w != nil {
+				fmt.Fprintf(w, "Waiting for %s to be ready\n", target.Name)
+			}
+			time.Sleep(interval)
+		}
+	}
+	return nil
+}
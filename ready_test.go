@@ -0,0 +1,90 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitReady(t *testing.T) {
+	var mutex sync.Mutex
+	polls := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		polls[r.URL.Path]++
+		n := polls[r.URL.Path]
+		mutex.Unlock()
+		switch {
+		case r.URL.Path == "/booting/health" && n >= 3:
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/up/health":
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		targets []string
+		polls   int
+		fails   string
+	}{
+		{[]string{server.URL + "/up/"}, 1, ""},
+		{[]string{server.URL + "/booting/"}, 3, ""},
+		{[]string{"ws" + strings.TrimPrefix(server.URL, "http") + "/up/"}, 1, ""},
+		{[]string{server.URL + "/up/", server.URL + "/down/"}, 0, "503 Service Unavailable"},
+		{[]string{"http://127.0.0.1:1/"}, 0, "Error while sending the request"},
+	}
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true})}
+	for _, test := range tests {
+		polls = make(map[string]int)
+		var targets []Target
+		for _, url := range test.targets {
+			targets = append(targets, Target{Name: url, URL: url})
+		}
+		var log bytes.Buffer
+		err := waitReady(&log, targets, "health", 50*time.Millisecond, 10*time.Millisecond, opt)
+		if test.fails != "" {
+			if err == nil || !strings.Contains(err.Error(), test.fails) {
+				t.Errorf("%v: got error %v, want %q", test.targets, err, test.fails)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: got error %s", test.targets, err)
+			continue
+		}
+		if !strings.Contains(log.String(), "ready after") {
+			t.Errorf("%v: got log %q", test.targets, log.String())
+		}
+		for path, n := range polls {
+			if n != test.polls {
+				t.Errorf("%v: got %d polls of %s, want %d", test.targets, n, path, test.polls)
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+var errRecycled = fmt.Errorf("request body is recycled")
+
+// bodyPool : Bounded free list of the bodies of the noisy payloads, the
+// workers hand a body back once its request is over and the producers make
+// the next payloads in it, so that their memory follows the clients rather
+// than the requests
+type bodyPool struct {
+	free chan []byte
+}
+
+func newBodyPool(size int) *bodyPool {
+	return &bodyPool{free: make(chan []byte, size)}
+}
+
+// make encodes a noisy payload into a recycled body when one is free, a nil
+// pool makes it as usual
+func (p *bodyPool) make(img image.Image, rnd *rand.Rand, batch int, encoding Encoding) *Cannonball {
+	if p == nil {
+		return makeCannonball(img, rnd, batch, encoding)
+	}
+	var body []byte
+	select {
+	case body = <-p.free:
+	default:
+	}
+	ball := makeCannonballIn(body, img, rnd, batch, encoding)
+	ball.lease = &bodyLease{pool: p, body: ball.Body}
+	return ball
+}
+
+// bodyLease : Hold of a pooled body by its cannonball, the readers of the
+// transport stop reading it once it is recycled
+type bodyLease struct {
+	mu       sync.Mutex
+	pool     *bodyPool
+	body     []byte
+	recycled bool
+}
+
+// holds tells whether the body is the very one leased, the copies of the
+// cannonball with a body of their own only share the lease
+func (l *bodyLease) holds(body []byte) bool {
+	return l != nil && len(body) == len(l.body) && len(body) > 0 && &body[0] == &l.body[0]
+}
+
+// reader of the body, safe to outlive the request
+func (l *bodyLease) reader() io.ReadCloser {
+	return &leasedReader{lease: l}
+}
+
+// recycle hands the body back to the pool, or drops it when the pool is
+// full, only the first call counts
+func (l *bodyLease) recycle() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.recycled {
+		return
+	}
+	l.recycled = true
+	select {
+	case l.pool.free <- l.body:
+	default:
+	}
+}
+
+// leasedReader : Reads a leased body, the transport may go on reading after
+// the response is in, when the server answered early
+type leasedReader struct {
+	lease *bodyLease
+	read  int
+}
+
+func (r *leasedReader) Read(p []byte) (int, error) {
+	r.lease.mu.Lock()
+	defer r.lease.mu.Unlock()
+	if r.lease.recycled {
+		return 0, errRecycled
+	}
+	if r.read == len(r.lease.body) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.lease.body[r.read:])
+	r.read += n
+	return n, nil
+}
+
+func (r *leasedReader) Close() error {
+	return nil
+}
+
+// recycles tells whether the bodies of the noisy payloads can go back to the
+// pool once their requests are over, that is nothing holds them any longer:
+// the failures keep their requests, the fuzzer and the hooks derive new ones,
+// the slow clients and the websockets read them on their own
+func recycles(opt *Options) bool {
+	return opt.Failures == nil && opt.Fuzz == nil && opt.Script == nil && opt.Chunked == nil &&
+		opt.UploadBandwidth == 0 && opt.Protocol != protocolWS
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBodyPool(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	rnd := rand.New(rand.NewSource(1))
+	encoding := Encoding{Format: formatPNG}
+	pool := newBodyPool(1)
+
+	first := pool.make(img, rnd, 1, encoding)
+	if !first.lease.holds(first.Body) {
+		t.Fatalf("got a lease of another body")
+	}
+	reader := first.lease.reader()
+	first.lease.recycle()
+	first.lease.recycle()
+	if _, err := reader.Read(make([]byte, 8)); err != errRecycled {
+		t.Errorf("got %v reading a recycled body, want %v", err, errRecycled)
+	}
+	if len(pool.free) != 1 {
+		t.Errorf("got %d free bodies after recycling one twice", len(pool.free))
+	}
+
+	second := pool.make(img, rnd, 1, encoding)
+	if &second.Body[:1][0] != &first.Body[:1][0] {
+		t.Errorf("got a new body instead of the recycled one")
+	}
+	want := makeCannonball(img, nil, 1, encoding).Body
+	if clean := pool.make(img, nil, 1, encoding); !bytes.Equal(clean.Body, want) {
+		t.Errorf("got %.40q in a fresh body, want %.40q", clean.Body, want)
+	}
+
+	copied := *second
+	copied.Body = append([]byte(nil), second.Body...)
+	if copied.lease.holds(copied.Body) {
+		t.Errorf("got the lease holding a copy of the body")
+	}
+	var none *bodyPool
+	if ball := none.make(img, rnd, 1, encoding); ball.lease != nil {
+		t.Errorf("got a lease without a pool")
+	}
+}
+
+func TestFireLeased(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	ball := newBodyPool(1).make(img, rand.New(rand.NewSource(1)), 2, Encoding{Format: formatPNG})
+	opt := &Options{Timeout: 1, Transport: &http.Transport{}}
+	response := fire(server.URL, ball, nil, opt)
+	if !bytes.Equal(response.raw, ball.Body) {
+		t.Errorf("got %.40q back, want %.40q", response.raw, ball.Body)
+	}
+}
+
+func TestRecycleOnStop(t *testing.T) {
+	pool := newBodyPool(1)
+	pipeline := make(chan *Cannonball, 1)
+	pipeline <- pool.make(image.NewGray(image.Rect(0, 0, 16, 16)), nil, 1, Encoding{Format: formatPNG})
+
+	// The client stopped while waiting for its turn hands the body back
+	limiter := newLimiter(0.1)
+	limiter.Wait(nil)
+	stop := make(chan struct{})
+	close(stop)
+	cannonade(0, newTargetPool([]Target{{Name: "none"}}), &Options{}, limiter, stop, pipeline, nil, nil)
+	if len(pool.free) != 1 {
+		t.Errorf("got %d free bodies after stopping, want the leased one back", len(pool.free))
+	}
+}
+
+func TestRecycles(t *testing.T) {
+	tests := []struct {
+		opt      *Options
+		recycles bool
+	}{
+		{opt: &Options{}, recycles: true},
+		{opt: &Options{Failures: &failureLog{}}, recycles: false},
+		{opt: &Options{Fuzz: &fuzzer{}}, recycles: false},
+		{opt: &Options{Chunked: &chunking{}}, recycles: false},
+		{opt: &Options{UploadBandwidth: 1024}, recycles: false},
+		{opt: &Options{Protocol: protocolWS}, recycles: false},
+	}
+	for i, test := range tests {
+		if got := recycles(test.opt); got != test.recycles {
+			t.Errorf("#%d: got %v, want %v", i, got, test.recycles)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// Millis : A latency in milliseconds that is encoded as null when undefined
+type Millis float64
+
+// MarshalJSON keeps the report valid JSON when there is no latency to show
+func (m Millis) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(m)) || math.IsInf(float64(m), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(m))
+}
+
+// UnmarshalJSON reads the undefined latencies of a saved report back as NaN
+func (m *Millis) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*m = Millis(math.NaN())
+		return nil
+	}
+	return json.Unmarshal(data, (*float64)(m))
+}
+
+// Percentile : A latency value below which the given share of requests fall
+type Percentile struct {
+	Threshold float64 `json:"threshold"`
+	Value     Millis  `json:"value"`
+}
+
+// Window : Interim statistics over a fixed period of a long task execution
+type Window struct {
+	Elapsed     float64 `json:"elapsed"`
+	NumRequests int     `json:"num_requests"`
+	NumFails    int     `json:"num_fails"`
+	RPS         float64 `json:"rps"`
+	P95         Millis  `json:"p95"`
+	ErrorRate   float64 `json:"error_rate"`
+}
+
+// Summary : Aggregated statistics of a single task execution
+type Summary struct {
+	NumRequests      int          `json:"num_requests"`
+	NumClients       int          `json:"num_clients"`
+	Payload          string       `json:"payload,omitempty"`
+	NumFails         int          `json:"num_fails"`
+	NumOversized     int          `json:"num_oversized,omitempty"`
+	AvgPolls         float64      `json:"avg_polls,omitempty"`
+	Failures         []Failure    `json:"failures,omitempty"`
+	TimeToError      *TimeToError `json:"time_to_error,omitempty"`
+	Compression      *Compression `json:"compression,omitempty"`
+	Connections      *Connections `json:"connections,omitempty"`
+	Caching          *Caching     `json:"caching,omitempty"`
+	Fuzzing          *Fuzzing     `json:"fuzzing,omitempty"`
+	RateLimit        *RateLimit   `json:"rate_limit,omitempty"`
+	Concurrency      *Concurrency `json:"concurrency,omitempty"`
+	CircuitOpened    int          `json:"circuit_opened,omitempty"`
+	ClientCost       *ClientCost  `json:"client_cost,omitempty"`
+	Adaptive         *Adaptive    `json:"adaptive,omitempty"`
+	Generator        *Generator   `json:"generator,omitempty"`
+	Seconds          float64      `json:"seconds"`
+	Avg              Millis       `json:"avg"`
+	Min              Millis       `json:"min"`
+	Max              Millis       `json:"max"`
+	Median           Millis       `json:"median"`
+	RPS              float64      `json:"rps"`
+	SuccessRPS       float64      `json:"success_rps"`
+	Percentiles      []Percentile `json:"percentiles"`
+	Estimated        bool         `json:"estimated,omitempty"`
+	BytesSent        int64        `json:"bytes_sent"`
+	BytesReceived    int64        `json:"bytes_received"`
+	AvgResponseBytes float64      `json:"avg_response_bytes"`
+	Throughput       float64      `json:"throughput"`
+	Fairness         *Fairness    `json:"fairness,omitempty"`
+	Scheduling       *Scheduling  `json:"scheduling,omitempty"`
+	Windows          []Window     `json:"windows,omitempty"`
+	Heatmap          *Heatmap     `json:"heatmap,omitempty"`
+	Apdex            *Apdex       `json:"apdex,omitempty"`
+	Targets          []Breakdown  `json:"targets,omitempty"`
+	Backends         []Breakdown  `json:"backends,omitempty"`
+	Hosts            []Breakdown  `json:"hosts,omitempty"`
+	Workers          []Breakdown  `json:"workers,omitempty"`
+	Requests         []Breakdown  `json:"requests,omitempty"`
+}
+
+// Report : Summaries of all the tasks executed within a single run
+type Report struct {
+	Endpoint string    `json:"endpoint"`
+	Tasks    []Summary `json:"tasks"`
+	FindMax  *FindMax  `json:"find_max,omitempty"`
+	Overall  *Summary  `json:"overall,omitempty"`
+	Cooldown *Cooldown `json:"cooldown,omitempty"`
+	Aborted  string    `json:"aborted,omitempty"`
+}
+
+// Renderer : A way of presenting the statistics to the user
+type Renderer interface {
+	// Task is called as soon as a task from the schedule is done
+	Task(summary *Summary) error
+	// Finish is called once the whole schedule is done
+	Finish(report *Report) error
+}
+
+func newRenderer(format string, templatePath string, w io.Writer) (Renderer, error) {
+	if templatePath != "" {
+		text, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(filepath.Base(templatePath)).Parse(string(text))
+		if err != nil {
+			return nil, err
+		}
+		return &templateRenderer{w, tmpl}, nil
+	}
+
+	switch format {
+	case "text":
+		return &textRenderer{w}, nil
+	case "markdown":
+		return &markdownRenderer{w}, nil
+	case "json":
+		return &jsonRenderer{w}, nil
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+func newWindow(latencies *latency.Accumulator, elapsed time.Duration, period time.Duration) Window {
+	stats := latencies.Stats(95)
+	window := Window{
+		Elapsed:     elapsed.Seconds(),
+		NumRequests: stats.Count,
+		NumFails:    stats.Fails,
+		RPS:         float64(stats.Count) / period.Seconds(),
+		P95:         Millis(stats.Percentiles[0]),
+	}
+	if stats.Count > 0 {
+		window.ErrorRate = float64(stats.Fails) / float64(stats.Count)
+	}
+
+	return window
+}
+
+func printWindow(w io.Writer, window *Window) {
+	fmt.Fprintf(w, "[%7.1fs] %7d reqs %8.2f req/s   p95 %6.0f ms   errors %5.1f%%\n",
+		window.Elapsed, window.NumRequests, window.RPS, window.P95, 100*window.ErrorRate)
+}
+
+type textRenderer struct {
+	w io.Writer
+}
+
+func (r *textRenderer) Task(summary *Summary) error {
+	fmt.Fprintf(r.w, "\nTask: %d@%d", summary.NumRequests, summary.NumClients)
+	if summary.Payload != "" {
+		fmt.Fprintf(r.w, " (%s)", summary.Payload)
+	}
+	fmt.Fprint(r.w, "\n\n")
+	printStats(r.w, summary)
+	if len(summary.Failures) > 0 {
+		fmt.Fprintln(r.w)
+		printFailures(r.w, summary.Failures, summary.NumFails)
+	}
+	if summary.TimeToError != nil {
+		fmt.Fprintf(r.w, "Time to error: %s\n", describeTimeToError(summary.TimeToError))
+	}
+	if summary.Apdex != nil {
+		fmt.Fprintf(r.w, "\nApdex: %s\n", describeApdex(summary.Apdex))
+	}
+	if summary.Fuzzing != nil {
+		fmt.Fprintln(r.w)
+		printFuzzing(r.w, summary.Fuzzing)
+	}
+	if summary.Scheduling != nil {
+		fmt.Fprintln(r.w)
+		printScheduling(r.w, summary.Scheduling, summary.NumRequests)
+	}
+	if summary.Fairness != nil {
+		fmt.Fprintln(r.w)
+		printFairness(r.w, summary.Fairness)
+	}
+	if len(summary.Targets) > 0 {
+		fmt.Fprintln(r.w)
+		printBreakdown(r.w, "Target", summary.Targets)
+	}
+	if len(summary.Backends) > 0 {
+		fmt.Fprintln(r.w)
+		printBreakdown(r.w, "Backend", summary.Backends)
+	}
+	if len(summary.Hosts) > 0 {
+		fmt.Fprintln(r.w)
+		printBreakdown(r.w, "Host", summary.Hosts)
+	}
+	if len(summary.Workers) > 0 {
+		fmt.Fprintln(r.w)
+		printBreakdown(r.w, "Worker", summary.Workers)
+	}
+	if len(summary.Requests) > 0 {
+		fmt.Fprintln(r.w)
+		printBreakdown(r.w, "Request", summary.Requests)
+	}
+	return nil
+}
+
+func (r *textRenderer) Finish(report *Report) error {
+	if report.FindMax != nil {
+		fmt.Fprint(r.w, "\n")
+		printFindMax(r.w, report.FindMax)
+	} else if len(report.Tasks) > 1 {
+		fmt.Fprint(r.w, "\n")
+		printPhases(r.w, report.Tasks, report.Overall)
+	}
+	if report.Cooldown != nil {
+		fmt.Fprint(r.w, "\n")
+		printCooldown(r.w, report.Cooldown)
+	}
+	if report.Aborted != "" {
+		fmt.Fprintf(r.w, "\nAborted: %s\n", report.Aborted)
+	}
+	return nil
+}
+
+type markdownRenderer struct {
+	w io.Writer
+}
+
+func (r *markdownRenderer) Task(summary *Summary) error {
+	fmt.Fprintf(r.w, "\n### Task %d@%d", summary.NumRequests, summary.NumClients)
+	if summary.Payload != "" {
+		fmt.Fprintf(r.w, " (%s)", summary.Payload)
+	}
+	fmt.Fprint(r.w, "\n\n")
+	fmt.Fprintln(r.w, "| # reqs | # fails | Avg | Min | Max | Median | req/s | ok/s |")
+	fmt.Fprintln(r.w, "|-------:|--------:|----:|----:|----:|-------:|------:|-----:|")
+	fmt.Fprintf(r.w, "| %d | %d | %.0f | %.0f | %.0f | %.0f | %.2f | %.2f |\n\n",
+		summary.NumRequests, summary.NumFails, summary.Avg, summary.Min, summary.Max,
+		summary.Median, summary.RPS, summary.SuccessRPS)
+
+	fmt.Fprint(r.w, "|")
+	for _, percentile := range summary.Percentiles {
+		fmt.Fprintf(r.w, " %s%% |", formatThreshold(percentile.Threshold))
+	}
+	fmt.Fprint(r.w, "\n|")
+	for range summary.Percentiles {
+		fmt.Fprint(r.w, "----:|")
+	}
+	fmt.Fprint(r.w, "\n|")
+	for _, percentile := range summary.Percentiles {
+		fmt.Fprintf(r.w, " %.0f |", percentile.Value)
+	}
+	fmt.Fprint(r.w, "\n")
+	if summary.Estimated {
+		fmt.Fprintf(r.w, "\n%s\n", estimatedNote)
+	}
+
+	fmt.Fprintf(r.w, "\nReceived **%s** (%s per response), sent %s, **%.2f MB/s**\n",
+		formatBytes(float64(summary.BytesReceived)), formatBytes(summary.AvgResponseBytes),
+		formatBytes(float64(summary.BytesSent)), summary.Throughput)
+	if compression := summary.Compression; compression != nil {
+		fmt.Fprintf(r.w, "\nCompressed bodies: %s\n", describeCompression(compression))
+	}
+	if summary.NumOversized > 0 {
+		fmt.Fprintf(r.w, "\nOversized: **%d** of %d responses cut at the size limit\n", summary.NumOversized, summary.NumRequests)
+	}
+	if summary.AvgPolls > 0 {
+		fmt.Fprintf(r.w, "\nPolled **%.1f** times per job on average\n", summary.AvgPolls)
+	}
+	if summary.Concurrency != nil {
+		fmt.Fprintf(r.w, "\nConcurrency: %s\n", describeConcurrency(summary.Concurrency))
+	}
+	if summary.Connections != nil {
+		fmt.Fprintf(r.w, "\nConnections: %s\n", describeConnections(summary.Connections))
+	}
+	if summary.Caching != nil {
+		fmt.Fprintf(r.w, "\nCache: %s\n", describeCaching(summary.Caching))
+	}
+	if summary.CircuitOpened > 0 {
+		fmt.Fprintf(r.w, "\nCircuit breaker: %s\n", describeCircuitOpened(summary.CircuitOpened))
+	}
+	if summary.RateLimit != nil {
+		fmt.Fprintf(r.w, "\nRate limit: %s\n", describeRateLimit(summary.RateLimit, summary.NumRequests))
+	}
+	if summary.ClientCost != nil {
+		fmt.Fprintf(r.w, "\nEncoding: %s\n", describeClientCost(summary.ClientCost, summary.Avg))
+	}
+	if summary.Adaptive != nil {
+		fmt.Fprintf(r.w, "\nTarget: %s\n", describeAdaptive(summary.Adaptive))
+	}
+	if summary.Generator != nil {
+		fmt.Fprintf(r.w, "\nGenerator: %s\n", describeGenerator(summary.Generator))
+	}
+	if len(summary.Failures) > 0 {
+		fmt.Fprint(r.w, "\n")
+		markdownFailures(r.w, summary.Failures, summary.NumFails)
+	}
+	if summary.TimeToError != nil {
+		fmt.Fprintf(r.w, "\nTime to error: %s\n", describeTimeToError(summary.TimeToError))
+	}
+	if summary.Apdex != nil {
+		fmt.Fprintf(r.w, "\nApdex: %s\n", describeApdex(summary.Apdex))
+	}
+	if summary.Fuzzing != nil {
+		fmt.Fprint(r.w, "\n")
+		markdownFuzzing(r.w, summary.Fuzzing)
+	}
+
+	if scheduling := summary.Scheduling; scheduling != nil {
+		fmt.Fprintf(r.w, "\nScheduling error: mean **%.2f ms**, 99%% %.2f ms, max %.2f ms, %d of %d requests sent late\n",
+			scheduling.Mean, scheduling.P99, scheduling.Max, scheduling.Late, summary.NumRequests)
+	}
+	if summary.Fairness != nil {
+		fmt.Fprintf(r.w, "\nFairness index: **%.3f**, longest wait %d completions (expected ~%d)\n",
+			summary.Fairness.Index, summary.Fairness.MaxGap, summary.Fairness.ExpectedGap)
+	}
+	if len(summary.Targets) > 0 {
+		fmt.Fprint(r.w, "\n")
+		markdownBreakdown(r.w, "Target", summary.Targets)
+	}
+	if len(summary.Backends) > 0 {
+		fmt.Fprint(r.w, "\n")
+		markdownBreakdown(r.w, "Backend", summary.Backends)
+	}
+	if len(summary.Hosts) > 0 {
+		fmt.Fprint(r.w, "\n")
+		markdownBreakdown(r.w, "Host", summary.Hosts)
+	}
+	if len(summary.Workers) > 0 {
+		fmt.Fprint(r.w, "\n")
+		markdownBreakdown(r.w, "Worker", summary.Workers)
+	}
+	if len(summary.Requests) > 0 {
+		fmt.Fprint(r.w, "\n")
+		markdownBreakdown(r.w, "Request", summary.Requests)
+	}
+	return nil
+}
+
+func markdownBreakdown(w io.Writer, title string, rows []Breakdown) {
+	fmt.Fprintf(w, "| %s | # reqs | # fails | Avg | Median | 95%% | Max |\n", title)
+	fmt.Fprintln(w, "|:---|-------:|--------:|----:|-------:|----:|----:|")
+	for _, row := range rows {
+		name := row.Name
+		if row.Outlier {
+			name += " **(outlier)**"
+		}
+		fmt.Fprintf(w, "| %s | %d | %d | %.0f | %.0f | %.0f | %.0f |\n", name,
+			row.NumRequests, row.NumFails, row.Avg, row.Median, row.P95, row.Max)
+	}
+}
+
+func (r *markdownRenderer) Finish(report *Report) error {
+	if report.FindMax != nil {
+		markdownFindMax(r.w, report.FindMax)
+	} else if len(report.Tasks) > 1 {
+		fmt.Fprint(r.w, "\n### Phases\n\n")
+		markdownPhases(r.w, report.Tasks, report.Overall)
+	}
+	if report.Cooldown != nil {
+		markdownCooldown(r.w, report.Cooldown)
+	}
+	if report.Aborted != "" {
+		fmt.Fprintf(r.w, "\n**Aborted:** %s\n", report.Aborted)
+	}
+	return nil
+}
+
+type jsonRenderer struct {
+	w io.Writer
+}
+
+func (r *jsonRenderer) Task(summary *Summary) error {
+	return nil
+}
+
+func (r *jsonRenderer) Finish(report *Report) error {
+	encoder := json.NewEncoder(r.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type templateRenderer struct {
+	w    io.Writer
+	tmpl *template.Template
+}
+
+func (r *templateRenderer) Task(summary *Summary) error {
+	return nil
+}
+
+func (r *templateRenderer) Finish(report *Report) error {
+	return r.tmpl.Execute(r.w, report)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// resolveFlag : Addresses pinned to the hosts the way curl --resolve does, by
+// host:port or by the host alone for any port, can be repeated
+type resolveFlag map[string]string
+
+func (r resolveFlag) String() string {
+	return strings.Join(r.lines(), ", ")
+}
+
+// lines lists the pins one host[:port]:addr each, in the order of the hosts
+func (r resolveFlag) lines() []string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+":"+r[key])
+	}
+	return lines
+}
+
+func (r resolveFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return fmt.Errorf("resolve %q should be host:port:addr or host:addr", value)
+	}
+	host, addr := strings.ToLower(parts[0]), strings.Join(parts[1:], ":")
+	if len(parts) == 3 {
+		if _, err := strconv.ParseUint(parts[1], 10, 16); err == nil {
+			host, addr = net.JoinHostPort(host, parts[1]), parts[2]
+		}
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if net.ParseIP(addr) == nil {
+		return fmt.Errorf("resolve %q should pin an ip address", value)
+	}
+	r[host] = addr
+	return nil
+}
+
+// pin swaps the host of the address to dial for the one pinned to it, if any
+func (r resolveFlag) pin(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	host = strings.ToLower(host)
+	if addr, ok := r[net.JoinHostPort(host, port)]; ok {
+		return net.JoinHostPort(addr, port)
+	}
+	if addr, ok := r[host]; ok {
+		return net.JoinHostPort(addr, port)
+	}
+	return address
+}
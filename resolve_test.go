@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestResolveFlag(t *testing.T) {
+	tests := []struct {
+		value string
+		want  resolveFlag
+		err   bool
+	}{
+		{"api.example.com:443:10.0.0.1", resolveFlag{"api.example.com:443": "10.0.0.1"}, false},
+		{"API.example.com:10.0.0.2", resolveFlag{"api.example.com": "10.0.0.2"}, false},
+		{"api.example.com:443:[::1]", resolveFlag{"api.example.com:443": "::1"}, false},
+		{"api.example.com:::1", resolveFlag{"api.example.com": "::1"}, false},
+		{"api.example.com:443:backend", nil, true},
+		{"api.example.com", nil, true},
+		{":443:10.0.0.1", nil, true},
+	}
+	for _, test := range tests {
+		r := make(resolveFlag)
+		err := r.Set(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("Set(%q) error = %v", test.value, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(r, test.want) {
+			t.Errorf("Set(%q) = %v, want %v", test.value, r, test.want)
+		}
+	}
+}
+
+func TestResolvePin(t *testing.T) {
+	r := resolveFlag{"api.example.com:443": "10.0.0.1", "api.example.com": "::1"}
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"api.example.com:443", "10.0.0.1:443"},
+		{"API.example.com:80", "[::1]:80"},
+		{"other.example.com:443", "other.example.com:443"},
+		{"no port", "no port"},
+	}
+	for _, test := range tests {
+		if got := r.pin(test.address); got != test.want {
+			t.Errorf("pin(%q) = %q, want %q", test.address, got, test.want)
+		}
+	}
+	if lines := r.lines(); !reflect.DeepEqual(lines, []string{"api.example.com:::1", "api.example.com:443:10.0.0.1"}) {
+		t.Errorf("got lines %v", lines)
+	}
+}
+
+func TestTransportResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	r := make(resolveFlag)
+	if err := r.Set("backend.invalid:" + u.Port() + ":127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	opt := &Options{Timeout: 1, Transport: newTransport(SocketOptions{Resolve: r, IPVersion: 4})}
+	response := fire("http://backend.invalid:"+u.Port()+"/", &Cannonball{Method: "GET"}, nil, opt)
+	if !response.Success || string(response.raw) != "backend.invalid:"+u.Port() {
+		t.Errorf("got %+v", response)
+	}
+}
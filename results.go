@@ -0,0 +1,421 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunRecord : The command line a results file was recorded with
+type RunRecord struct {
+	Args     []string `json:"args"`
+	Endpoint string   `json:"endpoint"`
+}
+
+// TaskRecord : The start of a task from the schedule
+type TaskRecord struct {
+	Index       int    `json:"index"`
+	NumRequests int    `json:"num_requests"`
+	NumClients  int    `json:"num_clients"`
+	Payload     string `json:"payload,omitempty"`
+}
+
+// ResponseRecord : The outcome of a single request
+type ResponseRecord struct {
+	Task        int               `json:"task"`
+	Elapsed     float64           `json:"elapsed"`
+	Latency     float64           `json:"latency"`
+	Success     bool              `json:"success"`
+	Status      int               `json:"status,omitempty"`
+	Worker      int               `json:"worker"`
+	Target      string            `json:"target,omitempty"`
+	Backend     string            `json:"backend,omitempty"`
+	Host        string            `json:"host,omitempty"`
+	Label       string            `json:"label,omitempty"`
+	TraceID     string            `json:"trace_id,omitempty"`
+	RequestID   string            `json:"request_id,omitempty"`
+	Intended    *float64          `json:"intended,omitempty"`
+	Fired       *float64          `json:"fired,omitempty"`
+	Sent        int               `json:"sent,omitempty"`
+	Bytes       int               `json:"bytes,omitempty"`
+	Oversized   bool              `json:"oversized,omitempty"`
+	Class       string            `json:"class,omitempty"`
+	Compression *Compression      `json:"compression,omitempty"`
+	Extracted   map[string]string `json:"extracted,omitempty"`
+	Polls       int               `json:"polls,omitempty"`
+	Connection  string            `json:"connection,omitempty"`
+	DNS         *float64          `json:"dns,omitempty"`
+	CacheHit    bool              `json:"cache_hit,omitempty"`
+}
+
+// DoneRecord : The end of a task from the schedule
+type DoneRecord struct {
+	Task       int     `json:"task"`
+	Seconds    float64 `json:"seconds"`
+	NumWorkers int     `json:"num_workers"`
+}
+
+// Record : A single line of the results file, exactly one of the fields is set
+type Record struct {
+	Run      *RunRecord      `json:"run,omitempty"`
+	Task     *TaskRecord     `json:"task,omitempty"`
+	Response *ResponseRecord `json:"response,omitempty"`
+	Done     *DoneRecord     `json:"done,omitempty"`
+}
+
+// resultsWriter : Streams the records of a run into a newline-delimited JSON file
+type resultsWriter struct {
+	file    *os.File
+	buf     *bufio.Writer
+	encoder *json.Encoder
+}
+
+func createResults(path string, args []string, endpoint string) (*resultsWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufio.NewWriter(file)
+	w := &resultsWriter{file, buf, json.NewEncoder(buf)}
+	w.write(Record{Run: &RunRecord{Args: args, Endpoint: endpoint}})
+
+	return w, nil
+}
+
+func (w *resultsWriter) write(record Record) {
+	panicIf(w.encoder.Encode(&record))
+}
+
+// Task records the start of a task, it is safe to call on a nil writer
+func (w *resultsWriter) Task(index int, task *Task, payload string) {
+	if w != nil {
+		w.write(Record{Task: &TaskRecord{index, task.NumRequests, task.NumClients, payload}})
+	}
+}
+
+// Response records a single request with its moments relative to the start
+// of the task, it is safe to call on a nil writer
+func (w *resultsWriter) Response(task int, start time.Time, response *Response) {
+	if w != nil {
+		record := &ResponseRecord{
+			Task:        task,
+			Elapsed:     response.End.Sub(start).Seconds(),
+			Latency:     float64(response.Latency) / float64(time.Millisecond),
+			Success:     response.Success,
+			Status:      response.Status,
+			Worker:      response.Worker,
+			Target:      response.Target,
+			Backend:     response.Backend,
+			Host:        response.Host,
+			Label:       response.Label,
+			TraceID:     response.TraceID,
+			RequestID:   response.RequestID,
+			Sent:        response.Sent,
+			Bytes:       response.Bytes,
+			Oversized:   response.Oversized,
+			Class:       response.Class,
+			Compression: response.Compression,
+			Extracted:   response.Extracted,
+			Polls:       response.Polls,
+			CacheHit:    response.CacheHit,
+		}
+		if timing := response.Timing; timing.Connected {
+			record.Connection = "new"
+			if timing.Reused {
+				record.Connection = "reused"
+			}
+		}
+		if response.Timing.Lookup {
+			dns := float64(response.Timing.DNS) / float64(time.Millisecond)
+			record.DNS = &dns
+		}
+		if !response.Intended.IsZero() {
+			intended, fired := response.Intended.Sub(start).Seconds(), response.Fired.Sub(start).Seconds()
+			record.Intended, record.Fired = &intended, &fired
+		}
+		w.write(Record{Response: record})
+	}
+}
+
+// Done records the end of a task, it is safe to call on a nil writer
+func (w *resultsWriter) Done(task int, seconds float64, numWorkers int) {
+	if w != nil {
+		w.write(Record{Done: &DoneRecord{task, seconds, numWorkers}})
+		panicIf(w.buf.Flush())
+	}
+}
+
+// Close flushes the records and closes the file
+func (w *resultsWriter) Close() {
+	if w != nil {
+		panicIf(w.buf.Flush())
+		panicIf(w.file.Close())
+	}
+}
+
+// recordedTask : A task read back from a results file
+// recordedEpoch stands for the start of the recorded tasks, only the
+// differences between the moments relative to it are meaningful
+var recordedEpoch = time.Unix(0, 0)
+
+type recordedTask struct {
+	task      TaskRecord
+	responses []Response
+	done      *DoneRecord
+	elapsed   float64
+}
+
+// readResults loads the whole results file grouping the responses by task
+func readResults(path string) (*RunRecord, []*recordedTask, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var run *RunRecord
+	tasks := make([]*recordedTask, 0)
+	byIndex := make(map[int]*recordedTask)
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case record.Run != nil:
+			run = record.Run
+		case record.Task != nil:
+			task := &recordedTask{task: *record.Task}
+			tasks = append(tasks, task)
+			byIndex[task.task.Index] = task
+		case record.Response != nil:
+			r := record.Response
+			task, ok := byIndex[r.Task]
+			if !ok {
+				return nil, nil, fmt.Errorf("response of unknown task %d", r.Task)
+			}
+			task.elapsed = math.Max(task.elapsed, r.Elapsed)
+			response := Response{
+				Success:     r.Success,
+				Status:      r.Status,
+				Latency:     time.Duration(r.Latency * float64(time.Millisecond)),
+				End:         recordedEpoch.Add(time.Duration(r.Elapsed * float64(time.Second))),
+				Worker:      r.Worker,
+				Target:      r.Target,
+				Backend:     r.Backend,
+				Host:        r.Host,
+				Label:       r.Label,
+				TraceID:     r.TraceID,
+				RequestID:   r.RequestID,
+				Sent:        r.Sent,
+				Bytes:       r.Bytes,
+				Oversized:   r.Oversized,
+				Class:       r.Class,
+				Compression: r.Compression,
+				Extracted:   r.Extracted,
+				Polls:       r.Polls,
+				CacheHit:    r.CacheHit,
+				Timing:      Timing{Connected: r.Connection != "", Reused: r.Connection == "reused"},
+			}
+			if r.DNS != nil {
+				response.Timing.Lookup, response.Timing.DNS = true, time.Duration(*r.DNS*float64(time.Millisecond))
+			}
+			if r.Intended != nil && r.Fired != nil {
+				response.Intended = recordedEpoch.Add(time.Duration(*r.Intended * float64(time.Second)))
+				response.Fired = recordedEpoch.Add(time.Duration(*r.Fired * float64(time.Second)))
+			}
+			task.responses = append(task.responses, response)
+		case record.Done != nil:
+			if task, ok := byIndex[record.Done.Task]; ok {
+				task.done = record.Done
+			}
+		}
+	}
+	if run == nil {
+		return nil, nil, fmt.Errorf("%s is not a cannonade results file", path)
+	}
+
+	return run, tasks, nil
+}
+
+// summarize rebuilds the task summary from the recorded responses
+func (t *recordedTask) summarize(set percentileSet, heatmap time.Duration, threshold time.Duration) Summary {
+	targets := make(map[string]bool)
+	backends := false
+	// An interrupted run has no done record, it lasted at least until the last response
+	numWorkers, seconds := 0, t.elapsed
+	for _, response := range t.responses {
+		targets[response.Target] = true
+		backends = backends || response.Backend != ""
+		if response.Worker >= numWorkers {
+			numWorkers = response.Worker + 1
+		}
+	}
+	if t.done != nil {
+		seconds, numWorkers = t.done.Seconds, t.done.NumWorkers
+	}
+
+	collected := newCollector(len(targets) > 1, backends, false, set)
+	if heatmap > 0 {
+		collected.heatmap = newHeatmap(recordedEpoch, heatmap)
+	}
+	if threshold > 0 {
+		collected.apdex = newApdex(threshold)
+	}
+	for i := range t.responses {
+		collected.add(&t.responses[i])
+	}
+	summary := collected.summarize(seconds, t.task.NumClients, numWorkers)
+	summary.Payload = t.task.Payload
+	return summary
+}
+
+func reportCommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	format := fs.String("format", "text", "report format (text, markdown, json)")
+	templatePath := fs.String("template", "", "path of a text/template to render the report with")
+	reportPath := fs.String("report", "", "path of the file to write the report to")
+	percentiles := fs.String("percentiles", defaultPercentiles, "comma-separated latency percentiles to report")
+	withFailures := fs.Bool("include-failures", false, "count the latencies of the failed requests towards the stats")
+	exact := fs.Bool("exact-percentiles", false, "keep every latency for exact percentiles instead of a histogram past a million requests")
+	heatmap := fs.Duration("heatmap", 0, "add a heatmap of the latencies over time to the json report, in intervals of this long")
+	apdex := fs.Duration("apdex-threshold", 0, "report the apdex score of the requests satisfied within this latency (300ms)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade report [options...] <results.ndjson>\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() == 0 {
+		fmt.Println("Provide a results file to report on!")
+		return 1
+	}
+	set, err := parsePercentiles(*percentiles, *withFailures)
+	if err != nil {
+		fmt.Printf("Failed parsing the percentiles: %s\n", err)
+		return 1
+	}
+	set.exact = *exact
+
+	run, tasks, err := readResults(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed reading the results: %s\n", err)
+		return 1
+	}
+
+	renderer, closer, err := openReport(*format, *templatePath, *reportPath, false, os.Stdout)
+	if err != nil {
+		fmt.Printf("Failed preparing the report: %s\n", err)
+		return 1
+	}
+	defer closer.Close()
+
+	report := Report{Endpoint: run.Endpoint}
+	overall := newAccumulator(*exact)
+	for _, task := range tasks {
+		summary := task.summarize(set, *heatmap, *apdex)
+		report.Tasks = append(report.Tasks, summary)
+		panicIf(renderer.Task(&summary))
+		for i := range task.responses {
+			overall.Add(float64(task.responses[i].Latency)/math.Pow10(6), task.responses[i].Success)
+		}
+	}
+	if len(report.Tasks) > 1 {
+		report.Overall = combinePhases(overall, report.Tasks, set)
+	}
+	panicIf(renderer.Finish(&report))
+
+	return 0
+}
+
+func replayCommand(args []string) int {
+	fs, flags := newAttackFlagSet("replay")
+	endpoint := fs.String("endpoint", "", "endpoint to shoot at instead of the recorded one")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade replay [options...] <results.ndjson>\n"+
+			"       cannonade replay [options...] <corpus/> <url>\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() == 0 {
+		fmt.Println("Provide a results file or a corpus to replay!")
+		return 1
+	}
+
+	// Fire the recorded requests, by default each of them exactly once
+	if info, err := os.Stat(fs.Arg(0)); err == nil && info.IsDir() || objectURL(fs.Arg(0)) {
+		// The recorded args take the corpus as an option, resolved so that the
+		// results can be replayed from any working directory
+		corpus := fs.Arg(0)
+		if !objectURL(corpus) {
+			corpus, err = filepath.Abs(corpus)
+			panicIf(err)
+		}
+		panicIf(fs.Set("corpus", corpus))
+		positional := fs.Args()[1:]
+		if *endpoint != "" {
+			positional = []string{*endpoint}
+		}
+		return flags.attack(positional, nil)
+	}
+
+	run, _, err := readResults(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed reading the results: %s\n", err)
+		return 1
+	}
+
+	// Repeat the recorded command line with the options given now on top,
+	// but never overwrite the recorded results
+	afs, recorded := newAttackFlagSet("attack")
+	afs.Init("attack", flag.ContinueOnError)
+	if err := afs.Parse(run.Args); err != nil {
+		fmt.Printf("Failed parsing the recorded options: %s\n", err)
+		return 1
+	}
+	panicIf(afs.Set("results", ""))
+	fs.Visit(func(f *flag.Flag) {
+		if afs.Lookup(f.Name) != nil {
+			panicIf(afs.Set(f.Name, f.Value.String()))
+		}
+	})
+
+	positional := afs.Args()
+	if *endpoint != "" {
+		positional = append([]string{*endpoint}, afs.Args()[1:]...)
+	}
+	return recorded.attack(positional, nil)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// loadFailures reads the failures saved with -save-failures in the order they happened
+func loadFailures(dir string) ([]failureRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "[0-9]*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	records := make([]failureRecord, 0, len(paths))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var record failureRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no failures found in %s", dir)
+	}
+	return records, nil
+}
+
+// cannonball rebuilds the request with the headers as they were sent
+func (r *failureRecord) cannonball() *Cannonball {
+	return &Cannonball{Method: r.Request.Method, Path: r.Request.Path, Header: r.Request.Header, Body: r.Request.Body}
+}
+
+// retryFailures fires the failed requests once again one by one, those which
+// succeed now were flaky and those failing again most likely deterministic
+func retryFailures(w io.Writer, records []failureRecord, endpoint string, opt *Options) (flaky int, again int) {
+	for i := range records {
+		record := &records[i]
+		target := record.Request.Endpoint
+		if endpoint != "" {
+			target = endpoint
+		}
+		shot := *opt
+		shot.Protocol = record.Request.Protocol
+		response := fireOnce(target, record.cannonball(), &shot)
+
+		fmt.Fprintf(w, "#%d %s %s, was %s: ", record.Number, record.Request.Method, target, record.Class)
+		if response.Success {
+			flaky++
+			fmt.Fprintf(w, "%d %s in %.1f ms, flaky\n", response.Status, http.StatusText(response.Status),
+				millis(response.Latency))
+		} else {
+			again++
+			fmt.Fprintf(w, "%s in %.1f ms, failed again\n", response.Class, millis(response.Latency))
+		}
+		fmt.Fprintf(w, "%s\n\n", response.Body)
+	}
+	fmt.Fprintf(w, "Retried %d failures: %d flaky, %d failed again\n", len(records), flaky, again)
+	return flaky, again
+}
+
+func retryFailuresCommand(args []string) int {
+	fs := flag.NewFlagSet("retry-failures", flag.ExitOnError)
+	endpoint := fs.String("endpoint", "", "endpoint to shoot at instead of the recorded one")
+	timeout := fs.Float64("timeout", defaultTimeout, "request timeout limit in seconds")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: cannonade retry-failures [options...] <failures/>\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	panicIf(fs.Parse(args))
+	if fs.NArg() == 0 {
+		fmt.Println("Provide the directory of the saved failures to retry!")
+		return 1
+	}
+
+	records, err := loadFailures(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Failed reading the failures: %s\n", err)
+		return 1
+	}
+	opt := Options{Timeout: *timeout, Transport: newTransport(SocketOptions{})}
+	if _, again := retryFailures(os.Stdout, records, *endpoint, &opt); again > 0 {
+		return 1
+	}
+	return 0
+}
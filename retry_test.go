@@ -0,0 +1,84 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRetryFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "broken" || r.Header.Get("X-Key") != "secret" {
+			http.Error(w, "bad input", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	failures, err := createFailureLog(dir, protocolHTTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"X-Key": {"secret"}}
+	for _, body := range []string{"fine", "broken", "fine"} {
+		ball := &Cannonball{Method: "POST", Path: "/predict", Body: []byte(body)}
+		response := Response{Status: 503, Class: statusClass(503), ball: ball, endpoint: server.URL,
+			Detail: &Detail{URL: server.URL + "/predict", RequestHeader: header}}
+		panicIf(failures.Save(0, &response))
+	}
+
+	records, err := loadFailures(dir)
+	if err != nil {
+		t.Fatalf("loadFailures() failed: %s", err)
+	}
+	var out bytes.Buffer
+	opt := Options{Timeout: 5, Transport: newTransport(SocketOptions{})}
+	flaky, again := retryFailures(&out, records, "", &opt)
+	if flaky != 2 || again != 1 {
+		t.Errorf("retryFailures() = %d flaky, %d again, want 2 and 1", flaky, again)
+	}
+	for _, want := range []string{
+		"#1 POST " + server.URL + ", was http 503: 200 OK in",
+		"#2 POST " + server.URL + ", was http 503: http 400 in",
+		"Retried 3 failures: 2 flaky, 1 failed again\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q has no %q", out.String(), want)
+		}
+	}
+
+	if _, err := loadFailures(os.TempDir() + "/no-such-failures"); err == nil {
+		t.Errorf("loadFailures() of a missing directory passed")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// Step : A request of the scenario, its path, body and header values may
+// refer to the values extracted by the steps before as {{name}}
+type Step struct {
+	Name    string            `json:"name"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Header  map[string]string `json:"header"`
+	Body    string            `json:"body"`
+	Payload bool              `json:"payload"`
+	Extract map[string]string `json:"extract"`
+
+	extracts []extraction
+}
+
+func (s *Step) label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Method + " " + s.Path
+}
+
+// Scenario : The steps every client goes through one after another, over and over
+type Scenario struct {
+	Steps []*Step `json:"steps"`
+}
+
+// loadScenario reads a json scenario file and checks its steps, the columns
+// of the data feed are known from the start and the values captured from
+// every response after the first one
+func loadScenario(path string, columns []string, captures []extraction) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, err
+	}
+	if err := scenario.compile(columns, captures); err != nil {
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+// compile makes sure every step only refers to the values extracted before it
+func (s *Scenario) compile(columns []string, captures []extraction) error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario has no steps")
+	}
+	known := make(map[string]bool)
+	for _, column := range columns {
+		known[column] = true
+	}
+	for _, step := range s.Steps {
+		if step.Method == "" {
+			step.Method = "GET"
+			if step.Body != "" || step.Payload {
+				step.Method = "POST"
+			}
+		}
+		templates := []string{step.Path, step.Body}
+		for _, value := range step.Header {
+			templates = append(templates, value)
+		}
+		for _, template := range templates {
+			for _, name := range placeholders(template) {
+				call, err := checkCall(name, known)
+				if err != nil {
+					return fmt.Errorf("%s: {{%s}}: %s", step.label(), name, err)
+				}
+				if !call && !known[name] {
+					return fmt.Errorf("%s refers to {{%s}} before it is extracted", step.label(), name)
+				}
+			}
+		}
+		extracts, err := compileExtracts(step.Extract)
+		if err != nil {
+			return fmt.Errorf("%s: %s", step.label(), err)
+		}
+		step.extracts = extracts
+		for name := range step.Extract {
+			known[name] = true
+		}
+		for _, capture := range captures {
+			known[capture.name] = true
+		}
+	}
+	return nil
+}
+
+func (s *Scenario) String() string {
+	labels := make([]string, len(s.Steps))
+	for i, step := range s.Steps {
+		labels[i] = step.label()
+	}
+	return strings.Join(labels, " -> ")
+}
+
+// virtualUser : A client going through the scenario with the values it extracted so far
+type virtualUser struct {
+	scenario *Scenario
+	step     int
+	vars     map[string]string
+}
+
+func newVirtualUser(scenario *Scenario) *virtualUser {
+	return &virtualUser{scenario: scenario, vars: make(map[string]string)}
+}
+
+// next builds the request of the current step, the payload steps send the
+// shot cannonball, every run through the scenario takes a row of the feed
+func (u *virtualUser) next(shot *Cannonball, feed *dataFeed, rnd *rand.Rand) *Cannonball {
+	if u.step == 0 {
+		for name, value := range feed.row(rnd) {
+			u.vars[name] = value
+		}
+	}
+	step := u.scenario.Steps[u.step]
+	ball := &Cannonball{Method: step.Method, Label: step.label()}
+	var err error
+	// The scenario is checked up front, so every value is always there
+	ball.Path, err = expand(step.Path, u.vars, rnd)
+	panicIf(err)
+	if step.Payload {
+		ball.Body, ball.Header, ball.RawSize = shot.Body, shot.Header.Clone(), shot.RawSize
+	} else if step.Body != "" {
+		body, err := expand(step.Body, u.vars, rnd)
+		panicIf(err)
+		ball.Body = []byte(body)
+	}
+	if len(step.Header) > 0 && ball.Header == nil {
+		ball.Header = make(http.Header)
+	}
+	for key, template := range step.Header {
+		value, err := expand(template, u.vars, rnd)
+		panicIf(err)
+		ball.Header.Set(key, value)
+	}
+	return ball
+}
+
+// advance captures the values from the response and moves on to the next
+// step, a failed step or a value missing from its response starts over
+func (u *virtualUser) advance(response *Response, opt *Options) {
+	extractValues(response, u.scenario.Steps[u.step].extracts, opt)
+	extractValues(response, opt.Extract, opt)
+	for name, value := range response.Extracted {
+		u.vars[name] = value
+	}
+	u.step++
+	if !response.Success || u.step == len(u.scenario.Steps) {
+		u.step = 0
+		u.vars = make(map[string]string)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestScenarioCompile(t *testing.T) {
+	tests := []struct {
+		steps []*Step
+		fails string
+	}{
+		{nil, "scenario has no steps"},
+		{[]*Step{{Path: "/jobs/{{id}}"}}, "GET /jobs/{{id}} refers to {{id}} before it is extracted"},
+		{[]*Step{{Name: "login", Extract: map[string]string{"token": "token"}}}, "login: path \"token\""},
+		{[]*Step{
+			{Name: "poll", Header: map[string]string{"Authorization": "Bearer {{token}}"}},
+			{Name: "login", Extract: map[string]string{"token": "$.token"}},
+		}, "poll refers to {{token}}"},
+		{[]*Step{
+			{Name: "login", Body: `{"user": "me"}`, Extract: map[string]string{"token": "$.token"}},
+			{Name: "poll", Path: "/jobs?token={{token}}"},
+		}, ""},
+	}
+	for i, test := range tests {
+		err := (&Scenario{Steps: test.steps}).compile(nil, nil)
+		switch {
+		case test.fails == "" && err != nil:
+			t.Errorf("#%d: got %s", i, err)
+		case test.fails != "" && (err == nil || !strings.HasPrefix(err.Error(), test.fails)):
+			t.Errorf("#%d: got %v, want %s", i, err, test.fails)
+		}
+	}
+
+	captures, _ := parseExtracts("request=$.request_id")
+	steps := []*Step{{Name: "first", Path: "/{{request}}"}}
+	if err := (&Scenario{Steps: steps}).compile(nil, captures); err == nil {
+		t.Errorf("got no error for a capture referred to by the first step")
+	}
+	if err := (&Scenario{Steps: steps}).compile([]string{"request"}, nil); err != nil {
+		t.Errorf("got %s for a column of the data feed", err)
+	}
+	steps = append([]*Step{{Name: "start"}}, steps...)
+	if err := (&Scenario{Steps: steps}).compile(nil, captures); err != nil {
+		t.Errorf("got %s for a capture referred to after the first step", err)
+	}
+}
+
+func TestVirtualUser(t *testing.T) {
+	var jobs, rejected int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login" && r.Method == "POST":
+			fmt.Fprint(w, `{"token": "t1"}`)
+		case r.URL.Path == "/predict" && r.Header.Get("Authorization") == "Bearer t1":
+			// The very first upload is refused to make the client start over
+			if atomic.AddInt32(&rejected, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, `{"job": {"id": "j%d"}}`, atomic.AddInt32(&jobs, 1))
+		case strings.HasPrefix(r.URL.Path, "/jobs/"):
+			fmt.Fprintf(w, `{"status": "done", "id": %q}`, strings.TrimPrefix(r.URL.Path, "/jobs/"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	scenario := &Scenario{Steps: []*Step{
+		{Name: "login", Path: "/login", Body: `{"user": "me"}`, Extract: map[string]string{"token": "$.token"}},
+		{Name: "upload", Path: "/predict", Payload: true, Header: map[string]string{"Authorization": "Bearer {{token}}"},
+			Extract: map[string]string{"job": "$.job.id"}},
+		{Name: "poll", Path: "/jobs/{{job}}", Extract: map[string]string{"status": "$.status", "missing": "$.nope"}},
+	}}
+	if err := scenario.compile(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	opt := &Options{Timeout: 5, Transport: newTransport(SocketOptions{NoDelay: true})}
+	user := newVirtualUser(scenario)
+	shot := &Cannonball{Method: "POST", Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"image": ""}`)}
+	want := []struct {
+		label   string
+		success bool
+		class   string
+	}{
+		{"login", true, ""},
+		{"upload", false, statusClass(http.StatusServiceUnavailable)},
+		{"login", true, ""},
+		{"upload", true, ""},
+		{"poll", false, classExtract},
+		{"login", true, ""},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i, step := range want {
+		ball := user.next(shot, nil, rnd)
+		response := fire(server.URL, ball, nil, opt)
+		user.advance(&response, opt)
+		if ball.Label != step.label || response.Success != step.success || response.Class != step.class {
+			t.Errorf("#%d: got %s with success %v, class %q (%s), want %s", i, ball.Label, response.Success,
+				response.Class, response.Body, step.label)
+		}
+		if ball.Label == "poll" && ball.Path != "/jobs/j1" {
+			t.Errorf("#%d: got poll of %s", i, ball.Path)
+		}
+	}
+	if shot.Header.Get("Authorization") != "" {
+		t.Errorf("got the shot cannonball header changed")
+	}
+}
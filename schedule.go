@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Milestone : A single step of the schedule along with its payload mix
+type Milestone struct {
+	NumRequests int
+	NumClients  int
+	Noise       float64
+	Scale       float64
+	Batch       int
+}
+
+// Payload describes the payload mix of the milestone, empty when it is the default one
+func (m *Milestone) Payload() string {
+	parts := make([]string, 0)
+	if m.Noise > 0 {
+		parts = append(parts, fmt.Sprintf("noise=%g", m.Noise))
+	}
+	if m.Scale != 1 {
+		parts = append(parts, fmt.Sprintf("scale=%g", m.Scale))
+	}
+	if m.Batch != 1 {
+		parts = append(parts, fmt.Sprintf("batch=%d", m.Batch))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSchedule reads milestones like 100@8 or 100@8:noise=0.5:scale=0.25:batch=4,
+// the noise share defaults to the given one
+func parseSchedule(schedule string, noise float64) ([]Milestone, error) {
+	milestones := make([]Milestone, 0)
+	for _, spec := range strings.Split(schedule, ",") {
+		parts := strings.Split(spec, ":")
+		load := strings.Split(parts[0], "@")
+		if len(load) != 2 {
+			return nil, fmt.Errorf("milestone %q is not in requests@clients form", spec)
+		}
+
+		milestone := Milestone{Noise: noise, Scale: 1, Batch: 1}
+		var err error
+		if milestone.NumRequests, err = strconv.Atoi(load[0]); err != nil || milestone.NumRequests < 1 {
+			return nil, fmt.Errorf("invalid number of requests in %q", spec)
+		}
+		if milestone.NumClients, err = strconv.Atoi(load[1]); err != nil || milestone.NumClients < 1 {
+			return nil, fmt.Errorf("invalid number of clients in %q", spec)
+		}
+
+		for _, option := range parts[1:] {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("option %q of %q is not in key=value form", option, spec)
+			}
+			switch kv[0] {
+			case "noise":
+				milestone.Noise, err = strconv.ParseFloat(kv[1], 64)
+				if err == nil && (milestone.Noise < 0 || milestone.Noise > 1) {
+					err = fmt.Errorf("out of range")
+				}
+			case "scale":
+				milestone.Scale, err = strconv.ParseFloat(kv[1], 64)
+				if err == nil && milestone.Scale <= 0 {
+					err = fmt.Errorf("out of range")
+				}
+			case "batch":
+				milestone.Batch, err = strconv.Atoi(kv[1])
+				if err == nil && milestone.Batch < 1 {
+					err = fmt.Errorf("out of range")
+				}
+			default:
+				err = fmt.Errorf("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s in %q: %s", kv[0], spec, err)
+			}
+		}
+
+		milestones = append(milestones, milestone)
+	}
+	return milestones, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		noise    float64
+		want     []Milestone
+	}{
+		{"100@8", 0, []Milestone{{100, 8, 0, 1, 1}}},
+		{"100@8", 1, []Milestone{{100, 8, 1, 1, 1}}},
+		{"10@1,100@8:noise=0.5", 0, []Milestone{{10, 1, 0, 1, 1}, {100, 8, 0.5, 1, 1}}},
+		{"50@4:scale=0.25:batch=4:noise=0", 1, []Milestone{{50, 4, 0, 0.25, 4}}},
+	}
+	for _, test := range tests {
+		got, err := parseSchedule(test.schedule, test.noise)
+		if err != nil {
+			t.Errorf("parseSchedule(%q) failed: %s", test.schedule, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSchedule(%q) = %+v, want %+v", test.schedule, got, test.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, schedule := range []string{
+		"", "100", "100@", "@8", "0@8", "100@0", "x@8", "100@8,",
+		"100@8:noise", "100@8:noise=2", "100@8:scale=0", "100@8:batch=0", "100@8:gamma=1",
+	} {
+		if _, err := parseSchedule(schedule, 0); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want an error", schedule)
+		}
+	}
+}
+
+func TestMilestonePayload(t *testing.T) {
+	tests := []struct {
+		milestone Milestone
+		want      string
+	}{
+		{Milestone{Scale: 1, Batch: 1}, ""},
+		{Milestone{Noise: 0.5, Scale: 1, Batch: 1}, "noise=0.5"},
+		{Milestone{Noise: 1, Scale: 0.5, Batch: 4}, "noise=1 scale=0.5 batch=4"},
+	}
+	for _, test := range tests {
+		if got := test.milestone.Payload(); got != test.want {
+			t.Errorf("%+v.Payload() = %q, want %q", test.milestone, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// lateThreshold is the scheduling error above which a request counts as sent late
+const lateThreshold = 1.0
+
+// Scheduling : How far behind their intended moments the requests were actually sent
+type Scheduling struct {
+	Mean   Millis `json:"mean"`
+	Median Millis `json:"median"`
+	P90    Millis `json:"p90"`
+	P99    Millis `json:"p99"`
+	Max    Millis `json:"max"`
+	Late   int    `json:"late"`
+}
+
+// schedulingStats : The scheduling errors of a task in milliseconds, folded
+// into histograms like the latencies past a million requests
+type schedulingStats struct {
+	lags *latency.Accumulator
+	late int
+}
+
+func newSchedulingStats(exact bool) *schedulingStats {
+	return &schedulingStats{lags: newAccumulator(exact)}
+}
+
+func (s *schedulingStats) add(lag float64) {
+	s.lags.Add(lag, true)
+	if lag > lateThreshold {
+		s.late++
+	}
+}
+
+// summarize the scheduling errors, nil when no request had an intended moment
+func (s *schedulingStats) summarize() *Scheduling {
+	if s.lags.Count() == 0 {
+		return nil
+	}
+	stats := s.lags.Stats(90, 99)
+	return &Scheduling{Millis(stats.Mean), Millis(stats.Median), Millis(stats.Percentiles[0]),
+		Millis(stats.Percentiles[1]), Millis(stats.Max), s.late}
+}
+
+func printScheduling(w io.Writer, scheduling *Scheduling, numRequests int) {
+	fmt.Fprintf(w, "Scheduling error: mean %.2f ms, median %.2f, 90%% %.2f, 99%% %.2f, max %.2f\n",
+		scheduling.Mean, scheduling.Median, scheduling.P90, scheduling.P99, scheduling.Max)
+	fmt.Fprintf(w, "Sent late by over %g ms: %d of %d requests", lateThreshold, scheduling.Late, numRequests)
+	if scheduling.Late*10 > numRequests {
+		fmt.Fprint(w, ", the generator did not keep up with the requested load")
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+func TestAnalyzeScheduling(t *testing.T) {
+	if newSchedulingStats(false).summarize() != nil {
+		t.Error("scheduling of no requests is not nil")
+	}
+	lags := newSchedulingStats(false)
+	for _, lag := range []float64{0, 0.5, 1, 2, 10} {
+		lags.add(lag)
+	}
+	scheduling := lags.summarize()
+	if scheduling.Mean != 2.7 || scheduling.Median != 1 || scheduling.Max != 10 || scheduling.Late != 2 {
+		t.Errorf("scheduling = %+v, want mean 2.7, median 1, max 10 and 2 late", scheduling)
+	}
+}
+
+func TestSchedulingFolded(t *testing.T) {
+	// A soak keeps no more than a million lags as they are
+	lags := newSchedulingStats(false)
+	for i := 0; i <= latency.DefaultMaxSamples; i++ {
+		lags.add(float64(i % 4))
+	}
+	scheduling := lags.summarize()
+	if !lags.lags.Folded() || scheduling.Max != 3 || scheduling.Late != (latency.DefaultMaxSamples/4)*2 {
+		t.Errorf("got folded %v, %+v", lags.lags.Folded(), scheduling)
+	}
+}
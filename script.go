@@ -0,0 +1,176 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// script : The Lua hooks around every request, compiled once and then run
+// by every client in a state of its own
+type script struct {
+	path  string
+	proto *lua.FunctionProto
+}
+
+// loadScript compiles the script and checks it defines at least one of the hooks
+func loadScript(path string) (*script, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	chunk, err := parse.Parse(file, path)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &script{path: path, proto: proto}
+	state, err := s.instance()
+	if err != nil {
+		return nil, err
+	}
+	defer state.close()
+	if state.before == nil && state.after == nil {
+		return nil, fmt.Errorf("%s defines neither before_request nor after_response", path)
+	}
+	return s, nil
+}
+
+// scriptState : A running copy of the script, owned by a single client
+type scriptState struct {
+	L      *lua.LState
+	before *lua.LFunction
+	after  *lua.LFunction
+}
+
+func (s *script) instance() (*scriptState, error) {
+	L := lua.NewState()
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, err
+	}
+	state := &scriptState{L: L}
+	state.before, _ = L.GetGlobal("before_request").(*lua.LFunction)
+	state.after, _ = L.GetGlobal("after_response").(*lua.LFunction)
+	return state, nil
+}
+
+func (s *scriptState) close() {
+	s.L.Close()
+}
+
+// beforeRequest hands the request to before_request as a table of its method,
+// path, headers and body, as they are about to be sent, and takes the changes back
+func (s *scriptState) beforeRequest(ball *Cannonball) *Cannonball {
+	if s.before == nil || ball.err != nil {
+		return ball
+	}
+	req := s.L.NewTable()
+	req.RawSetString("method", lua.LString(ball.Method))
+	req.RawSetString("path", lua.LString(ball.Path))
+	req.RawSetString("body", lua.LString(ball.Body))
+	req.RawSetString("headers", headerTable(s.L, ball.Header))
+	if err := s.L.CallByParam(lua.P{Fn: s.before, NRet: 0, Protect: true}, req); err != nil {
+		return &Cannonball{err: fmt.Errorf("before_request: %s", err)}
+	}
+
+	// The cannonballs are shared between the requests, the changes go to a copy
+	next := *ball
+	next.Method = lua.LVAsString(req.RawGetString("method"))
+	next.Path = lua.LVAsString(req.RawGetString("path"))
+	next.Body = []byte(lua.LVAsString(req.RawGetString("body")))
+	next.Header = make(http.Header)
+	if headers, ok := req.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(name lua.LValue, value lua.LValue) {
+			next.Header.Set(name.String(), value.String())
+		})
+	}
+	return &next
+}
+
+// afterResponse hands the response to after_response as a table of its status,
+// headers, body, latency in ms and success. The hook may return false and a
+// message to fail it, or true to pass a response with an unexpected status.
+func (s *scriptState) afterResponse(response *Response, opt *Options) {
+	if s.after == nil {
+		return
+	}
+	if response.raw != nil && response.encoding != "" {
+		decompress(response, opt)
+	}
+	body := response.Body
+	if response.raw != nil {
+		body = string(response.raw)
+	}
+	resp := s.L.NewTable()
+	resp.RawSetString("status", lua.LNumber(response.Status))
+	resp.RawSetString("body", lua.LString(body))
+	resp.RawSetString("latency", lua.LNumber(millis(response.Latency)))
+	resp.RawSetString("success", lua.LBool(response.Success))
+	if response.Detail != nil {
+		resp.RawSetString("headers", headerTable(s.L, response.Detail.ResponseHeader))
+	}
+
+	reject := func(message string) {
+		response.Success, response.Class, response.Body = false, classScript, message
+		response.raw = nil
+	}
+	if err := s.L.CallByParam(lua.P{Fn: s.after, NRet: 2, Protect: true}, resp); err != nil {
+		reject(fmt.Sprintf("Error in after_response: %s", err))
+		return
+	}
+	verdict, message := s.L.Get(-2), s.L.Get(-1)
+	s.L.Pop(2)
+	switch {
+	case verdict == lua.LFalse && response.Success:
+		if message == lua.LNil {
+			message = lua.LString("rejected")
+		}
+		reject(fmt.Sprintf("Rejected by after_response: %s", message))
+	case verdict == lua.LTrue && !response.Success && response.Class == statusClass(response.Status):
+		response.Success, response.Class = true, ""
+	}
+}
+
+// headerTable passes the first value of every header on, by its canonical name
+func headerTable(L *lua.LState, header http.Header) *lua.LTable {
+	table := L.NewTable()
+	for name, values := range header {
+		if len(values) > 0 {
+			table.RawSetString(name, lua.LString(values[0]))
+		}
+	}
+	return table
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeScript(t *testing.T, dir string, source string) string {
+	path := filepath.Join(dir, "hooks.lua")
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"function before_request(req) end", ""},
+		{"function after_response(resp) end", ""},
+		{"local x = 1", "defines neither before_request nor after_response"},
+		{"function before_request(req", "syntax error"},
+		{"error('boom')", "boom"},
+	}
+	for _, test := range tests {
+		_, err := loadScript(writeScript(t, dir, test.source))
+		if test.want == "" && err != nil || test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+			t.Errorf("loadScript(%q) = %v, want %q", test.source, err, test.want)
+		}
+	}
+	if _, err := loadScript(filepath.Join(dir, "missing.lua")); err == nil {
+		t.Errorf("loadScript() of a missing file passed")
+	}
+}
+
+func TestScriptBeforeRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hooks, err := loadScript(writeScript(t, dir, `
+local n = 0
+function before_request(req)
+  n = n + 1
+  if req.method == "DELETE" then error("not allowed") end
+  req.headers["X-Signature"] = req.method .. " " .. req.path .. " " .. #req.body .. " " .. n
+  req.headers["X-Drop"] = nil
+  req.path = req.path .. "?signed=1"
+end`))
+	if err != nil {
+		t.Fatalf("loadScript() failed: %s", err)
+	}
+	state, err := hooks.instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.close()
+
+	ball := &Cannonball{Method: "POST", Path: "/v1", Header: http.Header{"X-Drop": {"1"}}, Body: []byte("{}")}
+	want := []http.Header{{"X-Signature": {"POST /v1 2 1"}}, {"X-Signature": {"POST /v1 2 2"}}}
+	for _, header := range want {
+		got := state.beforeRequest(ball)
+		if got.err != nil || got.Path != "/v1?signed=1" || !reflect.DeepEqual(got.Header, header) {
+			t.Errorf("beforeRequest() = %+v, want %v", got, header)
+		}
+	}
+	if ball.Path != "/v1" || len(ball.Header) != 1 {
+		t.Errorf("beforeRequest() changed the shared cannonball to %+v", ball)
+	}
+	if got := state.beforeRequest(&Cannonball{Method: "DELETE"}); got.err == nil || !strings.Contains(got.err.Error(), "not allowed") {
+		t.Errorf("beforeRequest() of a failing hook = %+v", got)
+	}
+}
+
+func TestScriptAfterResponse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hooks, err := loadScript(writeScript(t, dir, `
+function after_response(resp)
+  if resp.status == 404 then return true end
+  if resp.headers and resp.headers["X-Crash"] then error("crashed") end
+  if resp.latency > 100 then return false, "too slow" end
+  if not string.find(resp.body, "label") then return false end
+end`))
+	if err != nil {
+		t.Fatalf("loadScript() failed: %s", err)
+	}
+	state, err := hooks.instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.close()
+
+	ok := func(body string) Response {
+		return Response{Success: true, Status: 200, raw: []byte(body), Latency: 10 * time.Millisecond}
+	}
+	tests := []struct {
+		response Response
+		success  bool
+		class    string
+		body     string
+	}{
+		{ok(`{"label": "cat"}`), true, "", ""},
+		{Response{Success: true, Status: 200, raw: []byte("{}"), Latency: 200 * time.Millisecond}, false, classScript,
+			"Rejected by after_response: too slow"},
+		{ok("{}"), false, classScript, "Rejected by after_response: rejected"},
+		{Response{Status: 404, Class: statusClass(404), raw: []byte("not found")}, true, "", ""},
+		{Response{Status: 500, Class: statusClass(500), raw: []byte("label")}, false, "http 500", ""},
+		{Response{Body: "Error while sending the request: refused", Class: classRefused}, false, classRefused,
+			"Error while sending the request: refused"},
+		{Response{Success: true, Status: 200, raw: []byte("label"), Detail: &Detail{ResponseHeader: http.Header{"X-Crash": {"1"}}}},
+			false, classScript, "Error in after_response: "},
+	}
+	for _, test := range tests {
+		response := test.response
+		state.afterResponse(&response, &Options{})
+		if response.Success != test.success || response.Class != test.class || !strings.HasPrefix(response.Body, test.body) {
+			t.Errorf("afterResponse(%q) = %v %q %q, want %v %q %q", test.response.raw, response.Success, response.Class,
+				response.Body, test.success, test.class, test.body)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// The streams of randomness of a run, apart so that no two of them repeat
+// each other under the same seed, the workers and the producers count from
+// theirs
+const (
+	streamWorkers   = 0
+	streamProducers = 1 << 20
+	streamConsole   = 2 << 20
+	streamArrivals  = 3 << 20
+	streamImage     = 4 << 20
+	streamMock      = 5 << 20
+)
+
+// randomness : The seed of a run every one of its streams of randomness
+// starts from, the clock unless the run has a fixed one with -seed. Each run
+// of the parallel command has its own, so that no run reseeds another
+type randomness struct {
+	seed int64
+}
+
+func newRandomness(seed int64) *randomness {
+	return &randomness{seed: seed}
+}
+
+// stream makes the source of randomness of the stream, it is safe to call on
+// a nil randomness, which seeds every stream from the clock
+func (r *randomness) stream(stream int64) *rand.Rand {
+	seed := time.Now().UnixNano()
+	if r != nil {
+		seed = r.seed
+	}
+	return rand.New(rand.NewSource(seed + stream))
+}
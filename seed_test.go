@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"sync"
+	"testing"
+)
+
+func TestRandomnessStreams(t *testing.T) {
+	random := newRandomness(42)
+	tests := []struct {
+		a, b int64
+		same bool
+	}{
+		{a: streamWorkers, b: streamWorkers, same: true},
+		{a: streamWorkers, b: streamWorkers + 1, same: false},
+		{a: streamWorkers, b: streamProducers, same: false},
+	}
+	for _, test := range tests {
+		a, b := random.stream(test.a).Int63(), random.stream(test.b).Int63()
+		if (a == b) != test.same {
+			t.Errorf("streams %d and %d: got %d and %d", test.a, test.b, a, b)
+		}
+	}
+	first, _ := expand("{{rand_int 1 1000000}}", nil, random.stream(streamWorkers))
+	if again, _ := expand("{{rand_int 1 1000000}}", nil, newRandomness(42).stream(streamWorkers)); again != first {
+		t.Errorf("got rand_int %s, then %s under the same seed", first, again)
+	}
+	var clock *randomness
+	if clock.stream(streamWorkers) == nil {
+		t.Errorf("got no stream without a seed")
+	}
+}
+
+func TestSeededPayloads(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	produce := func(seed int64) [][]byte {
+		task := &Task{Image: img, Scale: 1, Batch: 1, Noise: 1, NumRequests: 4,
+			Encoding: Encoding{Format: formatPNG}}
+		opt := &Options{Producers: 1, Random: newRandomness(seed)}
+		bodies := make([][]byte, 0, task.NumRequests)
+		for ball := range producePayloads(task, opt, 1, make(chan struct{})) {
+			bodies = append(bodies, ball.Body)
+		}
+		return bodies
+	}
+	first, again := produce(7), produce(7)
+	for i := range first {
+		if !bytes.Equal(first[i], again[i]) {
+			t.Errorf("#%d: got another payload under the same seed", i)
+		}
+		if i > 0 && bytes.Equal(first[i], first[i-1]) {
+			t.Errorf("#%d: got the payload of the request before it", i)
+		}
+	}
+
+	// The runs of the parallel command keep to their own seeds side by side
+	other := produce(8)
+	var wg sync.WaitGroup
+	side := make([][][]byte, 2)
+	for i, seed := range []int64{7, 8} {
+		wg.Add(1)
+		go func(i int, seed int64) {
+			defer wg.Done()
+			side[i] = produce(seed)
+		}(i, seed)
+	}
+	wg.Wait()
+	for i := range first {
+		if !bytes.Equal(side[0][i], first[i]) || !bytes.Equal(side[1][i], other[i]) {
+			t.Errorf("#%d: got other payloads running next to another seeded run", i)
+		}
+	}
+}
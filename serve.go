@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+)
+
+const defaultListen = "127.0.0.1:7070"
+
+// controlHandler exposes the run control over HTTP:
+// POST /control with a command as the body and GET /status
+func controlHandler(ctl *Control) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "use POST with a command as the body", http.StatusMethodNotAllowed)
+			return
+		}
+		command, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ctl.Apply(string(command)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeStatus(w, ctl)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, ctl)
+	})
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, ctl *Control) {
+	w.Header().Set("Content-Type", "application/json")
+	panicIf(json.NewEncoder(w).Encode(ctl.Status()))
+}
+
+func serveCommand(args []string) int {
+	fs, flags := newAttackFlagSet("serve")
+	listen := fs.String("listen", defaultListen, "address of the http control api")
+	panicIf(fs.Parse(args))
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Printf("Failed starting the control api: %s\n", err)
+		return 1
+	}
+	defer listener.Close()
+
+	return flags.attack(fs.Args(), func(ctl *Control) {
+		if !*flags.silent {
+			fmt.Fprintf(os.Stderr, "Control api is listening on http://%s\n", listener.Addr())
+		}
+		go func() {
+			// The listener is closed once the attack is over
+			_ = http.Serve(listener, controlHandler(ctl))
+		}()
+	})
+}
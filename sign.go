@@ -0,0 +1,93 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var signAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+// signer : An HMAC of every request body put in a header, over the unix time
+// of the request and the body when the time goes in a header of its own
+type signer struct {
+	algorithm string
+	hash      func() hash.Hash
+	secret    []byte
+	header    string
+	timestamp string
+	now       func() time.Time
+}
+
+// parseSign reads a signing spec: hmac-sha256:SECRET:X-Signature[:X-Timestamp]
+func parseSign(spec string) (*signer, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 3 || len(parts) > 4 || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("bad signing %q, expected hmac-sha256:SECRET:Header[:TimestampHeader]", spec)
+	}
+	algorithm, ok := signAlgorithms[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing algorithm %q (hmac-sha1, hmac-sha256, hmac-sha512)", parts[0])
+	}
+	s := &signer{algorithm: parts[0], hash: algorithm, secret: []byte(parts[1]),
+		header: http.CanonicalHeaderKey(parts[2]), now: time.Now}
+	if len(parts) == 4 {
+		if parts[3] == "" {
+			return nil, fmt.Errorf("bad signing %q, the timestamp header is empty", spec)
+		}
+		s.timestamp = http.CanonicalHeaderKey(parts[3])
+	}
+	return s, nil
+}
+
+// Sign puts the hex signature of the body as sent in the header, the
+// signed message is the timestamp, a dot and the body when there is one
+func (s *signer) Sign(req *http.Request, body []byte) {
+	mac := hmac.New(s.hash, s.secret)
+	if s.timestamp != "" {
+		timestamp := strconv.FormatInt(s.now().Unix(), 10)
+		req.Header.Set(s.timestamp, timestamp)
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	req.Header.Set(s.header, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (s *signer) String() string {
+	if s.timestamp != "" {
+		return fmt.Sprintf("%s in %s over the time in %s and the body", s.algorithm, s.header, s.timestamp)
+	}
+	return fmt.Sprintf("%s in %s over the body", s.algorithm, s.header)
+}
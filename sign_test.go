@@ -0,0 +1,85 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseSign(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  string
+		fails bool
+	}{
+		{"hmac-sha256:key:X-Signature", "hmac-sha256 in X-Signature over the body", false},
+		{"hmac-sha1:key:x-hub-signature:x-timestamp", "hmac-sha1 in X-Hub-Signature over the time in X-Timestamp and the body", false},
+		{"hmac-md5:key:X-Signature", "", true},
+		{"hmac-sha256:key", "", true},
+		{"hmac-sha256::X-Signature", "", true},
+		{"hmac-sha256:key:X-Signature:", "", true},
+		{"hmac-sha256:key:X-Signature:X-Timestamp:extra", "", true},
+	}
+	for _, test := range tests {
+		s, err := parseSign(test.spec)
+		if test.fails {
+			if err == nil {
+				t.Errorf("parseSign(%q) = %s, want an error", test.spec, s)
+			}
+			continue
+		}
+		if err != nil || s.String() != test.want {
+			t.Errorf("parseSign(%q) = %v (%v), want %q", test.spec, s, err, test.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		spec      string
+		body      string
+		signature string
+		timestamp string
+	}{
+		{"hmac-sha256:key:X-Signature", "The quick brown fox jumps over the lazy dog",
+			"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", ""},
+		{"hmac-sha1:key:X-Signature", "The quick brown fox jumps over the lazy dog",
+			"de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9", ""},
+		{"hmac-sha256:key:X-Signature:X-Timestamp", "dog", "069ee10bd1caa3b706d4cc0bbda8eb694daf3ca36ee97b328d2c320787158cb5", "1600000000"},
+	}
+	for _, test := range tests {
+		s, err := parseSign(test.spec)
+		if err != nil {
+			t.Fatalf("parseSign(%q) failed: %s", test.spec, err)
+		}
+		s.now = func() time.Time { return time.Unix(1600000000, 0) }
+		req, _ := http.NewRequest("POST", "http://api/hook", nil)
+		s.Sign(req, []byte(test.body))
+		if got := req.Header.Get("X-Signature"); got != test.signature {
+			t.Errorf("%s signed %q as %s, want %s", test.spec, test.body, got, test.signature)
+		}
+		if got := req.Header.Get("X-Timestamp"); got != test.timestamp {
+			t.Errorf("%s put the time %q, want %q", test.spec, got, test.timestamp)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Detail : Everything about a request worth keeping for a postmortem
+type Detail struct {
+	Method         string
+	URL            string
+	RequestHeader  http.Header
+	ResponseHeader http.Header
+	RequestBytes   int
+}
+
+// slowestHeap : A min-heap on latency holding the slowest responses seen so far
+type slowestHeap []Response
+
+func (h slowestHeap) Len() int            { return len(h) }
+func (h slowestHeap) Less(i, j int) bool  { return h[i].Latency < h[j].Latency }
+func (h slowestHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *slowestHeap) Push(x interface{}) { *h = append(*h, x.(Response)) }
+func (h *slowestHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// slowest : Keeps the N slowest responses of a task
+type slowest struct {
+	n int
+	h slowestHeap
+}
+
+func newSlowest(n int) *slowest {
+	return &slowest{n: n, h: make(slowestHeap, 0, n+1)}
+}
+
+func (s *slowest) add(response *Response) {
+	if s.n <= 0 {
+		return
+	}
+	if len(s.h) < s.n {
+		heap.Push(&s.h, *response)
+	} else if response.Latency > s.h[0].Latency {
+		s.h[0] = *response
+		heap.Fix(&s.h, 0)
+	}
+}
+
+type slowestTiming struct {
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	TLS     float64 `json:"tls"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	Reused  bool    `json:"reused"`
+}
+
+type slowestRecord struct {
+	Rank           int           `json:"rank"`
+	Latency        float64       `json:"latency"`
+	Method         string        `json:"method"`
+	URL            string        `json:"url"`
+	Status         int           `json:"status"`
+	Success        bool          `json:"success"`
+	Worker         int           `json:"worker"`
+	TraceID        string        `json:"trace_id,omitempty"`
+	RequestID      string        `json:"request_id,omitempty"`
+	Timing         slowestTiming `json:"timing"`
+	RequestBytes   int           `json:"request_bytes"`
+	RequestHeader  http.Header   `json:"request_header"`
+	ResponseHeader http.Header   `json:"response_header"`
+	Body           string        `json:"body"`
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// save writes the captured responses slowest first as numbered files of the directory
+func (s *slowest) save(dir string) error {
+	if len(s.h) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	responses := make([]Response, 0, len(s.h))
+	for len(s.h) > 0 {
+		responses = append(responses, heap.Pop(&s.h).(Response))
+	}
+	for i := len(responses) - 1; i >= 0; i-- {
+		response := responses[i]
+		rank := len(responses) - i
+		record := slowestRecord{
+			Rank:      rank,
+			Latency:   millis(response.Latency),
+			Status:    response.Status,
+			Success:   response.Success,
+			Worker:    response.Worker,
+			TraceID:   response.TraceID,
+			RequestID: response.RequestID,
+			Timing: slowestTiming{
+				DNS:     millis(response.Timing.DNS),
+				Connect: millis(response.Timing.Connect),
+				TLS:     millis(response.Timing.TLS),
+				Send:    millis(response.Timing.Send),
+				Wait:    millis(response.Timing.Wait),
+				Receive: millis(response.Timing.Receive),
+				Reused:  response.Timing.Reused,
+			},
+			Body: response.Body,
+		}
+		if detail := response.Detail; detail != nil {
+			record.Method, record.URL = detail.Method, detail.URL
+			record.RequestBytes = detail.RequestBytes
+			record.RequestHeader, record.ResponseHeader = detail.RequestHeader, detail.ResponseHeader
+		}
+
+		data, err := json.MarshalIndent(&record, "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%03d.json", rank))
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
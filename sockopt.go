@@ -0,0 +1,99 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// SocketOptions : Tuning of the sockets used to connect to the targets
+type SocketOptions struct {
+	NoDelay        bool
+	ReusePort      bool
+	Unix           string // path of the socket every connection goes to instead of the target address
+	Resolve        resolveFlag
+	IPVersion      int           // 4 or 6 to stick to that address family, any by default
+	ConnectTimeout time.Duration // of a single dial, 30 seconds when zero
+}
+
+// control applies the options which have to be set before the socket connects
+func (s SocketOptions) control(network, address string, c syscall.RawConn) error {
+	if !s.ReusePort {
+		return nil
+	}
+	var err error
+	controlErr := c.Control(func(fd uintptr) {
+		err = setReusePort(fd)
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// newTransport makes the transport shared by all the workers of a run, the
+// runtime enables TCP_NODELAY after connecting so it is applied to the result.
+// The connections count their traffic for the transfer stats.
+func newTransport(sockets SocketOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   sockets.control,
+	}
+	if sockets.ConnectTimeout > 0 {
+		dialer.Timeout = sockets.ConnectTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if sockets.Unix != "" {
+			network, address = "unix", sockets.Unix
+		} else {
+			address = sockets.Resolve.pin(address)
+			if sockets.IPVersion != 0 && network == "tcp" {
+				network = fmt.Sprintf("tcp%d", sockets.IPVersion)
+			}
+		}
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			if err := tcp.SetNoDelay(sockets.NoDelay); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return countConn(conn), nil
+	}
+	return transport
+}
+
+// warnSocketLimits points out the system limits too low for the number of clients
+func warnSocketLimits(live *console, numClients int) {
+	for _, hint := range socketHints(numClients) {
+		live.warn(hint)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const statsdPrefix = "cannonade"
+const statsdQueue = 1024
+
+// statsdClient : Pushes metrics to a statsd or DogStatsD agent over UDP
+type statsdClient struct {
+	conn    net.Conn
+	tags    string
+	metrics chan string
+	done    chan struct{}
+	dropped int64
+}
+
+func newStatsdClient(address string, tags string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &statsdClient{
+		conn:    conn,
+		metrics: make(chan string, statsdQueue),
+		done:    make(chan struct{}),
+	}
+	if tags != "" {
+		client.tags = "|#" + strings.Replace(tags, " ", "", -1)
+	}
+	go client.run()
+
+	return client, nil
+}
+
+// Timing reports a request latency, it is safe to call on a nil client
+func (c *statsdClient) Timing(name string, latency time.Duration) {
+	c.send(fmt.Sprintf("%s.%s:%.3f|ms", statsdPrefix, name, float64(latency)/float64(time.Millisecond)))
+}
+
+// Count increments a counter, it is safe to call on a nil client
+func (c *statsdClient) Count(name string, value int) {
+	c.send(fmt.Sprintf("%s.%s:%d|c", statsdPrefix, name, value))
+}
+
+func (c *statsdClient) send(metric string) {
+	if c == nil {
+		return
+	}
+	select {
+	case c.metrics <- metric + c.tags:
+	default:
+		// Never let a slow agent throttle the requests, metrics are best effort
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+// Close sends the queued metrics and releases the socket
+func (c *statsdClient) Close() {
+	if c != nil {
+		close(c.metrics)
+		<-c.done
+		c.conn.Close()
+		if dropped := atomic.LoadInt64(&c.dropped); dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Dropped %d metrics the agent could not keep up with\n", dropped)
+		}
+	}
+}
+
+func (c *statsdClient) run() {
+	defer close(c.done)
+	for metric := range c.metrics {
+		// Delivery errors are ignored just like statsd itself does
+		_, _ = c.conn.Write([]byte(metric))
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// storageTimeout bounds every request to the object storage
+const storageTimeout = 2 * time.Minute
+
+// emptyHash is the sha256 of the empty payload of the GET requests
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// objectURL tells the s3:// and gs:// locations from the local paths
+func objectURL(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// splitObjectURL reads the scheme, the bucket and the key or the prefix of the location
+func splitObjectURL(location string) (scheme string, bucket string, key string, err error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", "", "", err
+	}
+	if u.Host == "" {
+		return "", "", "", fmt.Errorf("no bucket in %s", location)
+	}
+	return u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// openObject downloads the object, with the credentials of the environment
+// when there are any, so public buckets work without them
+func openObject(location string) (io.ReadCloser, error) {
+	scheme, bucket, key, err := splitObjectURL(location)
+	if err != nil {
+		return nil, err
+	}
+	var req *http.Request
+	if scheme == "s3" {
+		req, err = s3Request(bucket, key, nil)
+	} else {
+		req, err = gcsRequest(fmt.Sprintf("/%s/%s", bucket, awsEscape(key, true)), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := storageGet(req, location)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// listObjects finds the keys of all the objects under the prefix, in order
+func listObjects(location string) ([]string, error) {
+	scheme, bucket, prefix, err := splitObjectURL(location)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	token := ""
+	for {
+		var page []string
+		if scheme == "s3" {
+			page, token, err = listS3(bucket, prefix, token, location)
+		} else {
+			page, token, err = listGCS(bucket, prefix, token, location)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		if token == "" {
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func listS3(bucket string, prefix string, token string, location string) ([]string, string, error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	req, err := s3Request(bucket, "", query)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := storageGet(req, location)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	var result struct {
+		Contents []struct {
+			Key string
+		}
+		IsTruncated           bool
+		NextContinuationToken string
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("bad listing of %s: %s", location, err)
+	}
+	keys := make([]string, len(result.Contents))
+	for i, object := range result.Contents {
+		keys[i] = object.Key
+	}
+	if !result.IsTruncated {
+		return keys, "", nil
+	}
+	return keys, result.NextContinuationToken, nil
+}
+
+func listGCS(bucket string, prefix string, token string, location string) ([]string, string, error) {
+	query := url.Values{"prefix": {prefix}}
+	if token != "" {
+		query.Set("pageToken", token)
+	}
+	req, err := gcsRequest("/storage/v1/b/"+url.PathEscape(bucket)+"/o", query)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := storageGet(req, location)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	var result struct {
+		Items []struct {
+			Name string `json:"name"`
+		} `json:"items"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("bad listing of %s: %s", location, err)
+	}
+	keys := make([]string, len(result.Items))
+	for i, object := range result.Items {
+		keys[i] = object.Name
+	}
+	return keys, result.NextPageToken, nil
+}
+
+// storageGet fails the responses other than 200 with what the storage said
+func storageGet(req *http.Request, location string) (*http.Response, error) {
+	client := http.Client{Timeout: storageTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, dryRunPreview))
+		return nil, fmt.Errorf("GET %s: %s %s", location, res.Status, strings.TrimSpace(string(message)))
+	}
+	return res, nil
+}
+
+// s3Request addresses the bucket by its virtual host on AWS, or by the path
+// on the AWS_ENDPOINT_URL of a compatible storage like MinIO
+func s3Request(bucket string, key string, query url.Values) (*http.Request, error) {
+	region := awsRegion()
+	target := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, awsEscape(key, true))
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		target = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), bucket, awsEscape(key, true))
+	}
+	if len(query) > 0 {
+		target += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id != "" && secret != "" {
+		signS3(req, id, secret, os.Getenv("AWS_SESSION_TOKEN"), region, time.Now())
+	}
+	return req, nil
+}
+
+// gcsRequest goes to storage.googleapis.com, or the STORAGE_EMULATOR_HOST,
+// with the GOOGLE_OAUTH_ACCESS_TOKEN as in gcloud auth print-access-token
+func gcsRequest(path string, query url.Values) (*http.Request, error) {
+	base := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		base = host
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	}
+	target := strings.TrimSuffix(base, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// awsRegion is the region of the AWS_REGION or AWS_DEFAULT_REGION, or else
+// the default one of AWS
+func awsRegion() string {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return region
+}
+
+// signS3 signs the request to S3, the payload of a GET being empty
+func signS3(req *http.Request, id string, secret string, token string, region string, now time.Time) {
+	signAWS(req, "s3", emptyHash, id, secret, token, region, now)
+}
+
+// signAWS signs the request with AWS signature version 4 over its host and
+// all of its headers, the payload goes in by its sha256
+func signAWS(req *http.Request, service string, payloadHash string, id string, secret string, token string,
+	region string, now time.Time) {
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{req.Method, req.URL.EscapedPath(), canonicalQuery(req.URL.Query()),
+		canonical.String(), signed, payloadHash}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	digest := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		id, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts the parameters by name and escapes them the way AWS does
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape keeps the unreserved characters and, in paths, the slashes
+func awsEscape(s string, path bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '.', b == '_', b == '~',
+			path && b == '/':
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultFindMaxRate is the rate the rps search starts from without -max-rps
+const defaultFindMaxRate = 50
+
+// sweepMaxSteps caps the number of load levels tried by a single search
+const sweepMaxSteps = 20
+
+// sweepRefinements is the number of bisections between the last sustainable
+// and the first failing level once the doubling has overshot
+const sweepRefinements = 4
+
+// sweepPrecision is the relative gap between the levels at which the rate search stops
+const sweepPrecision = 0.05
+
+// Limits : Thresholds a load level has to stay within to count as sustainable
+type Limits struct {
+	P99       Millis  `json:"p99,omitempty"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// check tells why the task went over the limits, empty when it did not
+func (l *Limits) check(summary *Summary) string {
+	rate := errorRate(summary)
+	if rate > l.ErrorRate {
+		return fmt.Sprintf("errors %.1f%% over %.1f%%", 100*rate, 100*l.ErrorRate)
+	}
+	if p99 := summaryPercentile(summary, 99); l.P99 > 0 && !(p99 <= l.P99) {
+		return fmt.Sprintf("p99 %.0f ms over %.0f ms", p99, l.P99)
+	}
+	return ""
+}
+
+func errorRate(summary *Summary) float64 {
+	if summary.NumRequests == 0 {
+		return 0
+	}
+	return float64(summary.NumFails) / float64(summary.NumRequests)
+}
+
+func summaryPercentile(summary *Summary, threshold float64) Millis {
+	for _, percentile := range summary.Percentiles {
+		if percentile.Threshold == threshold {
+			return percentile.Value
+		}
+	}
+	return Millis(math.NaN())
+}
+
+// SweepStep : The outcome of a single load level of the search
+type SweepStep struct {
+	Level      float64 `json:"level"`
+	RPS        float64 `json:"rps"`
+	SuccessRPS float64 `json:"success_rps"`
+	P99        Millis  `json:"p99"`
+	ErrorRate  float64 `json:"error_rate"`
+	Sustained  bool    `json:"sustained"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+// FindMax : The highest sustainable load found by the search, the levels
+// are numbers of clients or requests per second depending on the mode
+type FindMax struct {
+	Mode          string      `json:"mode"`
+	Limits        Limits      `json:"limits"`
+	Steps         []SweepStep `json:"steps"`
+	MaxLevel      float64     `json:"max_level"`
+	MaxThroughput float64     `json:"max_throughput"`
+	Knee          float64     `json:"knee"`
+}
+
+// sweep : Doubles the load until a level breaks the limits, then bisects
+// between the last sustainable and the first failing one
+type sweep struct {
+	result    FindMax
+	start     float64
+	level     float64
+	good, bad float64
+	refined   int
+}
+
+func newSweep(mode string, start float64, limits Limits) *sweep {
+	return &sweep{result: FindMax{Mode: mode, Limits: limits, Steps: make([]SweepStep, 0)}, start: start}
+}
+
+// next picks the level of the following step, false once the search is over
+func (s *sweep) next() (float64, bool) {
+	if len(s.result.Steps) >= sweepMaxSteps {
+		return 0, false
+	}
+	switch {
+	case len(s.result.Steps) == 0:
+		s.level = s.start
+	case s.bad == 0:
+		s.level = 2 * s.good
+	default:
+		if s.refined >= sweepRefinements {
+			return 0, false
+		}
+		level := (s.good + s.bad) / 2
+		if s.result.Mode == "clients" {
+			level = math.Floor(level)
+			if level <= s.good || level < 1 {
+				return 0, false
+			}
+		} else if (s.bad-s.good)/s.bad < sweepPrecision {
+			return 0, false
+		}
+		s.refined++
+		s.level = level
+	}
+	return s.level, true
+}
+
+// record judges the task run at the current level
+func (s *sweep) record(summary *Summary) {
+	reason := s.result.Limits.check(summary)
+	step := SweepStep{
+		Level:      s.level,
+		RPS:        summary.RPS,
+		SuccessRPS: summary.SuccessRPS,
+		P99:        summaryPercentile(summary, 99),
+		ErrorRate:  errorRate(summary),
+		Sustained:  reason == "",
+		Reason:     reason,
+	}
+	s.result.Steps = append(s.result.Steps, step)
+
+	if step.Sustained {
+		s.good = math.Max(s.good, step.Level)
+		s.result.MaxLevel = s.good
+		s.result.MaxThroughput = math.Max(s.result.MaxThroughput, step.SuccessRPS)
+	} else if s.bad == 0 || step.Level < s.bad {
+		s.bad = step.Level
+	}
+	s.result.Knee = findKnee(s.result.Steps)
+}
+
+// findKnee locates the level where the throughput stops growing in line with
+// the load: the point of the normalized curve farthest above its diagonal
+func findKnee(steps []SweepStep) float64 {
+	if len(steps) == 0 {
+		return 0
+	}
+	curve := make([]SweepStep, len(steps))
+	copy(curve, steps)
+	sort.Slice(curve, func(i, j int) bool { return curve[i].Level < curve[j].Level })
+
+	first, last := curve[0], curve[len(curve)-1]
+	low, high := first.SuccessRPS, first.SuccessRPS
+	for _, step := range curve {
+		low, high = math.Min(low, step.SuccessRPS), math.Max(high, step.SuccessRPS)
+	}
+	if len(curve) < 3 || last.Level == first.Level || high == low {
+		return first.Level
+	}
+
+	knee, farthest := first.Level, math.Inf(-1)
+	for _, step := range curve {
+		x := (step.Level - first.Level) / (last.Level - first.Level)
+		y := (step.SuccessRPS - low) / (high - low)
+		if y-x > farthest {
+			knee, farthest = step.Level, y-x
+		}
+	}
+	return knee
+}
+
+// describe tells what the limits are, e.g. "errors under 1.0%, p99 under 500 ms"
+func (l *Limits) describe() string {
+	parts := []string{fmt.Sprintf("errors under %.1f%%", 100*l.ErrorRate)}
+	if l.P99 > 0 {
+		parts = append(parts, fmt.Sprintf("p99 under %v", time.Duration(float64(l.P99)*float64(time.Millisecond))))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printFindMax(w io.Writer, result *FindMax) {
+	fmt.Fprintf(w, "Find max %s: %s\n\n", result.Mode, result.Limits.describe())
+	fmt.Fprintf(w, " %9s     req/s      ok/s      p99   errors\n", result.Mode)
+	fmt.Fprintln(w, strings.Repeat("-", 52))
+	for _, step := range result.Steps {
+		fmt.Fprintf(w, " %9g%10.2f%10.2f%9.0f%8.1f%%", step.Level, step.RPS, step.SuccessRPS, step.P99, 100*step.ErrorRate)
+		if !step.Sustained {
+			fmt.Fprintf(w, "  %s", step.Reason)
+		}
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprintln(w)
+	if result.MaxLevel == 0 {
+		fmt.Fprintln(w, "No level was sustainable within the limits")
+		return
+	}
+	fmt.Fprintf(w, "Max sustainable: %g %s, best throughput %.2f ok/s, knee at %g %s\n",
+		result.MaxLevel, result.Mode, result.MaxThroughput, result.Knee, result.Mode)
+}
+
+func markdownFindMax(w io.Writer, result *FindMax) {
+	fmt.Fprintf(w, "\n### Find max %s\n\nLimits: %s\n\n", result.Mode, result.Limits.describe())
+	fmt.Fprintf(w, "| %s | req/s | ok/s | p99 | errors | |\n", result.Mode)
+	fmt.Fprintln(w, "|---:|---:|---:|---:|---:|:---|")
+	for _, step := range result.Steps {
+		fmt.Fprintf(w, "| %g | %.2f | %.2f | %.0f | %.1f%% | %s |\n",
+			step.Level, step.RPS, step.SuccessRPS, step.P99, 100*step.ErrorRate, step.Reason)
+	}
+	fmt.Fprintln(w)
+	if result.MaxLevel == 0 {
+		fmt.Fprintln(w, "No level was sustainable within the limits")
+		return
+	}
+	fmt.Fprintf(w, "Max sustainable: **%g %s**, best throughput **%.2f ok/s**, knee at %g %s\n",
+		result.MaxLevel, result.Mode, result.MaxThroughput, result.Knee, result.Mode)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// runSweep drives the search against a service that sustains loads up to capacity
+func runSweep(mode string, start float64, capacity float64) []float64 {
+	search := newSweep(mode, start, Limits{ErrorRate: 0.01})
+	levels := make([]float64, 0)
+	for level, ok := search.next(); ok; level, ok = search.next() {
+		levels = append(levels, level)
+		summary := &Summary{NumRequests: 100, SuccessRPS: level}
+		if level > capacity {
+			summary.NumFails = 50
+		}
+		search.record(summary)
+	}
+	return levels
+}
+
+func TestSweepLevels(t *testing.T) {
+	tests := []struct {
+		mode     string
+		start    float64
+		capacity float64
+		levels   []float64
+	}{
+		{"clients", 1, 5, []float64{1, 2, 4, 8, 6, 5}},
+		{"clients", 8, 100, []float64{8, 16, 32, 64, 128, 96, 112, 104, 100}},
+		{"clients", 4, 1, []float64{4, 2, 1}},
+		{"clients", 1, 0, []float64{1}},
+		{"rps", 100, 1000, []float64{100, 200, 400, 800, 1600, 1200, 1000, 1100, 1050}},
+	}
+	for _, test := range tests {
+		levels := runSweep(test.mode, test.start, test.capacity)
+		if !reflect.DeepEqual(levels, test.levels) {
+			t.Errorf("%s from %g up to %g: got %v, want %v", test.mode, test.start, test.capacity, levels, test.levels)
+		}
+	}
+}
+
+func TestSweepResult(t *testing.T) {
+	search := newSweep("clients", 1, Limits{ErrorRate: 0.01})
+	for level, ok := search.next(); ok; level, ok = search.next() {
+		summary := &Summary{NumRequests: 100, SuccessRPS: 10 * level}
+		if level > 5 {
+			summary.NumFails = 50
+		}
+		search.record(summary)
+	}
+	if search.result.MaxLevel != 5 || search.result.MaxThroughput != 50 {
+		t.Errorf("got max %g at %g ok/s, want 5 at 50", search.result.MaxLevel, search.result.MaxThroughput)
+	}
+	if steps := search.result.Steps; len(steps) == 0 || steps[len(steps)-1].Reason != "" {
+		t.Errorf("got steps %+v", steps)
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	percentiles := []Percentile{{Threshold: 99, Value: 120}}
+	tests := []struct {
+		limits  Limits
+		summary Summary
+		over    bool
+	}{
+		{Limits{ErrorRate: 0.01}, Summary{NumRequests: 100, NumFails: 1, Percentiles: percentiles}, false},
+		{Limits{ErrorRate: 0.01}, Summary{NumRequests: 100, NumFails: 2, Percentiles: percentiles}, true},
+		{Limits{ErrorRate: 0.01, P99: 100}, Summary{NumRequests: 100, Percentiles: percentiles}, true},
+		{Limits{ErrorRate: 0.01, P99: 200}, Summary{NumRequests: 100, Percentiles: percentiles}, false},
+		{Limits{ErrorRate: 1, P99: 200}, Summary{NumRequests: 100, NumFails: 100, Percentiles: []Percentile{{99, Millis(math.NaN())}}}, true},
+	}
+	for i, test := range tests {
+		if reason := test.limits.check(&test.summary); (reason != "") != test.over {
+			t.Errorf("#%d: got %q", i, reason)
+		}
+	}
+}
+
+func TestFindKnee(t *testing.T) {
+	steps := func(points ...float64) []SweepStep {
+		result := make([]SweepStep, 0)
+		for i := 0; i < len(points); i += 2 {
+			result = append(result, SweepStep{Level: points[i], SuccessRPS: points[i+1]})
+		}
+		return result
+	}
+	tests := []struct {
+		steps []SweepStep
+		knee  float64
+	}{
+		{steps(), 0},
+		{steps(8, 100), 8},
+		{steps(1, 100, 2, 200, 4, 400, 8, 800), 1},
+		{steps(1, 100, 2, 200, 4, 390, 8, 420, 16, 430), 4},
+		{steps(16, 430, 1, 100, 8, 420, 2, 200, 4, 390), 4},
+		{steps(1, 100, 2, 190, 4, 350, 8, 360, 16, 200), 4},
+	}
+	for i, test := range tests {
+		if knee := findKnee(test.steps); knee != test.knee {
+			t.Errorf("#%d: got knee at %g, want %g", i, knee, test.knee)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// perlinOctaves is the number of noise layers summed up, each twice as fine
+const perlinOctaves = 4
+
+// parseSynthetic parses a synthetic image spec, WxH with an optional kind: 640x480:gradient
+func parseSynthetic(spec string) (int, int, string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	kind := "perlin"
+	if len(parts) == 2 {
+		kind = parts[1]
+	}
+	width, height, err := parseSize(parts[0])
+	if err != nil || width == 0 || height == 0 {
+		return 0, 0, "", fmt.Errorf("bad synthetic image %q, expected WxH or WxH:kind", spec)
+	}
+	switch kind {
+	case "solid", "gradient", "perlin":
+		return width, height, kind, nil
+	default:
+		return 0, 0, "", fmt.Errorf("unknown synthetic image kind %q (solid, gradient, perlin)", kind)
+	}
+}
+
+// syntheticImage generates a random image of the given kind and size
+func syntheticImage(kind string, width int, height int, rnd *rand.Rand) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	from, to := randomColor(rnd), randomColor(rnd)
+	switch kind {
+	case "solid":
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.SetRGBA(x, y, from)
+			}
+		}
+	case "gradient":
+		angle := rnd.Float64() * 2 * math.Pi
+		dx, dy := math.Cos(angle), math.Sin(angle)
+		span := math.Abs(dx)*float64(width) + math.Abs(dy)*float64(height)
+		offset := math.Min(0, dx*float64(width)) + math.Min(0, dy*float64(height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.SetRGBA(x, y, mix(from, to, (dx*float64(x)+dy*float64(y)-offset)/span))
+			}
+		}
+	case "perlin":
+		noise := newPerlin(rnd)
+		scale := 4 / float64(maxInt(width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				value := noise.octaves(float64(x)*scale, float64(y)*scale, perlinOctaves)
+				img.SetRGBA(x, y, mix(from, to, (value+1)/2))
+			}
+		}
+	}
+	return img
+}
+
+func randomColor(rnd *rand.Rand) color.RGBA {
+	return color.RGBA{R: uint8(rnd.Intn(256)), G: uint8(rnd.Intn(256)), B: uint8(rnd.Intn(256)), A: math.MaxUint8}
+}
+
+// mix interpolates between the colors, t is clamped to [0, 1]
+func mix(from color.RGBA, to color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	lerp := func(a uint8, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+	return color.RGBA{R: lerp(from.R, to.R), G: lerp(from.G, to.G), B: lerp(from.B, to.B), A: math.MaxUint8}
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// perlin : Classic 2D gradient noise over a shuffled permutation table
+type perlin struct {
+	perm [512]int
+}
+
+func newPerlin(rnd *rand.Rand) *perlin {
+	p := &perlin{}
+	for i, v := range rnd.Perm(256) {
+		p.perm[i], p.perm[i+256] = v, v
+	}
+	return p
+}
+
+// octaves sums the layers of noise with halving amplitudes, the result is within [-1, 1]
+func (p *perlin) octaves(x float64, y float64, count int) float64 {
+	sum, amplitude, total := 0.0, 1.0, 0.0
+	for i := 0; i < count; i++ {
+		sum += amplitude * p.noise(x, y)
+		total += amplitude
+		x, y, amplitude = 2*x, 2*y, amplitude/2
+	}
+	return sum / total
+}
+
+func (p *perlin) noise(x float64, y float64) float64 {
+	fx, fy := math.Floor(x), math.Floor(y)
+	xi, yi := int(fx)&255, int(fy)&255
+	x, y = x-fx, y-fy
+	u, v := fade(x), fade(y)
+
+	aa := p.perm[p.perm[xi]+yi]
+	ab := p.perm[p.perm[xi]+yi+1]
+	ba := p.perm[p.perm[xi+1]+yi]
+	bb := p.perm[p.perm[xi+1]+yi+1]
+
+	top := lerp(grad(aa, x, y), grad(ba, x-1, y), u)
+	bottom := lerp(grad(ab, x, y-1), grad(bb, x-1, y-1), u)
+	return lerp(top, bottom, v)
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(a float64, b float64, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// grad picks one of the eight gradient directions by the hash
+func grad(hash int, x float64, y float64) float64 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	default:
+		return -y
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestParseSynthetic(t *testing.T) {
+	tests := []struct {
+		spec   string
+		width  int
+		height int
+		kind   string
+		ok     bool
+	}{
+		{"640x480", 640, 480, "perlin", true},
+		{"64x32:solid", 64, 32, "solid", true},
+		{"64x32:gradient", 64, 32, "gradient", true},
+		{"64x:solid", 0, 0, "", false},
+		{"64x32:plasma", 0, 0, "", false},
+		{"big", 0, 0, "", false},
+	}
+	for _, test := range tests {
+		width, height, kind, err := parseSynthetic(test.spec)
+		if (err == nil) != test.ok || width != test.width || height != test.height || kind != test.kind {
+			t.Errorf("parseSynthetic(%q) = %d, %d, %q, %v", test.spec, width, height, kind, err)
+		}
+	}
+}
+
+func countColors(img image.Image) int {
+	colors := make(map[[4]uint32]bool)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			colors[[4]uint32{r, g, b, a}] = true
+		}
+	}
+	return len(colors)
+}
+
+func TestSyntheticImage(t *testing.T) {
+	tests := []struct {
+		kind      string
+		minColors int
+		maxColors int
+	}{
+		{"solid", 1, 1},
+		{"gradient", 8, 1 << 20},
+		{"perlin", 8, 1 << 20},
+	}
+	for _, test := range tests {
+		img := syntheticImage(test.kind, 64, 48, rand.New(rand.NewSource(1)))
+		if img.Bounds() != image.Rect(0, 0, 64, 48) {
+			t.Errorf("%s: got bounds %v", test.kind, img.Bounds())
+		}
+		if colors := countColors(img); colors < test.minColors || colors > test.maxColors {
+			t.Errorf("%s: got %d colors", test.kind, colors)
+		}
+	}
+}
+
+func TestPerlinRange(t *testing.T) {
+	noise := newPerlin(rand.New(rand.NewSource(1)))
+	for i := 0; i < 10000; i++ {
+		x, y := float64(i%100)/7, float64(i/100)/7
+		if value := noise.octaves(x, y, perlinOctaves); value < -1 || value > 1 {
+			t.Fatalf("noise(%g, %g) = %g is out of range", x, y, value)
+		}
+	}
+	if noise.noise(3, 5) != 0 {
+		t.Errorf("noise is not zero at the lattice points")
+	}
+}
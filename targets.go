@@ -0,0 +1,211 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nizhib/cannonade/latency"
+)
+
+// Target : An address to shoot at along with a label to report it by, the
+// host is set for the aliases of a sharded target
+type Target struct {
+	Name string
+	URL  string
+	Host string
+}
+
+// shardTargets spreads every target across the hostname aliases of its
+// backend, so that each alias gets its own share of proxy connection slots
+func shardTargets(targets []Target, hosts []string) ([]Target, error) {
+	sharded := make([]Target, 0, len(targets)*len(hosts))
+	for _, target := range targets {
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid target url %q", target.URL)
+		}
+		for _, host := range hosts {
+			alias := *u
+			alias.Host = host
+			if port := u.Port(); port != "" && !strings.Contains(host, ":") {
+				alias.Host = net.JoinHostPort(host, port)
+			}
+			sharded = append(sharded, Target{Name: target.Name, URL: alias.String(), Host: alias.Host})
+		}
+	}
+	return sharded, nil
+}
+
+// targetPool : Round-robin selection of the targets shared by all the clients
+type targetPool struct {
+	next    uint64
+	left    int64 // requests the clients of the pool may still fire, negative for no limit
+	targets []Target
+}
+
+func newTargetPool(targets []Target) *targetPool {
+	return &targetPool{targets: targets, left: -1}
+}
+
+// claim reserves one of the requests left to the pool, false once they are all taken
+func (p *targetPool) claim() bool {
+	for {
+		left := atomic.LoadInt64(&p.left)
+		if left < 0 {
+			return true
+		}
+		if left == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&p.left, left, left-1) {
+			return true
+		}
+	}
+}
+
+// release gives back the request claimed by a client quitting before firing it
+func (p *targetPool) release() {
+	if atomic.LoadInt64(&p.left) >= 0 {
+		atomic.AddInt64(&p.left, 1)
+	}
+}
+
+func (p *targetPool) pick() Target {
+	i := atomic.AddUint64(&p.next, 1) - 1
+	return p.targets[i%uint64(len(p.targets))]
+}
+
+const outlierLatencyFactor = 1.5
+const outlierFailFactor = 2.0
+
+// Breakdown : Latency statistics of a subset of the requests
+type Breakdown struct {
+	Name        string `json:"name"`
+	NumRequests int    `json:"num_requests"`
+	NumFails    int    `json:"num_fails"`
+	Avg         Millis `json:"avg"`
+	Median      Millis `json:"median"`
+	P95         Millis `json:"p95"`
+	Max         Millis `json:"max"`
+	Outlier     bool   `json:"outlier"`
+}
+
+type breakdownGroup struct {
+	latencies *latency.Accumulator
+}
+
+// breakdown : Accumulates the latencies of the requests grouped by name
+type breakdown struct {
+	names  []string
+	groups map[string]*breakdownGroup
+	exact  bool
+}
+
+func newBreakdown(exact bool) *breakdown {
+	return &breakdown{groups: make(map[string]*breakdownGroup), exact: exact}
+}
+
+func (b *breakdown) add(name string, millis float64, success bool) {
+	group, ok := b.groups[name]
+	if !ok {
+		group = &breakdownGroup{latencies: newAccumulator(b.exact)}
+		b.groups[name] = group
+		b.names = append(b.names, name)
+	}
+	group.latencies.Add(millis, success)
+}
+
+func (b *breakdown) summarize() []Breakdown {
+	rows := make([]Breakdown, 0, len(b.names))
+	for _, name := range b.names {
+		stats := b.groups[name].latencies.Stats(95)
+		rows = append(rows, Breakdown{
+			Name:        name,
+			NumRequests: stats.Count,
+			NumFails:    stats.Fails,
+			Avg:         Millis(stats.Mean),
+			Median:      Millis(stats.Median),
+			P95:         Millis(stats.Percentiles[0]),
+			Max:         Millis(stats.Max),
+		})
+	}
+	flagOutliers(rows)
+	return rows
+}
+
+// flagOutliers marks the groups which are much slower or fail much more often than their peers
+func flagOutliers(rows []Breakdown) {
+	if len(rows) < 2 {
+		return
+	}
+
+	medians := make([]float64, 0, len(rows))
+	var requests, fails int
+	for _, row := range rows {
+		if !math.IsNaN(float64(row.Median)) {
+			medians = append(medians, float64(row.Median))
+		}
+		requests += row.NumRequests
+		fails += row.NumFails
+	}
+	sort.Float64s(medians)
+	typical := latency.Percentile(medians, 50)
+	failRate := float64(fails) / float64(requests)
+
+	for i, row := range rows {
+		slow := float64(row.Median) > outlierLatencyFactor*typical
+		failing := float64(row.NumFails)/float64(row.NumRequests) > outlierFailFactor*failRate && row.NumFails > 0
+		rows[i].Outlier = slow || failing
+	}
+}
+
+func printBreakdown(w io.Writer, title string, rows []Breakdown) {
+	width := len(title)
+	for _, row := range rows {
+		if len(row.Name) > width {
+			width = len(row.Name)
+		}
+	}
+
+	fmt.Fprintf(w, " %-*s   # reqs   # fails     Avg  Median     95%%     Max  \n", width, title)
+	fmt.Fprintln(w, strings.Repeat("-", width+54))
+	outliers := 0
+	for _, row := range rows {
+		fmt.Fprintf(w, " %-*s%9d%10d%8.0f%8.0f%8.0f%8.0f", width, row.Name,
+			row.NumRequests, row.NumFails, row.Avg, row.Median, row.P95, row.Max)
+		if row.Outlier {
+			fmt.Fprint(w, "  *")
+			outliers++
+		}
+		fmt.Fprint(w, "\n")
+	}
+	if outliers > 0 {
+		fmt.Fprintf(w, "* %d outlier(s): slower or failing more often than the rest\n", outliers)
+	}
+}
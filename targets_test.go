@@ -0,0 +1,107 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestFlagOutliers(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []Breakdown
+		want []bool
+	}{
+		{"single", []Breakdown{{Median: 500, NumRequests: 10}}, []bool{false}},
+		{"even", []Breakdown{
+			{Median: 10, NumRequests: 10}, {Median: 12, NumRequests: 10}, {Median: 11, NumRequests: 10},
+		}, []bool{false, false, false}},
+		{"slow replica", []Breakdown{
+			{Median: 10, NumRequests: 10}, {Median: 40, NumRequests: 10}, {Median: 11, NumRequests: 10},
+		}, []bool{false, true, false}},
+		{"failing replica", []Breakdown{
+			{Median: 10, NumRequests: 10}, {Median: 10, NumRequests: 10, NumFails: 5}, {Median: 10, NumRequests: 10},
+		}, []bool{false, true, false}},
+		{"evenly failing", []Breakdown{
+			{Median: 10, NumRequests: 10, NumFails: 2}, {Median: 10, NumRequests: 10, NumFails: 2},
+		}, []bool{false, false}},
+	}
+	for _, test := range tests {
+		flagOutliers(test.rows)
+		for i, row := range test.rows {
+			if row.Outlier != test.want[i] {
+				t.Errorf("%s: row %d outlier = %v, want %v", test.name, i, row.Outlier, test.want[i])
+			}
+		}
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	b := newBreakdown(false)
+	b.add("b", 20, true)
+	b.add("a", 10, true)
+	b.add("b", 30, false)
+	rows := b.summarize()
+
+	if len(rows) != 2 || rows[0].Name != "b" || rows[1].Name != "a" {
+		t.Fatalf("rows = %+v, want b and a in order of appearance", rows)
+	}
+	if rows[0].NumRequests != 2 || rows[0].NumFails != 1 || rows[0].Median != 20 {
+		t.Errorf("row b = %+v, want 2 requests, 1 fail and median 20", rows[0])
+	}
+}
+
+func TestTargetPool(t *testing.T) {
+	pool := newTargetPool([]Target{{Name: "a"}, {Name: "b"}})
+	got := ""
+	for i := 0; i < 4; i++ {
+		got += pool.pick().Name
+	}
+	if got != "abab" && got != "baba" {
+		t.Errorf("picks = %q, want round robin", got)
+	}
+}
+
+func TestShardTargets(t *testing.T) {
+	targets := []Target{{Name: "api", URL: "http://api:8000/predict?v=1"}, {Name: "plain", URL: "https://x.example/"}}
+	sharded, err := shardTargets(targets, []string{"a.example", "b.example:9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Target{
+		{Name: "api", URL: "http://a.example:8000/predict?v=1", Host: "a.example:8000"},
+		{Name: "api", URL: "http://b.example:9000/predict?v=1", Host: "b.example:9000"},
+		{Name: "plain", URL: "https://a.example/", Host: "a.example"},
+		{Name: "plain", URL: "https://b.example:9000/", Host: "b.example:9000"},
+	}
+	if len(sharded) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(sharded), len(want))
+	}
+	for i := range want {
+		if sharded[i] != want[i] {
+			t.Errorf("target %d = %+v, want %+v", i, sharded[i], want[i])
+		}
+	}
+
+	if _, err := shardTargets([]Target{{URL: "no host"}}, []string{"a"}); err == nil {
+		t.Error("sharding an invalid url succeeded, want an error")
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// placeholderPattern matches the {{name}} placeholders of the templates
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// placeholders lists the names a template refers to in the order of appearance
+func placeholders(template string) []string {
+	matches := placeholderPattern.FindAllStringSubmatch(template, -1)
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// templateFunc : A function a placeholder may call with the arguments after
+// its name like {{rand_int 1 10000}}, its arguments are checked up front
+type templateFunc struct {
+	check func(args []string) error
+	call  func(rnd *rand.Rand, args []string) string
+}
+
+// sequence numbers the {{seq}} placeholders across all the requests
+var sequence uint64
+
+var templateFuncs = map[string]templateFunc{
+	"rand_int": {
+		check: func(args []string) error {
+			_, _, err := intRange(args)
+			return err
+		},
+		call: func(rnd *rand.Rand, args []string) string {
+			low, high, _ := intRange(args)
+			return strconv.FormatInt(low+rnd.Int63n(high-low+1), 10)
+		},
+	},
+	"rand_choice": {
+		check: func(args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("rand_choice takes the values to choose from")
+			}
+			return nil
+		},
+		call: func(rnd *rand.Rand, args []string) string {
+			return args[rnd.Intn(len(args))]
+		},
+	},
+	"seq": {
+		check: noArgs("seq"),
+		call: func(rnd *rand.Rand, args []string) string {
+			return strconv.FormatUint(atomic.AddUint64(&sequence, 1), 10)
+		},
+	},
+	"uuid": {
+		check: noArgs("uuid"),
+		call: func(rnd *rand.Rand, args []string) string {
+			var id [16]byte
+			rnd.Read(id[:])
+			return formatUUID(id)
+		},
+	},
+}
+
+// formatUUID makes a version 4 uuid of the random bytes
+func formatUUID(id [16]byte) string {
+	id[6], id[8] = id[6]&0x0f|0x40, id[8]&0x3f|0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// newUUID draws a version 4 uuid from the source of randomness
+func newUUID(rnd *rand.Rand) string {
+	var id [16]byte
+	rnd.Read(id[:])
+	return formatUUID(id)
+}
+
+func intRange(args []string) (int64, int64, error) {
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("rand_int takes the lowest and the highest value")
+	}
+	low, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("rand_int takes integers, not %q", args[0])
+	}
+	high, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("rand_int takes integers, not %q", args[1])
+	}
+	if high < low {
+		return 0, 0, fmt.Errorf("rand_int range %d to %d is empty", low, high)
+	}
+	return low, high, nil
+}
+
+func noArgs(name string) func(args []string) error {
+	return func(args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("%s takes no arguments", name)
+		}
+		return nil
+	}
+}
+
+// checkCall tells whether the placeholder calls a function rather than
+// refers to a value, the known values take precedence over the functions
+func checkCall(placeholder string, known map[string]bool) (bool, error) {
+	if known[placeholder] {
+		return false, nil
+	}
+	fields := strings.Fields(placeholder)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	function, ok := templateFuncs[fields[0]]
+	if !ok {
+		if len(fields) > 1 {
+			return true, fmt.Errorf("unknown function %s", fields[0])
+		}
+		return false, nil
+	}
+	return true, function.check(fields[1:])
+}
+
+// checkTemplate makes sure the template only refers to the known values
+// and calls the functions the right way
+func checkTemplate(template string, known map[string]bool) error {
+	for _, placeholder := range placeholders(template) {
+		call, err := checkCall(placeholder, known)
+		if err != nil {
+			return fmt.Errorf("{{%s}}: %s", placeholder, err)
+		}
+		if !call && !known[placeholder] {
+			return fmt.Errorf("no value for {{%s}}", placeholder)
+		}
+	}
+	return nil
+}
+
+// expand replaces every placeholder of the template with its value or
+// the result of the function it calls
+func expand(template string, vars map[string]string, rnd *rand.Rand) (string, error) {
+	if !strings.Contains(template, "{{") {
+		return template, nil
+	}
+	var missing error
+	expanded := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		fields := strings.Fields(name)
+		if len(fields) > 0 {
+			if function, ok := templateFuncs[fields[0]]; ok && function.check(fields[1:]) == nil {
+				return function.call(rnd, fields[1:])
+			}
+		}
+		if missing == nil {
+			missing = fmt.Errorf("no value for {{%s}}", name)
+		}
+		return ""
+	})
+	return expanded, missing
+}
+
+// requestTemplate : The parts of the plain requests expanded per request,
+// the path takes the place of the one of the endpoint and the body the payload
+type requestTemplate struct {
+	Path   string
+	Body   string
+	Header http.Header
+}
+
+// splitEndpoint moves the templated path and query of the endpoint out of
+// it, the rest is the endpoint to resolve the expanded path against
+func splitEndpoint(endpoint string) (string, string, error) {
+	if !strings.Contains(endpoint, "{{") {
+		return endpoint, "", nil
+	}
+	start := strings.Index(endpoint, "://") + len("://")
+	end := strings.IndexAny(endpoint[start:], "/?")
+	if start < len("://") || end < 0 || strings.Contains(endpoint[:start+end], "{{") {
+		return "", "", fmt.Errorf("placeholders only go into the path and the query of the endpoint")
+	}
+	return endpoint[:start+end], endpoint[start+end:], nil
+}
+
+// check makes sure the templates only refer to the known values
+func (t *requestTemplate) check(known map[string]bool) error {
+	templates := []string{t.Path, t.Body}
+	for _, values := range t.Header {
+		templates = append(templates, values...)
+	}
+	for _, template := range templates {
+		if err := checkTemplate(template, known); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply expands the templates over a copy of the cannonball, the path only
+// goes to the ones without a path of their own
+func (t *requestTemplate) apply(ball *Cannonball, vars map[string]string, rnd *rand.Rand) *Cannonball {
+	templated := *ball
+	var err error
+	// The templates are checked up front, so every value is always there
+	if t.Path != "" && ball.Path == "" {
+		templated.Path, err = expand(t.Path, vars, rnd)
+		panicIf(err)
+	}
+	if t.Body == "" && len(t.Header) == 0 {
+		return &templated
+	}
+	templated.Header = ball.Header.Clone()
+	if templated.Header == nil {
+		templated.Header = make(http.Header)
+	}
+	if t.Body != "" {
+		body, err := expand(t.Body, vars, rnd)
+		panicIf(err)
+		templated.Body, templated.RawSize = []byte(body), 0
+		templated.Header.Del("Content-Encoding")
+	}
+	for key, values := range t.Header {
+		templated.Header.Del(key)
+		for _, value := range values {
+			expanded, err := expand(value, vars, rnd)
+			panicIf(err)
+			templated.Header.Add(key, expanded)
+		}
+	}
+	return &templated
+}
+
+// headerFlag : Repeatable Name: value flag of the extra request headers
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return strings.Join(h.lines(), ", ")
+}
+
+// lines lists the headers one Name: value line each, in the order of the names
+func (h headerFlag) lines() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range h[key] {
+			lines = append(lines, key+": "+value)
+		}
+	}
+	return lines
+}
+
+func (h headerFlag) Set(value string) error {
+	pair := strings.SplitN(value, ":", 2)
+	if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+		return fmt.Errorf("header %q should be Name: value", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1]))
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	vars := map[string]string{"id": "42", "token": "abc"}
+	tests := []struct {
+		template string
+		want     string
+		fails    bool
+	}{
+		{"/jobs/{{id}}", "/jobs/42", false},
+		{"/jobs/{{ id }}/{{token}}", "/jobs/42/abc", false},
+		{"plain", "plain", false},
+		{"{not a placeholder}", "{not a placeholder}", false},
+		{"/jobs/{{missing}}", "", true},
+	}
+	for _, test := range tests {
+		got, err := expand(test.template, vars, rnd)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", test.template, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %q (%v), want %q", test.template, got, err, test.want)
+		}
+	}
+	if got := placeholders("{{a}}/{{ b }}/{{a}}"); !reflect.DeepEqual(got, []string{"a", "b", "a"}) {
+		t.Errorf("got placeholders %v", got)
+	}
+}
+
+func TestSplitEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		base     string
+		path     string
+		fails    bool
+	}{
+		{"http://localhost:5000/predict", "http://localhost:5000/predict", "", false},
+		{"http://localhost:5000/users/{{id}}/avatar", "http://localhost:5000", "/users/{{id}}/avatar", false},
+		{"https://api.example.com?user={{id}}", "https://api.example.com", "?user={{id}}", false},
+		{"http://{{host}}/predict", "", "", true},
+		{"localhost/{{id}}", "", "", true},
+	}
+	for _, test := range tests {
+		base, path, err := splitEndpoint(test.endpoint)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got no error", test.endpoint)
+			}
+			continue
+		}
+		if err != nil || base != test.base || path != test.path {
+			t.Errorf("%s: got %q and %q (%v)", test.endpoint, base, path, err)
+		}
+	}
+}
+
+func TestRequestTemplate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	header := make(headerFlag)
+	for _, line := range []string{"X-User: {{id}}", "Accept: application/json"} {
+		if err := header.Set(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := header.Set("no colon"); err == nil {
+		t.Errorf("got no error for a header without a value")
+	}
+	template := &requestTemplate{Path: "/users/{{id}}", Body: `{"name": "{{name}}"}`, Header: http.Header(header)}
+	if err := template.check(map[string]bool{"id": true}); err == nil {
+		t.Errorf("got no error for an unknown value")
+	}
+	if err := template.check(map[string]bool{"id": true, "name": true}); err != nil {
+		t.Errorf("got %s for the known values", err)
+	}
+
+	shot := &Cannonball{Method: "POST", Header: http.Header{"Content-Encoding": {"gzip"}, "Accept": {"*/*"}},
+		Body: []byte("compressed"), RawSize: 100}
+	ball := template.apply(shot, map[string]string{"id": "7", "name": "ann"}, rnd)
+	if ball.Path != "/users/7" || string(ball.Body) != `{"name": "ann"}` || ball.RawSize != 0 {
+		t.Errorf("got %s with %s", ball.Path, ball.Body)
+	}
+	want := http.Header{"X-User": {"7"}, "Accept": {"application/json"}}
+	if !reflect.DeepEqual(ball.Header, want) {
+		t.Errorf("got header %v, want %v", ball.Header, want)
+	}
+	if shot.Header.Get("Content-Encoding") != "gzip" || string(shot.Body) != "compressed" {
+		t.Errorf("got the shot cannonball changed")
+	}
+	recorded := template.apply(&Cannonball{Method: "GET", Path: "/own"}, map[string]string{"id": "7", "name": "ann"}, rnd)
+	if recorded.Path != "/own" {
+		t.Errorf("got the path of a recorded request replaced with %s", recorded.Path)
+	}
+	if got := header.lines(); !reflect.DeepEqual(got, []string{"Accept: application/json", "X-User: {{id}}"}) {
+		t.Errorf("got header lines %v", got)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		template string
+		fails    string
+	}{
+		{"/v1/items/{{rand_int 1 10000}}", ""},
+		{"/v1/items/{{rand_int 5 5}}", ""},
+		{"{{rand_choice red green}}/{{seq}}/{{uuid}}", ""},
+		{"{{rand_int 10 1}}", "is empty"},
+		{"{{rand_int 1}}", "lowest and the highest"},
+		{"{{rand_int a 5}}", "not \"a\""},
+		{"{{rand_choice}}", "values to choose from"},
+		{"{{seq 5}}", "takes no arguments"},
+		{"{{random 1 5}}", "unknown function random"},
+		{"{{id}}", "no value for {{id}}"},
+	}
+	for _, test := range tests {
+		err := checkTemplate(test.template, nil)
+		switch {
+		case test.fails == "" && err != nil:
+			t.Errorf("%s: got %s", test.template, err)
+		case test.fails != "" && (err == nil || !strings.Contains(err.Error(), test.fails)):
+			t.Errorf("%s: got %v, want %s", test.template, err, test.fails)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		got, err := expand("{{rand_int 1 3}}:{{rand_choice a b}}", nil, rnd)
+		if err != nil || (got[0] < '1' || got[0] > '3') || (got[2:] != "a" && got[2:] != "b") {
+			t.Fatalf("got %q (%v)", got, err)
+		}
+	}
+	first, _ := expand("{{seq}}", nil, rnd)
+	second, _ := expand("{{seq}}", nil, rnd)
+	if a, b := mustAtoi(t, first), mustAtoi(t, second); b != a+1 {
+		t.Errorf("got the sequence %d, %d", a, b)
+	}
+	id, _ := expand("{{uuid}}", nil, rnd)
+	if len(id) != 36 || id[14] != '4' || !strings.Contains("89ab", string(id[19])) {
+		t.Errorf("got uuid %s", id)
+	}
+	if got, _ := expand("{{seq}}", map[string]string{"seq": "mine"}, rnd); got != "mine" {
+		t.Errorf("got %s instead of the value shadowing the function", got)
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	a, b := newUUID(rand.New(rand.NewSource(1))), newUUID(rand.New(rand.NewSource(1)))
+	if a != b {
+		t.Errorf("got %s and %s from the same seed", a, b)
+	}
+	if len(a) != 36 || a[14] != '4' || !strings.Contains("89ab", string(a[19])) {
+		t.Errorf("got uuid %s", a)
+	}
+	if c := newUUID(rand.New(rand.NewSource(2))); c == a {
+		t.Errorf("got %s from another seed", c)
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultSeriesInterval is the window of the time series when no -interval is given
+const defaultSeriesInterval = time.Second
+
+// timeSeriesHeader are the columns of the time series, one row per window
+var timeSeriesHeader = []string{"elapsed", "task", "phase", "requests", "fails", "rps", "p95", "error_rate"}
+
+// timeSeries : CSV file of the windows of every task along the run
+type timeSeries struct {
+	f *os.File
+}
+
+// createTimeSeries creates the file upfront, so that a bad path fails before the run
+func createTimeSeries(path string) (*timeSeries, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &timeSeries{f: f}, nil
+}
+
+// write saves the windows of all the tasks and closes the file
+func (s *timeSeries) write(tasks []Summary) error {
+	err := writeTimeSeries(s.f, tasks)
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeTimeSeries puts the windows of the tasks one after another, the elapsed
+// time counts from the start of the run rather than from that of each task
+func writeTimeSeries(w io.Writer, tasks []Summary) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(timeSeriesHeader); err != nil {
+		return err
+	}
+	offset := 0.0
+	for i := range tasks {
+		task := &tasks[i]
+		for _, window := range task.Windows {
+			p95 := ""
+			if !math.IsNaN(float64(window.P95)) {
+				p95 = strconv.FormatFloat(float64(window.P95), 'f', 3, 64)
+			}
+			err := out.Write([]string{
+				strconv.FormatFloat(offset+window.Elapsed, 'f', 3, 64),
+				strconv.Itoa(i + 1),
+				phaseName(task),
+				strconv.Itoa(window.NumRequests),
+				strconv.Itoa(window.NumFails),
+				strconv.FormatFloat(window.RPS, 'f', 2, 64),
+				p95,
+				strconv.FormatFloat(window.ErrorRate, 'f', 4, 64),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		offset += task.Seconds
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWriteTimeSeries(t *testing.T) {
+	tasks := []Summary{
+		{NumRequests: 100, NumClients: 4, Seconds: 2.5, Windows: []Window{
+			{Elapsed: 1, NumRequests: 40, RPS: 40, P95: 12.5},
+			{Elapsed: 2, NumRequests: 50, NumFails: 5, RPS: 50, P95: 14, ErrorRate: 0.1},
+		}},
+		{NumRequests: 10, NumClients: 8, Seconds: 1, Windows: []Window{
+			{Elapsed: 1, NumRequests: 10, NumFails: 10, RPS: 10, P95: Millis(math.NaN()), ErrorRate: 1},
+		}},
+		{NumRequests: 5, NumClients: 1, Seconds: 0.5},
+	}
+	want := "elapsed,task,phase,requests,fails,rps,p95,error_rate\n" +
+		"1.000,1,100@4,40,0,40.00,12.500,0.0000\n" +
+		"2.000,1,100@4,50,5,50.00,14.000,0.1000\n" +
+		"3.500,2,10@8,10,10,10.00,,1.0000\n"
+
+	buf := new(bytes.Buffer)
+	if err := writeTimeSeries(buf, tasks); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
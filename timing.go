@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing : Breakdown of the request latency into its phases
+type Timing struct {
+	DNS       time.Duration
+	Connect   time.Duration
+	TLS       time.Duration
+	Send      time.Duration
+	Wait      time.Duration
+	Receive   time.Duration
+	Reused    bool
+	Connected bool // got a connection at all, reused or a new one
+	Lookup    bool // resolved the host before dialing
+}
+
+// timingTrace : Collects the moments of a single request from the http client
+// hooks, which may run concurrently and even after the request has timed out
+type timingTrace struct {
+	mu                                                       sync.Mutex
+	start, dnsStart, dnsDone, connectStart, connectDone      time.Time
+	tlsStart, tlsDone, gotConn, wroteRequest, firstByte, end time.Time
+	reused                                                   bool
+	wire                                                     *countingConn
+	read, written                                            int64
+}
+
+// mark stamps the moment unless it is already known, so that the dials racing
+// for the same request keep the first start and the first success
+func (t *timingTrace) mark(moment *time.Time) {
+	t.mu.Lock()
+	if moment.IsZero() {
+		*moment = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+func newTimingTrace() (*timingTrace, *httptrace.ClientTrace) {
+	t := &timingTrace{start: time.Now()}
+	return t, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:      func(string, string) { t.mark(&t.connectStart) },
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.mark(&t.connectDone)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mark(&t.gotConn)
+			t.mu.Lock()
+			t.reused = info.Reused
+			if t.wire = lookupWire(info.Conn); t.wire != nil {
+				t.read, t.written = t.wire.counts()
+			}
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// transfer is the traffic of the request on the wire, headers and compressed
+// bodies included, it is unknown unless the connection was a counting one
+func (t *timingTrace) transfer() (received int64, sent int64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.wire == nil {
+		return 0, 0, false
+	}
+	read, written := t.wire.counts()
+	return read - t.read, written - t.written, true
+}
+
+func since(from time.Time, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// timing finishes the trace once the body is read
+func (t *timingTrace) timing() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.end = time.Now()
+	return Timing{
+		DNS:       since(t.dnsStart, t.dnsDone),
+		Connect:   since(t.connectStart, t.connectDone),
+		TLS:       since(t.tlsStart, t.tlsDone),
+		Send:      since(t.gotConn, t.wroteRequest),
+		Wait:      since(t.wroteRequest, t.firstByte),
+		Receive:   since(t.firstByte, t.end),
+		Reused:    t.reused,
+		Connected: !t.gotConn.IsZero(),
+		Lookup:    !t.dnsStart.IsZero(),
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const otlpBatchSize = 512
+const otlpFlushPeriod = time.Second
+const otlpTimeout = 10 * time.Second
+const otlpPendingBatches = 4
+const otlpServiceName = "cannonade"
+
+const otlpSpanKindClient = 3
+const otlpStatusOk = 1
+const otlpStatusError = 2
+
+// Span : A single traced request
+type Span struct {
+	TraceID string
+	SpanID  string
+	Name    string
+	URL     string
+	Worker  int
+	Status  int
+	Success bool
+	Start   time.Time
+	End     time.Time
+}
+
+func randomHex(rnd *rand.Rand, size int) string {
+	id := make([]byte, size)
+	rnd.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// newSpan starts a span with fresh W3C trace context identifiers
+func newSpan(rnd *rand.Rand, method string) Span {
+	return Span{
+		TraceID: randomHex(rnd, 16),
+		SpanID:  randomHex(rnd, 8),
+		Name:    method,
+	}
+}
+
+// traceparent formats the span as a W3C Trace Context header value
+func (s *Span) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func stringAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	text := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &text}}
+}
+
+func (s *Span) otlp() otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		Name:              s.Name,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			stringAttribute("http.method", s.Name),
+			stringAttribute("http.url", s.URL),
+			intAttribute("cannonade.worker", s.Worker),
+		},
+	}
+	if s.Status != 0 {
+		span.Attributes = append(span.Attributes, intAttribute("http.status_code", s.Status))
+	}
+	span.Status.Code = otlpStatusOk
+	if !s.Success {
+		span.Status.Code = otlpStatusError
+	}
+	return span
+}
+
+// spanExporter : Batches finished spans and ships them to an OTLP/HTTP collector.
+// A slow or dead collector never holds the responses up, the spans which do
+// not fit in the queue are dropped and counted instead.
+type spanExporter struct {
+	url     string
+	spans   chan Span
+	batches chan []otlpSpan
+	done    chan struct{}
+	client  http.Client
+	dropped int64
+}
+
+func newSpanExporter(endpoint string) *spanExporter {
+	exporter := &spanExporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		spans:   make(chan Span, otlpBatchSize),
+		batches: make(chan []otlpSpan, otlpPendingBatches),
+		done:    make(chan struct{}),
+		client:  http.Client{Timeout: otlpTimeout},
+	}
+	go exporter.run()
+	go exporter.send()
+	return exporter
+}
+
+// Export queues a finished span, it is safe to call on a nil exporter
+func (e *spanExporter) Export(span Span) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.spans <- span:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// Close flushes the pending spans and stops the exporter, it waits for the
+// collector no longer than a single request would
+func (e *spanExporter) Close() {
+	if e != nil {
+		close(e.spans)
+		select {
+		case <-e.done:
+		case <-time.After(otlpTimeout):
+			fmt.Fprintln(os.Stderr, "Gave up exporting the pending spans")
+		}
+		if dropped := atomic.LoadInt64(&e.dropped); dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Dropped %d spans the collector could not keep up with\n", dropped)
+		}
+	}
+}
+
+// run groups the spans into batches, handing them over to the sender
+func (e *spanExporter) run() {
+	defer close(e.batches)
+
+	ticker := time.NewTicker(otlpFlushPeriod)
+	defer ticker.Stop()
+
+	batch := make([]otlpSpan, 0, otlpBatchSize)
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				if len(batch) > 0 {
+					e.batches <- batch
+				}
+				return
+			}
+			batch = append(batch, span.otlp())
+			if len(batch) < otlpBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		select {
+		case e.batches <- batch:
+		default:
+			atomic.AddInt64(&e.dropped, int64(len(batch)))
+		}
+		batch = make([]otlpSpan, 0, otlpBatchSize)
+	}
+}
+
+func (e *spanExporter) send() {
+	defer close(e.done)
+	for batch := range e.batches {
+		e.flush(batch)
+	}
+}
+
+func (e *spanExporter) flush(batch []otlpSpan) {
+	if len(batch) == 0 {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{stringAttribute("service.name", otlpServiceName)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": otlpServiceName},
+				"spans": batch,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	panicIf(err)
+
+	res, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed exporting spans: %s\n", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		fmt.Fprintf(os.Stderr, "Failed exporting spans: %s\n", res.Status)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// resizeImage scales the image to the given size with bilinear interpolation
+func resizeImage(img image.Image, width int, height int) image.Image {
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(resized, resized.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return resized
+}
+
+// scaleImage resizes the image by the given factor keeping its aspect ratio
+func scaleImage(img image.Image, factor float64) image.Image {
+	if factor == 1 {
+		return img
+	}
+	bounds := img.Bounds()
+	width := int(float64(bounds.Dx())*factor + 0.5)
+	height := int(float64(bounds.Dy())*factor + 0.5)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	return resizeImage(img, width, height)
+}
+
+// Transform : Preprocessing applied to the image once before any encoding
+type Transform struct {
+	Crop      *image.Rectangle
+	Centered  bool // the crop has no offset and is taken from the middle
+	Width     int  // zero keeps the aspect ratio from the other side
+	Height    int
+	Grayscale bool
+}
+
+// parseSize parses a resize spec, either side may be left out: 640x480, 640x, x480
+func parseSize(spec string) (int, int, error) {
+	parts := strings.Split(spec, "x")
+	if len(parts) != 2 || parts[0] == "" && parts[1] == "" {
+		return 0, 0, fmt.Errorf("bad size %q, expected WxH", spec)
+	}
+	sides := make([]int, 2)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		side, err := strconv.Atoi(part)
+		if err != nil || side < 1 {
+			return 0, 0, fmt.Errorf("bad size %q, expected WxH", spec)
+		}
+		sides[i] = side
+	}
+	return sides[0], sides[1], nil
+}
+
+// parseCrop parses a crop spec in the imagemagick geometry style, WxH+X+Y or
+// WxH for a crop in the middle of the image
+func parseCrop(spec string) (image.Rectangle, bool, error) {
+	geometry := strings.SplitN(spec, "+", 2)
+	width, height, err := parseSize(geometry[0])
+	if err != nil || width == 0 || height == 0 {
+		return image.Rectangle{}, false, fmt.Errorf("bad crop %q, expected WxH+X+Y", spec)
+	}
+	if len(geometry) == 1 {
+		return image.Rect(0, 0, width, height), true, nil
+	}
+	offset := strings.Split(geometry[1], "+")
+	if len(offset) != 2 {
+		return image.Rectangle{}, false, fmt.Errorf("bad crop %q, expected WxH+X+Y", spec)
+	}
+	x, errX := strconv.Atoi(offset[0])
+	y, errY := strconv.Atoi(offset[1])
+	if errX != nil || errY != nil || x < 0 || y < 0 {
+		return image.Rectangle{}, false, fmt.Errorf("bad crop %q, expected WxH+X+Y", spec)
+	}
+	return image.Rect(x, y, x+width, y+height), false, nil
+}
+
+// cropImage cuts the area out of the image, the result starts at the origin
+func cropImage(img image.Image, area image.Rectangle) (image.Image, error) {
+	bounds := img.Bounds()
+	area = area.Add(bounds.Min)
+	if !area.In(bounds) {
+		return nil, fmt.Errorf("%dx%d crop does not fit the %dx%d image",
+			area.Dx(), area.Dy(), bounds.Dx(), bounds.Dy())
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, area.Min, draw.Src)
+	return cropped, nil
+}
+
+// grayscaleImage drops the colors of the image
+func grayscaleImage(img image.Image) image.Image {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	return gray
+}
+
+// Apply crops, resizes and grays the image in that order
+func (t *Transform) Apply(img image.Image) (image.Image, error) {
+	if t.Crop != nil {
+		area := *t.Crop
+		if t.Centered {
+			bounds := img.Bounds()
+			area = area.Add(image.Pt((bounds.Dx()-area.Dx())/2, (bounds.Dy()-area.Dy())/2))
+		}
+		var err error
+		img, err = cropImage(img, area)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.Width > 0 || t.Height > 0 {
+		bounds := img.Bounds()
+		width, height := t.Width, t.Height
+		if width == 0 {
+			width = (bounds.Dx()*height + bounds.Dy()/2) / bounds.Dy()
+		}
+		if height == 0 {
+			height = (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+		}
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+		img = resizeImage(img, width, height)
+	}
+	if t.Grayscale {
+		img = grayscaleImage(img)
+	}
+	return img, nil
+}
+
+// String describes the transform for the payload label, empty when there is none
+func (t *Transform) String() string {
+	parts := make([]string, 0)
+	if t.Crop != nil {
+		if t.Centered {
+			parts = append(parts, fmt.Sprintf("crop=%dx%d", t.Crop.Dx(), t.Crop.Dy()))
+		} else {
+			parts = append(parts, fmt.Sprintf("crop=%dx%d+%d+%d", t.Crop.Dx(), t.Crop.Dy(), t.Crop.Min.X, t.Crop.Min.Y))
+		}
+	}
+	if t.Width > 0 || t.Height > 0 {
+		size := "x"
+		if t.Width > 0 {
+			size = strconv.Itoa(t.Width) + size
+		}
+		if t.Height > 0 {
+			size += strconv.Itoa(t.Height)
+		}
+		parts = append(parts, "resize="+size)
+	}
+	if t.Grayscale {
+		parts = append(parts, "grayscale")
+	}
+	return strings.Join(parts, " ")
+}
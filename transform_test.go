@@ -0,0 +1,134 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		spec   string
+		width  int
+		height int
+		ok     bool
+	}{
+		{"640x480", 640, 480, true},
+		{"640x", 640, 0, true},
+		{"x480", 0, 480, true},
+		{"x", 0, 0, false},
+		{"640", 0, 0, false},
+		{"0x480", 0, 0, false},
+		{"-1x480", 0, 0, false},
+		{"axb", 0, 0, false},
+	}
+	for _, test := range tests {
+		width, height, err := parseSize(test.spec)
+		if (err == nil) != test.ok || width != test.width || height != test.height {
+			t.Errorf("parseSize(%q) = %d, %d, %v", test.spec, width, height, err)
+		}
+	}
+}
+
+func TestParseCrop(t *testing.T) {
+	tests := []struct {
+		spec     string
+		area     image.Rectangle
+		centered bool
+		ok       bool
+	}{
+		{"100x50+10+20", image.Rect(10, 20, 110, 70), false, true},
+		{"100x50", image.Rect(0, 0, 100, 50), true, true},
+		{"100x", image.Rectangle{}, false, false},
+		{"100x50+10", image.Rectangle{}, false, false},
+		{"100x50+-1+0", image.Rectangle{}, false, false},
+	}
+	for _, test := range tests {
+		area, centered, err := parseCrop(test.spec)
+		if (err == nil) != test.ok || area != test.area || centered != test.centered {
+			t.Errorf("parseCrop(%q) = %v, %v, %v", test.spec, area, centered, err)
+		}
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	img.Set(150, 60, color.RGBA{R: 255, A: 255})
+	tests := []struct {
+		transform Transform
+		width     int
+		height    int
+		ok        bool
+	}{
+		{Transform{}, 200, 100, true},
+		{Transform{Width: 100}, 100, 50, true},
+		{Transform{Height: 25}, 50, 25, true},
+		{Transform{Width: 30, Height: 40}, 30, 40, true},
+		{Transform{Crop: &image.Rectangle{Max: image.Pt(50, 50)}, Centered: true, Width: 10}, 10, 10, true},
+		{Transform{Crop: &image.Rectangle{Min: image.Pt(180, 0), Max: image.Pt(230, 50)}}, 0, 0, false},
+	}
+	for _, test := range tests {
+		out, err := test.transform.Apply(img)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: unexpected error %v", test.transform.String(), err)
+			continue
+		}
+		if err == nil && (out.Bounds().Dx() != test.width || out.Bounds().Dy() != test.height) {
+			t.Errorf("%q: got %v, want %dx%d", test.transform.String(), out.Bounds(), test.width, test.height)
+		}
+	}
+
+	// The cropped image starts at the origin and keeps the pixels of the area
+	area := image.Rect(140, 50, 160, 70)
+	out, err := (&Transform{Crop: &area}).Apply(img)
+	if err != nil || out.Bounds().Min != image.ZP {
+		t.Fatalf("crop: got %v, %v", out.Bounds(), err)
+	}
+	if r, _, _, _ := out.At(10, 10).RGBA(); r == 0 {
+		t.Errorf("crop: lost the marked pixel")
+	}
+
+	gray, _ := (&Transform{Grayscale: true}).Apply(img)
+	if _, ok := gray.(*image.Gray); !ok {
+		t.Errorf("grayscale: got %T", gray)
+	}
+}
+
+func TestTransformString(t *testing.T) {
+	area := image.Rect(10, 20, 110, 70)
+	tests := []struct {
+		transform Transform
+		want      string
+	}{
+		{Transform{}, ""},
+		{Transform{Width: 640}, "resize=640x"},
+		{Transform{Height: 480, Grayscale: true}, "resize=x480 grayscale"},
+		{Transform{Crop: &area, Width: 64, Height: 32}, "crop=100x50+10+20 resize=64x32"},
+		{Transform{Crop: &area, Centered: true}, "crop=100x50"},
+	}
+	for _, test := range tests {
+		if got := test.transform.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
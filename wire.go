@@ -0,0 +1,75 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// countingConn : A connection keeping the count of the bytes it moved on the wire
+type countingConn struct {
+	net.Conn
+	read    int64
+	written int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	wireConns.Delete(c.LocalAddr().String())
+	return c.Conn.Close()
+}
+
+func (c *countingConn) counts() (int64, int64) {
+	return atomic.LoadInt64(&c.read), atomic.LoadInt64(&c.written)
+}
+
+// wireConns finds the counting connection under whatever the transport wrapped
+// it in, TLS included, by the local address they share
+var wireConns sync.Map
+
+func countConn(conn net.Conn) net.Conn {
+	counting := &countingConn{Conn: conn}
+	wireConns.Store(conn.LocalAddr().String(), counting)
+	return counting
+}
+
+func lookupWire(conn net.Conn) *countingConn {
+	if conn == nil {
+		return nil
+	}
+	if counting, ok := wireConns.Load(conn.LocalAddr().String()); ok {
+		return counting.(*countingConn)
+	}
+	return nil
+}
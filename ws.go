@@ -0,0 +1,178 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	protocolHTTP = "http"
+	protocolWS   = "ws"
+)
+
+// wsURL points the endpoint with the cannonball path at the websocket scheme
+func wsURL(endpoint string, path string) (*url.URL, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		ref, err := url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		target = target.ResolveReference(ref)
+	}
+	switch target.Scheme {
+	case "http", "ws":
+		target.Scheme = "ws"
+	case "https", "wss":
+		target.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q for a websocket", target.Scheme)
+	}
+	return target, nil
+}
+
+// wsClient : The websocket connections of a single worker, one per url,
+// each carries a message and its reply at a time
+type wsClient struct {
+	dialer *websocket.Dialer
+	conns  map[string]*websocket.Conn
+}
+
+// newWSClient dials through the same sockets, proxy and tls setup as the http transport
+func newWSClient(opt *Options) *wsClient {
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: time.Duration(opt.Timeout * float64(time.Second)),
+	}
+	dialer.Jar = opt.Jar
+	if opt.Transport != nil {
+		dialer.NetDialContext = opt.Transport.DialContext
+		dialer.Proxy = opt.Transport.Proxy
+		dialer.TLSClientConfig = opt.Transport.TLSClientConfig
+	}
+	return &wsClient{dialer: dialer, conns: make(map[string]*websocket.Conn)}
+}
+
+// connect reuses the open connection to the url or performs the handshake,
+// the headers of the first cannonball to the url go into the handshake
+func (c *wsClient) connect(target *url.URL, ball *Cannonball, header http.Header, opt *Options) (*websocket.Conn, *Response) {
+	key := target.String()
+	if conn, ok := c.conns[key]; ok {
+		return conn, nil
+	}
+	req := &http.Request{URL: target, Header: make(http.Header)}
+	for key, values := range ball.Header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Del("Content-Length")
+	if opt.Host != "" {
+		req.Header.Set("Host", opt.Host)
+	}
+	if opt.Auth != nil {
+		opt.Auth.Apply(req)
+	}
+	conn, res, err := c.dialer.Dial(req.URL.String(), req.Header)
+	if err != nil {
+		response := &Response{Body: fmt.Sprintf("Error while opening the websocket: %s", err), Class: classifyError(err)}
+		if err == websocket.ErrBadHandshake && res != nil {
+			response.Status, response.Class = res.StatusCode, statusClass(res.StatusCode)
+		}
+		return nil, response
+	}
+	if opt.MaxResponseBytes > 0 {
+		conn.SetReadLimit(opt.MaxResponseBytes)
+	}
+	c.conns[key] = conn
+	return conn, nil
+}
+
+// fire sends the cannonball body as a single message and waits for the reply,
+// a failed exchange drops the connection so that the next one starts anew
+func (c *wsClient) fire(endpoint string, ball *Cannonball, header http.Header, opt *Options) Response {
+	target, err := wsURL(endpoint, ball.Path)
+	if err != nil {
+		return Response{Body: fmt.Sprintf("Error while preparing the message: %s", err), Class: classPrepare}
+	}
+	conn, failed := c.connect(target, ball, header, opt)
+	if failed != nil {
+		return *failed
+	}
+	drop := func() {
+		conn.Close()
+		delete(c.conns, target.String())
+	}
+
+	// No timeout clears the deadlines a connection might carry over
+	var deadline time.Time
+	if opt.Timeout > 0 {
+		deadline = time.Now().Add(time.Duration(opt.Timeout * float64(time.Second)))
+	}
+	conn.SetWriteDeadline(deadline)
+	if err := conn.WriteMessage(messageType(ball.Body), ball.Body); err != nil {
+		drop()
+		return Response{Body: fmt.Sprintf("Error while sending the message: %s", err), Class: classifyError(err)}
+	}
+	conn.SetReadDeadline(deadline)
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		drop()
+		response := Response{Body: fmt.Sprintf("Error while reading the reply: %s", err), Class: classRead, Sent: len(ball.Body)}
+		switch {
+		case err == websocket.ErrReadLimit:
+			response.Body = fmt.Sprintf("Reply is over the limit of %d bytes", opt.MaxResponseBytes)
+			response.Class, response.Oversized = classOversized, true
+		case classifyError(err) == classTimeout:
+			response.Class = classTimeout
+		}
+		return response
+	}
+	return Response{Success: true, raw: message, Sent: len(ball.Body), Bytes: len(message)}
+}
+
+// close says goodbye on every open connection
+func (c *wsClient) close() {
+	for key, conn := range c.conns {
+		closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second))
+		conn.Close()
+		delete(c.conns, key)
+	}
+}
+
+// messageType sends the textual payloads like json as text and the rest as binary
+func messageType(body []byte) int {
+	if utf8.Valid(body) {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
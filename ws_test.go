@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Evgeny Nizhibitsky
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING
+// FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER
+// DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		path     string
+		want     string
+		fails    bool
+	}{
+		{"http://localhost:5000/stream", "", "ws://localhost:5000/stream", false},
+		{"https://api.example.com/stream", "", "wss://api.example.com/stream", false},
+		{"ws://localhost:5000/", "/predict?v=2", "ws://localhost:5000/predict?v=2", false},
+		{"wss://api.example.com", "", "wss://api.example.com", false},
+		{"ftp://localhost/", "", "", true},
+	}
+	for _, test := range tests {
+		got, err := wsURL(test.endpoint, test.path)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", test.endpoint, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != test.want {
+			t.Errorf("%s %s: got %v (%v), want %s", test.endpoint, test.path, got, err, test.want)
+		}
+	}
+}
+
+func TestWSFire(t *testing.T) {
+	var handshakes int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		atomic.AddInt32(&handshakes, 1)
+		for {
+			kind, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(message) == "bye" {
+				return
+			}
+			reply := `{"echo": "` + strings.ToUpper(string(message)) + `"}`
+			if err := conn.WriteMessage(kind, []byte(reply)); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	opt := &Options{Timeout: 5, MaxResponseBytes: 64, Auth: &bearerAuth{token: "secret"},
+		Transport: newTransport(SocketOptions{NoDelay: true})}
+	client := newWSClient(opt)
+	defer client.close()
+	tests := []struct {
+		body      string
+		success   bool
+		class     string
+		reply     string
+		handshake int32
+	}{
+		{"hello", true, "", `{"echo": "HELLO"}`, 1},
+		{"again", true, "", `{"echo": "AGAIN"}`, 1},
+		{strings.Repeat("x", 64), false, classOversized, "", 1},
+		{"redial", true, "", `{"echo": "REDIAL"}`, 2},
+		{"bye", false, classRead, "", 2},
+		{"back", true, "", `{"echo": "BACK"}`, 3},
+	}
+	for _, test := range tests {
+		response := client.fire(server.URL, &Cannonball{Method: "POST", Body: []byte(test.body)}, nil, opt)
+		if response.Success != test.success || response.Class != test.class {
+			t.Errorf("%.10s: got success %v, class %q (%s)", test.body, response.Success, response.Class, response.Body)
+		}
+		if test.success && string(response.raw) != test.reply {
+			t.Errorf("%.10s: got reply %q, want %q", test.body, response.raw, test.reply)
+		}
+		if got := atomic.LoadInt32(&handshakes); got != test.handshake {
+			t.Errorf("%.10s: got %d handshakes, want %d", test.body, got, test.handshake)
+		}
+	}
+
+	opt.Auth = nil
+	response := newWSClient(opt).fire(server.URL, &Cannonball{Method: "POST", Body: []byte("hello")}, nil, opt)
+	if response.Success || response.Status != http.StatusUnauthorized || response.Class != statusClass(http.StatusUnauthorized) {
+		t.Errorf("got status %d, class %q without the credentials", response.Status, response.Class)
+	}
+}
+
+func TestWSFireWithoutTimeout(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			kind, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+			if err := conn.WriteMessage(kind, message); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	// -timeout 0 waits as long as the reply takes, like the http requests do
+	opt := &Options{Timeout: 0, Transport: newTransport(SocketOptions{NoDelay: true})}
+	client := newWSClient(opt)
+	defer client.close()
+	for _, body := range []string{"first", "second"} {
+		response := client.fire(server.URL, &Cannonball{Method: "POST", Body: []byte(body)}, nil, opt)
+		if !response.Success || string(response.raw) != body {
+			t.Errorf("%s: got success %v, class %q (%s)", body, response.Success, response.Class, response.Body)
+		}
+	}
+}